@@ -0,0 +1,60 @@
+package main
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/charmbracelet/log"
+
+	"github.com/husarion/husarion-os-flasher/cluster"
+	"github.com/husarion/husarion-os-flasher/platform"
+	"github.com/husarion/husarion-os-flasher/ui"
+	"github.com/husarion/husarion-os-flasher/util"
+)
+
+// stationReport describes this station for the coordinator.
+func stationReport(name string, sshPort int, osImgPath string) cluster.Report {
+	r := cluster.Report{Name: name, Version: util.Version, SSHPort: sshPort}
+	if devices, err := platform.Current.Devices(); err == nil {
+		for _, dev := range devices {
+			size, _ := platform.Current.DiskSize(dev)
+			r.Devices = append(r.Devices, cluster.Device{Path: dev, Size: size})
+		}
+	}
+	if images, err := ui.ImageFiles(osImgPath); err == nil {
+		for _, img := range images {
+			r.Images = append(r.Images, filepath.Base(img))
+		}
+	}
+	for _, job := range ui.RunningJobs() {
+		r.Jobs = append(r.Jobs, cluster.Job{
+			ID:       job.ID,
+			Kind:     job.Kind,
+			Image:    filepath.Base(job.Src),
+			Device:   job.Dst,
+			Operator: job.Operator,
+			Started:  job.Started,
+		})
+	}
+	return r
+}
+
+// runAgent reports this station to the coordinator every cluster.ReportInterval.
+// It runs for the life of the SSH server, logging when the coordinator becomes
+// unreachable or reachable again.
+func runAgent(coordinator, coordinatorKey, name string, sshPort int, hostKeyPath, osImgPath string) {
+	reachable, first := false, true
+	for ; ; time.Sleep(cluster.ReportInterval) {
+		// The host key is generated when the SSH server starts
+		signer, err := cluster.LoadSigner(hostKeyPath)
+		if err == nil {
+			err = cluster.SendReport(coordinator, signer, coordinatorKey, stationReport(name, sshPort, osImgPath))
+		}
+		if err != nil && (reachable || first) {
+			log.Warn("Cannot report to coordinator", "coordinator", coordinator, "error", err)
+		} else if err == nil && !reachable {
+			log.Info("Reporting to coordinator", "coordinator", coordinator)
+		}
+		reachable, first = err == nil, false
+	}
+}
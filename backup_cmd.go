@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/husarion/husarion-os-flasher/config"
+	"github.com/husarion/husarion-os-flasher/ui"
+)
+
+const backupUsage = `Usage:
+  husarion-os-flasher backup [--os-img-path DIR] [--config FILE] [--output FILE] [--compress xz|none] [--bmap] DEVICE
+
+Copies DEVICE, one listed by the devices command, to an image: by default
+DIR/backup-<device>-<date>.img.xz, which can be flashed back like any other
+image. A <image>.meta.yaml describing DEVICE is written next to it. With
+--compress none --bmap the image is written sparse with a <image>.bmap, so
+flashing it back writes only the blocks in use. With a signing_key in the
+config the image is signed into <image>.sig.
+Progress is printed on stderr and the path of the image on stdout.
+` + exitCodesUsage
+
+// runBackupCommand copies a device to an image file.
+func runBackupCommand(args []string) int {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, backupUsage) }
+	osImgPath := fs.String("os-img-path", ".", "Path to OS image files directory")
+	output := fs.String("output", "", "Path of the image (default: a new image in --os-img-path)")
+	compress := fs.String("compress", "xz", "Compression of the image: xz or none")
+	withBmap := fs.Bool("bmap", false, "Write the image sparse with a bmap (needs --compress none)")
+	configPath := fs.String("config", config.DefaultPath, "Path to YAML config file")
+	fromEnv, err := applyEnv(fs)
+	if err != nil {
+		return failed(err)
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 || *compress != "xz" && *compress != "none" || *withBmap && *compress != "none" {
+		fmt.Fprint(os.Stderr, backupUsage)
+		return exitUsage
+	}
+	cfg, err := loadConfig(fs, *configPath, fromEnv)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error loading config:", err)
+		return exitFailure
+	}
+	device, err := resolveDevice(fs.Arg(0))
+	if err != nil {
+		return failed(err)
+	}
+	if *output == "" {
+		*output = backupPath(*osImgPath, device, *compress == "xz")
+	}
+
+	if err := ui.BackupDevice(cfg, device, *output, *compress == "xz", *withBmap, ui.ConsoleOperator(), os.Stderr, interrupted()); err != nil {
+		return failed(err)
+	}
+	fmt.Println(*output)
+	return exitOK
+}
+
+// backupPath returns the default path of a backup of device in osImgPath.
+func backupPath(osImgPath, device string, compress bool) string {
+	name := "backup-" + filepath.Base(device) + "-" + time.Now().Format("20060102-150405") + ".img"
+	if compress {
+		name += ".xz"
+	}
+	return filepath.Join(osImgPath, name)
+}
@@ -0,0 +1,324 @@
+// Package bmap reads, writes and applies bmaptool-compatible block maps, which
+// list the blocks of an image that contain data so only those are written.
+package bmap
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Range is an inclusive range of mapped blocks with its checksum.
+type Range struct {
+	First, Last int64
+	Checksum    string
+}
+
+// Bmap is a parsed block map.
+type Bmap struct {
+	Version      string
+	ImageSize    int64
+	BlockSize    int64
+	BlocksCount  int64
+	MappedBlocks int64
+	ChecksumType string
+	Ranges       []Range
+}
+
+type xmlRange struct {
+	Checksum string `xml:"chksum,attr"`
+	Blocks   string `xml:",chardata"`
+}
+
+type xmlBmap struct {
+	XMLName          xml.Name   `xml:"bmap"`
+	Version          string     `xml:"version,attr"`
+	ImageSize        int64      `xml:"ImageSize"`
+	BlockSize        int64      `xml:"BlockSize"`
+	BlocksCount      int64      `xml:"BlocksCount"`
+	MappedBlocksCnt  int64      `xml:"MappedBlocksCount"`
+	ChecksumType     string     `xml:"ChecksumType"`
+	BmapFileChecksum string     `xml:"BmapFileChecksum,omitempty"`
+	Ranges           []xmlRange `xml:"BlockMap>Range"`
+}
+
+// MappedBytes returns the number of bytes covered by the mapped ranges.
+func (b *Bmap) MappedBytes() int64 {
+	var total int64
+	for _, r := range b.Ranges {
+		total += b.rangeBytes(r)
+	}
+	return total
+}
+
+// rangeBytes returns the size of a range, trimming the final block to ImageSize.
+func (b *Bmap) rangeBytes(r Range) int64 {
+	start := r.First * b.BlockSize
+	end := (r.Last + 1) * b.BlockSize
+	if end > b.ImageSize {
+		end = b.ImageSize
+	}
+	return end - start
+}
+
+// Parse decodes a bmap XML document.
+func Parse(data []byte) (*Bmap, error) {
+	var doc xmlBmap
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid bmap: %w", err)
+	}
+	if doc.BlockSize <= 0 || doc.ImageSize <= 0 {
+		return nil, errors.New("invalid bmap: missing image or block size")
+	}
+
+	b := &Bmap{
+		Version:      doc.Version,
+		ImageSize:    doc.ImageSize,
+		BlockSize:    doc.BlockSize,
+		BlocksCount:  doc.BlocksCount,
+		MappedBlocks: doc.MappedBlocksCnt,
+		ChecksumType: strings.ToLower(strings.TrimSpace(doc.ChecksumType)),
+	}
+	// bmap 1.x files have no ChecksumType and use SHA-1
+	if b.ChecksumType == "" {
+		b.ChecksumType = "sha1"
+	}
+	if b.ChecksumType != "sha1" && b.ChecksumType != "sha256" {
+		return nil, fmt.Errorf("unsupported bmap checksum type %q", b.ChecksumType)
+	}
+
+	var prevLast int64 = -1
+	for _, xr := range doc.Ranges {
+		first, last, err := parseRange(strings.TrimSpace(xr.Blocks))
+		if err != nil {
+			return nil, err
+		}
+		if first <= prevLast || first*b.BlockSize >= b.ImageSize {
+			return nil, fmt.Errorf("invalid bmap: range %d-%d out of order or beyond image", first, last)
+		}
+		prevLast = last
+		b.Ranges = append(b.Ranges, Range{First: first, Last: last, Checksum: strings.ToLower(xr.Checksum)})
+	}
+	return b, nil
+}
+
+// parseRange parses "a-b" or "a".
+func parseRange(s string) (int64, int64, error) {
+	firstStr, lastStr, isRange := strings.Cut(s, "-")
+	first, err := strconv.ParseInt(strings.TrimSpace(firstStr), 10, 64)
+	if err != nil || first < 0 {
+		return 0, 0, fmt.Errorf("invalid bmap range %q", s)
+	}
+	last := first
+	if isRange {
+		if last, err = strconv.ParseInt(strings.TrimSpace(lastStr), 10, 64); err != nil || last < first {
+			return 0, 0, fmt.Errorf("invalid bmap range %q", s)
+		}
+	}
+	return first, last, nil
+}
+
+// Load reads and parses a bmap file.
+func Load(path string) (*Bmap, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Find returns the bmap path for an image, checking "<image>.bmap" and, for
+// compressed images, "<raw image>.bmap" (the bmaptool convention). It returns
+// an empty string when there is none.
+func Find(imagePath, rawPath string) string {
+	for _, p := range []string{imagePath + ".bmap", rawPath + ".bmap"} {
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+	}
+	return ""
+}
+
+func (b *Bmap) newHash() hash.Hash {
+	if b.ChecksumType == "sha1" {
+		return sha1.New()
+	}
+	return sha256.New()
+}
+
+// Progress is called with the mapped bytes written so far and the total.
+type Progress func(written, total int64, elapsed time.Duration)
+
+// Copy reads the full image from src and writes only mapped ranges to dst,
+// verifying each range's checksum. cancel aborts the copy when closed.
+func Copy(b *Bmap, src io.Reader, dst io.WriterAt, progress Progress, cancel <-chan struct{}) error {
+	const chunk = 4 << 20
+	buf := make([]byte, chunk)
+	total := b.MappedBytes()
+	start := time.Now()
+
+	var pos, written int64
+	for _, r := range b.Ranges {
+		select {
+		case <-cancel:
+			return errors.New("aborted")
+		default:
+		}
+
+		// Skip unmapped data between ranges
+		offset := r.First * b.BlockSize
+		if gap := offset - pos; gap > 0 {
+			if seeker, ok := src.(io.Seeker); ok {
+				if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+					return err
+				}
+			} else if _, err := io.CopyN(io.Discard, src, gap); err != nil {
+				return fmt.Errorf("reading image: %w", err)
+			}
+			pos = offset
+		}
+
+		h := b.newHash()
+		remaining := b.rangeBytes(r)
+		for remaining > 0 {
+			select {
+			case <-cancel:
+				return errors.New("aborted")
+			default:
+			}
+			n := int64(len(buf))
+			if remaining < n {
+				n = remaining
+			}
+			if _, err := io.ReadFull(src, buf[:n]); err != nil {
+				return fmt.Errorf("reading image at %d: %w", pos, err)
+			}
+			if _, err := dst.WriteAt(buf[:n], pos); err != nil {
+				return fmt.Errorf("writing at %d: %w", pos, err)
+			}
+			h.Write(buf[:n])
+			pos += n
+			written += n
+			remaining -= n
+			if progress != nil {
+				progress(written, total, time.Since(start))
+			}
+		}
+
+		if r.Checksum != "" && hex.EncodeToString(h.Sum(nil)) != r.Checksum {
+			return fmt.Errorf("checksum mismatch in blocks %d-%d: image does not match its bmap", r.First, r.Last)
+		}
+	}
+	return nil
+}
+
+// Linux lseek whence values for sparse file traversal.
+const (
+	seekData = 3
+	seekHole = 4
+)
+
+// Generate builds a bmap for a raw (uncompressed) image from its sparse layout.
+// Images without holes map every block.
+func Generate(imagePath string, blockSize int64) (*Bmap, error) {
+	if blockSize <= 0 {
+		blockSize = 4096
+	}
+	f, err := os.Open(imagePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+
+	b := &Bmap{
+		Version:      "2.0",
+		ImageSize:    size,
+		BlockSize:    blockSize,
+		BlocksCount:  (size + blockSize - 1) / blockSize,
+		ChecksumType: "sha256",
+	}
+
+	buf := make([]byte, 4<<20)
+	var offset int64
+	for offset < size {
+		dataStart, err := f.Seek(offset, seekData)
+		if err != nil {
+			break // ENXIO: no more data
+		}
+		dataEnd, err := f.Seek(dataStart, seekHole)
+		if err != nil {
+			dataEnd = size
+		}
+		first := dataStart / blockSize
+		last := (dataEnd - 1) / blockSize
+		// Merge with the previous range if they share a block
+		if n := len(b.Ranges); n > 0 && first <= b.Ranges[n-1].Last+1 {
+			first = b.Ranges[n-1].First
+			b.Ranges = b.Ranges[:n-1]
+		}
+		b.Ranges = append(b.Ranges, Range{First: first, Last: last})
+		offset = (last + 1) * blockSize
+	}
+
+	// Checksum every range
+	for i := range b.Ranges {
+		r := &b.Ranges[i]
+		h := b.newHash()
+		if _, err := io.CopyBuffer(h, io.NewSectionReader(f, r.First*blockSize, b.rangeBytes(*r)), buf); err != nil {
+			return nil, err
+		}
+		r.Checksum = hex.EncodeToString(h.Sum(nil))
+		b.MappedBlocks += r.Last - r.First + 1
+	}
+	return b, nil
+}
+
+// Marshal encodes the bmap in bmaptool's 2.0 XML format, including the
+// BmapFileChecksum computed over the document with the checksum zeroed.
+func (b *Bmap) Marshal() ([]byte, error) {
+	doc := xmlBmap{
+		Version:          "2.0",
+		ImageSize:        b.ImageSize,
+		BlockSize:        b.BlockSize,
+		BlocksCount:      b.BlocksCount,
+		MappedBlocksCnt:  b.MappedBlocks,
+		ChecksumType:     b.ChecksumType,
+		BmapFileChecksum: strings.Repeat("0", 64),
+	}
+	for _, r := range b.Ranges {
+		blocks := strconv.FormatInt(r.First, 10)
+		if r.Last != r.First {
+			blocks += "-" + strconv.FormatInt(r.Last, 10)
+		}
+		doc.Ranges = append(doc.Ranges, xmlRange{Checksum: r.Checksum, Blocks: " " + blocks + " "})
+	}
+
+	encode := func() ([]byte, error) {
+		out, err := xml.MarshalIndent(doc, "", "    ")
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte("<?xml version=\"1.0\" ?>\n"), append(out, '\n')...), nil
+	}
+	zeroed, err := encode()
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(zeroed)
+	doc.BmapFileChecksum = hex.EncodeToString(sum[:])
+	return encode()
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/husarion/husarion-os-flasher/bmap"
+	"github.com/husarion/husarion-os-flasher/util"
+)
+
+const bmapUsage = `Usage:
+  husarion-os-flasher bmap create [--block-size N] [-o IMAGE.img.bmap] IMAGE.img
+  husarion-os-flasher bmap info IMAGE.img.bmap
+`
+
+// printBmapStats prints a summary of a block map.
+func printBmapStats(bm *bmap.Bmap) {
+	fmt.Printf("Image size:    %s\n", util.FormatBytes(bm.ImageSize))
+	fmt.Printf("Block size:    %s\n", util.FormatBytes(bm.BlockSize))
+	fmt.Printf("Mapped blocks: %d of %d (%s)\n", bm.MappedBlocks, bm.BlocksCount, util.FormatBytes(bm.MappedBytes()))
+	fmt.Printf("Checksum:      %s\n", bm.ChecksumType)
+}
+
+// runBmapCommand implements the "bmap" tool mode and returns the exit code.
+func runBmapCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, bmapUsage)
+		return exitUsage
+	}
+
+	switch args[0] {
+	case "create":
+		fs := flag.NewFlagSet("bmap create", flag.ExitOnError)
+		out := fs.String("o", "", "Output bmap file (default IMAGE.bmap)")
+		blockSize := fs.Int64("block-size", 4096, "Block size in bytes")
+		fs.Parse(args[1:])
+		if fs.NArg() != 1 {
+			fmt.Fprint(os.Stderr, bmapUsage)
+			return exitUsage
+		}
+		image := fs.Arg(0)
+		if *out == "" {
+			*out = image + ".bmap"
+		}
+		bm, err := bmap.Generate(image, *blockSize)
+		if err != nil {
+			return failed(err)
+		}
+		data, err := bm.Marshal()
+		if err == nil {
+			err = os.WriteFile(*out, data, 0644)
+		}
+		if err != nil {
+			return failed(err)
+		}
+		printBmapStats(bm)
+		fmt.Printf("Bmap file:     %s\n", *out)
+		return exitOK
+
+	case "info":
+		if len(args) != 2 {
+			fmt.Fprint(os.Stderr, bmapUsage)
+			return exitUsage
+		}
+		bm, err := bmap.Load(args[1])
+		if err != nil {
+			return failed(err)
+		}
+		printBmapStats(bm)
+		return exitOK
+	}
+
+	fmt.Fprint(os.Stderr, bmapUsage)
+	return exitUsage
+}
@@ -0,0 +1,108 @@
+package cluster
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	gossh "golang.org/x/crypto/ssh"
+
+	"github.com/husarion/husarion-os-flasher/internal/flash"
+)
+
+// dialTimeout bounds connecting to another station.
+const dialTimeout = 10 * time.Second
+
+// LoadSigner reads the station's SSH host key, which it also uses to
+// authenticate to other stations.
+func LoadSigner(path string) (gossh.Signer, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return gossh.ParsePrivateKey(b)
+}
+
+// dial connects to a station as user. When hostKey is set the station's host key
+// must have that fingerprint.
+func dial(addr, user string, signer gossh.Signer, hostKey string) (*gossh.Client, error) {
+	return gossh.Dial("tcp", addr, &gossh.ClientConfig{
+		User: user,
+		Auth: []gossh.AuthMethod{gossh.PublicKeys(signer)},
+		HostKeyCallback: func(_ string, _ net.Addr, key gossh.PublicKey) error {
+			if hostKey != "" && gossh.FingerprintSHA256(key) != hostKey {
+				return fmt.Errorf("host key %s does not match %s", gossh.FingerprintSHA256(key), hostKey)
+			}
+			return nil
+		},
+		Timeout: dialTimeout,
+	})
+}
+
+// SendReport sends an agent's report to the coordinator at addr (host:port).
+// coordinatorKey, if set, is the expected fingerprint of the coordinator's host
+// key.
+func SendReport(addr string, signer gossh.Signer, coordinatorKey string, r Report) error {
+	client, err := dial(addr, r.Name, signer, coordinatorKey)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	body, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	var stderr bytes.Buffer
+	session.Stdin = bytes.NewReader(body)
+	session.Stderr = &stderr
+	if err := session.Run("agent-report"); err != nil {
+		if msg := bytes.TrimSpace(stderr.Bytes()); len(msg) > 0 {
+			return errors.New(string(msg))
+		}
+		return err
+	}
+	return nil
+}
+
+// Run runs a remote command on a station, streaming its output, and returns
+// the command's exit status. user identifies the coordinator's operator in the
+// station's audit log.
+func Run(s Station, user string, signer gossh.Signer, args []string, stdout, stderr io.Writer) (int, error) {
+	addr := net.JoinHostPort(s.Address, strconv.Itoa(s.SSHPort))
+	client, err := dial(addr, user, signer, s.HostKey)
+	if err != nil {
+		return 0, err
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return 0, err
+	}
+	defer session.Close()
+
+	session.Stdout = stdout
+	session.Stderr = stderr
+	err = session.Run(flash.ShellJoin(args))
+	var exitErr *gossh.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitStatus(), nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return 0, nil
+}
@@ -0,0 +1,101 @@
+// Package cluster lets flasher stations (agents) report their devices and jobs
+// to a coordinator, which shows every station in one dashboard and dispatches
+// jobs to them. Both directions use the stations' SSH servers: agents run the
+// agent-report command on the coordinator, the coordinator runs remote commands
+// on the agents.
+package cluster
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// ReportInterval is how often agents report to the coordinator.
+	ReportInterval = 10 * time.Second
+
+	// OfflineAfter is how long after its last report a station is shown offline.
+	OfflineAfter = 3 * ReportInterval
+)
+
+// Device is a flashable device of a station.
+type Device struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// Job is a job running on a station.
+type Job struct {
+	ID       int       `json:"id"`
+	Kind     string    `json:"kind"`
+	Image    string    `json:"image"`
+	Device   string    `json:"device,omitempty"`
+	Operator string    `json:"operator,omitempty"`
+	Started  time.Time `json:"started"`
+}
+
+// Report is the state an agent sends to the coordinator.
+type Report struct {
+	Name    string   `json:"name"`
+	Version string   `json:"version"`
+	SSHPort int      `json:"ssh_port"`
+	Devices []Device `json:"devices"`
+	Images  []string `json:"images"`
+	Jobs    []Job    `json:"jobs"`
+}
+
+// Station is an agent as known to the coordinator.
+type Station struct {
+	Report
+	Address  string    // address the report came from
+	HostKey  string    // fingerprint of the key the agent authenticated with
+	LastSeen time.Time // time of the last report
+}
+
+// Online reports whether the station reported recently.
+func (s Station) Online(now time.Time) bool {
+	return now.Sub(s.LastSeen) < OfflineAfter
+}
+
+// registry holds the stations known to this coordinator. It is shared by all
+// sessions in the process.
+var registry = struct {
+	sync.Mutex
+	stations map[string]Station
+}{stations: make(map[string]Station)}
+
+// Register records a report received from address by an agent authenticated
+// with hostKey. A station's key is pinned by its first report: as any key may
+// connect, a report under the name of a known station with another key is
+// refused, so no client can redirect the jobs dispatched to it.
+func Register(r Report, address, hostKey string) error {
+	registry.Lock()
+	defer registry.Unlock()
+	if known, ok := registry.stations[r.Name]; ok && known.HostKey != hostKey {
+		return fmt.Errorf("station %q is registered with another key (%s)", r.Name, known.HostKey)
+	}
+	registry.stations[r.Name] = Station{Report: r, Address: address, HostKey: hostKey, LastSeen: time.Now()}
+	return nil
+}
+
+// Stations returns the known stations sorted by name.
+func Stations() []Station {
+	registry.Lock()
+	list := make([]Station, 0, len(registry.stations))
+	for _, s := range registry.stations {
+		list = append(list, s)
+	}
+	registry.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Lookup returns the station with the given name.
+func Lookup(name string) (Station, bool) {
+	registry.Lock()
+	defer registry.Unlock()
+	s, ok := registry.stations[name]
+	return s, ok
+}
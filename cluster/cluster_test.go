@@ -0,0 +1,25 @@
+package cluster
+
+import "testing"
+
+func TestRegisterPinsHostKey(t *testing.T) {
+	report := Report{Name: "station-a", SSHPort: 2222}
+	if err := Register(report, "10.0.0.1", "SHA256:first"); err != nil {
+		t.Fatal(err)
+	}
+	// The station reports again, from a new address
+	if err := Register(report, "10.0.0.2", "SHA256:first"); err != nil {
+		t.Fatalf("report with the pinned key refused: %v", err)
+	}
+	// Another client takes the station's name
+	if err := Register(report, "10.6.6.6", "SHA256:other"); err == nil {
+		t.Fatal("report with another key accepted")
+	}
+	st, ok := Lookup("station-a")
+	if !ok {
+		t.Fatal("station not registered")
+	}
+	if st.Address != "10.0.0.2" || st.HostKey != "SHA256:first" {
+		t.Errorf("station changed by a refused report: %+v", st)
+	}
+}
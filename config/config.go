@@ -0,0 +1,774 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultPath is used when no --config flag is given. A missing file at the
+// default path is not an error.
+const DefaultPath = "/etc/husarion-os-flasher/config.yaml"
+
+// Config holds deployment-specific settings loaded from YAML.
+type Config struct {
+	// Path is the file the config was loaded from, empty when none was found.
+	Path string `yaml:"-"`
+
+	// ImageDir is the image directory when --os-img-path is not given.
+	ImageDir string `yaml:"image_dir,omitempty"`
+
+	// EnableSSH and SSHPort serve the UI over SSH when --enable-ssh and --port
+	// are not given.
+	EnableSSH bool `yaml:"enable_ssh,omitempty"`
+	SSHPort   int  `yaml:"ssh_port,omitempty"`
+
+	// ProtectedDevices are shell patterns matched against the path and the
+	// model of devices that must never be written, such as a data disk.
+	// Matching devices are left out of the device list and refused.
+	ProtectedDevices []string `yaml:"protected_devices,omitempty"`
+
+	// Theme is the color theme of the UI, one of Themes. Empty means
+	// "default".
+	Theme string `yaml:"theme,omitempty"`
+
+	// Actions are extra buttons rendered after the built-in ones.
+	Actions []Action `yaml:"actions"`
+
+	// OnSuccess and OnFailure are shell commands run after a job finishes. They get
+	// JOB, RESULT, IMAGE, DEVICE, DURATION, CHECKSUM, ERROR and ROBOT_MODEL,
+	// ROBOT_REVISION and ROBOT_SERIAL in their environment, plus IMAGE_VERSION and
+	// IMAGE_BUILD_DATE when the image has a .meta.yaml sidecar.
+	OnSuccess string `yaml:"on_success,omitempty"`
+	OnFailure string `yaml:"on_failure,omitempty"`
+
+	// Maintenance schedules image synchronisation, nil when not configured.
+	Maintenance *Maintenance `yaml:"maintenance,omitempty"`
+
+	// Retention limits how many versions of each image are kept, nil keeps all.
+	Retention *Retention `yaml:"retention,omitempty"`
+
+	// Verify is the check run after every flash, one of VerifyModes. Empty means
+	// "none".
+	Verify string `yaml:"verify,omitempty"`
+
+	// CheckBeforeFlash checks the integrity of an image, as Check does, before
+	// it is flashed and refuses to flash a corrupt one. A check recorded in
+	// integrity.yaml since the image last changed is reused.
+	CheckBeforeFlash bool `yaml:"check_before_flash,omitempty"`
+
+	// ExtractBeforeFlash makes Flash on a compressed image extract it next to
+	// the archive first, when there is room, and flash the raw image.
+	ExtractBeforeFlash bool `yaml:"extract_before_flash,omitempty"`
+
+	// VerifyProfiles are named verification policies for customers or
+	// compliance regimes with their own requirements. The profile of an image
+	// is named by its metadata, else by VerifyProfile; a flash under a profile
+	// follows it instead of Verify.
+	VerifyProfiles []VerifyProfile `yaml:"verify_profiles,omitempty"`
+	VerifyProfile  string          `yaml:"verify_profile,omitempty"`
+
+	// SpeedProbe times a short write to SD cards before flashing them, to flag
+	// cards slower than Class 10. Unset means true.
+	SpeedProbe *bool `yaml:"speed_probe,omitempty"`
+
+	// DeviceFlush asks the device to flush its write cache at the end of a
+	// write and before verifying it, as some USB bridges keep data cached
+	// after a sync. Unset means true.
+	DeviceFlush *bool `yaml:"device_flush,omitempty"`
+
+	// SyncEveryMB flushes in-process writes to the device every this many MiB,
+	// so that progress counts data on the card rather than in the page cache and
+	// the final sync is short. Unset means 64, 0 turns it off.
+	SyncEveryMB *int `yaml:"sync_every_mb,omitempty"`
+
+	// Writer is how in-process writes reach the device, one of Writers. Empty
+	// means "sync". The experimental "io_uring" keeps QueueDepth writes in
+	// flight, 8 when unset.
+	Writer     string `yaml:"writer,omitempty"`
+	QueueDepth int    `yaml:"queue_depth,omitempty"`
+
+	// Proxy is the HTTP(S) proxy of image downloads and of the maintenance
+	// sync command, such as "http://proxy.factory.lan:3128". Empty uses the
+	// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.
+	Proxy string `yaml:"proxy,omitempty"`
+
+	// Offline turns off the features that reach the internet, for air-gapped
+	// sites: downloads are refused, the maintenance sync is skipped and
+	// changelog links are hidden.
+	Offline bool `yaml:"offline,omitempty"`
+
+	// TerminalTitle shows the progress of the running job in the terminal
+	// title of SSH sessions, so that it can be followed from a tab or a
+	// minimized window. Unset means true.
+	TerminalTitle *bool `yaml:"terminal_title,omitempty"`
+
+	// Prewarm reads the selected image into the page cache while no job runs,
+	// as far as free memory allows, so that a flash from a slow disk or a
+	// network share starts at the device's speed.
+	Prewarm bool `yaml:"prewarm,omitempty"`
+
+	// Priority is the CPU and I/O priority of the flash, extract and check
+	// pipelines, lowered on workstations to keep the desktop responsive. Unset
+	// runs them at normal priority.
+	Priority *Priority `yaml:"priority,omitempty"`
+
+	// Robot is the robot or board this station provisions, e.g. "Panther". Images
+	// built for it are recommended, others are flagged as incompatible.
+	Robot string `yaml:"robot,omitempty"`
+
+	// Robots recognize robot controllers connected over USB. A detected robot
+	// becomes the target robot and is recorded with the jobs run while connected.
+	Robots []RobotRule `yaml:"robots,omitempty"`
+
+	// Firmware lists the controller firmware written by the Firmware button; the
+	// first entry for the target robot is used.
+	Firmware []Firmware `yaml:"firmware,omitempty"`
+
+	// Customize is run with bash -c by the provisioning wizard after the card is
+	// verified. It gets IMAGE, DEVICE, OS_IMG_PATH and the ROBOT_* variables in
+	// its environment.
+	Customize string `yaml:"customize,omitempty"`
+
+	// CAN updates the firmware of drivers on a CAN bus, nil when not configured.
+	CAN *CAN `yaml:"can,omitempty"`
+
+	// BurnIn adds the Burn-in button, which qualifies cards by writing and
+	// reading back the whole device, nil when not configured.
+	BurnIn *BurnIn `yaml:"burn_in,omitempty"`
+
+	// TwoPerson requires a second operator to approve flashes to matching
+	// devices with their PIN, nil when not configured.
+	TwoPerson *TwoPerson `yaml:"two_person,omitempty"`
+
+	// Roles reserves some actions to admins, nil lets everyone do everything.
+	Roles *Roles `yaml:"roles,omitempty"`
+
+	// SigningKey is an unencrypted OpenSSH private key that signs the backups
+	// made by the flasher, each into a <image>.sig file. Unset leaves them
+	// unsigned.
+	SigningKey string `yaml:"signing_key,omitempty"`
+
+	// Composites are profiles flashing several images in sequence, such as the
+	// OS to the eMMC and a data image to an SD card, for robots that need both.
+	Composites []Composite `yaml:"composites,omitempty"`
+
+	// Duplicators are USB duplicator hubs with many card slots. Their slots are
+	// grouped in the device list and can all be flashed in one run.
+	Duplicators []Duplicator `yaml:"duplicators,omitempty"`
+
+	// PluginsDir holds plugin executables, which can add images, verify
+	// flashed devices and act after a flash (see internal/plugin). Unset runs
+	// no plugins.
+	PluginsDir string `yaml:"plugins_dir,omitempty"`
+
+	// Images are extra file name patterns of flashable images, for artifacts not
+	// named .img, .wic, .iso, .xz or .zip.
+	Images []ImagePattern `yaml:"images,omitempty"`
+}
+
+// ImagePattern selects files by name and how they are read. Exactly one of
+// Glob or Regex must be set.
+type ImagePattern struct {
+	Glob   string `yaml:"glob,omitempty"`  // shell pattern matched against the file name
+	Regex  string `yaml:"regex,omitempty"` // regular expression matched against the file name
+	Format string `yaml:"format"`          // one of ImageFormats
+}
+
+// RobotRule recognizes the controller of a robot model by its USB descriptors.
+// At least one of USB and Product must be set.
+type RobotRule struct {
+	Model   string `yaml:"model"`             // e.g. "ROSbot 2R"
+	USB     string `yaml:"usb,omitempty"`     // "vendor:product" ids in hex, e.g. "0483:5740"
+	Product string `yaml:"product,omitempty"` // shell pattern matched against the product or manufacturer string
+	EEPROM  string `yaml:"eeprom,omitempty"`  // EEPROM configuration applied to this robot instead of /etc/boot.conf
+}
+
+// Firmware is a robot controller firmware and how it is written.
+type Firmware struct {
+	Robot   string `yaml:"robot,omitempty"`   // robot model it is for, empty for any
+	Tool    string `yaml:"tool"`              // stm32flash or esptool
+	File    string `yaml:"file"`              // firmware binary, relative to the image directory
+	Port    string `yaml:"port,omitempty"`    // serial port, by default the detected robot's
+	Baud    int    `yaml:"baud,omitempty"`    // 0 for the tool's default
+	Address string `yaml:"address,omitempty"` // flash offset, default the start of flash
+}
+
+// CAN runs an update command for each node on a SocketCAN interface, such as a
+// candleLight adapter. The command gets CAN_INTERFACE, NODE_ID, NODE_NAME and
+// FIRMWARE in its environment and may print its progress as a percentage.
+type CAN struct {
+	Interface string    `yaml:"interface"`         // e.g. can0
+	Bitrate   int       `yaml:"bitrate,omitempty"` // the interface is brought up at this bitrate when down
+	Update    string    `yaml:"update"`            // run with bash -c once per node
+	Nodes     []CANNode `yaml:"nodes"`
+}
+
+// CANNode is a device on the CAN bus and the firmware it gets.
+type CANNode struct {
+	ID       int    `yaml:"id"`             // node id on the bus
+	Name     string `yaml:"name,omitempty"` // e.g. "front driver"
+	Firmware string `yaml:"firmware"`       // relative to the image directory
+}
+
+// Priority is applied with nice and, on Linux, ionice.
+type Priority struct {
+	Nice    int    `yaml:"nice,omitempty"`     // -20 (highest) to 19 (lowest), 0 leaves it
+	IOClass string `yaml:"io_class,omitempty"` // one of IOClasses, empty leaves it
+	IOLevel int    `yaml:"io_level,omitempty"` // 0 (highest) to 7, within realtime and best-effort
+}
+
+// IOClasses are the accepted values of Priority.IOClass.
+var IOClasses = []string{"realtime", "best-effort", "idle"}
+
+// Writers are the accepted values of Config.Writer: a write at a time, or
+// io_uring on Linux.
+var Writers = []string{"sync", "io_uring"}
+
+// TwoPerson selects the devices whose flashes need a second operator's
+// approval: those at least MinSizeGB large or matching one of Devices.
+type TwoPerson struct {
+	MinSizeGB int        `yaml:"min_size_gb,omitempty"` // decimal gigabytes, 0 ignores the size
+	Devices   []string   `yaml:"devices,omitempty"`     // shell patterns matched against the device path or model
+	Approvers []Approver `yaml:"approvers"`
+}
+
+// Approver is an operator who can approve flashes.
+type Approver struct {
+	Name      string `yaml:"name"`
+	PINSHA256 string `yaml:"pin_sha256"` // hex SHA-256 of the PIN, e.g. from: echo -n 1234 | sha256sum
+}
+
+// Roles splits the users of a station into operators and admins. SSH users
+// are admins when their key is in AdminKeys, an authorized_keys file; on the
+// console an operator becomes admin with the PIN of AdminPINSHA256.
+type Roles struct {
+	AdminKeys      string   `yaml:"admin_keys,omitempty"`
+	AdminPINSHA256 string   `yaml:"admin_pin_sha256,omitempty"` // hex SHA-256 of the PIN
+	AdminOnly      []string `yaml:"admin_only,omitempty"`       // of Builtins and RemoteCommands, DefaultAdminOnly when empty
+}
+
+// DefaultAdminOnly are the actions reserved to admins unless Roles.AdminOnly
+// says otherwise: those that delete images or change the station's hardware.
+var DefaultAdminOnly = []string{"eeprom", "firmware", "can", "prune", "dedup"}
+
+// RemoteCommands are the commands of SSH sessions Roles.AdminOnly may reserve.
+var RemoteCommands = []string{"devices", "images", "jobs", "pause", "resume", "abort-all", "stats", "failures", "flash", "backup", "stations", "dispatch"}
+
+// AdminActions returns the actions reserved to admins.
+func (r *Roles) AdminActions() []string {
+	if len(r.AdminOnly) == 0 {
+		return DefaultAdminOnly
+	}
+	return r.AdminOnly
+}
+
+// sha256Hex matches hex SHA-256 digests.
+var sha256Hex = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
+// Composite is a profile flashing several images, each to its own device or
+// partition, as one run with one report.
+type Composite struct {
+	Name  string          `yaml:"name"`
+	Parts []CompositePart `yaml:"parts"` // flashed in this order
+}
+
+// VerifyProfile is a named verification policy.
+type VerifyProfile struct {
+	Name   string `yaml:"name"`
+	Verify string `yaml:"verify,omitempty"` // check run after the flash, one of VerifyModes
+
+	// Hashes are computed over the image file before it is written, of
+	// HashAlgorithms. A SHA-256 is compared with the image's checksum sidecar
+	// when there is one.
+	Hashes []string `yaml:"hashes,omitempty"`
+
+	// RequireSignature refuses images without a <image>.sig made by one of the
+	// keys of Signers, an authorized_keys or allowed_signers file.
+	RequireSignature bool   `yaml:"require_signature,omitempty"`
+	Signers          string `yaml:"signers,omitempty"`
+
+	// Report writes a verification report of every flash with these fields,
+	// of ReportFields, in this order. Empty writes none.
+	Report []string `yaml:"report,omitempty"`
+}
+
+// HashAlgorithms are the accepted values of VerifyProfile.Hashes.
+var HashAlgorithms = []string{"sha256", "sha512"}
+
+// ReportFields are the accepted values of VerifyProfile.Report.
+var ReportFields = []string{"image", "version", "device", "device_serial", "operator", "robot", "profile", "verify", "hashes", "signature", "started", "finished", "result"}
+
+// VerifyProfileNamed returns the verification profile called name, nil when
+// there is none.
+func (c *Config) VerifyProfileNamed(name string) *VerifyProfile {
+	if c == nil || name == "" {
+		return nil
+	}
+	for i := range c.VerifyProfiles {
+		if c.VerifyProfiles[i].Name == name {
+			return &c.VerifyProfiles[i]
+		}
+	}
+	return nil
+}
+
+// CompositePart is an image of a Composite and where it goes.
+type CompositePart struct {
+	Label     string `yaml:"label,omitempty"`     // e.g. "OS" or "data"
+	Image     string `yaml:"image"`               // shell pattern matched against the image file names, the last match in name order is flashed
+	Device    string `yaml:"device"`              // shell pattern matched against the device path or model
+	Partition int    `yaml:"partition,omitempty"` // write into this partition of the device, 0 for the whole device
+}
+
+// Duplicator is a hub whose ports hold card readers, one per slot.
+type Duplicator struct {
+	Name string `yaml:"name"`
+	Hub  string `yaml:"hub"` // USB port path of the hub, e.g. "1-1.2"; the devices below it are its slots
+	// Ports are the ports of slots 1, 2, ... below the hub, e.g. ["1", "2",
+	// "3.1"]. Empty numbers the connected devices in port order.
+	Ports []string `yaml:"ports,omitempty"`
+}
+
+// usbPort matches USB port paths such as "1-1.2".
+var usbPort = regexp.MustCompile(`^[0-9]+-[0-9]+(\.[0-9]+)*$`)
+
+// hubPort matches port paths below a hub such as "3" or "3.1".
+var hubPort = regexp.MustCompile(`^[0-9]+(\.[0-9]+)*$`)
+
+// BurnIn is how long cards are burned in.
+type BurnIn struct {
+	Duration string `yaml:"duration,omitempty"` // e.g. "4h", empty for a single pass
+}
+
+// Length returns the burn-in duration, 0 for a single pass.
+func (b *BurnIn) Length() time.Duration {
+	d, _ := time.ParseDuration(b.Duration)
+	return d
+}
+
+// FirmwareTools are the accepted values of Firmware.Tool.
+var FirmwareTools = []string{"stm32flash", "esptool"}
+
+// usbID matches "vendor:product" USB ids.
+var usbID = regexp.MustCompile(`^[0-9a-fA-F]{4}:[0-9a-fA-F]{4}$`)
+
+// Themes are the accepted values of Config.Theme: the Husarion colors, and
+// brighter ones for sunlit workshops and poor displays.
+var Themes = []string{"default", "high-contrast"}
+
+// ImageFormats are the accepted values of ImagePattern.Format: a raw image, an
+// xz-, zstd- or bzip2-compressed one, or a zip archive holding one.
+var ImageFormats = []string{"raw", "xz", "zstd", "bzip2", "zip"}
+
+// VerifyModes are the accepted values of Config.Verify: no check, a quick check
+// of the partition table, partition starts and samples, a check of the first
+// and last regions and a random share of the blocks, or a full read-back.
+var VerifyModes = []string{"none", "quick", "sampled", "full"}
+
+// VerifyPolicy returns the check run after every flash.
+func (c *Config) VerifyPolicy() string {
+	if c == nil || c.Verify == "" {
+		return "none"
+	}
+	return c.Verify
+}
+
+// SyncInterval returns how many bytes are written between flushes, 0 for none.
+func (c *Config) SyncInterval() int64 {
+	if c == nil || c.SyncEveryMB == nil {
+		return 64 << 20
+	}
+	return int64(*c.SyncEveryMB) << 20
+}
+
+// ProbeSpeed reports whether SD cards are probed for their write speed before
+// flashing.
+func (c *Config) ProbeSpeed() bool {
+	return c == nil || c.SpeedProbe == nil || *c.SpeedProbe
+}
+
+// FlushDevice reports whether devices are asked to flush their write cache
+// after a write.
+func (c *Config) FlushDevice() bool {
+	return c == nil || c.DeviceFlush == nil || *c.DeviceFlush
+}
+
+// ShowTerminalTitle reports whether SSH sessions show the progress of the
+// running job in their terminal title.
+func (c *Config) ShowTerminalTitle() bool {
+	return c == nil || c.TerminalTitle == nil || *c.TerminalTitle
+}
+
+// Retention selects old image versions for pruning.
+type Retention struct {
+	KeepLast  int      `yaml:"keep_last"`           // newest versions kept per image family
+	Favorites []string `yaml:"favorites,omitempty"` // file name globs that are never pruned
+}
+
+// Maintenance runs once a day inside Window while no job is running.
+type Maintenance struct {
+	Window       string `yaml:"window"`                  // local time "HH:MM-HH:MM", may wrap past midnight
+	Sync         string `yaml:"sync,omitempty"`          // run with bash -c, OS_IMG_PATH is exported
+	Prune        bool   `yaml:"prune,omitempty"`         // apply the retention policy after syncing
+	RecompressXZ bool   `yaml:"recompress_xz,omitempty"` // recompress single-block xz images in blocks
+}
+
+// Bounds returns the window start and end as offsets from midnight.
+func (mt *Maintenance) Bounds() (start, end time.Duration, err error) {
+	from, to, ok := strings.Cut(mt.Window, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("window %q: want HH:MM-HH:MM", mt.Window)
+	}
+	if start, err = parseClock(from); err != nil {
+		return 0, 0, fmt.Errorf("window %q: %w", mt.Window, err)
+	}
+	if end, err = parseClock(to); err != nil {
+		return 0, 0, fmt.Errorf("window %q: %w", mt.Window, err)
+	}
+	if start == end {
+		return 0, 0, fmt.Errorf("window %q is empty", mt.Window)
+	}
+	return start, end, nil
+}
+
+// WindowStart returns when the window containing t opened, and false when t is
+// outside the window.
+func (mt *Maintenance) WindowStart(t time.Time) (time.Time, bool) {
+	start, end, err := mt.Bounds()
+	if err != nil {
+		return time.Time{}, false
+	}
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	now := t.Sub(midnight)
+	switch {
+	case start < end && now >= start && now < end:
+		return midnight.Add(start), true
+	case start > end && now >= start:
+		return midnight.Add(start), true
+	case start > end && now < end:
+		// Opened yesterday evening
+		return midnight.AddDate(0, 0, -1).Add(start), true
+	}
+	return time.Time{}, false
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Action is a custom button. Exactly one of Command or Builtin must be set.
+type Action struct {
+	Label   string `yaml:"label"`
+	Command string `yaml:"command,omitempty"` // run with bash -c, IMAGE and DEVICE are exported
+	Builtin string `yaml:"builtin,omitempty"` // one of Builtins
+}
+
+// Builtins are the built-in actions an Action may refer to.
+var Builtins = []string{"flash", "extract", "check", "eeprom", "firmware", "can", "provision", "about", "prune", "dedup", "stations", "stats", "failures", "burnin", "composite", "duplicate", "preview", "boot"}
+
+// Load reads the config at path. When explicit is false a missing file yields an
+// empty config instead of an error.
+func Load(path string, explicit bool) (*Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if !explicit && errors.Is(err, fs.ErrNotExist) {
+			return &Config{}, nil
+		}
+		return nil, err
+	}
+
+	var cfg Config
+	if err := yaml.Unmarshal(b, &cfg); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	cfg.Path = path
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// Validate checks the config for inconsistent entries.
+func (c *Config) Validate() error {
+	if c.SSHPort < 0 || c.SSHPort > 65535 {
+		return fmt.Errorf("ssh_port: want 1-65535, got %d", c.SSHPort)
+	}
+	for i, pattern := range c.ProtectedDevices {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("protected_devices[%d]: %q: %w", i, pattern, err)
+		}
+	}
+	if c.Theme != "" && !contains(Themes, c.Theme) {
+		return fmt.Errorf("theme: want one of %s, got %q", strings.Join(Themes, ", "), c.Theme)
+	}
+	for i, a := range c.Actions {
+		if a.Label == "" {
+			return fmt.Errorf("actions[%d]: label is required", i)
+		}
+		if (a.Command == "") == (a.Builtin == "") {
+			return fmt.Errorf("actions[%d] (%s): exactly one of command or builtin must be set", i, a.Label)
+		}
+		if a.Builtin != "" && !isBuiltin(a.Builtin) {
+			return fmt.Errorf("actions[%d] (%s): unknown builtin %q", i, a.Label, a.Builtin)
+		}
+	}
+	if c.Maintenance != nil {
+		if _, _, err := c.Maintenance.Bounds(); err != nil {
+			return fmt.Errorf("maintenance: %w", err)
+		}
+		if c.Maintenance.Prune && c.Retention == nil {
+			return fmt.Errorf("maintenance: prune needs a retention policy")
+		}
+	}
+	for i, p := range c.Images {
+		if (p.Glob == "") == (p.Regex == "") {
+			return fmt.Errorf("images[%d]: exactly one of glob or regex must be set", i)
+		}
+		if _, err := filepath.Match(p.Glob, ""); err != nil {
+			return fmt.Errorf("images[%d]: glob %q: %w", i, p.Glob, err)
+		}
+		if _, err := regexp.Compile(p.Regex); err != nil {
+			return fmt.Errorf("images[%d]: regex: %w", i, err)
+		}
+		if !contains(ImageFormats, p.Format) {
+			return fmt.Errorf("images[%d]: format: want one of %s, got %q", i, strings.Join(ImageFormats, ", "), p.Format)
+		}
+	}
+	for i, r := range c.Robots {
+		if r.Model == "" {
+			return fmt.Errorf("robots[%d]: model is required", i)
+		}
+		if r.USB == "" && r.Product == "" {
+			return fmt.Errorf("robots[%d] (%s): at least one of usb or product must be set", i, r.Model)
+		}
+		if r.USB != "" && !usbID.MatchString(r.USB) {
+			return fmt.Errorf("robots[%d] (%s): usb %q: want vendor:product in hex", i, r.Model, r.USB)
+		}
+		if _, err := filepath.Match(r.Product, ""); err != nil {
+			return fmt.Errorf("robots[%d] (%s): product %q: %w", i, r.Model, r.Product, err)
+		}
+	}
+	for i, f := range c.Firmware {
+		if f.File == "" {
+			return fmt.Errorf("firmware[%d]: file is required", i)
+		}
+		if !contains(FirmwareTools, f.Tool) {
+			return fmt.Errorf("firmware[%d] (%s): tool: want one of %s, got %q", i, f.File, strings.Join(FirmwareTools, ", "), f.Tool)
+		}
+		if f.Baud < 0 {
+			return fmt.Errorf("firmware[%d] (%s): baud must not be negative", i, f.File)
+		}
+	}
+	if c.CAN != nil {
+		if c.CAN.Interface == "" || c.CAN.Update == "" {
+			return fmt.Errorf("can: interface and update are required")
+		}
+		if len(c.CAN.Nodes) == 0 {
+			return fmt.Errorf("can: no nodes")
+		}
+		for i, n := range c.CAN.Nodes {
+			if n.ID < 1 || n.ID > 127 {
+				return fmt.Errorf("can: nodes[%d]: id must be 1 to 127, got %d", i, n.ID)
+			}
+			if n.Firmware == "" {
+				return fmt.Errorf("can: nodes[%d]: firmware is required", i)
+			}
+		}
+	}
+	if p := c.Priority; p != nil {
+		if p.Nice < -20 || p.Nice > 19 {
+			return fmt.Errorf("priority: nice must be -20 to 19, got %d", p.Nice)
+		}
+		if p.IOClass != "" && !contains(IOClasses, p.IOClass) {
+			return fmt.Errorf("priority: io_class: want one of %s, got %q", strings.Join(IOClasses, ", "), p.IOClass)
+		}
+		if p.IOLevel < 0 || p.IOLevel > 7 {
+			return fmt.Errorf("priority: io_level must be 0 to 7, got %d", p.IOLevel)
+		}
+	}
+	if c.Writer != "" && !contains(Writers, c.Writer) {
+		return fmt.Errorf("writer: want one of %s, got %q", strings.Join(Writers, ", "), c.Writer)
+	}
+	if c.QueueDepth < 0 || c.QueueDepth > 4096 {
+		return fmt.Errorf("queue_depth must be 0 to 4096, got %d", c.QueueDepth)
+	}
+	if c.Proxy != "" {
+		u, err := url.Parse(c.Proxy)
+		if err != nil {
+			return fmt.Errorf("proxy: %w", err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5" || u.Host == "" {
+			return fmt.Errorf("proxy: want http://, https:// or socks5://host:port, got %q", c.Proxy)
+		}
+	}
+	if c.SyncEveryMB != nil && *c.SyncEveryMB < 0 {
+		return fmt.Errorf("sync_every_mb must not be negative")
+	}
+	if c.BurnIn != nil && c.BurnIn.Duration != "" {
+		if d, err := time.ParseDuration(c.BurnIn.Duration); err != nil {
+			return fmt.Errorf("burn_in: duration: %w", err)
+		} else if d < 0 {
+			return fmt.Errorf("burn_in: duration must not be negative")
+		}
+	}
+	if r := c.Roles; r != nil {
+		if r.AdminKeys == "" && r.AdminPINSHA256 == "" {
+			return fmt.Errorf("roles: at least one of admin_keys or admin_pin_sha256 must be set")
+		}
+		if r.AdminPINSHA256 != "" && !sha256Hex.MatchString(r.AdminPINSHA256) {
+			return fmt.Errorf("roles: admin_pin_sha256 must be 64 hex digits")
+		}
+		for _, action := range r.AdminOnly {
+			if !isBuiltin(action) && !contains(RemoteCommands, action) {
+				return fmt.Errorf("roles: unknown admin_only action %q", action)
+			}
+		}
+	}
+	if t := c.TwoPerson; t != nil {
+		if t.MinSizeGB < 0 {
+			return fmt.Errorf("two_person: min_size_gb must not be negative")
+		}
+		if t.MinSizeGB == 0 && len(t.Devices) == 0 {
+			return fmt.Errorf("two_person: at least one of min_size_gb or devices must be set")
+		}
+		for _, pattern := range t.Devices {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return fmt.Errorf("two_person: device %q: %w", pattern, err)
+			}
+		}
+		if len(t.Approvers) == 0 {
+			return fmt.Errorf("two_person: no approvers")
+		}
+		for i, a := range t.Approvers {
+			if a.Name == "" {
+				return fmt.Errorf("two_person: approvers[%d]: name is required", i)
+			}
+			if !sha256Hex.MatchString(a.PINSHA256) {
+				return fmt.Errorf("two_person: approvers[%d] (%s): pin_sha256 must be a hex SHA-256 digest", i, a.Name)
+			}
+		}
+	}
+	names := map[string]bool{}
+	for i, comp := range c.Composites {
+		if comp.Name == "" {
+			return fmt.Errorf("composites[%d]: name is required", i)
+		}
+		if names[comp.Name] {
+			return fmt.Errorf("composites[%d]: duplicate name %q", i, comp.Name)
+		}
+		names[comp.Name] = true
+		if len(comp.Parts) == 0 {
+			return fmt.Errorf("composites[%d] (%s): no parts", i, comp.Name)
+		}
+		for j, part := range comp.Parts {
+			if part.Image == "" || part.Device == "" {
+				return fmt.Errorf("composites[%d] (%s): parts[%d]: image and device are required", i, comp.Name, j)
+			}
+			for _, pattern := range []string{part.Image, part.Device} {
+				if _, err := filepath.Match(pattern, ""); err != nil {
+					return fmt.Errorf("composites[%d] (%s): parts[%d]: %q: %w", i, comp.Name, j, pattern, err)
+				}
+			}
+			if part.Partition < 0 {
+				return fmt.Errorf("composites[%d] (%s): parts[%d]: partition must not be negative", i, comp.Name, j)
+			}
+		}
+	}
+	names = map[string]bool{}
+	hubs := map[string]bool{}
+	for i, d := range c.Duplicators {
+		if d.Name == "" {
+			return fmt.Errorf("duplicators[%d]: name is required", i)
+		}
+		if names[d.Name] {
+			return fmt.Errorf("duplicators[%d]: duplicate name %q", i, d.Name)
+		}
+		names[d.Name] = true
+		if !usbPort.MatchString(d.Hub) {
+			return fmt.Errorf("duplicators[%d] (%s): hub %q: want a USB port path such as 1-1.2", i, d.Name, d.Hub)
+		}
+		if hubs[d.Hub] {
+			return fmt.Errorf("duplicators[%d] (%s): hub %s is also another duplicator's", i, d.Name, d.Hub)
+		}
+		hubs[d.Hub] = true
+		ports := map[string]bool{}
+		for j, p := range d.Ports {
+			if !hubPort.MatchString(p) {
+				return fmt.Errorf("duplicators[%d] (%s): ports[%d]: %q: want a port such as 3 or 3.1", i, d.Name, j, p)
+			}
+			if ports[p] {
+				return fmt.Errorf("duplicators[%d] (%s): port %s is listed twice", i, d.Name, p)
+			}
+			ports[p] = true
+		}
+	}
+	if c.Verify != "" && !contains(VerifyModes, c.Verify) {
+		return fmt.Errorf("verify: want one of %s, got %q", strings.Join(VerifyModes, ", "), c.Verify)
+	}
+	profiles := map[string]bool{}
+	for i, p := range c.VerifyProfiles {
+		if p.Name == "" {
+			return fmt.Errorf("verify_profiles[%d]: name is required", i)
+		}
+		if profiles[p.Name] {
+			return fmt.Errorf("verify_profiles[%d]: duplicate name %q", i, p.Name)
+		}
+		profiles[p.Name] = true
+		if p.Verify != "" && !contains(VerifyModes, p.Verify) {
+			return fmt.Errorf("verify_profiles[%d] (%s): verify: want one of %s, got %q", i, p.Name, strings.Join(VerifyModes, ", "), p.Verify)
+		}
+		for _, h := range p.Hashes {
+			if !contains(HashAlgorithms, h) {
+				return fmt.Errorf("verify_profiles[%d] (%s): hashes: want %s, got %q", i, p.Name, strings.Join(HashAlgorithms, " or "), h)
+			}
+		}
+		if p.RequireSignature && p.Signers == "" {
+			return fmt.Errorf("verify_profiles[%d] (%s): require_signature needs signers", i, p.Name)
+		}
+		for _, f := range p.Report {
+			if !contains(ReportFields, f) {
+				return fmt.Errorf("verify_profiles[%d] (%s): report: unknown field %q, want some of %s", i, p.Name, f, strings.Join(ReportFields, ", "))
+			}
+		}
+	}
+	if c.VerifyProfile != "" && !profiles[c.VerifyProfile] {
+		return fmt.Errorf("verify_profile: no verify_profiles entry is named %q", c.VerifyProfile)
+	}
+	if c.Retention != nil {
+		if c.Retention.KeepLast < 1 {
+			return fmt.Errorf("retention: keep_last must be at least 1")
+		}
+		for _, pattern := range c.Retention.Favorites {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return fmt.Errorf("retention: favorite %q: %w", pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+func isBuiltin(name string) bool {
+	return contains(Builtins, name)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,433 @@
+// Package delta creates and applies block-level binary deltas between two raw
+// images, so a device flashed with the base image can be updated by writing only
+// the blocks that changed.
+//
+// A delta file is a gzip stream containing a header, one record per changed block
+// and a trailer:
+//
+//	header:  magic "HOSDLT01", block size (uint32), base size, target size (int64)
+//	record:  block index (uint64), SHA-256 of the base block, new block data
+//	end:     block index 0xFFFFFFFFFFFFFFFF
+//	trailer: SHA-256 of the whole base image, SHA-256 of the whole target image
+//
+// All integers are big-endian. The last block of the target may be short.
+package delta
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/husarion/husarion-os-flasher/util"
+)
+
+// DefaultBlockSize balances delta granularity against per-record overhead.
+const DefaultBlockSize = 64 * 1024
+
+// MaxBlockSize is the largest block size of a delta, as each block is held in
+// memory when applying it.
+const MaxBlockSize = 64 << 20
+
+const endMarker = math.MaxUint64
+
+var magic = [8]byte{'H', 'O', 'S', 'D', 'L', 'T', '0', '1'}
+
+// Progress is called with the number of bytes processed so far and the total.
+type Progress func(done, total int64)
+
+type header struct {
+	Magic      [8]byte
+	BlockSize  uint32
+	BaseSize   int64
+	TargetSize int64
+}
+
+// Stats summarizes a created or applied delta.
+type Stats struct {
+	BlockSize     int
+	ChangedBlocks int64
+	ChangedBytes  int64
+	BaseSize      int64
+	TargetSize    int64
+}
+
+// openImage opens a raw image, transparently decompressing .xz files with xz.
+// It returns the reader and the uncompressed size when known (-1 otherwise).
+func openImage(path string) (io.ReadCloser, int64, error) {
+	if !strings.HasSuffix(path, ".xz") {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, 0, err
+		}
+		size, err := f.Seek(0, io.SeekEnd)
+		if err == nil {
+			_, err = f.Seek(0, io.SeekStart)
+		}
+		if err != nil {
+			f.Close()
+			return nil, 0, err
+		}
+		return f, size, nil
+	}
+
+	cmd := util.Command("xz", "-dc", path)
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, 0, err
+	}
+	return &cmdReader{ReadCloser: out, cmd: cmd}, -1, nil
+}
+
+// cmdReader waits for the decompressor on Close and reports its failure.
+type cmdReader struct {
+	io.ReadCloser
+	cmd *exec.Cmd
+}
+
+func (r *cmdReader) Close() error {
+	r.ReadCloser.Close()
+	return r.cmd.Wait()
+}
+
+// imageSize returns the size of an image, decompressing it if needed.
+func imageSize(path string) (int64, error) {
+	r, size, err := openImage(path)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	if size >= 0 {
+		return size, nil
+	}
+	return io.Copy(io.Discard, r)
+}
+
+// readBlock fills buf as far as the reader allows and returns the byte count.
+func readBlock(r io.Reader, buf []byte) (int, error) {
+	n, err := io.ReadFull(r, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return n, nil
+	}
+	return n, err
+}
+
+// Create writes a delta that turns base into target. blockSize <= 0 selects
+// DefaultBlockSize.
+func Create(basePath, targetPath, outPath string, blockSize int, progress Progress) (Stats, error) {
+	if blockSize <= 0 {
+		blockSize = DefaultBlockSize
+	}
+	if blockSize > MaxBlockSize {
+		return Stats{}, fmt.Errorf("block size %d is above the maximum of %d", blockSize, MaxBlockSize)
+	}
+	baseSize, err := imageSize(basePath)
+	if err != nil {
+		return Stats{}, fmt.Errorf("reading base image: %w", err)
+	}
+	targetSize, err := imageSize(targetPath)
+	if err != nil {
+		return Stats{}, fmt.Errorf("reading target image: %w", err)
+	}
+
+	base, _, err := openImage(basePath)
+	if err != nil {
+		return Stats{}, err
+	}
+	defer base.Close()
+	target, _, err := openImage(targetPath)
+	if err != nil {
+		return Stats{}, err
+	}
+	defer target.Close()
+
+	outFile, err := os.Create(outPath + ".part")
+	if err != nil {
+		return Stats{}, err
+	}
+	defer os.Remove(outPath + ".part")
+	defer outFile.Close()
+
+	bw := bufio.NewWriter(outFile)
+	zw := gzip.NewWriter(bw)
+	hdr := header{Magic: magic, BlockSize: uint32(blockSize), BaseSize: baseSize, TargetSize: targetSize}
+	if err := binary.Write(zw, binary.BigEndian, hdr); err != nil {
+		return Stats{}, err
+	}
+
+	stats := Stats{BlockSize: blockSize, BaseSize: baseSize, TargetSize: targetSize}
+	baseHash, targetHash := sha256.New(), sha256.New()
+	baseBuf, targetBuf := make([]byte, blockSize), make([]byte, blockSize)
+
+	for index := uint64(0); ; index++ {
+		tn, err := readBlock(target, targetBuf)
+		if err != nil {
+			return Stats{}, fmt.Errorf("reading target image: %w", err)
+		}
+		bn, err := readBlock(base, baseBuf)
+		if err != nil {
+			return Stats{}, fmt.Errorf("reading base image: %w", err)
+		}
+		baseHash.Write(baseBuf[:bn])
+		targetHash.Write(targetBuf[:tn])
+		if tn == 0 {
+			// Drain the rest of a longer base so its hash covers the whole image
+			if _, err := io.Copy(baseHash, base); err != nil {
+				return Stats{}, fmt.Errorf("reading base image: %w", err)
+			}
+			break
+		}
+
+		if bn != tn || !bytes.Equal(baseBuf[:bn], targetBuf[:tn]) {
+			if err := binary.Write(zw, binary.BigEndian, index); err != nil {
+				return Stats{}, err
+			}
+			// Blocks beyond the end of the base have nothing to verify against
+			var oldSum [sha256.Size]byte
+			if bn == blockSize {
+				oldSum = sha256.Sum256(baseBuf)
+			}
+			zw.Write(oldSum[:])
+			if _, err := zw.Write(targetBuf[:tn]); err != nil {
+				return Stats{}, err
+			}
+			stats.ChangedBlocks++
+			stats.ChangedBytes += int64(tn)
+		}
+		if progress != nil {
+			progress(int64(index)*int64(blockSize)+int64(tn), targetSize)
+		}
+	}
+
+	if err := binary.Write(zw, binary.BigEndian, uint64(endMarker)); err != nil {
+		return Stats{}, err
+	}
+	zw.Write(baseHash.Sum(nil))
+	zw.Write(targetHash.Sum(nil))
+	if err := zw.Close(); err != nil {
+		return Stats{}, err
+	}
+	if err := bw.Flush(); err != nil {
+		return Stats{}, err
+	}
+	if err := outFile.Close(); err != nil {
+		return Stats{}, err
+	}
+	return stats, os.Rename(outPath+".part", outPath)
+}
+
+// reader walks the records of a delta file.
+type reader struct {
+	file *os.File
+	zr   *gzip.Reader
+	hdr  header
+	buf  []byte
+}
+
+func openDelta(path string) (*reader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	zr, err := gzip.NewReader(bufio.NewReader(f))
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("not a delta file: %w", err)
+	}
+	r := &reader{file: f, zr: zr}
+	if err := binary.Read(zr, binary.BigEndian, &r.hdr); err != nil || r.hdr.Magic != magic {
+		r.Close()
+		return nil, errors.New("not a delta file: bad header")
+	}
+	if r.hdr.BlockSize == 0 || r.hdr.BlockSize > MaxBlockSize {
+		r.Close()
+		return nil, fmt.Errorf("invalid delta block size %d", r.hdr.BlockSize)
+	}
+	r.buf = make([]byte, r.hdr.BlockSize)
+	return r, nil
+}
+
+func (r *reader) Close() error {
+	r.zr.Close()
+	return r.file.Close()
+}
+
+// next returns the next changed block. ok is false after the last record.
+func (r *reader) next() (index uint64, oldSum [sha256.Size]byte, data []byte, ok bool, err error) {
+	if err = binary.Read(r.zr, binary.BigEndian, &index); err != nil {
+		return 0, oldSum, nil, false, fmt.Errorf("truncated delta: %w", err)
+	}
+	if index == endMarker {
+		return 0, oldSum, nil, false, nil
+	}
+	if _, err = io.ReadFull(r.zr, oldSum[:]); err != nil {
+		return 0, oldSum, nil, false, fmt.Errorf("truncated delta: %w", err)
+	}
+	// Only the final block of the target may be short
+	size := int64(r.hdr.BlockSize)
+	if rest := r.hdr.TargetSize - int64(index)*size; rest < size {
+		size = rest
+	}
+	if size <= 0 {
+		return 0, oldSum, nil, false, fmt.Errorf("delta record %d beyond target size", index)
+	}
+	data = r.buf[:size]
+	if _, err = io.ReadFull(r.zr, data); err != nil {
+		return 0, oldSum, nil, false, fmt.Errorf("truncated delta: %w", err)
+	}
+	return index, oldSum, data, true, nil
+}
+
+// trailer reads the hashes of the whole base and target images that follow
+// the last record, then the rest of the stream, so that gzip checks its CRC.
+func (r *reader) trailer() (baseSum, targetSum [sha256.Size]byte, err error) {
+	if _, err = io.ReadFull(r.zr, baseSum[:]); err == nil {
+		_, err = io.ReadFull(r.zr, targetSum[:])
+	}
+	if err != nil {
+		return baseSum, targetSum, fmt.Errorf("truncated delta: %w", err)
+	}
+	if n, err := io.Copy(io.Discard, r.zr); err != nil {
+		return baseSum, targetSum, fmt.Errorf("corrupt delta: %w", err)
+	} else if n > 0 {
+		return baseSum, targetSum, fmt.Errorf("corrupt delta: %d bytes after the trailer", n)
+	}
+	return baseSum, targetSum, nil
+}
+
+// Inspect returns the statistics of a delta file without touching any device.
+func Inspect(deltaPath string) (Stats, error) {
+	r, err := openDelta(deltaPath)
+	if err != nil {
+		return Stats{}, err
+	}
+	defer r.Close()
+	stats := Stats{BlockSize: int(r.hdr.BlockSize), BaseSize: r.hdr.BaseSize, TargetSize: r.hdr.TargetSize}
+	for {
+		_, _, data, ok, err := r.next()
+		if err != nil {
+			return Stats{}, err
+		}
+		if !ok {
+			if _, _, err := r.trailer(); err != nil {
+				return Stats{}, err
+			}
+			return stats, nil
+		}
+		stats.ChangedBlocks++
+		stats.ChangedBytes += int64(len(data))
+	}
+}
+
+// Apply writes the changed blocks of a delta to dst (a device or image file).
+// Every block is first checked against the base image hash recorded in the
+// delta; nothing is written if dst does not hold the base image there. Once
+// written, dst is read back up to the target size and checked against the
+// target image hash, which also catches unchanged blocks that differ from the
+// base. progress covers both the writes and the check.
+func Apply(deltaPath, dst string, progress Progress) (Stats, error) {
+	out, err := os.OpenFile(dst, os.O_RDWR, 0)
+	if err != nil {
+		return Stats{}, err
+	}
+	defer out.Close()
+
+	// Pass 1: verify the destination holds the base image where blocks change
+	r, err := openDelta(deltaPath)
+	if err != nil {
+		return Stats{}, err
+	}
+	stats := Stats{BlockSize: int(r.hdr.BlockSize), BaseSize: r.hdr.BaseSize, TargetSize: r.hdr.TargetSize}
+	current := make([]byte, r.hdr.BlockSize)
+	var targetSum [sha256.Size]byte
+	for {
+		index, oldSum, data, ok, err := r.next()
+		if err != nil {
+			r.Close()
+			return Stats{}, err
+		}
+		if !ok {
+			if _, targetSum, err = r.trailer(); err != nil {
+				r.Close()
+				return Stats{}, err
+			}
+			break
+		}
+		stats.ChangedBlocks++
+		stats.ChangedBytes += int64(len(data))
+		if oldSum == ([sha256.Size]byte{}) {
+			continue
+		}
+		if _, err := out.ReadAt(current, int64(index)*int64(r.hdr.BlockSize)); err != nil && err != io.EOF {
+			r.Close()
+			return Stats{}, fmt.Errorf("reading %s: %w", dst, err)
+		}
+		if sha256.Sum256(current) != oldSum {
+			r.Close()
+			return Stats{}, fmt.Errorf("%s does not contain the base image (block %d differs); nothing was written", dst, index)
+		}
+	}
+	r.Close()
+
+	// Pass 2: write the new blocks
+	r, err = openDelta(deltaPath)
+	if err != nil {
+		return Stats{}, err
+	}
+	defer r.Close()
+	total := stats.ChangedBytes + stats.TargetSize
+	var written int64
+	for {
+		index, _, data, ok, err := r.next()
+		if err != nil {
+			return Stats{}, err
+		}
+		if !ok {
+			break
+		}
+		if _, err := out.WriteAt(data, int64(index)*int64(r.hdr.BlockSize)); err != nil {
+			return Stats{}, fmt.Errorf("writing %s: %w", dst, err)
+		}
+		written += int64(len(data))
+		if progress != nil {
+			progress(written, total)
+		}
+	}
+	if err := out.Sync(); err != nil {
+		return Stats{}, fmt.Errorf("writing %s: %w", dst, err)
+	}
+
+	// Check the result as a whole
+	h := sha256.New()
+	var checked int64
+	buf := make([]byte, r.hdr.BlockSize)
+	for checked < stats.TargetSize {
+		n, err := out.ReadAt(buf[:min(int64(len(buf)), stats.TargetSize-checked)], checked)
+		h.Write(buf[:n])
+		checked += int64(n)
+		if err == io.EOF && checked < stats.TargetSize {
+			return Stats{}, fmt.Errorf("%s ends after %s, short of the target image", dst, util.FormatBytes(checked))
+		}
+		if err != nil && err != io.EOF {
+			return Stats{}, fmt.Errorf("reading %s: %w", dst, err)
+		}
+		if progress != nil {
+			progress(written+checked, total)
+		}
+	}
+	if !bytes.Equal(h.Sum(nil), targetSum[:]) {
+		return Stats{}, fmt.Errorf("%s does not match the target image after the update: it did not hold the base image outside the changed blocks", dst)
+	}
+	return stats, nil
+}
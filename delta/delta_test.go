@@ -0,0 +1,148 @@
+package delta
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testBlock = 4096
+
+// testImages writes a base image and a target differing from it in two blocks
+// and returns their paths and the target's content.
+func testImages(t *testing.T, dir string) (base, target string, want []byte) {
+	t.Helper()
+	data := make([]byte, 16*testBlock+100)
+	rand.New(rand.NewSource(1)).Read(data)
+	base = filepath.Join(dir, "base.img")
+	if err := os.WriteFile(base, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	want = append([]byte(nil), data...)
+	want[3*testBlock] ^= 0xff
+	want[len(want)-1] ^= 0xff
+	target = filepath.Join(dir, "target.img")
+	if err := os.WriteFile(target, want, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return base, target, want
+}
+
+// copyFile copies src to a new file dst.
+func copyFile(t *testing.T, src, dst string) {
+	t.Helper()
+	if err := os.WriteFile(dst, mustRead(t, src), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	base, target, want := testImages(t, dir)
+	deltaPath := filepath.Join(dir, "update.hdelta")
+	created, err := Create(base, target, deltaPath, testBlock, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.ChangedBlocks != 2 {
+		t.Errorf("changed blocks = %d, want 2", created.ChangedBlocks)
+	}
+
+	info, err := Inspect(deltaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info != created {
+		t.Errorf("info = %+v, want %+v", info, created)
+	}
+
+	device := filepath.Join(dir, "device.img")
+	copyFile(t, base, device)
+	if _, err := Apply(deltaPath, device, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(device); !bytes.Equal(got, want) {
+		t.Error("device differs from the target image")
+	}
+}
+
+func TestApplyMismatchingBase(t *testing.T) {
+	dir := t.TempDir()
+	base, target, _ := testImages(t, dir)
+	deltaPath := filepath.Join(dir, "update.hdelta")
+	if _, err := Create(base, target, deltaPath, testBlock, nil); err != nil {
+		t.Fatal(err)
+	}
+	data := mustRead(t, base)
+
+	// A changed block differs: nothing is written
+	changed := append([]byte(nil), data...)
+	changed[3*testBlock+1] ^= 0xff
+	device := filepath.Join(dir, "changed.img")
+	if err := os.WriteFile(device, changed, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Apply(deltaPath, device, nil); err == nil || !strings.Contains(err.Error(), "nothing was written") {
+		t.Errorf("expected the base check to fail, got %v", err)
+	}
+	if got, _ := os.ReadFile(device); !bytes.Equal(got, changed) {
+		t.Error("device written despite the failed base check")
+	}
+
+	// An unchanged block differs: the check of the result fails
+	unchanged := append([]byte(nil), data...)
+	unchanged[5*testBlock] ^= 0xff
+	device = filepath.Join(dir, "unchanged.img")
+	if err := os.WriteFile(device, unchanged, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Apply(deltaPath, device, nil); err == nil || !strings.Contains(err.Error(), "does not match the target image") {
+		t.Errorf("expected the target check to fail, got %v", err)
+	}
+}
+
+func TestCorruptDelta(t *testing.T) {
+	dir := t.TempDir()
+	base, target, _ := testImages(t, dir)
+	deltaPath := filepath.Join(dir, "update.hdelta")
+	if _, err := Create(base, target, deltaPath, testBlock, nil); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(deltaPath)
+	// Damage the gzip CRC of the stream, after the trailer
+	data[len(data)-8] ^= 0xff
+	if err := os.WriteFile(deltaPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Inspect(deltaPath); err == nil {
+		t.Error("corrupt delta accepted by Inspect")
+	}
+	device := filepath.Join(dir, "device.img")
+	copyFile(t, base, device)
+	if _, err := Apply(deltaPath, device, nil); err == nil {
+		t.Error("corrupt delta applied")
+	}
+	if got, _ := os.ReadFile(device); !bytes.Equal(got, mustRead(t, base)) {
+		t.Error("device written from a corrupt delta")
+	}
+}
+
+func TestCreateRejectsLargeBlocks(t *testing.T) {
+	dir := t.TempDir()
+	base, target, _ := testImages(t, dir)
+	if _, err := Create(base, target, filepath.Join(dir, "update.hdelta"), MaxBlockSize+1, nil); err == nil {
+		t.Error("block size above the maximum accepted")
+	}
+}
+
+func mustRead(t *testing.T, path string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
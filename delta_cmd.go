@@ -0,0 +1,103 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/husarion/husarion-os-flasher/delta"
+	"github.com/husarion/husarion-os-flasher/util"
+)
+
+const deltaUsage = `Usage:
+  husarion-os-flasher delta create --base OLD.img[.xz] --target NEW.img[.xz] -o UPDATE.hdelta
+  husarion-os-flasher delta apply --delta UPDATE.hdelta --device /dev/sdX
+  husarion-os-flasher delta info UPDATE.hdelta
+`
+
+// printProgress renders a single updating progress line on stderr.
+func printProgress(label string) delta.Progress {
+	last := -1
+	return func(done, total int64) {
+		if total <= 0 {
+			return
+		}
+		if pct := int(done * 100 / total); pct != last {
+			last = pct
+			fmt.Fprintf(os.Stderr, "\r%s: %3d%% (%s / %s)", label, pct, util.FormatBytes(done), util.FormatBytes(total))
+		}
+	}
+}
+
+// printDeltaStats prints a summary of a delta.
+func printDeltaStats(stats delta.Stats) {
+	fmt.Printf("Base size:      %s\n", util.FormatBytes(stats.BaseSize))
+	fmt.Printf("Target size:    %s\n", util.FormatBytes(stats.TargetSize))
+	fmt.Printf("Block size:     %s\n", util.FormatBytes(int64(stats.BlockSize)))
+	fmt.Printf("Changed blocks: %d (%s)\n", stats.ChangedBlocks, util.FormatBytes(stats.ChangedBytes))
+}
+
+// runDeltaCommand implements the "delta" tool mode and returns the exit code.
+func runDeltaCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, deltaUsage)
+		return exitUsage
+	}
+
+	switch args[0] {
+	case "create":
+		fs := flag.NewFlagSet("delta create", flag.ExitOnError)
+		base := fs.String("base", "", "Image currently on the devices")
+		target := fs.String("target", "", "New image version")
+		out := fs.String("o", "", "Output delta file")
+		blockSize := fs.Int("block-size", delta.DefaultBlockSize, "Block size in bytes (at most 64 MiB)")
+		fs.Parse(args[1:])
+		if *base == "" || *target == "" || *out == "" {
+			fmt.Fprint(os.Stderr, deltaUsage)
+			return exitUsage
+		}
+		stats, err := delta.Create(*base, *target, *out, *blockSize, printProgress("Creating delta"))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return failed(err)
+		}
+		printDeltaStats(stats)
+		if info, err := os.Stat(*out); err == nil {
+			fmt.Printf("Delta file:     %s (%s)\n", *out, util.FormatBytes(info.Size()))
+		}
+		return exitOK
+
+	case "apply":
+		fs := flag.NewFlagSet("delta apply", flag.ExitOnError)
+		deltaPath := fs.String("delta", "", "Delta file to apply")
+		device := fs.String("device", "", "Device (or image file) holding the base image")
+		fs.Parse(args[1:])
+		if *deltaPath == "" || *device == "" {
+			fmt.Fprint(os.Stderr, deltaUsage)
+			return exitUsage
+		}
+		stats, err := delta.Apply(*deltaPath, *device, printProgress("Applying delta"))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return failed(err)
+		}
+		printDeltaStats(stats)
+		fmt.Printf("%s updated successfully\n", *device)
+		return exitOK
+
+	case "info":
+		if len(args) != 2 {
+			fmt.Fprint(os.Stderr, deltaUsage)
+			return exitUsage
+		}
+		stats, err := delta.Inspect(args[1])
+		if err != nil {
+			return failed(err)
+		}
+		printDeltaStats(stats)
+		return exitOK
+	}
+
+	fmt.Fprint(os.Stderr, deltaUsage)
+	return exitUsage
+}
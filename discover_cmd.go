@@ -0,0 +1,117 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/husarion/husarion-os-flasher/util"
+)
+
+const discoverUsage = `Usage:
+  husarion-os-flasher discover
+`
+
+// station is a flasher found on the local network.
+type station struct {
+	Name    string
+	Host    string
+	Address string
+	Port    int
+	Version string
+}
+
+// unescapeAvahi decodes the escapes of avahi-browse --parsable output: \DDD
+// for a decimal byte value and a backslash before any other character.
+func unescapeAvahi(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 >= len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+3 < len(s) {
+			if n, err := strconv.Atoi(s[i+1 : i+4]); err == nil && n < 256 {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i+1])
+		i++
+	}
+	return b.String()
+}
+
+// parseAvahiBrowse returns the resolved stations in avahi-browse --resolve
+// --parsable output, once per address.
+func parseAvahiBrowse(out string) []station {
+	var stations []station
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(out, "\n") {
+		// =;interface;protocol;name;type;domain;host;address;port;txt
+		fields := strings.SplitN(line, ";", 10)
+		if len(fields) < 9 || fields[0] != "=" {
+			continue
+		}
+		s := station{
+			Name:    unescapeAvahi(fields[3]),
+			Host:    fields[6],
+			Address: fields[7],
+		}
+		s.Port, _ = strconv.Atoi(fields[8])
+		if len(fields) == 10 {
+			for _, txt := range strings.Fields(fields[9]) {
+				if v, ok := strings.CutPrefix(strings.Trim(txt, `"`), "version="); ok {
+					s.Version = v
+				}
+			}
+		}
+		key := s.Name + ";" + s.Address
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		stations = append(stations, s)
+	}
+	return stations
+}
+
+// runDiscoverCommand implements the "discover" tool mode: it lists the stations
+// announced on the local network and returns the exit code.
+func runDiscoverCommand(args []string) int {
+	fs := flag.NewFlagSet("discover", flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, discoverUsage) }
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fmt.Fprint(os.Stderr, discoverUsage)
+		return exitUsage
+	}
+
+	if _, err := exec.LookPath("avahi-browse"); err != nil {
+		fmt.Fprintln(os.Stderr, "Error: discover needs avahi-browse (avahi-utils) and a running avahi-daemon")
+		return exitFailure
+	}
+	out, err := util.Command("avahi-browse", "--resolve", "--parsable", "--terminate", mdnsServiceType).Output()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error: avahi-browse:", err)
+		return exitFailure
+	}
+
+	stations := parseAvahiBrowse(string(out))
+	if len(stations) == 0 {
+		fmt.Println("No stations found.")
+		return exitOK
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tHOST\tADDRESS\tVERSION\tCONNECT")
+	for _, s := range stations {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\tssh -p %d %s\n", s.Name, s.Host, s.Address, s.Version, s.Port, s.Address)
+	}
+	w.Flush()
+	return exitOK
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/husarion/husarion-os-flasher/config"
+	"github.com/husarion/husarion-os-flasher/internal/flash"
+	"github.com/husarion/husarion-os-flasher/platform"
+	"github.com/husarion/husarion-os-flasher/ui"
+	"github.com/husarion/husarion-os-flasher/util"
+)
+
+const doctorUsage = `Usage:
+  husarion-os-flasher doctor [--os-img-path DIR] [--config FILE] [--host-key FILE] [--json]
+
+Checks privileges, the clock, tools, the config, device access, the image directory and
+its free space, and the SSH host key. --json prints the checks as a JSON
+object instead, with the overall status. The exit code is 1 when any check
+failed.
+`
+
+// containerRunHint shows the mounts a containerized flasher needs.
+const containerRunHint = `docker run -it --privileged -v /dev:/dev -v /run/udev:/run/udev:ro \
+  -v /path/to/images:/os-images husarion-os-flasher`
+
+// Check results, in increasing severity.
+const (
+	checkOK   = "ok"
+	checkWarn = "warn"
+	checkFail = "fail"
+)
+
+// doctorCheck is the outcome of one environment check.
+type doctorCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+	Hint   string `json:"hint,omitempty"`
+}
+
+// doctorReport is the output of doctor --json.
+type doctorReport struct {
+	Status string        `json:"status"` // of the most severe check
+	Checks []doctorCheck `json:"checks"`
+}
+
+// runDoctorChecks inspects the host (or container) the flasher runs in. cfg is
+// the loaded config, nil when loading it failed with cfgErr.
+func runDoctorChecks(osImgPath, hostKeyPath string, cfg *config.Config, cfgErr error) []doctorCheck {
+	var checks []doctorCheck
+	inContainer := platform.InContainer()
+
+	env := doctorCheck{Name: "Environment", Status: checkOK, Detail: runtime.GOOS + "/" + runtime.GOARCH}
+	if inContainer {
+		env.Detail += ", running in a container"
+	}
+	checks = append(checks, env)
+
+	priv := doctorCheck{Name: "Privileges", Status: checkOK, Detail: "running as " + util.PrivilegedUser}
+	if !util.IsPrivileged() {
+		priv.Status = checkFail
+		priv.Detail = "not running as " + util.PrivilegedUser
+		if inContainer {
+			priv.Hint = "start the container with --privileged and without --user"
+		}
+	}
+	checks = append(checks, priv)
+
+	clock := doctorCheck{Name: "Clock", Status: checkOK, Detail: time.Now().Format(time.RFC3339)}
+	if synced, reason := ui.ClockStatus(); !synced {
+		clock.Status = checkWarn
+		clock.Detail = reason + "; reports are marked \"unsynced clock\""
+		clock.Hint = "enable NTP with timedatectl set-ntp true, or fit a real-time clock"
+	}
+	checks = append(checks, clock)
+
+	var missing []string
+	for _, tool := range platform.RequiredTools {
+		if _, err := exec.LookPath(tool); err != nil {
+			missing = append(missing, tool)
+		}
+	}
+	tools := doctorCheck{Name: "Tools", Status: checkOK, Detail: strings.Join(platform.RequiredTools, ", ")}
+	if len(missing) > 0 {
+		tools.Status = checkFail
+		tools.Detail = "missing " + strings.Join(missing, ", ")
+		if inContainer {
+			tools.Hint = "use the provided Dockerfile or install them in the image"
+		}
+	}
+	checks = append(checks, tools)
+
+	var features []string
+	for _, ft := range platform.FeatureTools {
+		if _, err := exec.LookPath(ft.Tool); err != nil {
+			features = append(features, ft.Tool+" ("+ft.Feature+")")
+		}
+	}
+	if len(features) > 0 {
+		checks = append(checks, doctorCheck{
+			Name:   "Feature tools",
+			Status: checkWarn,
+			Detail: "missing " + strings.Join(features, ", "),
+			Hint:   "flashing works without them; install them for the features listed",
+		})
+	}
+
+	conf := doctorCheck{Name: "Config", Status: checkOK}
+	switch {
+	case cfgErr != nil:
+		conf.Status = checkFail
+		conf.Detail = cfgErr.Error()
+	case cfg.Path == "":
+		conf.Detail = "none, using the defaults"
+	default:
+		conf.Detail = cfg.Path
+	}
+	checks = append(checks, conf)
+
+	devices := doctorCheck{Name: "Devices", Status: checkOK}
+	list, err := platform.Current.Devices()
+	if err != nil {
+		devices.Status = checkFail
+		devices.Detail = err.Error()
+	} else if len(list) == 0 {
+		devices.Status = checkWarn
+		devices.Detail = "no removable devices found"
+		if inContainer {
+			devices.Hint = "the host /dev must be mounted: " + containerRunHint
+		}
+	} else {
+		devices.Detail = strings.Join(list, ", ")
+	}
+	checks = append(checks, devices)
+
+	if len(list) > 0 {
+		access := doctorCheck{Name: "Device access", Status: checkOK, Detail: "all devices can be opened"}
+		var denied []string
+		for _, dev := range list {
+			f, err := os.Open(dev)
+			if err != nil {
+				denied = append(denied, err.Error())
+				continue
+			}
+			f.Close()
+		}
+		if len(denied) > 0 {
+			access.Status = checkFail
+			access.Detail = strings.Join(denied, "; ")
+			if !util.IsPrivileged() {
+				access.Hint = "run the flasher as " + util.PrivilegedUser
+			}
+		}
+		checks = append(checks, access)
+	}
+
+	if inContainer && runtime.GOOS == "linux" {
+		// Without a recognizable system disk the host's own disk could be listed
+		sys := doctorCheck{Name: "System disk", Status: checkOK}
+		roots, err := platform.Current.RootDevices()
+		var names []string
+		for name := range roots {
+			if _, err := os.Stat("/sys/block/" + name); err == nil {
+				names = append(names, name)
+			}
+		}
+		if err != nil || len(names) == 0 {
+			sys.Status = checkWarn
+			sys.Detail = "the host system disk could not be identified and may be listed"
+			sys.Hint = "make sure the host system disk is not listed under Devices before flashing"
+		} else {
+			sys.Detail = "hiding " + strings.Join(names, ", ")
+		}
+		checks = append(checks, sys)
+	}
+
+	images := doctorCheck{Name: "Images", Status: checkOK}
+	if list, err := flash.GetImageFiles(osImgPath); err != nil {
+		images.Status = checkFail
+		images.Detail = err.Error()
+	} else if len(list) == 0 {
+		images.Status = checkWarn
+		images.Detail = "no images in " + osImgPath
+	} else {
+		images.Detail = fmt.Sprintf("%d in %s", len(list), osImgPath)
+	}
+	if images.Status != checkOK && inContainer {
+		images.Hint = "mount the image directory, e.g. -v /path/to/images:/os-images"
+	}
+	checks = append(checks, images)
+
+	if free, err := platform.FreeSpace(osImgPath); err == nil {
+		space := doctorCheck{Name: "Disk space", Status: checkOK, Detail: util.FormatBytes(free) + " free in " + osImgPath}
+		// Extracting the largest image must fit next to it
+		var largest int64
+		var name string
+		images, _ := flash.GetImageFiles(osImgPath)
+		for _, img := range images {
+			if !flash.IsCompressed(img) {
+				continue
+			}
+			if size, _ := flash.RawSize(img); size > largest {
+				largest, name = size, filepath.Base(img)
+			}
+		}
+		if largest > free {
+			space.Status = checkWarn
+			space.Detail += fmt.Sprintf(", extracting %s needs %s", name, util.FormatBytes(largest))
+			space.Hint = "free up space, e.g. with P in the UI to prune old images"
+		}
+		checks = append(checks, space)
+	}
+
+	key := doctorCheck{Name: "SSH host key", Status: checkOK, Detail: hostKeyPath}
+	if st, err := os.Stat(hostKeyPath); errors.Is(err, os.ErrNotExist) {
+		key.Status = checkWarn
+		key.Detail = hostKeyPath + " missing"
+		key.Hint = "it is generated on the first start with --enable-ssh"
+	} else if err != nil {
+		key.Status = checkFail
+		key.Detail = err.Error()
+	} else if runtime.GOOS != "windows" && st.Mode().Perm()&0o077 != 0 {
+		key.Status = checkWarn
+		key.Detail = fmt.Sprintf("%s is readable by other users (%v)", hostKeyPath, st.Mode().Perm())
+		key.Hint = "chmod 600 " + hostKeyPath
+	}
+	checks = append(checks, key)
+
+	return checks
+}
+
+// runDoctorCommand implements the "doctor" tool mode and returns the exit code:
+// 1 when any check failed.
+func runDoctorCommand(args []string) int {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, doctorUsage) }
+	osImgPath := fs.String("os-img-path", ".", "Path to OS image files directory")
+	configPath := fs.String("config", config.DefaultPath, "Path to YAML config file")
+	hostKeyPath := fs.String("host-key", defaultHostKeyPath, "Path to the SSH host key")
+	asJSON := fs.Bool("json", false, "Print the checks as JSON")
+	fromEnv, err := applyEnv(fs)
+	if err != nil {
+		return failed(err)
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fmt.Fprint(os.Stderr, doctorUsage)
+		return exitUsage
+	}
+
+	cfg, cfgErr := loadConfig(fs, *configPath, fromEnv)
+	checks := runDoctorChecks(*osImgPath, *hostKeyPath, cfg, cfgErr)
+	if *asJSON {
+		report := doctorReport{Status: checkOK, Checks: checks}
+		for _, c := range checks {
+			if c.Status == checkFail || c.Status == checkWarn && report.Status == checkOK {
+				report.Status = c.Status
+			}
+		}
+		if err := writeJSON(os.Stdout, report); err != nil {
+			return failed(err)
+		}
+		if report.Status == checkFail {
+			return exitFailure
+		}
+		return exitOK
+	}
+
+	code := exitOK
+	for _, c := range checks {
+		fmt.Printf("%-4s  %-13s %s\n", strings.ToUpper(c.Status), c.Name, c.Detail)
+		if c.Hint != "" {
+			fmt.Printf("      %-13s %s\n", "", c.Hint)
+		}
+		if c.Status == checkFail {
+			code = exitFailure
+		}
+	}
+	if platform.InContainer() {
+		fmt.Printf("\nRequired container mounts:\n%s\n", containerRunHint)
+	}
+	return code
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/husarion/husarion-os-flasher/config"
+	"github.com/husarion/husarion-os-flasher/ui"
+)
+
+const downloadUsage = `Usage:
+  husarion-os-flasher download [--os-img-path DIR] [--config FILE] [NAME...]
+
+Downloads the named images, or else every image missing from DIR, from the
+mirrors listed for them in DIR/catalog.yaml. The SHA256SUMS of the mirrors are
+cross-checked with each other and with the sha256 of the catalog first; a
+mirror that fails or stalls is replaced by the next one, which resumes the
+download. Downloads go through the proxy of the config, or else of HTTP_PROXY
+and HTTPS_PROXY, and are refused in offline mode. Progress is printed on
+stderr and the paths of the images on stdout.
+` + exitCodesUsage
+
+// runDownloadCommand downloads catalog images from their mirrors.
+func runDownloadCommand(args []string) int {
+	fs := flag.NewFlagSet("download", flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, downloadUsage) }
+	osImgPath := fs.String("os-img-path", ".", "Path to OS image files directory")
+	configPath := fs.String("config", config.DefaultPath, "Path to YAML config file")
+	fromEnv, err := applyEnv(fs)
+	if err != nil {
+		return failed(err)
+	}
+	fs.Parse(args)
+	cfg, err := loadConfig(fs, *configPath, fromEnv)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error loading config:", err)
+		return exitFailure
+	}
+
+	paths, err := ui.DownloadImages(cfg, *osImgPath, fs.Args(), ui.ConsoleOperator(), os.Stderr, interrupted())
+	for _, path := range paths {
+		fmt.Println(path)
+	}
+	if err != nil {
+		return failed(err)
+	}
+	if len(paths) == 0 {
+		fmt.Fprintln(os.Stderr, "Every image of the catalog is already downloaded.")
+	}
+	return exitOK
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"syscall"
+
+	"github.com/husarion/husarion-os-flasher/internal/flash"
+	"github.com/husarion/husarion-os-flasher/ui"
+)
+
+// Exit codes of the subcommands and remote commands, so that wrapper scripts
+// can tell failures apart.
+const (
+	exitOK           = 0
+	exitFailure      = 1 // any other failure
+	exitUsage        = 2
+	exitNotFound     = 3 // the device or image does not exist
+	exitVerifyFailed = 4 // the image or the written device is not intact
+	exitAborted      = 5 // stopped by Ctrl+C, SIGTERM or a closed connection
+	exitNoSpace      = 6 // the device or the image directory is full
+	exitToolMissing  = 7 // a program the job runs is not installed
+	exitDenied       = 8 // the command is reserved to admins
+)
+
+// exitCodesUsage lists the exit codes in the usage of the commands.
+const exitCodesUsage = `
+Exit codes: 0 success, 1 failure, 2 usage error, 3 device or image not found,
+4 verification failed, 5 aborted, 6 no space left, 7 tool missing,
+8 reserved to admins.
+`
+
+// errNotFound matches the errors of devices and images that do not exist.
+var errNotFound = errors.New("not found")
+
+// notFoundError is the error of a device or image that does not exist.
+type notFoundError struct{ error }
+
+func (notFoundError) Is(target error) bool { return target == errNotFound }
+
+// Messages of failures that only reach the flasher as the text of a tool.
+var (
+	noSpaceOutput     = regexp.MustCompile(`(?i)no space left on device`)
+	toolMissingOutput = regexp.MustCompile(`(?i)command not found|exit status 127\b`)
+)
+
+// exitCode returns the exit code of a failed command.
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	text := err.Error()
+	var jobErr *ui.JobError
+	if errors.As(err, &jobErr) {
+		text += "\n" + strings.Join(jobErr.Output, "\n")
+	}
+	switch {
+	case errors.Is(err, errNotFound):
+		return exitNotFound
+	case errors.Is(err, flash.ErrMismatch):
+		return exitVerifyFailed
+	case errors.Is(err, ui.ErrAborted):
+		return exitAborted
+	case errors.Is(err, syscall.ENOSPC), noSpaceOutput.MatchString(text):
+		return exitNoSpace
+	case errors.Is(err, exec.ErrNotFound), toolMissingOutput.MatchString(text):
+		return exitToolMissing
+	}
+	return exitFailure
+}
+
+// failed prints the error of a command and returns its exit code.
+func failed(err error) int {
+	fmt.Fprintln(os.Stderr, "Error:", err)
+	return exitCode(err)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/husarion/husarion-os-flasher/internal/flash"
+	"github.com/husarion/husarion-os-flasher/ui"
+)
+
+const verifyUsage = `Usage:
+  husarion-os-flasher verify [--os-img-path DIR] IMAGE
+
+Checks the integrity of IMAGE, a path or the name of an image in DIR, as Check
+does in the UI: compressed images are tested by their decompressor, raw images
+are compared with their checksum sidecar. Progress is printed on stderr and the
+result is recorded in integrity.yaml.
+` + exitCodesUsage
+
+const extractUsage = `Usage:
+  husarion-os-flasher extract [--os-img-path DIR] [--output FILE] IMAGE
+
+Decompresses IMAGE, a path or the name of an image in DIR, next to it or to
+FILE, replacing any previous output. Progress is printed on stderr.
+` + exitCodesUsage
+
+// runVerifyCommand checks the integrity of an image.
+func runVerifyCommand(args []string) int {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, verifyUsage) }
+	osImgPath := fs.String("os-img-path", ".", "Path to OS image files directory")
+	if _, err := applyEnv(fs); err != nil {
+		return failed(err)
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Fprint(os.Stderr, verifyUsage)
+		return exitUsage
+	}
+	image, err := commandImage(*osImgPath, fs.Arg(0))
+	if err != nil {
+		return failed(err)
+	}
+
+	ok, err := ui.CheckImage(image, os.Stderr, interrupted())
+	if err != nil {
+		return failed(err)
+	}
+	if !ok {
+		fmt.Println("Integrity FAILED")
+		return exitVerifyFailed
+	}
+	fmt.Println("Integrity OK")
+	return exitOK
+}
+
+// runExtractCommand decompresses an image.
+func runExtractCommand(args []string) int {
+	fs := flag.NewFlagSet("extract", flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, extractUsage) }
+	osImgPath := fs.String("os-img-path", ".", "Path to OS image files directory")
+	output := fs.String("output", "", "Path of the decompressed image (default: next to the image)")
+	if _, err := applyEnv(fs); err != nil {
+		return failed(err)
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Fprint(os.Stderr, extractUsage)
+		return exitUsage
+	}
+	image, err := commandImage(*osImgPath, fs.Arg(0))
+	if err != nil {
+		return failed(err)
+	}
+	if !flash.IsCompressed(image) {
+		fmt.Fprintf(os.Stderr, "Error: %s is not compressed\n", image)
+		return exitFailure
+	}
+	if *output == "" {
+		*output = flash.ExtractedPath(image)
+	}
+
+	if err := ui.ExtractImage(image, *output, os.Stderr, interrupted()); err != nil {
+		return failed(err)
+	}
+	fmt.Println(*output)
+	return exitOK
+}
+
+// commandImage returns the image a command names: a file, or an image of
+// osImgPath such as a split image listed once.
+func commandImage(osImgPath, name string) (string, error) {
+	if st, err := os.Stat(name); err == nil && !st.IsDir() {
+		return name, nil
+	} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+	return resolveImage(osImgPath, name)
+}
+
+// interrupted returns a channel closed on the first SIGINT or SIGTERM, which
+// aborts the job of a command.
+func interrupted() <-chan struct{} {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	abort := make(chan struct{})
+	go func() {
+		<-sig
+		signal.Stop(sig)
+		close(abort)
+	}()
+	return abort
+}
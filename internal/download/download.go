@@ -0,0 +1,308 @@
+// Package download fetches images listed in a catalog from one or more
+// mirrors. The SHA256SUMS published next to the image on each mirror is
+// cross-checked against the others and against the catalog before anything is
+// fetched, so one stale or tampered mirror cannot serve a different image. A
+// mirror that fails or stalls is dropped for the next one, which resumes where
+// it stopped, and the image is only renamed into place once its SHA-256 matches.
+package download
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/husarion/husarion-os-flasher/internal/flash"
+	"github.com/husarion/husarion-os-flasher/util"
+)
+
+// PartSuffix is appended to the file name of an image being downloaded.
+const PartSuffix = ".part"
+
+// StallTimeout is how long a mirror may go without sending anything before the
+// next one takes over.
+var StallTimeout = 30 * time.Second
+
+// ErrNoDigest is returned when neither the catalog nor any mirror gives the
+// SHA-256 of an image, which then cannot be checked.
+var ErrNoDigest = errors.New("no SHA-256 for the image: set sha256 in the catalog or publish a SHA256SUMS next to it")
+
+// NewClient returns the HTTP client of downloads, going through proxy when set
+// and else through the proxy of the HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+// environment variables. An unreachable mirror or proxy fails within seconds
+// rather than hanging.
+func NewClient(proxy string) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxy != "" {
+		u, err := url.Parse(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("proxy: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(u)
+	}
+	transport.DialContext = (&net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+	transport.TLSHandshakeTimeout = 10 * time.Second
+	transport.ResponseHeaderTimeout = StallTimeout
+	return &http.Client{Transport: transport}, nil
+}
+
+// Source is an image to download.
+type Source struct {
+	Name    string   // file name in the image directory
+	SHA256  string   // expected digest, empty to rely on the mirrors' SHA256SUMS
+	Mirrors []string // URLs of the image, tried in order
+}
+
+// Digest returns the SHA-256 the image must have and the mirrors agreeing with
+// it. A mirror whose SHA256SUMS gives another digest is left out; one without
+// a SHA256SUMS is kept, as the download is checked anyway. Without a digest in
+// the catalog the mirrors that publish one must all agree.
+func Digest(ctx context.Context, client *http.Client, src Source, out io.Writer) (string, []string, error) {
+	want := strings.ToLower(src.SHA256)
+	published := make(map[string]string) // mirror -> digest
+	for _, mirror := range src.Mirrors {
+		sum, err := manifestDigest(ctx, client, mirror)
+		if err != nil {
+			fmt.Fprintf(out, "%s: no SHA256SUMS (%v)\n", host(mirror), err)
+			continue
+		}
+		published[mirror] = sum
+	}
+
+	if want == "" {
+		for mirror, sum := range published {
+			if want == "" {
+				want = sum
+			} else if sum != want {
+				return "", nil, fmt.Errorf("%w: mirrors disagree on the SHA-256 of %s (%s has %s, another %s)",
+					flash.ErrMismatch, src.Name, host(mirror), sum, want)
+			}
+		}
+		if want == "" {
+			return "", nil, ErrNoDigest
+		}
+	}
+
+	var mirrors []string
+	for _, mirror := range src.Mirrors {
+		if sum, ok := published[mirror]; ok && sum != want {
+			fmt.Fprintf(out, "%s: skipped, its SHA256SUMS gives %s instead of %s\n", host(mirror), sum, want)
+			continue
+		}
+		mirrors = append(mirrors, mirror)
+	}
+	if len(mirrors) == 0 {
+		return "", nil, fmt.Errorf("%w: no mirror publishes the expected SHA-256 of %s", flash.ErrMismatch, src.Name)
+	}
+	return want, mirrors, nil
+}
+
+// manifestDigest returns the digest of the image at rawURL listed in the
+// SHA256SUMS of the same directory.
+func manifestDigest(ctx context.Context, client *http.Client, rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	name := path.Base(u.Path)
+	u.Path = path.Join(path.Dir(u.Path), "SHA256SUMS")
+	u.RawQuery = ""
+	ctx, cancel := context.WithTimeout(ctx, StallTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s", resp.Status)
+	}
+	scanner := bufio.NewScanner(io.LimitReader(resp.Body, 1<<20))
+	for scanner.Scan() {
+		// "<hash>  <name>" or "<hash> *<name>" (binary mode)
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("%s is not listed", name)
+}
+
+// Fetch downloads src into dir, trying its mirrors in turn, and returns the
+// path of the image. The image is written to <name>.part, which a later Fetch
+// resumes, and renamed once its SHA-256 matches. Progress lines are written to
+// out.
+func Fetch(ctx context.Context, client *http.Client, src Source, dir string, out io.Writer) (string, error) {
+	if len(src.Mirrors) == 0 {
+		return "", fmt.Errorf("%s has no mirrors", src.Name)
+	}
+	want, mirrors, err := Digest(ctx, client, src, out)
+	if err != nil {
+		return "", err
+	}
+	dst := filepath.Join(dir, src.Name)
+	part := dst + PartSuffix
+	var errs []error
+	for _, mirror := range mirrors {
+		if err := fetchFrom(ctx, client, mirror, part, out); err != nil {
+			if ctx.Err() != nil {
+				return "", ctx.Err()
+			}
+			fmt.Fprintf(out, "%s: %v, trying the next mirror\n", host(mirror), err)
+			errs = append(errs, fmt.Errorf("%s: %w", host(mirror), err))
+			continue
+		}
+		got, err := fileDigest(part)
+		if err != nil {
+			return "", err
+		}
+		if got != want {
+			// Whatever went wrong may have been resumed from a bad part, so
+			// the next mirror starts over. The bad part is kept for inspection.
+			if moved, err := flash.Quarantine(part); err == nil {
+				fmt.Fprintf(out, "%s: SHA-256 mismatch, moved the download to %s, trying the next mirror\n", host(mirror), moved)
+			} else {
+				os.Remove(part)
+				fmt.Fprintf(out, "%s: SHA-256 mismatch, trying the next mirror\n", host(mirror))
+			}
+			errs = append(errs, fmt.Errorf("%s: %w: SHA-256 is %s, expected %s", host(mirror), flash.ErrMismatch, got, want))
+			continue
+		}
+		if err := os.Rename(part, dst); err != nil {
+			return "", err
+		}
+		fmt.Fprintf(out, "%s: SHA-256 verified\n", src.Name)
+		return dst, nil
+	}
+	return "", fmt.Errorf("every mirror of %s failed: %w", src.Name, errors.Join(errs...))
+}
+
+// fetchFrom appends the image at rawURL to part, from its current size on.
+func fetchFrom(ctx context.Context, client *http.Client, rawURL, part string, out io.Writer) error {
+	f, err := os.OpenFile(part, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stall := time.AfterFunc(StallTimeout, cancel)
+	defer stall.Stop()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return stalled(ctx, err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case offset > 0 && resp.StatusCode == http.StatusPartialContent:
+		fmt.Fprintf(out, "%s: resuming at %s\n", host(rawURL), util.FormatBytes(offset))
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		// The part is already complete
+		return nil
+	case resp.StatusCode == http.StatusOK:
+		if offset > 0 {
+			// The mirror ignores ranges
+			if err := f.Truncate(0); err != nil {
+				return err
+			}
+			offset = 0
+		}
+		fmt.Fprintf(out, "%s: downloading\n", host(rawURL))
+	default:
+		return fmt.Errorf("%s", resp.Status)
+	}
+
+	total := offset + resp.ContentLength
+	written := offset
+	lastReport := time.Now()
+	buf := make([]byte, 1<<20)
+	for {
+		n, rerr := resp.Body.Read(buf)
+		if n > 0 {
+			stall.Reset(StallTimeout)
+			if _, err := f.Write(buf[:n]); err != nil {
+				return err
+			}
+			written += int64(n)
+			if time.Since(lastReport) >= 5*time.Second {
+				lastReport = time.Now()
+				if resp.ContentLength > 0 {
+					fmt.Fprintf(out, "%s of %s (%d%%)\n", util.FormatBytes(written), util.FormatBytes(total), written*100/total)
+				} else {
+					fmt.Fprintf(out, "%s\n", util.FormatBytes(written))
+				}
+			}
+		}
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			return stalled(ctx, rerr)
+		}
+	}
+	if resp.ContentLength > 0 && written != total {
+		return fmt.Errorf("connection closed after %s of %s", util.FormatBytes(written), util.FormatBytes(total))
+	}
+	return f.Sync()
+}
+
+// stalled replaces the error of a request cancelled by the stall timer.
+func stalled(ctx context.Context, err error) error {
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return fmt.Errorf("stalled for %s", StallTimeout)
+	}
+	return err
+}
+
+// fileDigest returns the SHA-256 of a file.
+func fileDigest(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// host returns the host of a mirror URL, to name it in messages.
+func host(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return rawURL
+}
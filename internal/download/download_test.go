@@ -0,0 +1,83 @@
+package download
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/husarion/husarion-os-flasher/internal/flash"
+)
+
+// mirror serves image as /img/test.img with a SHA256SUMS giving sum.
+func mirror(t *testing.T, image []byte, sum string, broken bool) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/img/SHA256SUMS":
+			io.WriteString(w, sum+"  test.img\n")
+		case "/img/test.img":
+			if broken {
+				http.Error(w, "broken", http.StatusInternalServerError)
+				return
+			}
+			http.ServeContent(w, r, "test.img", time.Time{}, bytes.NewReader(image))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestFetch(t *testing.T) {
+	image := bytes.Repeat([]byte("husarion"), 100000)
+	h := sha256.Sum256(image)
+	sum := hex.EncodeToString(h[:])
+
+	t.Run("failover", func(t *testing.T) {
+		dir := t.TempDir()
+		broken := mirror(t, image, sum, true)
+		good := mirror(t, image, sum, false)
+		// Half an image left by an earlier attempt is resumed
+		if err := os.WriteFile(filepath.Join(dir, "test.img"+PartSuffix), image[:len(image)/2], 0o644); err != nil {
+			t.Fatal(err)
+		}
+		src := Source{Name: "test.img", Mirrors: []string{broken.URL + "/img/test.img", good.URL + "/img/test.img"}}
+		path, err := Fetch(context.Background(), http.DefaultClient, src, dir, io.Discard)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _ := os.ReadFile(path)
+		if !bytes.Equal(got, image) {
+			t.Errorf("downloaded %d bytes differing from the image", len(got))
+		}
+	})
+
+	t.Run("disagreeing mirror skipped", func(t *testing.T) {
+		stale := mirror(t, []byte("stale"), "00"+sum[2:], false)
+		good := mirror(t, image, sum, false)
+		src := Source{Name: "test.img", SHA256: sum, Mirrors: []string{stale.URL + "/img/test.img", good.URL + "/img/test.img"}}
+		_, mirrors, err := Digest(context.Background(), http.DefaultClient, src, io.Discard)
+		if err != nil || len(mirrors) != 1 || mirrors[0] != src.Mirrors[1] {
+			t.Errorf("Digest() = %v, %v; want only the second mirror", mirrors, err)
+		}
+	})
+
+	t.Run("mirrors disagree", func(t *testing.T) {
+		a := mirror(t, image, sum, false)
+		b := mirror(t, image, "00"+sum[2:], false)
+		src := Source{Name: "test.img", Mirrors: []string{a.URL + "/img/test.img", b.URL + "/img/test.img"}}
+		_, err := Fetch(context.Background(), http.DefaultClient, src, t.TempDir(), io.Discard)
+		if !errors.Is(err, flash.ErrMismatch) {
+			t.Errorf("Fetch() error = %v, want a mismatch", err)
+		}
+	})
+}
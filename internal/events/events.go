@@ -0,0 +1,59 @@
+// Package events is a typed publish/subscribe bus. It decouples the modules
+// reacting to what happens in the flasher, such as the history, the audit log
+// or notifications, from the code where it happens.
+package events
+
+import "sync"
+
+// Bus delivers published events to the subscribers of their type.
+type Bus struct {
+	mu     sync.Mutex
+	nextID int
+	subs   []subscriber
+}
+
+type subscriber struct {
+	id      int
+	deliver func(any)
+}
+
+// New returns an empty bus.
+func New() *Bus {
+	return &Bus{}
+}
+
+// Subscribe calls fn with every event of type T published on b, until the
+// returned function is called.
+func Subscribe[T any](b *Bus, fn func(T)) (unsubscribe func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.nextID++
+	id := b.nextID
+	b.subs = append(b.subs, subscriber{id: id, deliver: func(e any) {
+		if t, ok := e.(T); ok {
+			fn(t)
+		}
+	}})
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		for i, s := range b.subs {
+			if s.id == id {
+				b.subs = append(b.subs[:i:i], b.subs[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Publish calls the subscribers of e's type in the order they subscribed,
+// before returning. Subscribers should be quick, and may publish or subscribe
+// themselves.
+func (b *Bus) Publish(e any) {
+	b.mu.Lock()
+	subs := b.subs
+	b.mu.Unlock()
+	for _, s := range subs {
+		s.deliver(e)
+	}
+}
@@ -0,0 +1,85 @@
+// Package firmware builds the commands flashing robot controller firmware over a
+// serial port, with stm32flash for STM32 boards such as the CORE2 and esptool for
+// ESP32 ones, and reads their progress output.
+package firmware
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+)
+
+// Tools that flash firmware.
+const (
+	STM32Flash = "stm32flash"
+	ESPTool    = "esptool"
+)
+
+// Tools are the accepted tool names.
+var Tools = []string{STM32Flash, ESPTool}
+
+// Job is a firmware to write to a controller.
+type Job struct {
+	Tool    string // STM32Flash or ESPTool
+	File    string // firmware binary
+	Port    string // serial port the controller's bootloader listens on
+	Baud    int    // 0 for the tool's default
+	Address string // flash offset: the start of flash when empty
+}
+
+// Command returns the program and arguments writing the firmware. stm32flash
+// verifies what it wrote and starts the new firmware; esptool resets the chip
+// after writing.
+func (j Job) Command() (string, []string, error) {
+	switch j.Tool {
+	case STM32Flash:
+		args := []string{"-w", j.File, "-v", "-g", "0x0"}
+		if j.Address != "" {
+			args = append(args, "-S", j.Address)
+		}
+		if j.Baud > 0 {
+			args = append(args, "-b", strconv.Itoa(j.Baud))
+		}
+		return "stm32flash", append(args, j.Port), nil
+	case ESPTool:
+		args := []string{"--chip", "auto", "--port", j.Port}
+		if j.Baud > 0 {
+			args = append(args, "--baud", strconv.Itoa(j.Baud))
+		}
+		address := j.Address
+		if address == "" {
+			address = "0x0"
+		}
+		return esptool(), append(args, "write_flash", address, j.File), nil
+	}
+	return "", nil, fmt.Errorf("unknown firmware tool %q", j.Tool)
+}
+
+// esptool returns the esptool program: "esptool" in recent packages, the
+// "esptool.py" script in older ones.
+func esptool() string {
+	if _, err := exec.LookPath("esptool"); err == nil {
+		return "esptool"
+	}
+	return "esptool.py"
+}
+
+// progressLines match the progress the tools print, e.g. stm32flash's
+// "Wrote and verified address 0x08012100 (52.33%)" and esptool's
+// "Writing at 0x00010000... (12 %)".
+var progressLines = []*regexp.Regexp{
+	regexp.MustCompile(`^Wrote .*address 0x[0-9a-fA-F]+ \(([0-9.]+)%\)`),
+	regexp.MustCompile(`^Writing at 0x[0-9a-fA-F]+\.*\s*\(([0-9.]+) ?%\)`),
+}
+
+// Progress returns the percentage written that a line of tool output reports.
+func Progress(line string) (float64, bool) {
+	for _, re := range progressLines {
+		if m := re.FindStringSubmatch(line); m != nil {
+			percent, err := strconv.ParseFloat(m[1], 64)
+			return percent, err == nil
+		}
+	}
+	return 0, false
+}
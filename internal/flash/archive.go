@@ -0,0 +1,132 @@
+package flash
+
+import (
+	"archive/zip"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// IsZip reports whether an image is a .zip archive holding a raw image.
+func IsZip(path string) bool {
+	if strings.HasSuffix(path, ".zip") {
+		return true
+	}
+	format, _ := patternFormat(path)
+	return format == FormatZip
+}
+
+// IsCompressed reports whether an image must be decompressed before it can
+// be written (xz, zstd, bzip2 or zip).
+func IsCompressed(path string) bool {
+	return IsXZ(path) || IsZstd(path) || IsBzip2(path) || IsZip(path)
+}
+
+// DecompressTool returns the program that decompresses an image, or "" for
+// raw images and zip archives, which are read in-process.
+func DecompressTool(path string) string {
+	switch {
+	case IsZip(path):
+		return ""
+	case IsXZ(path):
+		return "xz"
+	case IsZstd(path):
+		return "zstd"
+	case IsBzip2(path):
+		return "bzip2"
+	}
+	return ""
+}
+
+// ZipImageEntry returns the name and uncompressed size of the single raw image
+// inside a zip archive. Archives with no image or several images are rejected.
+func ZipImageEntry(path string) (string, int64, error) {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer r.Close()
+
+	var found *zip.File
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() || strings.HasPrefix(filepath.Base(f.Name), ".") || IsXZ(f.Name) || IsZstd(f.Name) || IsBzip2(f.Name) || !IsImageName(f.Name) {
+			continue
+		}
+		if found != nil {
+			return "", 0, fmt.Errorf("%s contains more than one image", filepath.Base(path))
+		}
+		found = f
+	}
+	if found == nil {
+		return "", 0, fmt.Errorf("%s does not contain an image", filepath.Base(path))
+	}
+	return found.Name, int64(found.UncompressedSize64), nil
+}
+
+// DecompressArgs returns the command line that writes the raw image of a
+// compressed image to stdout. For split images the command reads the joined
+// parts from stdin (see OpenFile).
+func DecompressArgs(path string) ([]string, error) {
+	if IsZip(path) {
+		inner, _, err := ZipImageEntry(path)
+		if err != nil {
+			return nil, err
+		}
+		return []string{"unzip", "-p", path, inner}, nil
+	}
+	// -T0 decompresses the blocks of a multi-block archive in parallel, with
+	// xz 5.4 and newer; older ones ignore it
+	args := []string{"xz", "-dc", "-T0"}
+	switch {
+	case IsZstd(path):
+		args = []string{"zstd", "-dcq"}
+	case IsBzip2(path):
+		args = []string{"bzip2", "-dc"}
+	}
+	if IsSplit(path) {
+		return args, nil
+	}
+	return append(args, path), nil
+}
+
+// ShellJoin quotes args for use in a bash -c pipeline.
+func ShellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = fmt.Sprintf("%q", a)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// ExtractedPath returns where extracting a compressed image writes its raw
+// image: next to the archive, named after the inner image for zips.
+func ExtractedPath(path string) string {
+	if IsZip(path) {
+		if inner, _, err := ZipImageEntry(path); err == nil {
+			return filepath.Join(filepath.Dir(path), filepath.Base(inner))
+		}
+		return withoutExt(path, ".zip")
+	}
+	switch {
+	case IsXZ(path):
+		return withoutExt(SplitBase(path), ".xz")
+	case IsZstd(path):
+		return withoutExt(SplitBase(path), ".zst")
+	case IsBzip2(path):
+		return withoutExt(SplitBase(path), ".bz2")
+	}
+	return SplitBase(path)
+}
+
+// withoutExt removes ext from path. Images matched by a configured pattern may
+// not end in ext: their last extension is replaced by .img instead, so the
+// result never names the compressed file itself.
+func withoutExt(path, ext string) string {
+	if trimmed, ok := strings.CutSuffix(path, ext); ok {
+		return trimmed
+	}
+	if filepath.Ext(path) == ".img" {
+		return path + ".img"
+	}
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".img"
+}
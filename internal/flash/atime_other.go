@@ -0,0 +1,14 @@
+//go:build !linux
+
+package flash
+
+import (
+	"os"
+	"time"
+)
+
+// accessTime returns the modification time: access times are not read on
+// other platforms.
+func accessTime(info os.FileInfo) time.Time {
+	return info.ModTime()
+}
@@ -0,0 +1,117 @@
+package flash
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"time"
+)
+
+// SectorSize is the unit bad areas of a burn-in are reported in.
+const SectorSize = 512
+
+// maxBadSectors is how many bad sectors of a pass are listed; the rest are
+// only counted.
+const maxBadSectors = 1000
+
+// BurnInPass is the outcome of one pass of a burn-in.
+type BurnInPass struct {
+	Number     int
+	Took       time.Duration
+	Bad        int64   // sectors that failed to write, read or match
+	BadSectors []int64 // the first maxBadSectors of them
+}
+
+// BurnIn qualifies a card by filling dev (size bytes) with pseudo-random data
+// and reading it back, pass after pass until duration has elapsed; a zero
+// duration runs a single pass. Every pass writes different data, so stale
+// blocks returned by a counterfeit or failing card do not match. progress gets
+// the pass, its phase ("writing" or "verifying") and how far it got. cancel
+// aborts the burn-in when closed, returning the passes completed.
+func BurnIn(dev *os.File, size int64, duration time.Duration, progress func(pass int, phase string, done, total int64, elapsed time.Duration), cancel <-chan struct{}) ([]BurnInPass, error) {
+	size = size / SectorSize * SectorSize
+	if size == 0 {
+		return nil, fmt.Errorf("device is empty")
+	}
+	// Flushing as it goes keeps the page cache from filling up with the card
+	out := SyncEvery(dev, 64<<20)
+	seed := uint64(time.Now().UnixNano())
+	buf := make([]byte, 4<<20)
+	want := make([]byte, len(buf))
+
+	var passes []BurnInPass
+	start := time.Now()
+	for n := 1; ; n++ {
+		p := BurnInPass{Number: n}
+		passStart := time.Now()
+		bad := func(off, length int64) {
+			for s := off / SectorSize; s < (off+length)/SectorSize; s++ {
+				p.Bad++
+				if len(p.BadSectors) < maxBadSectors {
+					p.BadSectors = append(p.BadSectors, s)
+				}
+			}
+		}
+
+		for off := int64(0); off < size; off += int64(len(buf)) {
+			select {
+			case <-cancel:
+				return passes, fmt.Errorf("aborted")
+			default:
+			}
+			chunk := buf[:min(int64(len(buf)), size-off)]
+			burnInPattern(chunk, seed, n, off)
+			if _, err := out.WriteAt(chunk, off); err != nil {
+				bad(off, int64(len(chunk)))
+			}
+			progress(n, "writing", off+int64(len(chunk)), size, time.Since(passStart))
+		}
+		if err := dev.Sync(); err != nil {
+			return passes, fmt.Errorf("sync failed: %w", err)
+		}
+		DropCache(dev)
+
+		verifyStart := time.Now()
+		for off := int64(0); off < size; off += int64(len(buf)) {
+			select {
+			case <-cancel:
+				return passes, fmt.Errorf("aborted")
+			default:
+			}
+			chunk := buf[:min(int64(len(buf)), size-off)]
+			expected := want[:len(chunk)]
+			burnInPattern(expected, seed, n, off)
+			if _, err := dev.ReadAt(chunk, off); err != nil {
+				bad(off, int64(len(chunk)))
+			} else {
+				for i := 0; i < len(chunk); i += SectorSize {
+					if !bytes.Equal(chunk[i:i+SectorSize], expected[i:i+SectorSize]) {
+						bad(off+int64(i), SectorSize)
+					}
+				}
+			}
+			progress(n, "verifying", off+int64(len(chunk)), size, time.Since(verifyStart))
+		}
+
+		p.Took = time.Since(passStart)
+		passes = append(passes, p)
+		if time.Since(start) >= duration {
+			return passes, nil
+		}
+	}
+}
+
+// burnInPattern fills data, which starts at off on the device, with the
+// pseudo-random bytes of a pass. Each sector depends on its offset, so a card
+// returning another sector's data is caught.
+func burnInPattern(data []byte, seed uint64, pass int, off int64) {
+	var r rand.PCG
+	for i := 0; i < len(data); i += SectorSize {
+		r.Seed(seed+uint64(pass), uint64(off)+uint64(i))
+		for j := i; j < i+SectorSize; j += 8 {
+			binary.LittleEndian.PutUint64(data[j:], r.Uint64())
+		}
+	}
+}
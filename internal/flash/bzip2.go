@@ -0,0 +1,14 @@
+package flash
+
+import "strings"
+
+// IsBzip2 reports whether an image (or split image part) is bzip2-compressed.
+// bzip2 records no uncompressed size, so progress and space checks of these
+// images are estimates.
+func IsBzip2(path string) bool {
+	if strings.HasSuffix(SplitBase(path), ".bz2") {
+		return true
+	}
+	format, _ := patternFormat(path)
+	return format == FormatBzip2
+}
@@ -0,0 +1,9 @@
+package flash
+
+import "golang.org/x/sys/unix"
+
+// DropCache evicts f's cached pages, so that reading it back reads the device
+// rather than what was just written to memory.
+func DropCache(f interface{ Fd() uintptr }) {
+	_ = unix.Fadvise(int(f.Fd()), 0, 0, unix.FADV_DONTNEED)
+}
@@ -0,0 +1,6 @@
+//go:build !linux
+
+package flash
+
+// DropCache is a no-op: raw devices on other platforms are not cached.
+func DropCache(f interface{ Fd() uintptr }) {}
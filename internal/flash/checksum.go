@@ -0,0 +1,38 @@
+package flash
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SidecarChecksum returns the expected SHA-256 of a raw image and the file it came
+// from. It looks at `<file>.checksum`, `<file>.sha256` and, as published next to
+// most ISO and WIC downloads, a SHA256SUMS file in the same directory. The path is
+// empty when no checksum was found.
+func SidecarChecksum(imagePath string) (string, string) {
+	imagePath = SplitBase(imagePath)
+	for _, path := range []string{imagePath + ".checksum", imagePath + ".sha256"} {
+		if data, err := os.ReadFile(path); err == nil {
+			if sp := strings.Fields(string(data)); len(sp) > 0 {
+				return sp[0], path
+			}
+			return "", path
+		}
+	}
+
+	sumsPath := filepath.Join(filepath.Dir(imagePath), "SHA256SUMS")
+	data, err := os.ReadFile(sumsPath)
+	if err != nil {
+		return "", ""
+	}
+	name := filepath.Base(imagePath)
+	for _, line := range strings.Split(string(data), "\n") {
+		// "<hash>  <name>" or "<hash> *<name>" (binary mode)
+		fields := strings.Fields(line)
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return fields[0], sumsPath
+		}
+	}
+	return "", ""
+}
@@ -0,0 +1,101 @@
+package flash
+
+import (
+	"os"
+	"sort"
+)
+
+// DuplicateGroup is a set of byte-identical images stored under different names.
+type DuplicateGroup struct {
+	Hash  string
+	Size  int64
+	Files []string // sorted by name; the first one is kept
+}
+
+// Reclaimable returns the bytes freed by deduplicating the group.
+func (g DuplicateGroup) Reclaimable() int64 {
+	return g.Size * int64(len(g.Files)-1)
+}
+
+// FindDuplicates groups the images in dir that have the same size and the same
+// stored SHA-256. hashOf returns the stored hash of an image, or "" when it is
+// unknown or out of date; those images are skipped, as are split images. Files
+// that are already hard links of one another count once.
+func FindDuplicates(dir string, hashOf func(path string) string) ([]DuplicateGroup, error) {
+	images, err := GetImageFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	type key struct {
+		hash string
+		size int64
+	}
+	groups := make(map[key][]string)
+	infos := make(map[string]os.FileInfo)
+	for _, img := range images {
+		if IsSplit(img) {
+			continue
+		}
+		hash := hashOf(img)
+		if hash == "" {
+			continue
+		}
+		info, err := os.Stat(img)
+		if err != nil {
+			continue
+		}
+		k := key{hash, info.Size()}
+		linked := false
+		for _, other := range groups[k] {
+			if os.SameFile(info, infos[other]) {
+				linked = true
+				break
+			}
+		}
+		if !linked {
+			infos[img] = info
+			groups[k] = append(groups[k], img)
+		}
+	}
+
+	var dups []DuplicateGroup
+	for k, files := range groups {
+		if len(files) < 2 {
+			continue
+		}
+		sort.Strings(files)
+		dups = append(dups, DuplicateGroup{Hash: k.hash, Size: k.size, Files: files})
+	}
+	sort.Slice(dups, func(i, j int) bool { return dups[i].Files[0] < dups[j].Files[0] })
+	return dups, nil
+}
+
+// Hardlink replaces every duplicate with a hard link to the first file, keeping
+// all names (and their sidecars) valid.
+func (g DuplicateGroup) Hardlink() error {
+	for _, dup := range g.Files[1:] {
+		tmp := dup + ".link"
+		_ = os.Remove(tmp)
+		if err := os.Link(g.Files[0], tmp); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, dup); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes every duplicate, together with its sidecars, keeping the first file.
+func (g DuplicateGroup) Delete() error {
+	for _, dup := range g.Files[1:] {
+		for _, f := range append([]string{dup}, Sidecars(dup)...) {
+			if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
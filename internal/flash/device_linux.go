@@ -0,0 +1,19 @@
+package flash
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// OpenDevice opens a device for writing with O_DIRECT, so that the write
+// bypasses the page cache as dd's oflag=direct did, or buffered where the
+// device does not support it.
+func OpenDevice(dst string) (*os.File, error) {
+	f, err := os.OpenFile(dst, os.O_WRONLY|unix.O_DIRECT, 0)
+	if errors.Is(err, unix.EINVAL) {
+		return os.OpenFile(dst, os.O_WRONLY, 0)
+	}
+	return f, err
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package flash
+
+import "os"
+
+// OpenDevice opens a device for writing.
+func OpenDevice(dst string) (*os.File, error) {
+	return os.OpenFile(dst, os.O_WRONLY, 0)
+}
@@ -0,0 +1,124 @@
+package flash
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// sgIOHdr is struct sg_io_hdr of <scsi/sg.h>.
+type sgIOHdr struct {
+	interfaceID    int32
+	dxferDirection int32
+	cmdLen         uint8
+	mxSbLen        uint8
+	iovecCount     uint16
+	dxferLen       uint32
+	dxferp         unsafe.Pointer
+	cmdp           unsafe.Pointer
+	sbp            unsafe.Pointer
+	timeout        uint32
+	flags          uint32
+	packID         int32
+	usrPtr         unsafe.Pointer
+	status         uint8
+	maskedStatus   uint8
+	msgStatus      uint8
+	sbLenWr        uint8
+	hostStatus     uint16
+	driverStatus   uint16
+	resid          int32
+	duration       uint32
+	info           uint32
+}
+
+// nvmePassthruCmd is struct nvme_passthru_cmd of <linux/nvme_ioctl.h>.
+type nvmePassthruCmd struct {
+	opcode      uint8
+	flags       uint8
+	rsvd1       uint16
+	nsid        uint32
+	cdw2, cdw3  uint32
+	metadata    uint64
+	addr        uint64
+	metadataLen uint32
+	dataLen     uint32
+	cdw10       uint32
+	cdw11       uint32
+	cdw12       uint32
+	cdw13       uint32
+	cdw14       uint32
+	cdw15       uint32
+	timeoutMs   uint32
+	result      uint32
+}
+
+const (
+	sgIO            = 0x2285     // SG_IO
+	sgDxferNone     = -1         // SG_DXFER_NONE
+	nvmeIoctlID     = 0x4e40     // NVME_IOCTL_ID
+	nvmeIoctlIOCmd  = 0xc0484e43 // NVME_IOCTL_IO_CMD
+	flushTimeoutMs  = 60_000
+	scsiSyncCache10 = 0x35 // SYNCHRONIZE CACHE (10)
+	nvmeCmdFlush    = 0x00
+)
+
+// FlushDeviceCache asks the device at path, open as f, to write its volatile
+// write cache to the medium: a Flush command for NVMe drives, SYNCHRONIZE
+// CACHE over SG_IO for SCSI, SATA and USB disks. fsync only does so when the
+// kernel knows the device caches writes, which some USB bridges hide. SD cards
+// in a built-in slot are flushed by fsync and left alone.
+func FlushDeviceCache(f interface{ Fd() uintptr }, path string) error {
+	if p, err := filepath.EvalSymlinks(path); err == nil {
+		path = p
+	}
+	name := filepath.Base(path)
+	switch {
+	case strings.HasPrefix(name, "nvme"):
+		return flushNVMe(f.Fd())
+	case strings.HasPrefix(name, "mmcblk"):
+		return nil
+	}
+	return flushSCSI(f.Fd())
+}
+
+// flushSCSI sends SYNCHRONIZE CACHE (10) for the whole device.
+func flushSCSI(fd uintptr) error {
+	cdb := [10]byte{scsiSyncCache10}
+	var sense [32]byte
+	hdr := sgIOHdr{
+		interfaceID:    'S',
+		dxferDirection: sgDxferNone,
+		cmdLen:         uint8(len(cdb)),
+		mxSbLen:        uint8(len(sense)),
+		cmdp:           unsafe.Pointer(&cdb[0]),
+		sbp:            unsafe.Pointer(&sense[0]),
+		timeout:        flushTimeoutMs,
+	}
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, fd, sgIO, uintptr(unsafe.Pointer(&hdr))); errno == unix.ENOTTY {
+		return nil // not a SCSI device, e.g. a loop or virtio disk
+	} else if errno != 0 {
+		return fmt.Errorf("SYNCHRONIZE CACHE: %w", errno)
+	}
+	if hdr.status != 0 || hdr.hostStatus != 0 || hdr.driverStatus&0x0f != 0 {
+		return fmt.Errorf("SYNCHRONIZE CACHE failed: status %#x, host %#x, driver %#x, sense key %#x",
+			hdr.status, hdr.hostStatus, hdr.driverStatus, sense[2]&0x0f)
+	}
+	return nil
+}
+
+// flushNVMe sends a Flush command to the namespace of the device.
+func flushNVMe(fd uintptr) error {
+	nsid, _, errno := unix.Syscall(unix.SYS_IOCTL, fd, nvmeIoctlID, 0)
+	if errno != 0 {
+		return fmt.Errorf("NVMe namespace: %w", errno)
+	}
+	cmd := nvmePassthruCmd{opcode: nvmeCmdFlush, nsid: uint32(nsid), timeoutMs: flushTimeoutMs}
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, fd, nvmeIoctlIOCmd, uintptr(unsafe.Pointer(&cmd))); errno != 0 {
+		return fmt.Errorf("NVMe flush: %w", errno)
+	}
+	return nil
+}
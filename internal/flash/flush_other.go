@@ -0,0 +1,7 @@
+//go:build !linux
+
+package flash
+
+// FlushDeviceCache is a no-op on other platforms, where the device is left to
+// its driver: Windows flushes the write cache when syncing a physical drive.
+func FlushDeviceCache(f interface{ Fd() uintptr }, path string) error { return nil }
@@ -0,0 +1,202 @@
+// Package flash recognizes the supported image formats (raw, xz, zip and split
+// parts, under built-in or configured names) and streams their raw contents,
+// shared by the TUI and the command-line tools.
+package flash
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/husarion/husarion-os-flasher/util"
+)
+
+// parseHumanSize converts "<num>[.<num>] <UNIT>" (with optional commas) to bytes.
+func parseHumanSize(num, unit string) (int64, bool) {
+	num = strings.ReplaceAll(num, ",", "")
+	unit = strings.TrimSpace(unit)
+	// Sometimes xz prints just "B" or already suffixed like "1234B"
+	if unit == "" && strings.HasSuffix(num, "B") {
+		num, unit = strings.TrimSuffix(num, "B"), "B"
+	}
+	f, err := strconv.ParseFloat(num, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) || f < 0 {
+		return 0, false
+	}
+	multipliers := map[string]float64{
+		"B":   1,
+		"KiB": 1024,
+		"MiB": 1024 * 1024,
+		"GiB": 1024 * 1024 * 1024,
+		"TiB": 1024 * 1024 * 1024 * 1024,
+	}
+	m, ok := multipliers[unit]
+	if !ok || f*m > math.MaxInt64 {
+		return 0, false
+	}
+	return int64(f * m), true
+}
+
+// XZUncompressedSize runs `xz --robot -l` and extracts the uncompressed size,
+// falling back to the human `xz -l` output for xz builds without robot mode.
+// Sizes in bytes from robot mode are kept in the size cache, which is asked
+// first.
+// Returns (bytes, exact).
+func XZUncompressedSize(path string) (int64, bool) {
+	if size, ok := cachedSize(path); ok {
+		return size, true
+	}
+	if out, err := util.Command("xz", "--robot", "-l", path).Output(); err == nil {
+		if size, ok := parseXZRobot(string(out)); ok {
+			RememberSize(path, size)
+			return size, true
+		}
+	}
+	out, err := util.Command("xz", "-l", path).CombinedOutput()
+	if err != nil {
+		return 0, false
+	}
+	return parseXZList(string(out), filepath.Base(path))
+}
+
+// parseXZRobot extracts the uncompressed size from `xz --robot -l` output,
+// whose tab-separated "totals" line (or "file" line for a single file) has the
+// size in bytes in its fifth column.
+func parseXZRobot(out string) (int64, bool) {
+	size, found := int64(0), false
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) < 5 || fields[0] != "totals" && fields[0] != "file" {
+			continue
+		}
+		n, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil || n < 0 {
+			return 0, false
+		}
+		size, found = n, true
+		if fields[0] == "totals" {
+			break
+		}
+	}
+	return size, found
+}
+
+// xzSizeRe matches a human-readable size such as "1,234.5 MiB" in xz -l output.
+var xzSizeRe = regexp.MustCompile(`([0-9][0-9,]*\.?[0-9]*)\s*(B|KiB|MiB|GiB|TiB)`)
+
+// parseXZList extracts the uncompressed size from human `xz -l` output.
+// Returns (bytes, exact).
+func parseXZList(out, filename string) (int64, bool) {
+	lines := strings.Split(out, "\n")
+	for _, line := range lines {
+		if !strings.Contains(line, filename) {
+			continue
+		}
+		// Find all size occurrences (compressed, uncompressed, maybe more)
+		matches := xzSizeRe.FindAllStringSubmatch(line, -1)
+		if len(matches) >= 2 {
+			// Second match is uncompressed.
+			if val, ok := parseHumanSize(matches[1][1], matches[1][2]); ok {
+				return val, true
+			}
+		}
+	}
+	// Fallback: try last non-empty numeric line (totals)
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := lines[i]
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		matches := xzSizeRe.FindAllStringSubmatch(line, -1)
+		if len(matches) >= 2 {
+			if val, ok := parseHumanSize(matches[1][1], matches[1][2]); ok {
+				return val, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// imageExtensions are the raw image formats that can be flashed; each may also be xz-, zstd-
+// or bzip2-compressed.
+var imageExtensions = []string{".img", ".wic", ".iso"}
+
+// IsImageName reports whether a file name is a supported image (.img, .wic, .iso, optionally .xz,
+// .zst or .bz2), or a raw, xz, zstd or bzip2 image by a configured pattern.
+func IsImageName(name string) bool {
+	raw := SplitBase(name)
+	for _, ext := range []string{".xz", ".zst", ".bz2"} {
+		raw = strings.TrimSuffix(raw, ext)
+	}
+	for _, ext := range imageExtensions {
+		if strings.HasSuffix(raw, ext) {
+			return true
+		}
+	}
+	format, ok := patternFormat(name)
+	return ok && format != FormatZip
+}
+
+// IsXZ reports whether an image (or split image part) is xz-compressed.
+func IsXZ(path string) bool {
+	if strings.HasSuffix(SplitBase(path), ".xz") {
+		return true
+	}
+	format, _ := patternFormat(path)
+	return format == FormatXZ
+}
+
+// IsHybridISO reports whether an ISO has an MBR boot signature, i.e. it boots when
+// written to a USB drive rather than burned to optical media.
+func IsHybridISO(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	mbr := make([]byte, 512)
+	if _, err := f.ReadAt(mbr, 0); err != nil {
+		return false
+	}
+	return mbr[510] == 0x55 && mbr[511] == 0xAA
+}
+
+// GetImageFiles lists the images in osImgPath that can be flashed.
+func GetImageFiles(osImgPath string) ([]string, error) {
+	// Use osImgPath instead of hardcoded "/os-images"
+	entries, err := os.ReadDir(osImgPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var images []string
+	for _, entry := range entries {
+		// Skip directories and macOS metadata items
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "._") {
+			continue
+		}
+
+		// Support .img, .wic and .iso files, plain or .xz compressed; split
+		// images are listed once, by their first part
+		if IsImageName(name) {
+			path := filepath.Join(osImgPath, name)
+			if IsSplit(path) && !IsFirstSplitPart(path) {
+				continue
+			}
+			images = append(images, path)
+		}
+
+		// Zip archives are listed when they hold exactly one image
+		if IsZip(name) {
+			if _, _, err := ZipImageEntry(filepath.Join(osImgPath, name)); err == nil {
+				images = append(images, filepath.Join(osImgPath, name))
+			}
+		}
+	}
+
+	return images, nil
+}
@@ -0,0 +1,120 @@
+package flash
+
+import "testing"
+
+const xzListSample = `Strms  Blocks   Compressed Uncompressed  Ratio  Check   Filename
+    1       1    821.3 MiB  4,000.0 MiB  0.205  CRC64   husarion-os.img.xz
+`
+
+const xzListLocalized = `Strms  Blöcke   Komprimiert Unkomprimiert  Verh.  Check   Dateiname
+    1       1    821,3 MiB  4.000,0 MiB  0,205  CRC64   husarion-os.img.xz
+`
+
+func TestParseHumanSize(t *testing.T) {
+	tests := []struct {
+		num, unit string
+		want      int64
+		ok        bool
+	}{
+		{"512", "B", 512, true},
+		{"1", "KiB", 1024, true},
+		{"1.5", "MiB", 1572864, true},
+		{"4,000.0", "MiB", 4000 << 20, true},
+		{"2", "GiB", 2 << 30, true},
+		{"1234B", "", 1234, true},
+		{"1", "MB", 0, false},
+		{"-1", "MiB", 0, false},
+		{"1e400", "TiB", 0, false},
+		{"abc", "MiB", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseHumanSize(tt.num, tt.unit)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseHumanSize(%q, %q) = (%d, %v), want (%d, %v)", tt.num, tt.unit, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParseXZList(t *testing.T) {
+	got, ok := parseXZList(xzListSample, "husarion-os.img.xz")
+	if !ok || got != 4000<<20 {
+		t.Errorf("parseXZList(sample) = (%d, %v), want (%d, true)", got, ok, int64(4000<<20))
+	}
+	if _, ok := parseXZList("", "x.img.xz"); ok {
+		t.Error("parseXZList(empty) reported a size")
+	}
+}
+
+func TestParseXZRobot(t *testing.T) {
+	const robot = "name\thusarion-os.img.xz\n" +
+		"file\t1\t1\t861184000\t4194304000\t0.205\tCRC64\t0\n" +
+		"totals\t1\t1\t861184000\t4194304000\t0.205\tCRC64\t0\t1\n"
+	if got, ok := parseXZRobot(robot); !ok || got != 4194304000 {
+		t.Errorf("parseXZRobot(sample) = (%d, %v), want (4194304000, true)", got, ok)
+	}
+	// Human output, localized or not, is left to parseXZList
+	if _, ok := parseXZRobot(xzListLocalized); ok {
+		t.Error("parseXZRobot(human output) reported a size")
+	}
+}
+
+func TestParseZstdList(t *testing.T) {
+	const verbose = "r.img.zst \n# Zstandard Frames: 1\nDictID: 0\n" +
+		"Window Size: 2.00 MiB (2097152 B)\n" +
+		"Compressed Size: 47.7 MiB (50001160 B)\n" +
+		"Decompressed Size: 47.7 MiB (50000000 B)\n" +
+		"Ratio: 1.0000\nCheck: XXH64 4c040660\n"
+	if got, ok := parseZstdList(verbose); !ok || got != 50000000 {
+		t.Errorf("parseZstdList(sample) = (%d, %v), want (50000000, true)", got, ok)
+	}
+	// Compressed from a pipe: no size in the frame header
+	if _, ok := parseZstdList("s.zst \nCompressed Size: 47.7 MiB (50002316 B)\n"); ok {
+		t.Error("parseZstdList(streamed) reported a size")
+	}
+}
+
+func TestParseXZBlocks(t *testing.T) {
+	const robot = "name\thusarion-os.img.xz\n" +
+		"file\t1\t125\t861184000\t4194304000\t0.205\tCRC64\t0\n" +
+		"totals\t1\t125\t861184000\t4194304000\t0.205\tCRC64\t0\t1\n"
+	if got, ok := parseXZBlocks(robot); !ok || got != 125 {
+		t.Errorf("parseXZBlocks(sample) = (%d, %v), want (125, true)", got, ok)
+	}
+	if _, ok := parseXZBlocks(xzListLocalized); ok {
+		t.Error("parseXZBlocks(human output) reported blocks")
+	}
+}
+
+func FuzzParseHumanSize(f *testing.F) {
+	f.Add("821.3", "MiB")
+	f.Add("4,000.0", "MiB")
+	f.Add("821,3", "MiB")
+	f.Add("1234B", "")
+	f.Add("1e400", "TiB")
+	f.Add("NaN", "GiB")
+	f.Fuzz(func(t *testing.T, num, unit string) {
+		v, ok := parseHumanSize(num, unit)
+		if !ok && v != 0 {
+			t.Errorf("parseHumanSize(%q, %q) returned %d with ok=false", num, unit, v)
+		}
+		if ok && v < 0 {
+			t.Errorf("parseHumanSize(%q, %q) returned negative size %d", num, unit, v)
+		}
+	})
+}
+
+func FuzzParseXZList(f *testing.F) {
+	f.Add(xzListSample, "husarion-os.img.xz")
+	f.Add(xzListLocalized, "husarion-os.img.xz")
+	f.Add("    1       1    821.3", "x")
+	f.Add("1 MiB\n\n\n", "")
+	f.Fuzz(func(t *testing.T, out, filename string) {
+		v, ok := parseXZList(out, filename)
+		if !ok && v != 0 {
+			t.Errorf("parseXZList returned %d with ok=false", v)
+		}
+		if ok && v < 0 {
+			t.Errorf("parseXZList returned negative size %d", v)
+		}
+	})
+}
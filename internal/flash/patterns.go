@@ -0,0 +1,98 @@
+package flash
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Formats a pattern can select: how matching files are read.
+const (
+	FormatRaw   = "raw"   // written as is
+	FormatXZ    = "xz"    // decompressed with xz
+	FormatZstd  = "zstd"  // decompressed with zstd
+	FormatBzip2 = "bzip2" // decompressed with bzip2
+	FormatZip   = "zip"   // the single image inside the archive
+)
+
+// Pattern makes files whose names match Glob or Regex flashable images, beyond
+// the built-in .img, .wic, .iso, .xz, .zst, .bz2 and .zip names.
+type Pattern struct {
+	Glob   string // shell pattern matched against the file name
+	Regex  string // regular expression matched against the file name
+	Format string // FormatRaw, FormatXZ, FormatZstd, FormatBzip2 or FormatZip
+
+	re *regexp.Regexp
+}
+
+func (p Pattern) match(name string) bool {
+	if p.re != nil {
+		return p.re.MatchString(name)
+	}
+	ok, _ := filepath.Match(p.Glob, name)
+	return ok
+}
+
+// patterns are the configured image patterns, shared by the whole process.
+var patterns struct {
+	sync.RWMutex
+	list []Pattern
+}
+
+// SetPatterns replaces the configured image patterns. On an invalid pattern it
+// returns an error and keeps the previous ones.
+func SetPatterns(list []Pattern) error {
+	compiled := make([]Pattern, 0, len(list))
+	for _, p := range list {
+		switch p.Format {
+		case FormatRaw, FormatXZ, FormatZstd, FormatBzip2, FormatZip:
+		default:
+			return fmt.Errorf("unknown format %q", p.Format)
+		}
+		if (p.Glob == "") == (p.Regex == "") {
+			return fmt.Errorf("exactly one of glob or regex must be set")
+		}
+		if p.Regex != "" {
+			re, err := regexp.Compile(p.Regex)
+			if err != nil {
+				return err
+			}
+			p.re = re
+		} else if _, err := filepath.Match(p.Glob, ""); err != nil {
+			return fmt.Errorf("glob %q: %w", p.Glob, err)
+		}
+		compiled = append(compiled, p)
+	}
+
+	patterns.Lock()
+	defer patterns.Unlock()
+	patterns.list = compiled
+	return nil
+}
+
+// patternFormat returns the format of the first configured pattern matching the
+// file name of path, without a split part suffix. A name matching a raw pattern
+// once ".xz", ".zst" or ".bz2" is removed is an xz, zstd or bzip2 image, as
+// for the built-in names.
+func patternFormat(path string) (string, bool) {
+	name := filepath.Base(SplitBase(path))
+	patterns.RLock()
+	defer patterns.RUnlock()
+	for _, p := range patterns.list {
+		if p.match(name) {
+			return p.Format, true
+		}
+	}
+	for ext, format := range map[string]string{".xz": FormatXZ, ".zst": FormatZstd, ".bz2": FormatBzip2} {
+		if raw, ok := strings.CutSuffix(name, ext); ok {
+			for _, p := range patterns.list {
+				if p.Format == FormatRaw && p.match(raw) {
+					return format, true
+				}
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,41 @@
+package flash
+
+import (
+	"context"
+	"io"
+)
+
+// prewarmChunk is how much Prewarm reads at a time.
+const prewarmChunk = 4 << 20
+
+// Prewarm reads the start of an image, up to limit bytes, so that it sits in
+// the page cache when the flash reads it. It stops early when ctx is done and
+// returns how many bytes it read. progress, if not nil, is called after each
+// chunk with the bytes read so far.
+func Prewarm(ctx context.Context, path string, limit int64, progress func(int64)) (int64, error) {
+	f, err := OpenFile(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, prewarmChunk)
+	var read int64
+	for read < limit {
+		if err := ctx.Err(); err != nil {
+			return read, err
+		}
+		n, err := f.Read(buf[:min(int64(len(buf)), limit-read)])
+		read += int64(n)
+		if progress != nil {
+			progress(read)
+		}
+		if err == io.EOF {
+			return read, nil
+		}
+		if err != nil {
+			return read, err
+		}
+	}
+	return read, nil
+}
@@ -0,0 +1,32 @@
+package flash
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// QuarantineDir is the subdirectory of an image directory corrupt images are
+// moved to. It is not listed, so they cannot be flashed by mistake.
+const QuarantineDir = "quarantine"
+
+// Quarantine moves an image, all parts of a split image and their sidecars to
+// the quarantine directory next to it, replacing older files of the same name,
+// and returns the new path of the image.
+func Quarantine(image string) (string, error) {
+	dir := filepath.Join(filepath.Dir(image), QuarantineDir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	files := []string{image}
+	if IsSplit(image) {
+		if parts, err := SplitParts(image); err == nil {
+			files = parts
+		}
+	}
+	for _, f := range append(files, Sidecars(image)...) {
+		if err := os.Rename(f, filepath.Join(dir, filepath.Base(f))); err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+	return filepath.Join(dir, filepath.Base(image)), nil
+}
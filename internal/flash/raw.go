@@ -0,0 +1,269 @@
+package flash
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+	"unsafe"
+
+	"github.com/husarion/husarion-os-flasher/util"
+)
+
+// Raw device writes (Windows physical drives, macOS rdisk) must be whole
+// sectors; 4096 covers 512e and 4Kn disks.
+const SectorAlign = 4096
+
+// Raw streams the uncompressed contents of an image for in-process writers
+// (block-map and native flashing). xz, zstd and bzip2 images run their
+// binary; zip archives are read with archive/zip.
+type Raw struct {
+	io.Reader
+	cmd     *exec.Cmd
+	waited  bool
+	stderr  bytes.Buffer
+	closers []io.Closer
+}
+
+// OpenRaw opens src for reading its raw image. prepare is applied to the
+// decompressor before it starts, e.g. to lower its priority.
+func OpenRaw(src string, prepare ...func(*exec.Cmd)) (*Raw, error) {
+	img := &Raw{}
+
+	switch {
+	case IsZip(src):
+		inner, _, err := ZipImageEntry(src)
+		if err != nil {
+			return nil, err
+		}
+		zr, err := zip.OpenReader(src)
+		if err != nil {
+			return nil, err
+		}
+		entry, err := zr.Open(inner)
+		if err != nil {
+			zr.Close()
+			return nil, err
+		}
+		img.Reader = entry
+		img.closers = []io.Closer{entry, zr}
+
+	case IsXZ(src) || IsZstd(src) || IsBzip2(src):
+		args, err := DecompressArgs(src)
+		if err != nil {
+			return nil, err
+		}
+		img.cmd = util.Command(args[0], args[1:]...)
+		img.cmd.Stderr = &img.stderr
+		for _, p := range prepare {
+			p(img.cmd)
+		}
+		if IsSplit(src) {
+			parts, err := OpenFile(src)
+			if err != nil {
+				return nil, err
+			}
+			img.cmd.Stdin = parts
+			img.closers = append(img.closers, parts)
+		}
+		pipe, err := img.cmd.StdoutPipe()
+		if err == nil {
+			err = img.cmd.Start()
+		}
+		if err != nil {
+			img.closeFiles()
+			return nil, fmt.Errorf("failed to start %s: %v", args[0], err)
+		}
+		// Hide the pipe's (failing) Seek so readers skip data by reading it
+		img.Reader = struct{ io.Reader }{pipe}
+
+	default:
+		f, err := OpenFile(src)
+		if err != nil {
+			return nil, err
+		}
+		img.Reader = f
+		img.closers = []io.Closer{f}
+	}
+	return img, nil
+}
+
+// Kill stops the decompressor, if any. It is safe to call from another goroutine.
+func (img *Raw) Kill() {
+	if img.cmd != nil && img.cmd.Process != nil {
+		_ = img.cmd.Process.Kill()
+	}
+}
+
+// Wait waits for the decompressor to exit once its output was read to the
+// end, and fails when it did not succeed: a truncated or corrupt archive
+// ends its output early rather than failing the read. Images read in-process
+// have nothing to wait for.
+func (img *Raw) Wait() error {
+	if img.cmd == nil || img.waited {
+		return nil
+	}
+	img.waited = true
+	if err := img.cmd.Wait(); err != nil {
+		return img.Explain(fmt.Errorf("%s failed: %v", img.cmd.Args[0], err))
+	}
+	return nil
+}
+
+// Close stops the decompressor and releases all files.
+func (img *Raw) Close() {
+	if img.cmd != nil && !img.waited {
+		img.Kill()
+		img.waited = true
+		_ = img.cmd.Wait()
+	}
+	img.closeFiles()
+}
+
+func (img *Raw) closeFiles() {
+	for _, c := range img.closers {
+		c.Close()
+	}
+}
+
+// Explain replaces a read error with the decompressor's own message when it
+// printed one. Call it after Close.
+func (img *Raw) Explain(err error) error {
+	if msg := strings.TrimSpace(img.stderr.String()); msg != "" {
+		return fmt.Errorf("compressed file error: %s", msg)
+	}
+	return err
+}
+
+// RawSize returns the uncompressed size of an image and whether it is exact.
+func RawSize(src string) (int64, bool) {
+	switch {
+	case IsZip(src):
+		_, size, err := ZipImageEntry(src)
+		return size, err == nil
+	case IsXZ(src):
+		if size, exact := XZUncompressedSize(src); exact {
+			return size, true
+		}
+		size, _ := FileSize(src)
+		return size * 4, false // heuristic, as for the dd pipeline
+	case IsZstd(src):
+		if size, exact := ZstdUncompressedSize(src); exact {
+			return size, true
+		}
+		size, _ := FileSize(src)
+		return size * 4, false
+	case IsBzip2(src):
+		size, _ := FileSize(src) // bzip2 records no size
+		return size * 4, false
+	}
+	size, err := FileSize(src)
+	return size, err == nil
+}
+
+// Device is an open device written to in-process: an *os.File, or a URing
+// writing to one.
+type Device interface {
+	io.Writer
+	io.WriterAt
+	Sync() error // waits for the writes and flushes them to the medium
+	Fd() uintptr
+}
+
+// SyncedFile is a device flushed after every interval bytes written to it, so
+// that what was written is on the medium rather than in the page cache. The
+// flushed pages are dropped from the cache, which would otherwise fill the
+// memory of small boards.
+type SyncedFile struct {
+	Device
+	interval int64
+	pending  int64 // bytes written since the last flush
+}
+
+// SyncEvery wraps dev to be flushed every interval bytes, never when interval
+// is 0.
+func SyncEvery(dev Device, interval int64) *SyncedFile {
+	return &SyncedFile{Device: dev, interval: interval}
+}
+
+// Write writes p and flushes the device when the interval is reached.
+func (f *SyncedFile) Write(p []byte) (int, error) {
+	n, err := f.Device.Write(p)
+	if err == nil {
+		err = f.wrote(n)
+	}
+	return n, err
+}
+
+// WriteAt writes p at off and flushes the device when the interval is reached.
+func (f *SyncedFile) WriteAt(p []byte, off int64) (int, error) {
+	n, err := f.Device.WriteAt(p, off)
+	if err == nil {
+		err = f.wrote(n)
+	}
+	return n, err
+}
+
+// wrote counts n bytes written and flushes once interval bytes are pending.
+func (f *SyncedFile) wrote(n int) error {
+	if f.interval <= 0 {
+		return nil
+	}
+	f.pending += int64(n)
+	if f.pending < f.interval {
+		return nil
+	}
+	f.pending = 0
+	if err := f.Device.Sync(); err != nil {
+		return fmt.Errorf("sync failed: %w", err)
+	}
+	DropCache(f.Device)
+	return nil
+}
+
+// WriteAligned copies src to dst in whole sectors, zero-padding the final write,
+// and returns the bytes read from src. The buffer is aligned to SectorAlign in
+// memory too, as O_DIRECT requires.
+func WriteAligned(src io.Reader, dst io.Writer, total int64, progress func(written, total int64, elapsed time.Duration), cancel <-chan struct{}) (int64, error) {
+	buf := alignedBuffer(4 << 20)
+	start := time.Now()
+	var written int64
+	for {
+		select {
+		case <-cancel:
+			return written, fmt.Errorf("aborted")
+		default:
+		}
+
+		n, readErr := io.ReadFull(src, buf)
+		if n > 0 {
+			padded := (n + SectorAlign - 1) / SectorAlign * SectorAlign
+			clear(buf[n:padded])
+			if _, err := dst.Write(buf[:padded]); err != nil {
+				return written, fmt.Errorf("writing at %d: %w", written, err)
+			}
+			written += int64(n)
+			progress(written, max(total, written), time.Since(start))
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			return written, nil
+		}
+		if readErr != nil {
+			return written, fmt.Errorf("reading image at %d: %w", written, readErr)
+		}
+	}
+}
+
+// alignedBuffer returns a buffer of size bytes starting at a multiple of
+// SectorAlign in memory.
+func alignedBuffer(size int) []byte {
+	buf := make([]byte, size+SectorAlign)
+	off := 0
+	if rem := int(uintptr(unsafe.Pointer(&buf[0])) % SectorAlign); rem != 0 {
+		off = SectorAlign - rem
+	}
+	return buf[off : off+size : off+size]
+}
@@ -0,0 +1,164 @@
+package flash
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// sidecarSuffixes are files stored next to an image that go away with it.
+var sidecarSuffixes = []string{".checksum", ".sha256", ".bmap", ".meta.yaml", ".sig"}
+
+// PruneCandidate is an image version selected for deletion.
+type PruneCandidate struct {
+	Family   string
+	Image    string    // raw image path identifying the version
+	Files    []string  // compressed and extracted copies, split parts and sidecars
+	Size     int64     // total size of Files
+	Modified time.Time // newest modification time of the version's images
+}
+
+// versionPart matches the parts of an image name that change between
+// versions of an image: a version number (1.2.0, v2.1) or a date (20240501).
+// Other parts with digits, such as rpi4 or 2r, name the board.
+var versionPart = regexp.MustCompile(`^(v?\d+(\.\d+)+|\d{8})$`)
+
+// ImageFamily returns the name shared by all versions of an image: the file name
+// without extensions and without its version and date parts (separated by - or
+// _). "rosbot-xl-1.2.0-20240501.img.xz" belongs to "rosbot-xl".
+func ImageFamily(path string) string {
+	base := filepath.Base(ExtractedPath(SplitBase(path)))
+	base = strings.TrimSuffix(base, filepath.Ext(base))
+	var kept []string
+	for _, part := range strings.FieldsFunc(base, func(r rune) bool { return r == '-' || r == '_' }) {
+		if !versionPart.MatchString(part) {
+			kept = append(kept, part)
+		}
+	}
+	if len(kept) == 0 {
+		return base
+	}
+	return strings.Join(kept, "-")
+}
+
+// PlanPrune returns the image versions in dir that keeping the newest keepLast
+// versions of each family would delete, oldest first. Versions matching one of
+// the favorites glob patterns, or listed in inUse, are always kept.
+func PlanPrune(dir string, keepLast int, favorites, inUse []string) ([]PruneCandidate, error) {
+	images, err := GetImageFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	protected := func(path string) bool {
+		for _, p := range inUse {
+			if p == path || ExtractedPath(SplitBase(p)) == ExtractedPath(SplitBase(path)) {
+				return true
+			}
+		}
+		for _, pattern := range favorites {
+			if ok, _ := filepath.Match(pattern, filepath.Base(path)); ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	// A compressed image and its extracted copy are one version
+	versions := make(map[string]*PruneCandidate)
+	keep := make(map[string]bool)
+	for _, img := range images {
+		key := ExtractedPath(SplitBase(img))
+		v, ok := versions[key]
+		if !ok {
+			v = &PruneCandidate{Family: ImageFamily(img), Image: key}
+			versions[key] = v
+		}
+		if protected(img) {
+			keep[key] = true
+		}
+		files := []string{img}
+		if IsSplit(img) {
+			if parts, err := SplitParts(img); err == nil {
+				files = parts
+			}
+		}
+		for _, f := range files {
+			if info, err := os.Stat(f); err == nil {
+				v.Files = append(v.Files, f)
+				v.Size += info.Size()
+				if info.ModTime().After(v.Modified) {
+					v.Modified = info.ModTime()
+				}
+			}
+		}
+	}
+
+	families := make(map[string][]*PruneCandidate)
+	for _, v := range versions {
+		families[v.Family] = append(families[v.Family], v)
+	}
+
+	var candidates []PruneCandidate
+	for _, list := range families {
+		sort.Slice(list, func(i, j int) bool { return list[i].Modified.After(list[j].Modified) })
+		for i, v := range list {
+			if i < keepLast || keep[v.Image] {
+				continue
+			}
+			candidates = append(candidates, withSidecars(*v))
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Modified.Before(candidates[j].Modified) })
+	return candidates, nil
+}
+
+// Sidecars returns the existing sidecar files of an image.
+func Sidecars(image string) []string {
+	var files []string
+	for _, suffix := range sidecarSuffixes {
+		p := SplitBase(image) + suffix
+		if _, err := os.Stat(p); err == nil {
+			files = append(files, p)
+		}
+	}
+	return files
+}
+
+// withSidecars adds the sidecar files of a version's images to its file list.
+func withSidecars(v PruneCandidate) PruneCandidate {
+	seen := make(map[string]bool)
+	for _, f := range v.Files {
+		seen[f] = true
+	}
+	for _, img := range append([]string{v.Image}, v.Files...) {
+		for _, p := range Sidecars(img) {
+			if seen[p] {
+				continue
+			}
+			if info, err := os.Stat(p); err == nil {
+				seen[p] = true
+				v.Files = append(v.Files, p)
+				v.Size += info.Size()
+			}
+		}
+	}
+	return v
+}
+
+// Prune deletes the files of the given versions. It continues past failures and
+// returns the first error.
+func Prune(candidates []PruneCandidate) error {
+	var first error
+	for _, c := range candidates {
+		for _, f := range c.Files {
+			if err := os.Remove(f); err != nil && !os.IsNotExist(err) && first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
@@ -0,0 +1,75 @@
+package flash
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestImageFamily(t *testing.T) {
+	tests := []struct{ path, want string }{
+		{"rosbot-xl-1.2.0-20240501.img.xz", "rosbot-xl"},
+		{"rosbot-xl_v2.1_20240601.img", "rosbot-xl"},
+		{"husarion-os-rpi4-1.0.0.img.xz", "husarion-os-rpi4"},
+		{"husarion-os-rpi5-1.0.0.img.xz", "husarion-os-rpi5"},
+		{"rosbot-2r-1.0.0.img", "rosbot-2r"},
+		{"rosbot-3-1.0.0.img", "rosbot-3"},
+		{"panther.img.zst", "panther"},
+		{"1.2.0.img", "1.2.0"},
+	}
+	for _, tt := range tests {
+		if got := ImageFamily(tt.path); got != tt.want {
+			t.Errorf("ImageFamily(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestPlanPrune(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-time.Hour)
+	// Newest last within each family
+	files := []string{
+		"husarion-os-rpi4-1.0.0.img", "husarion-os-rpi4-1.1.0.img", "husarion-os-rpi4-1.2.0.img",
+		"husarion-os-rpi5-1.0.0.img",
+		"rosbot-2r-1.0.0.img", "rosbot-3-1.0.0.img", "rosbot-3-1.1.0.img",
+	}
+	for i, name := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("image"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		mtime := old.Add(time.Duration(i) * time.Minute)
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		favorites []string
+		inUse     []string
+		want      []string
+	}{
+		{"keeps each board's newest", nil, nil,
+			[]string{"husarion-os-rpi4-1.0.0.img", "husarion-os-rpi4-1.1.0.img", "rosbot-3-1.0.0.img"}},
+		{"keeps favorites", []string{"*-1.0.0.img"}, nil,
+			[]string{"husarion-os-rpi4-1.1.0.img"}},
+		{"keeps images in use", nil, []string{filepath.Join(dir, "husarion-os-rpi4-1.1.0.img")},
+			[]string{"husarion-os-rpi4-1.0.0.img", "rosbot-3-1.0.0.img"}},
+	}
+	for _, tt := range tests {
+		candidates, err := PlanPrune(dir, 1, tt.favorites, tt.inUse)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, c := range candidates {
+			got = append(got, filepath.Base(c.Image))
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: PlanPrune() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package flash
+
+import "sync"
+
+// SizeCache remembers the exact uncompressed sizes of xz images, as listing
+// a large archive with `xz -l` takes a while.
+type SizeCache interface {
+	// CachedSize returns the size recorded for an image, if the image has not
+	// changed since.
+	CachedSize(path string) (int64, bool)
+	// CacheSize records the size of an image.
+	CacheSize(path string, size int64)
+}
+
+// sizeCache is the configured size cache, shared by the whole process.
+var sizeCache struct {
+	sync.RWMutex
+	c SizeCache
+}
+
+// SetSizeCache sets where XZUncompressedSize keeps the sizes it found. Nil
+// keeps none.
+func SetSizeCache(c SizeCache) {
+	sizeCache.Lock()
+	defer sizeCache.Unlock()
+	sizeCache.c = c
+}
+
+// cachedSize returns the cached uncompressed size of an image, if any.
+func cachedSize(path string) (int64, bool) {
+	sizeCache.RLock()
+	defer sizeCache.RUnlock()
+	if sizeCache.c == nil {
+		return 0, false
+	}
+	return sizeCache.c.CachedSize(path)
+}
+
+// RememberSize records the exact uncompressed size of an xz image, found by
+// decompressing it.
+func RememberSize(path string, size int64) {
+	sizeCache.RLock()
+	defer sizeCache.RUnlock()
+	if sizeCache.c != nil && IsXZ(path) {
+		sizeCache.c.CacheSize(path, size)
+	}
+}
@@ -0,0 +1,152 @@
+package flash
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// splitSuffixRe matches the numeric part suffix of split images, e.g. ".000" in
+// "rosbot.img.xz.000".
+var splitSuffixRe = regexp.MustCompile(`\.(\d{2,3})$`)
+
+// SplitBase returns the image path without a split part suffix.
+func SplitBase(path string) string {
+	if loc := splitSuffixRe.FindStringIndex(path); loc != nil {
+		return path[:loc[0]]
+	}
+	return path
+}
+
+// IsSplit reports whether path is a part of a split image.
+func IsSplit(path string) bool {
+	return splitSuffixRe.MatchString(path) && IsImageName(filepath.Base(path))
+}
+
+// SplitParts returns all parts of the split image that path belongs to, in order.
+// Parts must be numbered consecutively; a gap means a part is missing.
+func SplitParts(path string) ([]string, error) {
+	base := SplitBase(path)
+	width := len(path) - len(base) - 1
+	matches, err := filepath.Glob(globEscape(base) + ".*")
+	if err != nil {
+		return nil, err
+	}
+
+	numbered := map[int]string{}
+	for _, m := range matches {
+		suffix := m[len(base)+1:]
+		if len(suffix) != width || !splitSuffixRe.MatchString("."+suffix) {
+			continue
+		}
+		n, _ := strconv.Atoi(suffix)
+		numbered[n] = m
+	}
+	nums := make([]int, 0, len(numbered))
+	for n := range numbered {
+		nums = append(nums, n)
+	}
+	sort.Ints(nums)
+
+	var parts []string
+	for i, n := range nums {
+		if i > 0 && n != nums[i-1]+1 {
+			return nil, fmt.Errorf("%s: part %0*d is missing", filepath.Base(base), width, nums[i-1]+1)
+		}
+		parts = append(parts, numbered[n])
+	}
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("%s: no parts found", filepath.Base(base))
+	}
+	return parts, nil
+}
+
+// globEscape escapes glob metacharacters in a literal path.
+func globEscape(path string) string {
+	return regexp.MustCompile(`[*?\[\\]`).ReplaceAllString(path, `\$0`)
+}
+
+// IsFirstSplitPart reports whether path is the lowest-numbered part of its split
+// image; only that part is listed.
+func IsFirstSplitPart(path string) bool {
+	parts, err := SplitParts(path)
+	return err == nil && parts[0] == path
+}
+
+// FileSize returns the on-disk size of an image, summing all split parts.
+func FileSize(path string) (int64, error) {
+	files := []string{path}
+	if IsSplit(path) {
+		parts, err := SplitParts(path)
+		if err != nil {
+			return 0, err
+		}
+		files = parts
+	}
+	var total int64
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			return 0, err
+		}
+		total += info.Size()
+	}
+	return total, nil
+}
+
+// PVShell returns a shell fragment that streams an image file to stdout through
+// pv, concatenating split parts in order.
+func PVShell(path string) (string, error) {
+	if !IsSplit(path) {
+		return fmt.Sprintf("pv -f %q", path), nil
+	}
+	parts, err := SplitParts(path)
+	if err != nil {
+		return "", err
+	}
+	size, err := FileSize(path)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("cat %s | pv -f -s %d", ShellJoin(parts), size), nil
+}
+
+// OpenFile opens an image file for reading, joining split parts.
+func OpenFile(path string) (io.ReadCloser, error) {
+	if !IsSplit(path) {
+		return os.Open(path)
+	}
+	parts, err := SplitParts(path)
+	if err != nil {
+		return nil, err
+	}
+	var files multiCloser
+	readers := make([]io.Reader, 0, len(parts))
+	for _, p := range parts {
+		f, err := os.Open(p)
+		if err != nil {
+			files.Close()
+			return nil, err
+		}
+		files = append(files, f)
+		readers = append(readers, f)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(readers...), files}, nil
+}
+
+// multiCloser closes every file of a split image.
+type multiCloser []*os.File
+
+func (m multiCloser) Close() error {
+	for _, f := range m {
+		f.Close()
+	}
+	return nil
+}
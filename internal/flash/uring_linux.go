@@ -0,0 +1,248 @@
+package flash
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// io_uring ABI, see linux/io_uring.h.
+const (
+	uringOffSQRing = 0
+	uringOffCQRing = 0x8000000
+	uringOffSQEs   = 0x10000000
+
+	uringOpWrite        = 23 // IORING_OP_WRITE, Linux 5.6
+	uringEnterGetEvents = 1
+	uringSQESize        = 64
+	uringCQESize        = 16
+)
+
+// uringParams is struct io_uring_params.
+type uringParams struct {
+	sqEntries, cqEntries, flags, sqThreadCPU, sqThreadIdle, features, wqFD uint32
+	resv                                                                   [3]uint32
+	sqOff                                                                  struct {
+		head, tail, ringMask, ringEntries, flags, dropped, array, resv1 uint32
+		resv2                                                           uint64
+	}
+	cqOff struct {
+		head, tail, ringMask, ringEntries, overflow, cqes, flags, resv1 uint32
+		resv2                                                           uint64
+	}
+}
+
+// uringSlot is a write in flight, or a free buffer.
+type uringSlot struct {
+	buf  []byte
+	off  int64
+	busy bool
+}
+
+// URing writes to a file through io_uring, keeping up to the queue depth of
+// writes in flight so that the device is never idle waiting for the next one.
+// Writes are copied and return at once; a failed write is reported by a later
+// Write, WriteAt or Sync.
+type URing struct {
+	file *os.File
+	fd   int // of the ring
+
+	sqRing, cqRing, sqes                           []byte
+	sqHead, sqTail, sqMask, cqHead, cqTail, cqMask *uint32
+	sqArray                                        []uint32
+	cqes                                           uint32 // offset of the completions in cqRing
+
+	slots    []uringSlot
+	inflight int
+	pos      int64 // offset of the next Write
+	err      error // first failed write
+}
+
+// NewURing sets up an io_uring with depth writes in flight for f. It fails on
+// kernels without io_uring or where it is disabled.
+func NewURing(f *os.File, depth int) (*URing, error) {
+	var p uringParams
+	fd, _, errno := unix.Syscall(unix.SYS_IO_URING_SETUP, uintptr(depth), uintptr(unsafe.Pointer(&p)), 0)
+	if errno != 0 {
+		return nil, fmt.Errorf("io_uring setup: %w", errno)
+	}
+	u := &URing{file: f, fd: int(fd)}
+	fail := func(err error) (*URing, error) {
+		u.unmap()
+		unix.Close(u.fd)
+		return nil, fmt.Errorf("io_uring setup: %w", err)
+	}
+
+	prot, flags := unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE
+	var err error
+	if u.sqRing, err = unix.Mmap(u.fd, uringOffSQRing, int(p.sqOff.array+p.sqEntries*4), prot, flags); err != nil {
+		return fail(err)
+	}
+	if u.cqRing, err = unix.Mmap(u.fd, uringOffCQRing, int(p.cqOff.cqes+p.cqEntries*uringCQESize), prot, flags); err != nil {
+		return fail(err)
+	}
+	if u.sqes, err = unix.Mmap(u.fd, uringOffSQEs, int(p.sqEntries*uringSQESize), prot, flags); err != nil {
+		return fail(err)
+	}
+
+	u.sqHead, u.sqTail, u.sqMask = ringWord(u.sqRing, p.sqOff.head), ringWord(u.sqRing, p.sqOff.tail), ringWord(u.sqRing, p.sqOff.ringMask)
+	u.sqArray = unsafe.Slice(ringWord(u.sqRing, p.sqOff.array), p.sqEntries)
+	u.cqHead, u.cqTail, u.cqMask = ringWord(u.cqRing, p.cqOff.head), ringWord(u.cqRing, p.cqOff.tail), ringWord(u.cqRing, p.cqOff.ringMask)
+	u.cqes = p.cqOff.cqes
+	u.slots = make([]uringSlot, min(depth, int(p.sqEntries)))
+	return u, nil
+}
+
+// ringWord points at the 32-bit word at off in a ring.
+func ringWord(ring []byte, off uint32) *uint32 {
+	return (*uint32)(unsafe.Pointer(&ring[off]))
+}
+
+// Write writes p at the current offset.
+func (u *URing) Write(p []byte) (int, error) {
+	n, err := u.WriteAt(p, u.pos)
+	u.pos += int64(n)
+	return n, err
+}
+
+// WriteAt queues a write of a copy of p at off, waiting for a free slot when
+// the queue is full.
+func (u *URing) WriteAt(p []byte, off int64) (int, error) {
+	if len(p) == 0 {
+		return 0, u.err
+	}
+	for u.inflight == len(u.slots) && u.err == nil {
+		if err := u.reap(true); err != nil {
+			return 0, err
+		}
+	}
+	if u.err != nil {
+		return 0, u.err
+	}
+
+	i := 0
+	for u.slots[i].busy {
+		i++
+	}
+	s := &u.slots[i]
+	// The device is opened with O_DIRECT, which needs aligned memory
+	if cap(s.buf) < len(p) {
+		s.buf = alignedBuffer(len(p))
+	}
+	s.buf = s.buf[:len(p)]
+	copy(s.buf, p)
+	s.off, s.busy = off, true
+	u.inflight++
+
+	tail := atomic.LoadUint32(u.sqTail)
+	idx := tail & *u.sqMask
+	sqe := u.sqes[idx*uringSQESize : (idx+1)*uringSQESize]
+	clear(sqe)
+	sqe[0] = uringOpWrite
+	binary.NativeEndian.PutUint32(sqe[4:], uint32(u.file.Fd()))
+	binary.NativeEndian.PutUint64(sqe[8:], uint64(off))
+	binary.NativeEndian.PutUint64(sqe[16:], uint64(uintptr(unsafe.Pointer(&s.buf[0]))))
+	binary.NativeEndian.PutUint32(sqe[24:], uint32(len(p)))
+	binary.NativeEndian.PutUint64(sqe[32:], uint64(i))
+	u.sqArray[idx] = idx
+	atomic.StoreUint32(u.sqTail, tail+1)
+
+	if err := u.enter(1, 0, 0); err != nil {
+		u.err = err
+		return 0, err
+	}
+	if err := u.reap(false); err != nil {
+		return 0, err
+	}
+	return len(p), u.err
+}
+
+// enter submits queued writes and waits for minComplete completions.
+func (u *URing) enter(submit, minComplete, flags uint32) error {
+	for {
+		_, _, errno := unix.Syscall6(unix.SYS_IO_URING_ENTER, uintptr(u.fd), uintptr(submit), uintptr(minComplete), uintptr(flags), 0, 0)
+		switch errno {
+		case 0:
+			return nil
+		case unix.EINTR:
+			continue
+		}
+		return fmt.Errorf("io_uring enter: %w", errno)
+	}
+}
+
+// reap frees the slots of completed writes, waiting for one when wait is set,
+// and records the first failed write. It fails when the ring does.
+func (u *URing) reap(wait bool) error {
+	if wait && atomic.LoadUint32(u.cqHead) == atomic.LoadUint32(u.cqTail) {
+		if err := u.enter(0, 1, uringEnterGetEvents); err != nil {
+			if u.err == nil {
+				u.err = err
+			}
+			return err
+		}
+	}
+	head, tail := atomic.LoadUint32(u.cqHead), atomic.LoadUint32(u.cqTail)
+	for ; head != tail; head++ {
+		cqe := u.cqRing[u.cqes+(head&*u.cqMask)*uringCQESize:]
+		s := &u.slots[binary.NativeEndian.Uint64(cqe)]
+		res := int32(binary.NativeEndian.Uint32(cqe[8:]))
+		switch {
+		case u.err != nil:
+		case res < 0:
+			u.err = fmt.Errorf("writing at %d: %w", s.off, unix.Errno(-res))
+		case int(res) < len(s.buf):
+			u.err = fmt.Errorf("writing at %d: %w", s.off, io.ErrShortWrite)
+		}
+		s.busy = false
+		u.inflight--
+	}
+	atomic.StoreUint32(u.cqHead, head)
+	return nil
+}
+
+// drain waits for every write in flight, unless the ring failed.
+func (u *URing) drain() {
+	for u.inflight > 0 {
+		if u.reap(true) != nil {
+			return
+		}
+	}
+}
+
+// Sync waits for the writes in flight and flushes the file to the medium.
+func (u *URing) Sync() error {
+	u.drain()
+	if u.err != nil {
+		return u.err
+	}
+	return u.file.Sync()
+}
+
+// Fd returns the file's descriptor.
+func (u *URing) Fd() uintptr {
+	return u.file.Fd()
+}
+
+// Close waits for the writes in flight and releases the ring, leaving the file
+// open.
+func (u *URing) Close() error {
+	u.drain()
+	u.unmap()
+	return unix.Close(u.fd)
+}
+
+// unmap releases the rings mapped so far.
+func (u *URing) unmap() {
+	for _, ring := range [][]byte{u.sqRing, u.cqRing, u.sqes} {
+		if ring != nil {
+			_ = unix.Munmap(ring)
+		}
+	}
+	u.sqRing, u.cqRing, u.sqes = nil, nil, nil
+}
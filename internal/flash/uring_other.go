@@ -0,0 +1,18 @@
+//go:build !linux
+
+package flash
+
+import (
+	"errors"
+	"os"
+)
+
+// URing is only available on Linux; see uring_linux.go.
+type URing struct {
+	*os.File
+}
+
+// NewURing fails: io_uring is a Linux interface.
+func NewURing(f *os.File, depth int) (*URing, error) {
+	return nil, errors.New("io_uring needs Linux")
+}
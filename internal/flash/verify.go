@@ -0,0 +1,251 @@
+package flash
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"sort"
+	"time"
+)
+
+const (
+	// headerBytes is always compared: it holds the partition table and, on GPT
+	// disks, the disk and partition GUIDs.
+	headerBytes = 1 << 20
+
+	// Quick verification also compares the first headerBytes of every partition,
+	// where file systems keep their superblock and UUID, and spreadSamples blocks
+	// of sampleBytes spread over the image.
+	spreadSamples = 64
+	sampleBytes   = 64 << 10
+
+	// Sampled verification compares samplePercent of the sampleBytes blocks of
+	// the image, chosen at random, besides its first and last headerBytes.
+	samplePercent = 5
+)
+
+// ErrMismatch is returned by Verify when the device does not hold the image.
+var ErrMismatch = errors.New("device differs from the image")
+
+// Sampling is how much of an image Verify compares.
+type Sampling int
+
+const (
+	VerifyAll     Sampling = iota // everything written
+	VerifyQuick                   // the partition table, partition starts and a spread of samples
+	VerifySampled                 // the first and last regions and a random share of the blocks
+)
+
+// Extent is a byte range [Start, End) of an image.
+type Extent struct {
+	Start, End int64
+}
+
+// Verify reads back what was written to dev and compares it with the image read
+// from img. size is the image size, or an estimate: the image ends where img
+// does. Only the mapped extents are compared when mapped is not nil, as a
+// block-map write leaves the rest of the device as it was. Unless sampling is
+// VerifyAll only parts of the image are compared, though img is still read up to
+// the last one. cancel aborts the verification when closed.
+func Verify(img io.Reader, dev io.ReaderAt, size int64, mapped []Extent, sampling Sampling, progress func(done, total int64, elapsed time.Duration), cancel <-chan struct{}) error {
+	v := &verifier{img: img, dev: dev, size: size, progress: progress, cancel: cancel, start: time.Now()}
+
+	if sampling == VerifyAll {
+		if mapped == nil {
+			mapped = []Extent{{0, math.MaxInt64}}
+		}
+		return v.compare(mapped)
+	}
+
+	if err := v.compare(intersect([]Extent{{0, headerBytes}}, mapped)); err != nil || v.done {
+		return err
+	}
+	var regions []Extent
+	if sampling == VerifySampled {
+		blocks := size / sampleBytes
+		for i := int64(0); i < blocks*samplePercent/100; i++ {
+			start := rand.N(blocks) * sampleBytes
+			regions = append(regions, Extent{start, start + sampleBytes})
+		}
+		regions = append(regions, Extent{max(size-headerBytes, headerBytes), size})
+		return v.compare(intersect(normalize(regions), mapped))
+	}
+	for _, start := range partitionStarts(v.header) {
+		regions = append(regions, Extent{start, start + headerBytes})
+	}
+	for i := int64(1); i < spreadSamples; i++ {
+		start := size / spreadSamples * i
+		regions = append(regions, Extent{start, start + sampleBytes})
+	}
+	return v.compare(intersect(normalize(regions), mapped))
+}
+
+// verifier compares an image stream with a device, reading the stream once.
+type verifier struct {
+	img      io.Reader
+	dev      io.ReaderAt
+	size     int64
+	pos      int64  // bytes read from img
+	done     bool   // img ended
+	header   []byte // first headerBytes of the image, once read
+	progress func(done, total int64, elapsed time.Duration)
+	cancel   <-chan struct{}
+	start    time.Time
+	buf      []byte
+	devBuf   []byte
+}
+
+// compare compares the sorted, non-overlapping extents of the image with dev.
+func (v *verifier) compare(extents []Extent) error {
+	if v.buf == nil {
+		v.buf = make([]byte, 4<<20)
+		v.devBuf = make([]byte, 4<<20)
+	}
+	for _, e := range extents {
+		for v.pos < e.End {
+			select {
+			case <-v.cancel:
+				return fmt.Errorf("aborted")
+			default:
+			}
+
+			n := min(int64(len(v.buf)), e.End-v.pos)
+			if v.pos < e.Start {
+				n = min(n, e.Start-v.pos) // skip data before the extent
+			}
+			read, err := io.ReadFull(v.img, v.buf[:n])
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				v.done = true
+			} else if err != nil {
+				return fmt.Errorf("reading image at %d: %w", v.pos, err)
+			}
+			n = int64(read)
+			if v.pos < headerBytes {
+				v.header = append(v.header, v.buf[:min(n, headerBytes-v.pos)]...)
+			}
+			if v.pos >= e.Start {
+				if err := v.check(v.buf[:n]); err != nil {
+					return err
+				}
+			}
+			v.pos += n
+			if v.progress != nil && n > 0 {
+				v.progress(v.pos, max(v.size, v.pos), time.Since(v.start))
+			}
+			if v.done {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// check compares data, read from the image at v.pos, with the device. The
+// device is read in whole sectors, as raw devices require.
+func (v *verifier) check(data []byte) error {
+	off := v.pos / SectorAlign * SectorAlign
+	skip := v.pos - off
+	length := (skip + int64(len(data)) + SectorAlign - 1) / SectorAlign * SectorAlign
+	if int64(cap(v.devBuf)) < length {
+		v.devBuf = make([]byte, length)
+	}
+	got := v.devBuf[:length]
+	n, err := v.dev.ReadAt(got, off)
+	if int64(n) < skip+int64(len(data)) {
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		return fmt.Errorf("reading device at %d: %w", off, err)
+	}
+	got = got[skip : skip+int64(len(data))]
+	if !bytes.Equal(got, data) {
+		i := 0
+		for got[i] == data[i] {
+			i++
+		}
+		return fmt.Errorf("%w at byte %d", ErrMismatch, v.pos+int64(i))
+	}
+	return nil
+}
+
+// normalize sorts and merges extents.
+func normalize(extents []Extent) []Extent {
+	sort.Slice(extents, func(i, j int) bool { return extents[i].Start < extents[j].Start })
+	var out []Extent
+	for _, e := range extents {
+		if last := len(out) - 1; last >= 0 && e.Start <= out[last].End {
+			out[last].End = max(out[last].End, e.End)
+			continue
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+// intersect returns the parts of the sorted extents that are also in mapped,
+// or the extents unchanged when mapped is nil.
+func intersect(extents, mapped []Extent) []Extent {
+	if mapped == nil {
+		return extents
+	}
+	var out []Extent
+	for _, e := range extents {
+		for _, m := range mapped {
+			if s, end := max(e.Start, m.Start), min(e.End, m.End); s < end {
+				out = append(out, Extent{s, end})
+			}
+		}
+	}
+	return out
+}
+
+// partitionStarts returns the byte offsets of the partitions in the MBR or GPT
+// partition table at the start of header.
+func partitionStarts(header []byte) []int64 {
+	if len(header) < 512 || header[510] != 0x55 || header[511] != 0xAA {
+		return nil
+	}
+	var starts []int64
+	for i := 0; i < 4; i++ {
+		entry := header[446+16*i : 446+16*(i+1)]
+		if entry[4] == 0xEE {
+			return gptStarts(header)
+		}
+		if lba := binary.LittleEndian.Uint32(entry[8:]); entry[4] != 0 && lba != 0 {
+			starts = append(starts, int64(lba)*512)
+		}
+	}
+	return starts
+}
+
+// gptStarts returns the partition offsets of a GPT with 512-byte sectors, as
+// far as its entries fit in header.
+func gptStarts(header []byte) []int64 {
+	const lba = 512
+	if len(header) < 2*lba || string(header[lba:lba+8]) != "EFI PART" {
+		return nil
+	}
+	table := int64(binary.LittleEndian.Uint64(header[lba+72:])) * lba
+	count := int64(binary.LittleEndian.Uint32(header[lba+80:]))
+	entrySize := int64(binary.LittleEndian.Uint32(header[lba+84:]))
+	if entrySize < 128 {
+		return nil
+	}
+	var starts []int64
+	for i := int64(0); i < count; i++ {
+		off := table + i*entrySize
+		if off+entrySize > int64(len(header)) {
+			break
+		}
+		entry := header[off : off+entrySize]
+		if bytes.Equal(entry[:16], make([]byte, 16)) {
+			continue // unused entry
+		}
+		starts = append(starts, int64(binary.LittleEndian.Uint64(entry[32:]))*lba)
+	}
+	return starts
+}
@@ -0,0 +1,151 @@
+package flash
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/husarion/husarion-os-flasher/util"
+)
+
+// RecompressBlockSize is the block size of recompressed xz images. Each block
+// is decompressed on its own core.
+const RecompressBlockSize = "32MiB"
+
+// XZBlocks returns how many blocks an xz image has, from `xz --robot -l`.
+// xz 5.4 and newer decompress the blocks of an archive on several cores, so a
+// single-block archive decompresses on one core only. Split images are not
+// listed.
+func XZBlocks(path string) (int, bool) {
+	if IsSplit(path) {
+		return 0, false
+	}
+	out, err := util.Command("xz", "--robot", "-l", path).Output()
+	if err != nil {
+		return 0, false
+	}
+	return parseXZBlocks(string(out))
+}
+
+// parseXZBlocks extracts the block count from `xz --robot -l` output, in the
+// third column of its "totals" line.
+func parseXZBlocks(out string) (int, bool) {
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) < 3 || fields[0] != "totals" {
+			continue
+		}
+		n, err := strconv.Atoi(fields[2])
+		return n, err == nil && n > 0
+	}
+	return 0, false
+}
+
+// RecompressXZ recompresses an xz image in blocks of RecompressBlockSize, so
+// that it decompresses on several cores. The new archive is written next to
+// the image and replaces it once it tests sound and holds as many bytes.
+// replaced, when not nil, is called just before that, e.g. to forget the
+// checksum of the old archive; its error leaves the image alone. prepare is
+// applied to the commands before they start, e.g. to lower their priority.
+// Images with a checksum or signature are left alone, as those cover the
+// archive's bytes.
+func RecompressXZ(path string, log io.Writer, replaced func() error, prepare ...func(*exec.Cmd)) error {
+	if IsSplit(path) {
+		return fmt.Errorf("%s is split", path)
+	}
+	if _, sums := SidecarChecksum(path); sums != "" {
+		return fmt.Errorf("%s has a checksum in %s", path, sums)
+	}
+	if _, err := os.Stat(SplitBase(path) + ".sig"); err == nil {
+		return fmt.Errorf("%s is signed", path)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	size, exact := XZUncompressedSize(path)
+	if !exact {
+		return fmt.Errorf("cannot list %s", path)
+	}
+
+	tmp := path + ".recompress"
+	defer os.Remove(tmp)
+	command := func(args ...string) *exec.Cmd {
+		cmd := util.Command("xz", args...)
+		cmd.Stdout = log
+		cmd.Stderr = log
+		for _, p := range prepare {
+			p(cmd)
+		}
+		return cmd
+	}
+	if err := recompress(path, tmp, command); err != nil {
+		return fmt.Errorf("recompressing %s: %w", path, err)
+	}
+	if err := command("-t", tmp).Run(); err != nil {
+		return fmt.Errorf("testing the recompressed %s: %w", path, err)
+	}
+	out, err := util.Command("xz", "--robot", "-l", tmp).Output()
+	if err != nil {
+		return fmt.Errorf("listing the recompressed %s: %w", path, err)
+	}
+	if got, ok := parseXZRobot(string(out)); !ok || got != size {
+		return fmt.Errorf("the recompressed %s holds %d bytes, not %d", path, got, size)
+	}
+	// Keep the times of the original: retention ranks versions by them
+	if err := os.Chtimes(tmp, accessTime(info), info.ModTime()); err != nil {
+		return err
+	}
+	if replaced != nil {
+		if err := replaced(); err != nil {
+			return err
+		}
+	}
+	return os.Rename(tmp, path)
+}
+
+// recompress writes src to dst in blocks, decompressing with one xz process
+// and compressing with another. When either fails the other gets EOF or
+// EPIPE, as this process keeps no end of the pipe between them.
+func recompress(src, dst string, command func(args ...string) *exec.Cmd) error {
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	decompress := command("-dc", src)
+	decompress.Stdout = w
+	compress := command("-T0", "--block-size="+RecompressBlockSize, "-c")
+	compress.Stdin = r
+	compress.Stdout = out
+
+	err = decompress.Start()
+	w.Close()
+	if err != nil {
+		r.Close()
+		return err
+	}
+	err = compress.Start()
+	r.Close()
+	if err != nil {
+		decompress.Process.Kill()
+		decompress.Wait()
+		return err
+	}
+	derr := decompress.Wait()
+	cerr := compress.Wait()
+	if derr != nil {
+		return derr
+	}
+	if cerr != nil {
+		return cerr
+	}
+	return out.Close()
+}
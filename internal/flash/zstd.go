@@ -0,0 +1,43 @@
+package flash
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/husarion/husarion-os-flasher/util"
+)
+
+// IsZstd reports whether an image (or split image part) is zstd-compressed.
+func IsZstd(path string) bool {
+	if strings.HasSuffix(SplitBase(path), ".zst") {
+		return true
+	}
+	format, _ := patternFormat(path)
+	return format == FormatZstd
+}
+
+// zstdSizeRe matches the exact size in the "Decompressed Size" line of
+// `zstd -lv` output.
+var zstdSizeRe = regexp.MustCompile(`Decompressed Size:.*\((\d+) B\)`)
+
+// ZstdUncompressedSize returns the uncompressed size recorded in the frame
+// headers of a zstd image, from `zstd -lv`. Archives compressed from a pipe
+// record none. Returns (bytes, exact).
+func ZstdUncompressedSize(path string) (int64, bool) {
+	out, err := util.Command("zstd", "-lv", path).CombinedOutput()
+	if err != nil {
+		return 0, false
+	}
+	return parseZstdList(string(out))
+}
+
+// parseZstdList extracts the uncompressed size from `zstd -lv` output.
+func parseZstdList(out string) (int64, bool) {
+	m := zstdSizeRe.FindStringSubmatch(out)
+	if m == nil {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(m[1], 10, 64)
+	return n, err == nil
+}
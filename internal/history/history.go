@@ -0,0 +1,139 @@
+// Package history records finished jobs in a CSV file and summarizes them into
+// flashing statistics: counts, success rates, durations, throughput per day and
+// failures per device model.
+package history
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strconv"
+	"time"
+)
+
+// FileName is the history file in the log directory.
+const FileName = "history.csv"
+
+// Entry is a finished job.
+type Entry struct {
+	Finished time.Time
+	Kind     string // flash, extract, check, firmware, can, burnin or action
+	Image    string // file name of the image
+	Device   string
+	Model    string // vendor and model of the device, when known
+	Result   string // success, failure or aborted
+	Duration time.Duration
+	Bytes    int64 // image size, for flashes
+	Operator string
+	Error    string
+	Robot    string // robot connected over USB during the job, when detected
+	Revision string // of the robot's controller
+	Serial   string // of the robot's controller
+	Details  string // file with the output of a failed job, relative to the log directory
+	Clock    string // "unsynced" when Finished comes from a clock that was not set
+	Power    string // PowerUndervoltage when the supply voltage dropped during the job
+}
+
+// PowerUndervoltage marks a job during which a Raspberry Pi reported a low
+// supply voltage, whose writes may be corrupt.
+const PowerUndervoltage = "undervoltage"
+
+// columns is the header row of the history file.
+var columns = []string{"finished", "kind", "image", "device", "model", "result", "duration_s", "bytes", "operator", "error", "robot", "robot_revision", "robot_serial", "details", "clock", "power"}
+
+// oldColumns is the number of columns of history files written before robots
+// were recorded. Files written since have more columns, up to all of them.
+const oldColumns = 10
+
+// Append adds e to the history file at path, creating it with a header row.
+func Append(path string, e Entry) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	if info, err := f.Stat(); err == nil && info.Size() == 0 {
+		_ = w.Write(columns)
+	}
+	_ = w.Write([]string{
+		e.Finished.Format(time.RFC3339),
+		e.Kind,
+		e.Image,
+		e.Device,
+		e.Model,
+		e.Result,
+		strconv.FormatFloat(e.Duration.Seconds(), 'f', 3, 64),
+		strconv.FormatInt(e.Bytes, 10),
+		e.Operator,
+		e.Error,
+		e.Robot,
+		e.Revision,
+		e.Serial,
+		e.Details,
+		e.Clock,
+		e.Power,
+	})
+	w.Flush()
+	return w.Error()
+}
+
+// Load reads the history file at path. A missing file is an empty history.
+func Load(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	var entries []Entry
+	for line := 1; ; line++ {
+		rec, err := r.Read()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return entries, fmt.Errorf("%s: %w", path, err)
+		}
+		if len(rec) < oldColumns || len(rec) > len(columns) {
+			return entries, fmt.Errorf("%s:%d: want %d fields, got %d", path, line, len(columns), len(rec))
+		}
+		rec = append(rec, make([]string, len(columns)-len(rec))...)
+		if line == 1 && rec[0] == columns[0] {
+			continue
+		}
+		finished, err := time.Parse(time.RFC3339, rec[0])
+		if err != nil {
+			return entries, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		seconds, _ := strconv.ParseFloat(rec[6], 64)
+		size, _ := strconv.ParseInt(rec[7], 10, 64)
+		entries = append(entries, Entry{
+			Finished: finished,
+			Kind:     rec[1],
+			Image:    rec[2],
+			Device:   rec[3],
+			Model:    rec[4],
+			Result:   rec[5],
+			Duration: time.Duration(seconds * float64(time.Second)),
+			Bytes:    size,
+			Operator: rec[8],
+			Error:    rec[9],
+			Robot:    rec[10],
+			Revision: rec[11],
+			Serial:   rec[12],
+			Details:  rec[13],
+			Clock:    rec[14],
+			Power:    rec[15],
+		})
+	}
+}
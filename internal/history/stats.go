@@ -0,0 +1,197 @@
+package history
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/husarion/husarion-os-flasher/util"
+)
+
+// TrendDays is how many days with flashes the throughput trend shows.
+const TrendDays = 14
+
+// Group aggregates the flashes sharing an image, a day or a device model.
+type Group struct {
+	Key       string
+	Flashes   int
+	Succeeded int
+	Failed    int
+	Aborted   int
+
+	duration time.Duration // of successful flashes
+	bytes    int64         // written by successful flashes
+}
+
+func (g *Group) add(e Entry) {
+	g.Flashes++
+	switch e.Result {
+	case "success":
+		g.Succeeded++
+		g.duration += e.Duration
+		g.bytes += e.Bytes
+	case "aborted":
+		g.Aborted++
+	default:
+		g.Failed++
+	}
+}
+
+// SuccessRate returns the share of flashes that succeeded, from 0 to 1.
+func (g Group) SuccessRate() float64 {
+	if g.Flashes == 0 {
+		return 0
+	}
+	return float64(g.Succeeded) / float64(g.Flashes)
+}
+
+// MeanDuration returns the mean duration of the successful flashes.
+func (g Group) MeanDuration() time.Duration {
+	if g.Succeeded == 0 {
+		return 0
+	}
+	return g.duration / time.Duration(g.Succeeded)
+}
+
+// Throughput returns the bytes per second written by the successful flashes.
+func (g Group) Throughput() float64 {
+	if g.duration <= 0 {
+		return 0
+	}
+	return float64(g.bytes) / g.duration.Seconds()
+}
+
+// Summary is the statistics of the flashes in a history.
+type Summary struct {
+	Total  Group
+	Images []Group // by number of flashes, most flashed first
+	Days   []Group // keyed YYYY-MM-DD, oldest first
+	Models []Group // by number of failures, most failing first
+}
+
+// Summarize computes the statistics of the flashes among entries.
+func Summarize(entries []Entry) Summary {
+	s := Summary{Total: Group{Key: "total"}}
+	images := map[string]*Group{}
+	days := map[string]*Group{}
+	models := map[string]*Group{}
+	group := func(m map[string]*Group, key string) *Group {
+		if m[key] == nil {
+			m[key] = &Group{Key: key}
+		}
+		return m[key]
+	}
+
+	for _, e := range entries {
+		if e.Kind != "flash" {
+			continue
+		}
+		model := e.Model
+		if model == "" {
+			model = "unknown"
+		}
+		s.Total.add(e)
+		group(images, e.Image).add(e)
+		group(days, e.Finished.Local().Format(time.DateOnly)).add(e)
+		group(models, model).add(e)
+	}
+
+	s.Images = sorted(images, func(a, b Group) bool { return a.Flashes > b.Flashes })
+	s.Days = sorted(days, func(a, b Group) bool { return a.Key < b.Key })
+	s.Models = sorted(models, func(a, b Group) bool { return a.Failed > b.Failed })
+	return s
+}
+
+// sorted returns the groups of m ordered by less, then by key.
+func sorted(m map[string]*Group, less func(a, b Group) bool) []Group {
+	list := make([]Group, 0, len(m))
+	for _, g := range m {
+		list = append(list, *g)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if less(list[i], list[j]) != less(list[j], list[i]) {
+			return less(list[i], list[j])
+		}
+		return list[i].Key < list[j].Key
+	})
+	return list
+}
+
+// Lines renders the summary as text for the statistics screen and the stats
+// command.
+func (s Summary) Lines() []string {
+	if s.Total.Flashes == 0 {
+		return []string{"No flashes recorded yet."}
+	}
+	t := s.Total
+	lines := []string{
+		fmt.Sprintf("Cards flashed: %d (%d ok, %d failed, %d aborted), success rate %.1f%%",
+			t.Flashes, t.Succeeded, t.Failed, t.Aborted, 100*t.SuccessRate()),
+		fmt.Sprintf("Mean duration %s, mean throughput %s/s",
+			util.FormatDuration(t.MeanDuration()), util.FormatBytes(int64(t.Throughput()))),
+		"",
+		"Per image:",
+	}
+	for _, g := range s.Images {
+		lines = append(lines, fmt.Sprintf("  %-40s %4d flashes  %5.1f%% ok  mean %s",
+			g.Key, g.Flashes, 100*g.SuccessRate(), util.FormatDuration(g.MeanDuration())))
+	}
+
+	lines = append(lines, "", "Throughput by day:")
+	days := s.Days[max(0, len(s.Days)-TrendDays):]
+	var fastest float64
+	for _, g := range days {
+		fastest = max(fastest, g.Throughput())
+	}
+	for _, g := range days {
+		bar := 0
+		if fastest > 0 {
+			bar = int(20 * g.Throughput() / fastest)
+		}
+		lines = append(lines, fmt.Sprintf("  %s %4d flashes %10s/s %s",
+			g.Key, g.Flashes, util.FormatBytes(int64(g.Throughput())), strings.Repeat("█", bar)))
+	}
+
+	lines = append(lines, "", "Failures by device model:")
+	for _, g := range s.Models {
+		lines = append(lines, fmt.Sprintf("  %-40s %4d of %d", g.Key, g.Failed, g.Flashes))
+	}
+	return lines
+}
+
+// WriteCSV writes the summary as one table, each row a group in a section:
+// total, image, day or model.
+func (s Summary) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"section", "key", "flashes", "succeeded", "failed", "aborted",
+		"success_rate", "mean_duration_s", "throughput_bytes_s"})
+	row := func(section string, g Group) {
+		_ = cw.Write([]string{
+			section,
+			g.Key,
+			strconv.Itoa(g.Flashes),
+			strconv.Itoa(g.Succeeded),
+			strconv.Itoa(g.Failed),
+			strconv.Itoa(g.Aborted),
+			strconv.FormatFloat(g.SuccessRate(), 'f', 3, 64),
+			strconv.FormatFloat(g.MeanDuration().Seconds(), 'f', 1, 64),
+			strconv.FormatFloat(g.Throughput(), 'f', 0, 64),
+		})
+	}
+	row("total", s.Total)
+	for _, g := range s.Images {
+		row("image", g)
+	}
+	for _, g := range s.Days {
+		row("day", g)
+	}
+	for _, g := range s.Models {
+		row("model", g)
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,91 @@
+// Package instance keeps a single flasher process in control of the devices. The
+// process holding the lock publishes its running jobs so that a second process,
+// for example the console while the SSH service runs, can show them read-only.
+package instance
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrLocked is returned by Acquire when another process holds the lock.
+var ErrLocked = errors.New("another flasher instance is running")
+
+// DefaultPath returns the lock file used when none is configured: under /run
+// where it exists, in the temporary directory otherwise.
+func DefaultPath() string {
+	dir := "/run"
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "husarion-os-flasher.lock")
+}
+
+// Status is what the lock holder publishes about itself.
+type Status struct {
+	PID     int       `yaml:"pid"`
+	Started time.Time `yaml:"started"`
+	Jobs    []string  `yaml:"jobs,omitempty"` // running jobs, one line each
+}
+
+// statusPath returns the file the status of the holder of the lock at path is
+// published in. It is separate from the lock file, which cannot be read while
+// locked on Windows.
+func statusPath(path string) string {
+	return path + ".status"
+}
+
+// Lock is a held instance lock.
+type Lock struct {
+	f       *os.File
+	path    string
+	started time.Time
+}
+
+// Acquire takes the lock at path without waiting. It returns ErrLocked when
+// another process holds it. The lock is released when the process exits.
+func Acquire(path string) (*Lock, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	l := &Lock{f: f, path: path, started: time.Now()}
+	return l, l.Publish(nil)
+}
+
+// Publish records the running jobs for processes in monitor mode.
+func (l *Lock) Publish(jobs []string) error {
+	out, err := yaml.Marshal(Status{PID: os.Getpid(), Started: l.started, Jobs: jobs})
+	if err != nil {
+		return err
+	}
+	tmp := statusPath(l.path) + ".tmp"
+	if err := os.WriteFile(tmp, out, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, statusPath(l.path))
+}
+
+// Release removes the published status and releases the lock.
+func (l *Lock) Release() {
+	_ = os.Remove(statusPath(l.path))
+	l.f.Close()
+}
+
+// ReadStatus returns the status published by the holder of the lock at path.
+func ReadStatus(path string) (Status, error) {
+	var s Status
+	b, err := os.ReadFile(statusPath(path))
+	if err != nil {
+		return s, err
+	}
+	return s, yaml.Unmarshal(b, &s)
+}
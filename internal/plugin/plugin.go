@@ -0,0 +1,263 @@
+// Package plugin runs site-specific plugins: executables in a directory that
+// speak JSON-RPC 2.0 over their standard input and output, one message per
+// line. Each plugin is started once and answers the flasher's requests in
+// turn:
+//
+//	initialize  {"version": "1.2.0"}
+//	            -> {"name": "nas", "capabilities": ["images", "verify", "post_flash"]}
+//	images      -> [{"path": "/mnt/nas/rosbot-xl.img.xz"}]
+//	verify      {"image": "...", "device": "/dev/sdb"} -> {"ok": true, "message": "..."}
+//	post_flash  {"image": "...", "device": "/dev/sdb"} -> {"ok": true, "message": "..."}
+//
+// images adds image files to the image list, verify checks a written device
+// after the flasher's own verification, and post_flash runs once a flash is
+// verified. A plugin that exits or times out is started again for the next
+// request.
+package plugin
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Capabilities a plugin declares in its initialize result.
+const (
+	Images    = "images"
+	Verify    = "verify"
+	PostFlash = "post_flash"
+)
+
+// InitTimeout bounds the initialize request.
+const InitTimeout = 10 * time.Second
+
+// stderrTail is how much of a plugin's standard error is kept for error
+// messages.
+const stderrTail = 2048
+
+// Plugin is a running plugin executable.
+type Plugin struct {
+	Path         string
+	Name         string   // from initialize, the file name by default
+	Capabilities []string // from initialize
+
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	stderr *tail
+	nextID int
+}
+
+// Result is the result of the verify and post_flash requests.
+type Result struct {
+	OK      bool   `json:"ok"`
+	Message string `json:"message,omitempty"`
+}
+
+// Image is an image a plugin adds to the image list.
+type Image struct {
+	Path string `json:"path"`
+}
+
+// Load starts and initializes the executables in dir, sorted by name. Plugins
+// that fail to start are left out and returned as errors.
+func Load(dir, version string) ([]*Plugin, []error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, []error{err}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	var plugins []*Plugin
+	var errs []error
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || !info.Mode().IsRegular() || info.Mode().Perm()&0o111 == 0 {
+			continue
+		}
+		p := &Plugin{Path: filepath.Join(dir, e.Name()), Name: e.Name()}
+		var init struct {
+			Name         string   `json:"name"`
+			Capabilities []string `json:"capabilities"`
+		}
+		if err := p.Call("initialize", map[string]string{"version": version}, &init, InitTimeout); err != nil {
+			p.Close()
+			errs = append(errs, err)
+			continue
+		}
+		if init.Name != "" {
+			p.Name = init.Name
+		}
+		p.Capabilities = init.Capabilities
+		plugins = append(plugins, p)
+	}
+	return plugins, errs
+}
+
+// Has reports whether the plugin declared a capability.
+func (p *Plugin) Has(capability string) bool {
+	return slices.Contains(p.Capabilities, capability)
+}
+
+type request struct {
+	JSONRPC string `json:"jsonrpc"`
+	ID      int    `json:"id"`
+	Method  string `json:"method"`
+	Params  any    `json:"params,omitempty"`
+}
+
+type response struct {
+	ID     *int            `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Call sends a request to the plugin, starting it if needed, and decodes its
+// result into result. A plugin that does not answer within timeout is killed.
+func (p *Plugin) Call(method string, params, result any, timeout time.Duration) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.start(); err != nil {
+		return fmt.Errorf("plugin %s: %v", p.Name, err)
+	}
+
+	p.nextID++
+	id := p.nextID
+	b, err := json.Marshal(request{JSONRPC: "2.0", ID: id, Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	if _, err := p.stdin.Write(append(b, '\n')); err != nil {
+		p.stop()
+		return p.failed(method, err)
+	}
+
+	answer := make(chan response, 1)
+	failure := make(chan error, 1)
+	go func() {
+		for {
+			line, err := p.stdout.ReadBytes('\n')
+			if err != nil {
+				failure <- err
+				return
+			}
+			var r response
+			// Notifications and stray output are skipped
+			if json.Unmarshal(line, &r) == nil && r.ID != nil && *r.ID == id {
+				answer <- r
+				return
+			}
+		}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case r := <-answer:
+		if r.Error != nil {
+			return fmt.Errorf("plugin %s: %s: %s", p.Name, method, r.Error.Message)
+		}
+		if result == nil {
+			return nil
+		}
+		if err := json.Unmarshal(r.Result, result); err != nil {
+			return fmt.Errorf("plugin %s: %s: bad result: %v", p.Name, method, err)
+		}
+		return nil
+	case err := <-failure:
+		p.stop()
+		return p.failed(method, err)
+	case <-timer.C:
+		p.stop()
+		return fmt.Errorf("plugin %s: %s: no answer within %s", p.Name, method, timeout)
+	}
+}
+
+// failed describes a plugin that broke off a request, with the end of its
+// standard error.
+func (p *Plugin) failed(method string, err error) error {
+	if errors.Is(err, io.EOF) {
+		err = errors.New("exited")
+	}
+	if msg := strings.TrimSpace(p.stderr.String()); msg != "" {
+		return fmt.Errorf("plugin %s: %s: %v: %s", p.Name, method, err, msg)
+	}
+	return fmt.Errorf("plugin %s: %s: %v", p.Name, method, err)
+}
+
+// start runs the plugin executable unless it is running.
+func (p *Plugin) start() error {
+	if p.cmd != nil {
+		return nil
+	}
+	cmd := exec.Command(p.Path)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	p.stderr = &tail{}
+	cmd.Stderr = p.stderr
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	p.cmd, p.stdin, p.stdout = cmd, stdin, bufio.NewReader(stdout)
+	return nil
+}
+
+// stop kills the plugin executable; the next request starts it again.
+func (p *Plugin) stop() {
+	if p.cmd == nil {
+		return
+	}
+	_ = p.stdin.Close()
+	_ = p.cmd.Process.Kill()
+	_ = p.cmd.Wait()
+	p.cmd = nil
+}
+
+// Close stops the plugin.
+func (p *Plugin) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stop()
+}
+
+// tail keeps the end of what is written to it.
+type tail struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (t *tail) Write(b []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.buf = append(t.buf, b...)
+	if over := len(t.buf) - stderrTail; over > 0 {
+		t.buf = t.buf[over:]
+	}
+	return len(b), nil
+}
+
+func (t *tail) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return string(t.buf)
+}
@@ -0,0 +1,86 @@
+// Package robot detects the controller of a robot connected to the station over
+// USB, such as the CORE2 of a ROSbot or the Panther's main board, from the
+// descriptors it reports.
+package robot
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Controller is a USB device, as it describes itself.
+type Controller struct {
+	Vendor       string // idVendor, four hex digits
+	Product      string // idProduct, four hex digits
+	Manufacturer string
+	Name         string // product string
+	Serial       string
+	Revision     string // device release (bcdDevice) as "major.minor"
+	Port         string // serial port, e.g. /dev/ttyACM0, empty when it has none
+}
+
+// Rule recognizes the controller of a robot model. Empty fields match any
+// controller, but at least one of USB and Name must be set.
+type Rule struct {
+	Model  string // robot reported on a match, e.g. "ROSbot 2R"
+	USB    string // "vendor:product" ids, e.g. "0483:5740"
+	Name   string // shell pattern matched against the product or manufacturer string
+	EEPROM string // EEPROM configuration applied to this robot, empty for the default
+}
+
+// Matches reports whether c is the controller r recognizes.
+func (r Rule) Matches(c Controller) bool {
+	if r.USB == "" && r.Name == "" {
+		return false
+	}
+	if r.USB != "" && !strings.EqualFold(r.USB, c.Vendor+":"+c.Product) {
+		return false
+	}
+	if r.Name != "" {
+		name, _ := filepath.Match(r.Name, c.Name)
+		manufacturer, _ := filepath.Match(r.Name, c.Manufacturer)
+		if !name && !manufacturer {
+			return false
+		}
+	}
+	return true
+}
+
+// Robot is a detected robot: the rule that recognized it and its controller.
+type Robot struct {
+	Rule
+	Controller Controller
+}
+
+// String describes the robot for the log, e.g. "ROSbot 2R rev 1.00 (serial 12345)".
+func (r Robot) String() string {
+	s := r.Model
+	if r.Controller.Revision != "" {
+		s += " rev " + r.Controller.Revision
+	}
+	if r.Controller.Serial != "" {
+		s += fmt.Sprintf(" (serial %s)", r.Controller.Serial)
+	}
+	return s
+}
+
+// Detect returns the robot whose controller is connected, trying rules in
+// order. With several robots connected the first rule matching wins.
+func Detect(rules []Rule) (Robot, bool, error) {
+	if len(rules) == 0 {
+		return Robot{}, false, nil
+	}
+	controllers, err := Controllers()
+	if err != nil {
+		return Robot{}, false, err
+	}
+	for _, rule := range rules {
+		for _, c := range controllers {
+			if rule.Matches(c) {
+				return Robot{Rule: rule, Controller: c}, true, nil
+			}
+		}
+	}
+	return Robot{}, false, nil
+}
@@ -0,0 +1,82 @@
+package robot
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// usbDevices is where the kernel lists USB devices and their interfaces.
+const usbDevices = "/sys/bus/usb/devices"
+
+// Controllers lists the connected USB devices, in bus order.
+func Controllers() ([]Controller, error) {
+	entries, err := os.ReadDir(usbDevices)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		// Interfaces are named bus-port:config.interface
+		if !strings.Contains(e.Name(), ":") {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+
+	var controllers []Controller
+	for _, name := range names {
+		dir := filepath.Join(usbDevices, name)
+		c := Controller{
+			Vendor:       sysfsAttr(dir, "idVendor"),
+			Product:      sysfsAttr(dir, "idProduct"),
+			Manufacturer: sysfsAttr(dir, "manufacturer"),
+			Name:         sysfsAttr(dir, "product"),
+			Serial:       sysfsAttr(dir, "serial"),
+			Revision:     bcdRevision(sysfsAttr(dir, "bcdDevice")),
+			Port:         serialPort(dir),
+		}
+		if c.Vendor == "" || c.Product == "" {
+			continue
+		}
+		controllers = append(controllers, c)
+	}
+	return controllers, nil
+}
+
+// sysfsAttr returns a sysfs attribute of dir, empty when it is missing.
+func sysfsAttr(dir, name string) string {
+	b, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// bcdRevision formats a binary-coded decimal release number like "0102" as
+// "1.02".
+func bcdRevision(bcd string) string {
+	if len(bcd) != 4 {
+		return bcd
+	}
+	major := strings.TrimLeft(bcd[:2], "0")
+	if major == "" {
+		major = "0"
+	}
+	return major + "." + bcd[2:]
+}
+
+// serialPort returns the tty of a USB device's interfaces: ttyACM devices
+// appear under a tty directory, USB serial converters directly.
+func serialPort(dir string) string {
+	for _, pattern := range []string{"*:*/tty/tty*", "*:*/tty*"} {
+		matches, _ := filepath.Glob(filepath.Join(dir, pattern))
+		for _, m := range matches {
+			if name := filepath.Base(m); name != "tty" {
+				return "/dev/" + name
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package robot
+
+// Controllers lists no devices: USB detection relies on Linux sysfs.
+func Controllers() ([]Controller, error) {
+	return nil, nil
+}
@@ -0,0 +1,240 @@
+// Package sign signs images produced by the flasher, such as backups, with an
+// SSH key. Signatures use the format of ssh-keygen -Y sign, so they can be
+// checked with ssh-keygen -Y verify as well as by the flasher.
+package sign
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// Suffix is appended to a file name to form its signature file.
+const Suffix = ".sig"
+
+// Namespace is the signature namespace, to be passed as -n to ssh-keygen.
+const Namespace = "file"
+
+const (
+	magic   = "SSHSIG"
+	version = 1
+	hashAlg = "sha512"
+)
+
+// LoadKey reads an unencrypted OpenSSH private key.
+func LoadKey(path string) (gossh.Signer, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := gossh.ParsePrivateKey(b)
+	if err != nil {
+		return nil, fmt.Errorf("signing key %s: %w", path, err)
+	}
+	return signer, nil
+}
+
+// File signs a file with signer and writes the armored signature to
+// path+Suffix, returning its path.
+func File(path string, signer gossh.Signer) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha512.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	// The signed data is defined by OpenSSH's PROTOCOL.sshsig
+	var signed bytes.Buffer
+	signed.WriteString(magic)
+	writeString(&signed, []byte(Namespace))
+	writeString(&signed, nil) // reserved
+	writeString(&signed, []byte(hashAlg))
+	writeString(&signed, h.Sum(nil))
+
+	var sig *gossh.Signature
+	if s, ok := signer.(gossh.AlgorithmSigner); ok && signer.PublicKey().Type() == gossh.KeyAlgoRSA {
+		// ssh-keygen rejects SHA-1 RSA signatures
+		sig, err = s.SignWithAlgorithm(rand.Reader, signed.Bytes(), gossh.KeyAlgoRSASHA512)
+	} else {
+		sig, err = signer.Sign(rand.Reader, signed.Bytes())
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var blob bytes.Buffer
+	blob.WriteString(magic)
+	binary.Write(&blob, binary.BigEndian, uint32(version))
+	writeString(&blob, signer.PublicKey().Marshal())
+	writeString(&blob, []byte(Namespace))
+	writeString(&blob, nil)
+	writeString(&blob, []byte(hashAlg))
+	writeString(&blob, gossh.Marshal(sig))
+
+	sigPath := path + Suffix
+	tmp := sigPath + ".tmp"
+	if err := os.WriteFile(tmp, armor(blob.Bytes()), 0o644); err != nil {
+		return "", err
+	}
+	return sigPath, os.Rename(tmp, sigPath)
+}
+
+// LoadKeys reads the public keys trusted to sign images, one per line in the
+// authorized_keys format. The principals that start the lines of an
+// ssh-keygen allowed_signers file are ignored, so such a file can be used too.
+func LoadKeys(path string) ([]gossh.PublicKey, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var keys []gossh.PublicKey
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		key, _, _, _, err := gossh.ParseAuthorizedKey([]byte(text))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		keys = append(keys, key)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%s: no keys", path)
+	}
+	return keys, nil
+}
+
+// Verify checks the signature in path+Suffix against sums, the digests of the
+// signed file by hash algorithm ("sha256", "sha512"), which lets the caller
+// hash the file once for several purposes. It returns the key that made the
+// signature, which must be one of keys.
+func Verify(path string, sums map[string][]byte, keys []gossh.PublicKey) (gossh.PublicKey, error) {
+	armored, err := os.ReadFile(path + Suffix)
+	if err != nil {
+		return nil, err
+	}
+	blob, err := dearmor(armored)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path+Suffix, err)
+	}
+
+	r := bytes.NewReader(blob)
+	if m := make([]byte, len(magic)); readFull(r, m) != nil || string(m) != magic {
+		return nil, errors.New("not an SSH signature")
+	}
+	var v uint32
+	if binary.Read(r, binary.BigEndian, &v) != nil || v != version {
+		return nil, fmt.Errorf("unsupported signature version %d", v)
+	}
+	fields := make([][]byte, 5) // public key, namespace, reserved, hash algorithm, signature
+	for i := range fields {
+		if fields[i], err = readString(r); err != nil {
+			return nil, errors.New("truncated signature")
+		}
+	}
+	pub, err := gossh.ParsePublicKey(fields[0])
+	if err != nil {
+		return nil, err
+	}
+	if string(fields[1]) != Namespace {
+		return nil, fmt.Errorf("signature namespace is %q, want %q", fields[1], Namespace)
+	}
+	alg := string(fields[3])
+	sum, ok := sums[alg]
+	if !ok {
+		return nil, fmt.Errorf("no %s digest to check the signature with", alg)
+	}
+	var sig gossh.Signature
+	if err := gossh.Unmarshal(fields[4], &sig); err != nil {
+		return nil, err
+	}
+
+	trusted := false
+	for _, key := range keys {
+		trusted = trusted || bytes.Equal(key.Marshal(), pub.Marshal())
+	}
+	if !trusted {
+		return nil, fmt.Errorf("signed by untrusted key %s", gossh.FingerprintSHA256(pub))
+	}
+
+	var signed bytes.Buffer
+	signed.WriteString(magic)
+	writeString(&signed, []byte(Namespace))
+	writeString(&signed, nil)
+	writeString(&signed, []byte(alg))
+	writeString(&signed, sum)
+	if err := pub.Verify(signed.Bytes(), &sig); err != nil {
+		return nil, fmt.Errorf("bad signature: %w", err)
+	}
+	return pub, nil
+}
+
+// readString reads an SSH wire format string.
+func readString(r *bytes.Reader) ([]byte, error) {
+	var n uint32
+	if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+		return nil, err
+	}
+	if int64(n) > int64(r.Len()) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	s := make([]byte, n)
+	return s, readFull(r, s)
+}
+
+// readFull fills b from r.
+func readFull(r io.Reader, b []byte) error {
+	_, err := io.ReadFull(r, b)
+	return err
+}
+
+// dearmor decodes a signature written by armor or ssh-keygen.
+func dearmor(armored []byte) ([]byte, error) {
+	text := strings.TrimSpace(string(armored))
+	body, begin := strings.CutPrefix(text, "-----BEGIN SSH SIGNATURE-----")
+	body, end := strings.CutSuffix(body, "-----END SSH SIGNATURE-----")
+	if !begin || !end {
+		return nil, errors.New("not an armored SSH signature")
+	}
+	return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(body), ""))
+}
+
+// writeString appends an SSH wire format string: its length, then its bytes.
+func writeString(b *bytes.Buffer, s []byte) {
+	binary.Write(b, binary.BigEndian, uint32(len(s)))
+	b.Write(s)
+}
+
+// armor encodes a signature blob as ssh-keygen writes it.
+func armor(blob []byte) []byte {
+	enc := base64.StdEncoding.EncodeToString(blob)
+	var b strings.Builder
+	b.WriteString("-----BEGIN SSH SIGNATURE-----\n")
+	for len(enc) > 70 {
+		b.WriteString(enc[:70] + "\n")
+		enc = enc[70:]
+	}
+	b.WriteString(enc + "\n")
+	b.WriteString("-----END SSH SIGNATURE-----\n")
+	return []byte(b.String())
+}
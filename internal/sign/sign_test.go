@@ -0,0 +1,53 @@
+package sign
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"os"
+	"path/filepath"
+	"testing"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func TestVerify(t *testing.T) {
+	dir := t.TempDir()
+	image := filepath.Join(dir, "image.img")
+	data := []byte("husarion os image")
+	if err := os.WriteFile(image, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	newSigner := func() gossh.Signer {
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signer, err := gossh.NewSignerFromKey(priv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signer
+	}
+	signer, other := newSigner(), newSigner()
+	if _, err := File(image, signer); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha512.Sum512(data)
+	sums := map[string][]byte{"sha512": sum[:]}
+
+	key, err := Verify(image, sums, []gossh.PublicKey{other.PublicKey(), signer.PublicKey()})
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if gossh.FingerprintSHA256(key) != gossh.FingerprintSHA256(signer.PublicKey()) {
+		t.Errorf("Verify returned key %s, want the signer's", gossh.FingerprintSHA256(key))
+	}
+	if _, err := Verify(image, sums, []gossh.PublicKey{other.PublicKey()}); err == nil {
+		t.Error("Verify accepted an untrusted key")
+	}
+	tampered := sha512.Sum512([]byte("another image"))
+	if _, err := Verify(image, map[string][]byte{"sha512": tampered[:]}, []gossh.PublicKey{signer.PublicKey()}); err == nil {
+		t.Error("Verify accepted the signature of another file")
+	}
+}
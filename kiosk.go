@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"runtime/debug"
+	"sync"
+	"syscall"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/log"
+
+	"github.com/husarion/husarion-os-flasher/config"
+	"github.com/husarion/husarion-os-flasher/ui"
+)
+
+const (
+	// defaultKioskTTY is the virtual terminal the kiosk takes over.
+	defaultKioskTTY = "/dev/tty1"
+
+	// kioskRestartDelay keeps a UI that fails on start from spinning.
+	kioskRestartDelay = 2 * time.Second
+)
+
+// runKiosk runs the UI on a virtual terminal and restarts it whenever it exits or
+// crashes, until the user powers off from the UI or the process is signalled.
+// It returns the exit code.
+func runKiosk(ttyPath, osImgPath string, cfg *config.Config) int {
+	tty, err := openKioskTTY(ttyPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+	defer tty.Close()
+
+	var (
+		mu      sync.Mutex
+		current *tea.Program
+		stopped bool
+	)
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-stop
+		mu.Lock()
+		defer mu.Unlock()
+		stopped = true
+		if current != nil {
+			current.Quit()
+		}
+	}()
+
+	for {
+		model := ui.NewModel(osImgPath, cfg, minListWidth, 20)
+		model.Kiosk = true
+		p := tea.NewProgram(model, tea.WithInput(tty), tea.WithOutput(tty), tea.WithAltScreen(),
+			tea.WithMouseCellMotion(), tea.WithoutCatchPanics(), tea.WithoutSignalHandler())
+
+		mu.Lock()
+		if stopped {
+			mu.Unlock()
+			return 0
+		}
+		current = p
+		mu.Unlock()
+
+		final, err := runKioskProgram(p)
+
+		mu.Lock()
+		current = nil
+		done := stopped
+		mu.Unlock()
+		if done {
+			return 0
+		}
+		if m, ok := final.(ui.Model); ok && m.ShutdownRequested {
+			return 0
+		}
+		if err != nil {
+			log.Error("UI exited, restarting", "error", err)
+		} else {
+			log.Info("UI exited, restarting")
+		}
+		time.Sleep(kioskRestartDelay)
+	}
+}
+
+// runKioskProgram runs p and turns a panic into a crash report and an error
+// instead of exiting, so the kiosk can restart the UI.
+func runKioskProgram(p *tea.Program) (final tea.Model, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			p.Kill()
+			err = fmt.Errorf("crashed: %v", r)
+			if path, werr := ui.WriteCrashDump(r, debug.Stack()); werr == nil {
+				err = fmt.Errorf("crashed: %v (crash report: %s)", r, path)
+			}
+		}
+	}()
+	return p.Run()
+}
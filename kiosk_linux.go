@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Console ioctls from linux/vt.h.
+const (
+	vtActivate   = 0x5606
+	vtWaitActive = 0x5607
+)
+
+// openKioskTTY opens a virtual terminal, switches the console to it and turns
+// off screen blanking and powerdown, like `setterm -blank 0 -powerdown 0`.
+func openKioskTTY(path string) (*os.File, error) {
+	tty, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("opening kiosk terminal: %w", err)
+	}
+
+	// /dev/ttyN is a virtual terminal that can be brought to the front
+	if n, err := strconv.Atoi(strings.TrimPrefix(path, "/dev/tty")); err == nil && n > 0 {
+		for _, req := range []uintptr{vtActivate, vtWaitActive} {
+			if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, tty.Fd(), req, uintptr(n)); errno != 0 {
+				tty.Close()
+				return nil, fmt.Errorf("switching to %s: %v", path, errno)
+			}
+		}
+	}
+
+	if _, err := tty.WriteString("\x1b[9;0]\x1b[14;0]"); err != nil {
+		tty.Close()
+		return nil, fmt.Errorf("disabling console blanking: %w", err)
+	}
+	return tty, nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// openKioskTTY is only available on Linux, where the flasher runs as an appliance.
+func openKioskTTY(path string) (*os.File, error) {
+	return nil, errors.New("kiosk mode is only supported on Linux")
+}
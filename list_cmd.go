@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/husarion/husarion-os-flasher/config"
+	"github.com/husarion/husarion-os-flasher/ui"
+	"github.com/husarion/husarion-os-flasher/util"
+)
+
+const devicesUsage = `Usage:
+  husarion-os-flasher devices [--os-img-path DIR] [--json]
+
+Lists the devices that can be flashed, as the device list of the UI shows them.
+Devices whose last write was cut short are reported as suspect. --json prints
+them as a JSON array instead.
+`
+
+const imagesUsage = `Usage:
+  husarion-os-flasher images [--os-img-path DIR] [--config FILE] [--robot MODEL] [--json]
+
+Lists the images of DIR, as the image list of the UI shows them, marking those
+built for the robot (by default the one of the config). --json prints them as a
+JSON array instead.
+`
+
+// runDevicesCommand prints the devices that can be flashed.
+func runDevicesCommand(args []string) int {
+	fs := flag.NewFlagSet("devices", flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, devicesUsage) }
+	osImgPath := fs.String("os-img-path", ".", "Path to OS image files directory")
+	asJSON := fs.Bool("json", false, "Print the devices as JSON")
+	if _, err := applyEnv(fs); err != nil {
+		return failed(err)
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fmt.Fprint(os.Stderr, devicesUsage)
+		return exitUsage
+	}
+
+	devices, err := ui.ListDevices(*osImgPath)
+	if err != nil {
+		return failed(err)
+	}
+	if *asJSON {
+		if err := writeJSON(os.Stdout, devices); err != nil {
+			return failed(err)
+		}
+		return exitOK
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, d := range devices {
+		size := "?"
+		if d.Size > 0 {
+			size = util.FormatBytes(d.Size)
+		}
+		desc := d.Description
+		if d.ReadOnly {
+			desc += ", write-protected"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", d.Path, size, d.Model, desc)
+	}
+	w.Flush()
+	return exitOK
+}
+
+// runImagesCommand prints the images of an image directory.
+func runImagesCommand(args []string) int {
+	fs := flag.NewFlagSet("images", flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, imagesUsage) }
+	osImgPath := fs.String("os-img-path", ".", "Path to OS image files directory")
+	configPath := fs.String("config", config.DefaultPath, "Path to YAML config file")
+	robot := fs.String("robot", "", "Robot the recommended images are built for")
+	asJSON := fs.Bool("json", false, "Print the images as JSON")
+	fromEnv, err := applyEnv(fs)
+	if err != nil {
+		return failed(err)
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fmt.Fprint(os.Stderr, imagesUsage)
+		return exitUsage
+	}
+
+	cfg, err := loadConfig(fs, *configPath, fromEnv)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error loading config:", err)
+		return exitFailure
+	}
+	target := *robot
+	if target == "" {
+		target = cfg.Robot
+	}
+
+	images, err := ui.ListImages(*osImgPath, target)
+	if err != nil {
+		return failed(err)
+	}
+	if *asJSON {
+		if err := writeJSON(os.Stdout, images); err != nil {
+			return failed(err)
+		}
+		return exitOK
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, img := range images {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", img.Name, util.FormatBytes(img.Size), img.Description)
+	}
+	w.Flush()
+	return exitOK
+}
+
+// writeJSON prints v as indented JSON.
+func writeJSON(out io.Writer, v any) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -1,13 +1,16 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"errors"
 	"flag"
 	"fmt"
+	"net"
 	"os"
 	"os/signal"
-	"os/user"
+	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
@@ -18,29 +21,125 @@ import (
 	"github.com/charmbracelet/wish/activeterm"
 	"github.com/charmbracelet/wish/bubbletea"
 	"github.com/charmbracelet/wish/logging"
+	"github.com/muesli/termenv"
+	gossh "golang.org/x/crypto/ssh"
 	
+	"github.com/husarion/husarion-os-flasher/config"
+	"github.com/husarion/husarion-os-flasher/internal/flash"
+	"github.com/husarion/husarion-os-flasher/internal/instance"
+	"github.com/husarion/husarion-os-flasher/platform"
 	"github.com/husarion/husarion-os-flasher/ui"
+	"github.com/husarion/husarion-os-flasher/util"
 )
 
 const (
 	// Minimal width for each selection window.
 	minListWidth = 50
+
+	// defaultHostKeyPath is where the SSH server keeps its host key. It is
+	// generated on first start.
+	defaultHostKeyPath = "/var/lib/husarion-flasher/ssh_host_ed25519"
 )
 
 func main() {
-	currentUser, err := user.Current()
+	// Tool subcommands run without the UI
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "delta":
+			os.Exit(runDeltaCommand(os.Args[2:]))
+		case "bmap":
+			os.Exit(runBmapCommand(os.Args[2:]))
+		case "doctor":
+			os.Exit(runDoctorCommand(os.Args[2:]))
+		case "discover":
+			os.Exit(runDiscoverCommand(os.Args[2:]))
+		case "remote":
+			os.Exit(runRemoteCommand(os.Args[2:]))
+		case "stats":
+			os.Exit(runStatsCommand(os.Args[2:]))
+		case "devices":
+			os.Exit(runDevicesCommand(os.Args[2:]))
+		case "images":
+			os.Exit(runImagesCommand(os.Args[2:]))
+		case "verify":
+			os.Exit(runVerifyCommand(os.Args[2:]))
+		case "extract":
+			os.Exit(runExtractCommand(os.Args[2:]))
+		case "backup":
+			os.Exit(runBackupCommand(os.Args[2:]))
+		case "download":
+			os.Exit(runDownloadCommand(os.Args[2:]))
+		case "replay":
+			os.Exit(runReplayCommand(os.Args[2:]))
+		case "setup":
+			os.Exit(runSetupCommand(os.Args[2:]))
+		}
+	}
+
+	// Define and parse command-line flags
+	sshPort := flag.Int("port", 2222, "Port number for SSH server (1-65535)")
+	osImgPath := flag.String("os-img-path", ".", "Path to OS image files directory")
+	enableSsh := flag.Bool("enable-ssh", false, "Run in SSH server mode")
+	hostKeyPath := flag.String("host-key", defaultHostKeyPath, "Path to the SSH host key, generated if missing")
+	maxSessions := flag.Int("max-sessions", 8, "Maximum number of concurrent SSH sessions (0 for no limit)")
+	maxConnRate := flag.Int("max-conn-rate", 10, "SSH connections per minute from one address before it is banned for a while (0 for no limit)")
+	mdns := flag.Bool("mdns", true, "Announce the SSH server over mDNS through avahi-daemon")
+	banList := flag.String("ban-list", "", "File with IP addresses or CIDR ranges refused by the SSH server, one per line")
+	coordinate := flag.Bool("coordinate", false, "Accept reports from agent stations and dispatch jobs to them (SSH mode)")
+	coordinator := flag.String("coordinator", "", "Report this station to the coordinator at HOST:PORT (SSH mode)")
+	coordinatorKey := flag.String("coordinator-key", "", "Expected SHA256 fingerprint of the coordinator's host key")
+	stationName := flag.String("station-name", "", "Name of this station in the coordinator's dashboard (default the hostname)")
+	lockPath := flag.String("lock-file", instance.DefaultPath(), "Lock file that keeps a single flasher process in control of the devices")
+	configPath := flag.String("config", config.DefaultPath, "Path to YAML config file")
+	kiosk := flag.Bool("kiosk", false, "Run as an appliance on a virtual terminal, restarting the UI when it exits")
+	kioskTTY := flag.String("kiosk-tty", defaultKioskTTY, "Virtual terminal used in kiosk mode")
+	demo := flag.Bool("demo", false, "Show the UI with made-up devices and simulated jobs, without root or hardware")
+
+	// Environment variables override defaults, explicit flags override both
+	fromEnv, err := applyEnv(flag.CommandLine)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "Error retrieving user info:", err)
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
-	if currentUser.Uid != "0" {
-		fmt.Fprintln(os.Stderr, "This program must be run as root.")
+	flag.Parse()
+
+	if !*demo && !util.IsPrivileged() {
+		fmt.Fprintf(os.Stderr, "This program must be run as %s.\n", util.PrivilegedUser)
+		if platform.InContainer() {
+			fmt.Fprintln(os.Stderr, "In a container, run it with --privileged; see `husarion-os-flasher doctor`.")
+		}
 		os.Exit(1)
 	}
 
-	// Define and parse command-line flags
-	sshPort := flag.Int("port", 2222, "Port number for SSH server (1-65535)")
-	osImgPath := flag.String("os-img-path", ".", "Path to OS image files directory")
+	// A first start in a terminal without a config asks for the settings
+	if !*demo && !*kiosk && needsSetup(flag.CommandLine, *configPath, fromEnv) {
+		if err := runSetup(*configPath, *osImgPath, bufio.NewReader(os.Stdin), os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+	}
+	cfg, err := loadConfig(flag.CommandLine, *configPath, fromEnv)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error loading config:", err)
+		os.Exit(1)
+	}
+	// Settings of the config apply unless their flags are given
+	explicit := explicitFlags(flag.CommandLine, fromEnv)
+	if cfg.ImageDir != "" && !explicit["os-img-path"] {
+		*osImgPath = cfg.ImageDir
+	}
+	if cfg.EnableSSH && !explicit["enable-ssh"] && !*kiosk {
+		*enableSsh = true
+	}
+	if cfg.SSHPort != 0 && !explicit["port"] {
+		*sshPort = cfg.SSHPort
+	}
+	ui.SetTheme(cfg.Theme)
+
+	if *kiosk && *enableSsh {
+		fmt.Fprintln(os.Stderr, "--kiosk and --enable-ssh cannot be combined")
+		os.Exit(1)
+	}
 
 	// Validate port number
 	if *sshPort < 1 || *sshPort > 65535 {
@@ -48,32 +147,105 @@ func main() {
 		os.Exit(1)
 	}
 
-	enableSsh := flag.Bool("enable-ssh", false, "Run in SSH server mode")
-	flag.Parse()
+	if (*coordinate || *coordinator != "") && !*enableSsh {
+		fmt.Fprintln(os.Stderr, "--coordinate and --coordinator require --enable-ssh")
+		os.Exit(1)
+	}
+
+	if *maxSessions < 0 || *maxConnRate < 0 {
+		fmt.Fprintln(os.Stderr, "--max-sessions and --max-conn-rate cannot be negative")
+		os.Exit(1)
+	}
+
+	// Only one process may write to devices. A second one is refused, or only
+	// monitors while the first is flashing. The demo writes to none.
+	if *demo {
+		dir, err := ui.StartDemo()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error preparing the demo:", err)
+			os.Exit(1)
+		}
+		defer os.RemoveAll(dir)
+		*osImgPath = dir
+	} else if lock, err := instance.Acquire(*lockPath); errors.Is(err, instance.ErrLocked) {
+		status, _ := instance.ReadStatus(*lockPath)
+		if len(status.Jobs) == 0 {
+			fmt.Fprintf(os.Stderr, "Another flasher instance is running (pid %d).\n", status.PID)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "Another flasher instance (pid %d) is flashing; starting in read-only monitor mode.\n", status.PID)
+		ui.MonitorInstance(*lockPath)
+	} else if err != nil {
+		log.Warn("Cannot take the instance lock, other flasher processes will not be detected", "error", err)
+	} else {
+		ui.SetInstanceLock(lock)
+	}
 
-	if !*enableSsh {
+	if *demo {
+		// The config's hooks and actions would run for real
+		cfg = &config.Config{Verify: "quick"}
+	}
+	if cfg.PluginsDir != "" {
+		for _, err := range ui.LoadPlugins(cfg.PluginsDir) {
+			log.Warn("Plugin not loaded", "error", err)
+		}
+		defer ui.ClosePlugins()
+	}
+
+	if *kiosk {
+		os.Exit(runKiosk(*kioskTTY, *osImgPath, cfg))
+	} else if !*enableSsh {
 		// Regular mode - start the application directly
 		// Provide non-zero fallback sizes to avoid blank screen on some terminals
 		w, h := minListWidth, 20
-		p := tea.NewProgram(ui.NewModel(*osImgPath, w, h), tea.WithAltScreen(), tea.WithMouseCellMotion())
+		// Panics are handled by ui.RecoverProgram so a crash report is written
+		p := tea.NewProgram(ui.NewModel(*osImgPath, cfg, w, h), tea.WithAltScreen(), tea.WithMouseCellMotion(), tea.WithoutCatchPanics())
+		defer ui.RecoverProgram(p)
 		if _, err := p.Run(); err != nil {
 			fmt.Printf("Error: %v\n", err)
 			os.Exit(1)
 		}
 	} else {
+		// The key is generated on first start, its directory may not exist yet
+		if err := os.MkdirAll(filepath.Dir(*hostKeyPath), 0o700); err != nil {
+			fmt.Println("Error creating host key directory:", err)
+			os.Exit(1)
+		}
+
+		limiter, err := newConnLimiter(*maxSessions, *maxConnRate, *banList)
+		if err != nil {
+			fmt.Println("Error reading ban list:", err)
+			os.Exit(1)
+		}
+
 		// SSH server configuration
 		sshServer, err := wish.NewServer(
 			wish.WithAddress(fmt.Sprintf(":%d", *sshPort)), // SSH port
-			wish.WithHostKeyPath(".ssh/id_ed25519"),
+			wish.WithHostKeyPath(*hostKeyPath),
+			ssh.WrapConn(limiter.wrapConn),
+			// Any key is accepted; it is only asked for to identify the operator
+			// in the audit log. Clients without keys can still connect.
+			wish.WithPublicKeyAuth(func(ssh.Context, ssh.PublicKey) bool { return true }),
+			wish.WithKeyboardInteractiveAuth(func(ssh.Context, gossh.KeyboardInteractiveChallenge) bool { return true }),
 			wish.WithMiddleware(
-				bubbletea.Middleware(func(s ssh.Session) (tea.Model, []tea.ProgramOption) {
+				bubbletea.MiddlewareWithProgramHandler(func(s ssh.Session) *tea.Program {
 					pty, _, _ := s.Pty() // Get terminal dimensions
-					return ui.NewModel(*osImgPath, pty.Window.Width, pty.Window.Height), []tea.ProgramOption{
+					model := ui.NewModel(*osImgPath, cfg, pty.Window.Width, pty.Window.Height)
+					model.Operator = sshOperator(s)
+					model.SSH = true
+					model.Role = ui.KeyRole(cfg, s.PublicKey())
+					model.Coordinator = *coordinate
+					// A panic ends this session only, with a crash report
+					p := tea.NewProgram(ui.GuardSession(model), append([]tea.ProgramOption{
 						tea.WithAltScreen(),       // Keep your existing options
 						tea.WithMouseCellMotion(), // Keep mouse support
-					}
-				}),
+					}, bubbletea.MakeOptions(s)...)...)
+					s.Context().SetValue(sessionProgramKey{}, p)
+					return p
+				}, termenv.Ascii),
+				recoverSessions(),
 				activeterm.Middleware(), // Bubble Tea apps usually require a PTY.
+				(&commandServer{osImgPath: *osImgPath, cfg: cfg, hostKeyPath: *hostKeyPath, coordinate: *coordinate}).middleware(),
 				logging.Middleware(),
 			),
 		)
@@ -83,6 +255,22 @@ func main() {
 			os.Exit(1)
 		}
 
+		if *mdns {
+			if withdraw, err := announceService(*sshPort); err != nil {
+				log.Warn("Not announcing over mDNS", "error", err)
+			} else {
+				defer withdraw()
+			}
+		}
+
+		if *coordinator != "" {
+			name := *stationName
+			if name == "" {
+				name, _ = os.Hostname()
+			}
+			go runAgent(*coordinator, *coordinatorKey, name, *sshPort, *hostKeyPath, *osImgPath)
+		}
+
 		done := make(chan os.Signal, 1)
 		signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 		log.Info("Starting SSH server")
@@ -106,3 +294,92 @@ func main() {
 		}
 	}
 }
+
+// envPrefix is prepended to a flag name, upper-cased with dashes replaced by
+// underscores, to get its environment variable (e.g. HUSARION_FLASHER_OS_IMG_PATH).
+const envPrefix = "HUSARION_FLASHER_"
+
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// applyEnv sets every flag of fs whose environment variable is set and returns
+// the names of those flags. It must run before fs.Parse so command-line flags
+// still take precedence.
+func applyEnv(fs *flag.FlagSet) (map[string]bool, error) {
+	set := map[string]bool{}
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		name := envName(f.Name)
+		f.Usage += fmt.Sprintf(" (env %s)", name)
+		v, ok := os.LookupEnv(name)
+		if !ok || err != nil {
+			return
+		}
+		if e := f.Value.Set(v); e != nil {
+			err = fmt.Errorf("invalid value %q for %s: %v", v, name, e)
+			return
+		}
+		set[f.Name] = true
+	})
+	return set, err
+}
+
+// sshOperator identifies the user of an SSH session for the audit log as
+// user@address, followed by the public key fingerprint when a key was offered.
+func sshOperator(s ssh.Session) string {
+	host, _, err := net.SplitHostPort(s.RemoteAddr().String())
+	if err != nil {
+		host = s.RemoteAddr().String()
+	}
+	operator := s.User() + "@" + host
+	if key := s.PublicKey(); key != nil {
+		operator += " (" + gossh.FingerprintSHA256(key) + ")"
+	}
+	return operator
+}
+
+// sessionProgramKey is the session context key of the program of an SSH UI
+// session.
+type sessionProgramKey struct{}
+
+// recoverSessions handles a panic escaping the UI of an SSH session: the
+// session's program is stopped, which restores its terminal, and a crash
+// report written. Unlike in console mode the flasher keeps running, as the
+// other sessions may be flashing.
+func recoverSessions() wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			defer func() {
+				if r := recover(); r != nil {
+					p, _ := s.Context().Value(sessionProgramKey{}).(*tea.Program)
+					ui.CrashSession(p, r)
+				}
+			}()
+			next(s)
+		}
+	}
+}
+
+// loadConfig loads the config given by the --config flag of fs and applies its
+// image patterns. A missing config is only an error if its path was given
+// explicitly, on the command line or in fromEnv.
+func loadConfig(fs *flag.FlagSet, path string, fromEnv map[string]bool) (*config.Config, error) {
+	cfg, err := config.Load(path, explicitFlags(fs, fromEnv)["config"])
+	if err != nil {
+		return nil, err
+	}
+	if err := flash.SetPatterns(imagePatterns(cfg)); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// imagePatterns converts the configured image patterns for the flash package.
+func imagePatterns(cfg *config.Config) []flash.Pattern {
+	var patterns []flash.Pattern
+	for _, p := range cfg.Images {
+		patterns = append(patterns, flash.Pattern{Glob: p.Glob, Regex: p.Regex, Format: p.Format})
+	}
+	return patterns
+}
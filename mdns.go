@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/husarion/husarion-os-flasher/util"
+)
+
+const (
+	// mdnsServiceType is the DNS-SD service type stations are announced as.
+	mdnsServiceType = "_husarion-flasher._tcp"
+
+	// avahiServiceFile is read by avahi-daemon, which announces the service
+	// while the file exists.
+	avahiServiceFile = "/etc/avahi/services/husarion-flasher.service"
+)
+
+// avahiService is an Avahi static service definition.
+type avahiService struct {
+	XMLName xml.Name `xml:"service-group"`
+	Name    struct {
+		ReplaceWildcards string `xml:"replace-wildcards,attr"`
+		Value            string `xml:",chardata"`
+	} `xml:"name"`
+	Type string   `xml:"service>type"`
+	Port int      `xml:"service>port"`
+	TXT  []string `xml:"service>txt-record"`
+}
+
+// announceService announces the SSH endpoint of this station over mDNS through
+// avahi-daemon. The returned function withdraws the announcement.
+func announceService(sshPort int) (withdraw func(), err error) {
+	if _, err := os.Stat(filepath.Dir(avahiServiceFile)); err != nil {
+		return nil, fmt.Errorf("avahi-daemon is not installed: %w", err)
+	}
+
+	var svc avahiService
+	svc.Name.ReplaceWildcards = "yes"
+	svc.Name.Value = "Husarion OS Flasher on %h"
+	svc.Type = mdnsServiceType
+	svc.Port = sshPort
+	svc.TXT = []string{"version=" + util.Version, "ssh=" + fmt.Sprint(sshPort)}
+
+	out, err := xml.MarshalIndent(svc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	content := xml.Header + `<!DOCTYPE service-group SYSTEM "avahi-service.dtd">` + "\n" + string(out) + "\n"
+	if err := os.WriteFile(avahiServiceFile, []byte(content), 0644); err != nil {
+		return nil, err
+	}
+	return func() { _ = os.Remove(avahiServiceFile) }, nil
+}
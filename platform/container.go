@@ -0,0 +1,42 @@
+package platform
+
+import (
+	"os"
+	"strings"
+)
+
+// ContainerHostMounts are files Docker and Podman bind-mount into every
+// container from their data directory, which usually lives on the host's system
+// disk. Inside a container "/" is an overlay, so these mounts are how the host
+// system disk is recognized.
+var ContainerHostMounts = []string{"/etc/hosts", "/etc/hostname", "/etc/resolv.conf"}
+
+// InContainer reports whether the flasher runs inside a Docker, Podman or
+// Kubernetes container.
+func InContainer() bool {
+	for _, marker := range []string{"/.dockerenv", "/run/.containerenv"} {
+		if _, err := os.Stat(marker); err == nil {
+			return true
+		}
+	}
+	if os.Getenv("container") != "" {
+		return true
+	}
+	cgroup, err := os.ReadFile("/proc/1/cgroup")
+	if err != nil {
+		return false
+	}
+	return ParseContainerCgroup(string(cgroup))
+}
+
+// ParseContainerCgroup reports whether /proc/1/cgroup content names a container
+// runtime. It only detects cgroup v1 hosts; on cgroup v2 the marker files
+// checked by InContainer are relied on instead.
+func ParseContainerCgroup(cgroup string) bool {
+	for _, runtime := range []string{"docker", "kubepods", "containerd", "libpod", "lxc"} {
+		if strings.Contains(cgroup, runtime) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+package platform
+
+import "fmt"
+
+// Demo is a platform of made-up devices for the demo mode, which shows the UI
+// without hardware. Nothing is unmounted or ejected.
+var Demo Platform = demo{}
+
+// demoDevice is a made-up device of Demo.
+type demoDevice struct {
+	path, model, serial string
+	size                int64
+}
+
+var demoDevices = []demoDevice{
+	{"/dev/sdb", "SanDisk Extreme 64GB", "DEMO00A1", 63_864_569_856},
+	{"/dev/sdc", "Samsung EVO Plus 128GB", "DEMO00B2", 128_043_712_512},
+	{"/dev/mmcblk0", "SD SC32G", "DEMO00C3", 31_914_983_424},
+}
+
+type demo struct{}
+
+func (demo) Devices() ([]string, error) {
+	var devices []string
+	for _, d := range demoDevices {
+		devices = append(devices, d.path)
+	}
+	return devices, nil
+}
+
+func (demo) DiskSize(device string) (int64, error) {
+	d, err := findDemoDevice(device)
+	return d.size, err
+}
+
+func (demo) Unmount(string) error                  { return nil }
+func (demo) Eject(string) error                    { return nil }
+func (demo) RootDevices() (map[string]bool, error) { return map[string]bool{}, nil }
+func (demo) ReadOnly(string) (bool, error)         { return false, nil }
+
+func (demo) Model(device string) string {
+	d, _ := findDemoDevice(device)
+	return d.model
+}
+
+func (demo) Serial(device string) string {
+	d, _ := findDemoDevice(device)
+	return d.serial
+}
+
+func findDemoDevice(device string) (demoDevice, error) {
+	for _, d := range demoDevices {
+		if d.path == device {
+			return d, nil
+		}
+	}
+	return demoDevice{}, fmt.Errorf("no such device: %s", device)
+}
@@ -0,0 +1,17 @@
+package platform
+
+import "golang.org/x/sys/windows"
+
+// FreeSpace returns the bytes available to the flasher on the volume holding
+// path.
+func FreeSpace(path string) (int64, error) {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	var avail uint64
+	if err := windows.GetDiskFreeSpaceEx(p, &avail, nil, nil); err != nil {
+		return 0, err
+	}
+	return int64(avail), nil
+}
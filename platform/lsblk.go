@@ -0,0 +1,168 @@
+package platform
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// GetParentDevice returns the base disk name for a partition.
+// For example, "nvme0n1p2" becomes "nvme0n1", "mmcblk0p2" becomes "mmcblk0"
+// and "sda1" becomes "sda". Whole disks are returned unchanged.
+func GetParentDevice(dev string) string {
+	// Disks whose names end in a digit (nvme0n1, mmcblk0) use a "p<N>" partition suffix.
+	if strings.HasPrefix(dev, "nvme") || strings.HasPrefix(dev, "mmcblk") {
+		if idx := strings.LastIndex(dev, "p"); idx > 0 && idx < len(dev)-1 && isDigits(dev[idx+1:]) {
+			return dev[:idx]
+		}
+		return dev
+	}
+	// For other devices, remove trailing digits.
+	i := len(dev) - 1
+	for ; i >= 0; i-- {
+		if dev[i] < '0' || dev[i] > '9' {
+			break
+		}
+	}
+	return dev[:i+1]
+}
+
+// isDigits reports whether s is a non-empty string of ASCII digits.
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// FindmntOutput represents the JSON structure of findmnt --json output
+type FindmntOutput struct {
+	Filesystems []struct {
+		Source string `json:"source"`
+	} `json:"filesystems"`
+}
+
+// LsblkOutput represents the JSON structure of lsblk --json output
+type LsblkOutput struct {
+	Blockdevices []struct {
+		Name        string   `json:"name"`
+		Mountpoints []string `json:"mountpoints"`
+		Children    []struct {
+			Name        string   `json:"name"`
+			Mountpoints []string `json:"mountpoints"`
+		} `json:"children,omitempty"`
+	} `json:"blockdevices"`
+}
+
+// ParseFindmntRoot extracts the root filesystem source from `findmnt --json -o SOURCE /`
+// output, with any /dev/ prefix removed.
+func ParseFindmntRoot(data []byte) (string, error) {
+	var findmntData FindmntOutput
+	if err := json.Unmarshal(data, &findmntData); err != nil {
+		return "", err
+	}
+	if len(findmntData.Filesystems) == 0 {
+		return "", fmt.Errorf("findmnt reported no filesystems")
+	}
+	return strings.TrimPrefix(findmntData.Filesystems[0].Source, "/dev/"), nil
+}
+
+// ParseLsblk decodes `lsblk --json -o NAME,MOUNTPOINTS` output.
+func ParseLsblk(data []byte) (LsblkOutput, error) {
+	var lsblkData LsblkOutput
+	if err := json.Unmarshal(data, &lsblkData); err != nil {
+		return LsblkOutput{}, err
+	}
+	return lsblkData, nil
+}
+
+// RootDeviceNames returns the set of device names (disks and partitions) that back
+// the root filesystem. rootSource is the findmnt source and may be empty.
+func RootDeviceNames(rootSource string, lsblkData LsblkOutput) map[string]bool {
+	rootDeviceNames := MountedDeviceNames(lsblkData, "/")
+
+	if rootSource != "" {
+		// Mark both the partition and its parent device as root devices
+		rootDeviceNames[rootSource] = true
+		rootDeviceNames[GetParentDevice(rootSource)] = true
+	}
+
+	return rootDeviceNames
+}
+
+// MountedDeviceNames returns the names of the devices (disks and partitions)
+// with a filesystem mounted at any of mountpoints, together with their parent disks.
+func MountedDeviceNames(lsblkData LsblkOutput, mountpoints ...string) map[string]bool {
+	wanted := make(map[string]bool)
+	for _, mp := range mountpoints {
+		wanted[mp] = true
+	}
+	names := make(map[string]bool)
+
+	for _, device := range lsblkData.Blockdevices {
+		// Check if this device itself is mounted
+		for _, mount := range device.Mountpoints {
+			if wanted[mount] {
+				names[device.Name] = true
+				names[GetParentDevice(device.Name)] = true
+			}
+		}
+
+		// Also check children (partitions)
+		for _, child := range device.Children {
+			for _, mount := range child.Mountpoints {
+				if wanted[mount] {
+					names[child.Name] = true
+					names[device.Name] = true // Parent device
+				}
+			}
+		}
+	}
+
+	return names
+}
+
+// FilterDevices returns /dev paths for the given /sys/block entries, skipping
+// loop and ram devices as well as anything backing the root filesystem.
+func FilterDevices(names []string, rootDeviceNames map[string]bool) []string {
+	var devices []string
+	for _, name := range names {
+		// Skip loop and ram devices.
+		if strings.HasPrefix(name, "loop") || strings.HasPrefix(name, "ram") {
+			continue
+		}
+		// Skip if this device is a root device or its partition is a root device
+		if rootDeviceNames[name] {
+			continue
+		}
+		devices = append(devices, "/dev/"+name)
+	}
+	return devices
+}
+
+// USBPort returns the USB port path in a sysfs device path, such as
+// "1-1.4.2" in ".../usb1/1-1/1-1.4/1-1.4.2/1-1.4.2:1.0/host0/...", or an empty
+// string when the device is not on USB. It is the deepest component of the
+// form bus-port[.port...].
+func USBPort(sysPath string) string {
+	var port string
+	for _, part := range strings.Split(sysPath, "/") {
+		bus, ports, ok := strings.Cut(part, "-")
+		if !ok || !isDigits(bus) || ports == "" {
+			continue
+		}
+		valid := true
+		for _, p := range strings.Split(ports, ".") {
+			valid = valid && isDigits(p)
+		}
+		if valid {
+			port = part
+		}
+	}
+	return port
+}
@@ -0,0 +1,178 @@
+package platform
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("reading fixture %s: %v", name, err)
+	}
+	return data
+}
+
+func TestGetParentDevice(t *testing.T) {
+	tests := []struct {
+		dev  string
+		want string
+	}{
+		{"sda", "sda"},
+		{"sda1", "sda"},
+		{"sdb12", "sdb"},
+		{"nvme0n1", "nvme0n1"},
+		{"nvme0n1p2", "nvme0n1"},
+		{"nvme10n1p15", "nvme10n1"},
+		{"mmcblk0", "mmcblk0"},
+		{"mmcblk0p2", "mmcblk0"},
+		{"mmcblk1boot0", "mmcblk1boot0"},
+	}
+	for _, tt := range tests {
+		if got := GetParentDevice(tt.dev); got != tt.want {
+			t.Errorf("GetParentDevice(%q) = %q, want %q", tt.dev, got, tt.want)
+		}
+	}
+}
+
+func TestParseFindmntRoot(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    string
+		wantErr bool
+	}{
+		{name: "pi", data: readFixture(t, "findmnt_pi.json"), want: "mmcblk0p2"},
+		{name: "nvme laptop", data: readFixture(t, "findmnt_nvme_laptop.json"), want: "nvme0n1p2"},
+		{name: "multi reader", data: readFixture(t, "findmnt_multi_reader.json"), want: "sda2"},
+		{name: "overlay root", data: []byte(`{"filesystems":[{"source":"overlay"}]}`), want: "overlay"},
+		{name: "empty", data: []byte(`{"filesystems":[]}`), wantErr: true},
+		{name: "garbage", data: []byte(`not json`), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseFindmntRoot(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseLsblkInvalid(t *testing.T) {
+	if _, err := ParseLsblk([]byte(`{"blockdevices":`)); err == nil {
+		t.Fatal("expected error for truncated lsblk output")
+	}
+}
+
+func TestDeviceEnumerationFixtures(t *testing.T) {
+	tests := []struct {
+		name      string
+		findmnt   string
+		lsblk     string
+		container bool
+		sysBlock  []string
+		want      []string
+	}{
+		{
+			name:     "pi with usb reader",
+			findmnt:  "findmnt_pi.json",
+			lsblk:    "lsblk_pi.json",
+			sysBlock: []string{"loop0", "loop1", "mmcblk0", "ram0", "sda"},
+			want:     []string{"/dev/sda"},
+		},
+		{
+			name:     "nvme laptop",
+			findmnt:  "findmnt_nvme_laptop.json",
+			lsblk:    "lsblk_nvme_laptop.json",
+			sysBlock: []string{"loop0", "nvme0n1", "nvme1n1", "sda"},
+			want:     []string{"/dev/nvme1n1", "/dev/sda"},
+		},
+		{
+			name:     "multi reader hub",
+			findmnt:  "findmnt_multi_reader.json",
+			lsblk:    "lsblk_multi_reader.json",
+			sysBlock: []string{"sda", "sdb", "sdc", "sdd", "sde"},
+			want:     []string{"/dev/sdb", "/dev/sdc", "/dev/sdd", "/dev/sde"},
+		},
+		{
+			name:      "privileged container",
+			findmnt:   "findmnt_container.json",
+			lsblk:     "lsblk_container.json",
+			container: true,
+			sysBlock:  []string{"loop0", "nvme0n1", "sda"},
+			want:      []string{"/dev/sda"},
+		},
+		{
+			name:     "findmnt unavailable",
+			lsblk:    "lsblk_nvme_laptop.json",
+			sysBlock: []string{"nvme0n1", "nvme1n1"},
+			want:     []string{"/dev/nvme1n1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rootSource string
+			if tt.findmnt != "" {
+				var err error
+				if rootSource, err = ParseFindmntRoot(readFixture(t, tt.findmnt)); err != nil {
+					t.Fatalf("ParseFindmntRoot: %v", err)
+				}
+			}
+			lsblkData, err := ParseLsblk(readFixture(t, tt.lsblk))
+			if err != nil {
+				t.Fatalf("ParseLsblk: %v", err)
+			}
+			rootDeviceNames := RootDeviceNames(rootSource, lsblkData)
+			if tt.container {
+				for name := range MountedDeviceNames(lsblkData, ContainerHostMounts...) {
+					rootDeviceNames[name] = true
+				}
+			}
+			got := FilterDevices(tt.sysBlock, rootDeviceNames)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseContainerCgroup(t *testing.T) {
+	tests := []struct {
+		cgroup string
+		want   bool
+	}{
+		{"12:devices:/docker/3f2a9c\n11:cpu:/docker/3f2a9c\n", true},
+		{"1:name=systemd:/kubepods/besteffort/pod1234\n", true},
+		{"12:devices:/init.scope\n11:cpu:/\n", false},
+		{"0::/\n", false},
+	}
+	for _, tt := range tests {
+		if got := ParseContainerCgroup(tt.cgroup); got != tt.want {
+			t.Errorf("ParseContainerCgroup(%q) = %v, want %v", tt.cgroup, got, tt.want)
+		}
+	}
+}
+
+func TestUSBPort(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/sys/devices/platform/scb/fd500000.pcie/pci0000:00/0000:00:00.0/0000:01:00.0/usb2/2-1/2-1.3/2-1.3:1.0/host1/target1:0:0/1:0:0:0/block/sdb", "2-1.3"},
+		{"/sys/devices/pci0000:00/0000:00:14.0/usb1/1-1/1-1.4/1-1.4.2/1-1.4.2:1.0/host3/target3:0:0/3:0:0:0/block/sdc", "1-1.4.2"},
+		{"/sys/devices/platform/emmc2bus/fe340000.mmc/mmc_host/mmc0/mmc0:aaaa/block/mmcblk0", ""},
+		{"/sys/devices/pci0000:00/0000:00:1d.0/0000:3d:00.0/nvme/nvme0/nvme0n1", ""},
+	}
+	for _, tt := range tests {
+		if got := USBPort(tt.path); got != tt.want {
+			t.Errorf("USBPort(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
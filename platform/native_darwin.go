@@ -0,0 +1,140 @@
+package platform
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/husarion/husarion-os-flasher/util"
+)
+
+// RequiredTools are the external commands used for device enumeration and .xz images.
+var RequiredTools = []string{"diskutil", "xz"}
+
+// FeatureTools is empty: Check and backups are Linux-only.
+var FeatureTools []FeatureTool
+
+// native implements Platform with diskutil.
+type native struct{}
+
+// ParseDiskutilList returns the whole disks from `diskutil list -plist` output.
+func ParseDiskutilList(data []byte) ([]string, error) {
+	v, err := ParsePlist(data)
+	if err != nil {
+		return nil, err
+	}
+	list, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("unexpected diskutil list output")
+	}
+	var disks []string
+	whole, _ := list["WholeDisks"].([]any)
+	for _, d := range whole {
+		if name, ok := d.(string); ok {
+			disks = append(disks, name)
+		}
+	}
+	return disks, nil
+}
+
+// DiskInfo returns the `diskutil info -plist` dictionary for a disk or mount point.
+func DiskInfo(target string) (map[string]any, error) {
+	out, err := util.Command("diskutil", "info", "-plist", target).Output()
+	if err != nil {
+		return nil, err
+	}
+	v, err := ParsePlist(out)
+	if err != nil {
+		return nil, err
+	}
+	info, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("unexpected diskutil output for %s", target)
+	}
+	return info, nil
+}
+
+// DiskSize returns the size (in bytes) of a disk using "diskutil info"
+func (native) DiskSize(device string) (int64, error) {
+	info, err := DiskInfo(device)
+	if err != nil {
+		return 0, err
+	}
+	// Older macOS versions report TotalSize, newer ones Size
+	for _, key := range []string{"TotalSize", "Size"} {
+		if size, ok := info[key].(int64); ok {
+			return size, nil
+		}
+	}
+	return 0, fmt.Errorf("diskutil reported no size for %s", device)
+}
+
+func (native) RootDevices() (map[string]bool, error) {
+	info, err := DiskInfo("/")
+	if err != nil {
+		return nil, err
+	}
+	roots := make(map[string]bool)
+	if disk, ok := info["ParentWholeDisk"].(string); ok {
+		roots[disk] = true
+	}
+	return roots, nil
+}
+
+// Devices lists external physical disks (/dev/diskN), skipping the disk that
+// holds the root filesystem.
+func (p native) Devices() ([]string, error) {
+	out, err := util.Command("diskutil", "list", "-plist", "external", "physical").Output()
+	if err != nil {
+		return nil, err
+	}
+	disks, err := ParseDiskutilList(out)
+	if err != nil {
+		return nil, err
+	}
+	roots, _ := p.RootDevices()
+
+	var devices []string
+	for _, name := range disks {
+		if roots[name] {
+			continue
+		}
+		devices = append(devices, "/dev/"+name)
+	}
+	return devices, nil
+}
+
+// diskutil runs a diskutil verb on a device, returning its output as the error.
+func diskutil(verb, device string) error {
+	if out, err := util.Command("diskutil", verb, device).CombinedOutput(); err != nil {
+		return fmt.Errorf("diskutil %s failed: %s", verb, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// Model returns the media name diskutil reports for a device.
+func (native) Model(device string) string {
+	info, err := DiskInfo(device)
+	if err != nil {
+		return ""
+	}
+	name, _ := info["MediaName"].(string)
+	return strings.TrimSpace(name)
+}
+
+func (native) Unmount(device string) error {
+	return diskutil("unmountDisk", device)
+}
+
+func (native) Eject(device string) error {
+	return diskutil("eject", device)
+}
+
+// ReadOnly reports whether diskutil sees the media as not writable.
+func (native) ReadOnly(device string) (bool, error) {
+	info, err := DiskInfo(device)
+	if err != nil {
+		return false, err
+	}
+	writable, ok := info["WritableMedia"].(bool)
+	return ok && !writable, nil
+}
@@ -0,0 +1,160 @@
+//go:build !windows && !darwin
+
+package platform
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/husarion/husarion-os-flasher/util"
+)
+
+// RequiredTools are the external commands used for device commands and .xz images.
+var RequiredTools = []string{"xz", "lsblk", "findmnt", "blockdev", "umount", "eject"}
+
+// FeatureTools are the external commands only one feature still needs.
+var FeatureTools = []FeatureTool{
+	{Tool: "bash", Feature: "Check and backups"},
+	{Tool: "pv", Feature: "Check and backups"},
+	{Tool: "sha256sum", Feature: "Check of raw images"},
+	{Tool: "unzip", Feature: "Check of .zip images"},
+	{Tool: "dd", Feature: "backups with a bmap"},
+}
+
+// native implements Platform with lsblk, findmnt, blockdev and umount.
+type native struct{}
+
+func (native) RootDevices() (map[string]bool, error) {
+	// Use findmnt with JSON output to identify the root filesystem device
+	var rootSource string
+	if rootOutput, err := util.Command("findmnt", "--json", "-o", "SOURCE", "/").Output(); err == nil {
+		rootSource, _ = ParseFindmntRoot(rootOutput)
+	}
+
+	// Use lsblk with JSON output to get detailed information about all block devices
+	output, err := util.Command("lsblk", "--json", "-o", "NAME,MOUNTPOINTS").Output()
+	if err != nil {
+		return nil, err
+	}
+	lsblkData, err := ParseLsblk(output)
+	if err != nil {
+		return nil, err
+	}
+	rootDeviceNames := RootDeviceNames(rootSource, lsblkData)
+
+	// In a container "/" is an overlay; the host's system disk is the one
+	// holding the runtime's bind-mounted files
+	if InContainer() {
+		for name := range MountedDeviceNames(lsblkData, ContainerHostMounts...) {
+			rootDeviceNames[name] = true
+		}
+	}
+	return rootDeviceNames, nil
+}
+
+func (p native) Devices() ([]string, error) {
+	rootDeviceNames, err := p.RootDevices()
+	if err != nil {
+		return nil, err
+	}
+
+	// Iterate over /sys/block to list available disks
+	entries, err := os.ReadDir("/sys/block")
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+
+	var devices []string
+	for _, devicePath := range FilterDevices(names, rootDeviceNames) {
+		if info, err := os.Stat(devicePath); err == nil && info.Mode()&os.ModeDevice != 0 {
+			devices = append(devices, devicePath)
+		}
+	}
+
+	return devices, nil
+}
+
+// DiskSize returns the size (in bytes) of a disk using "blockdev --getsize64"
+func (native) DiskSize(device string) (int64, error) {
+	out, err := util.Command("blockdev", "--getsize64", device).Output()
+	if err != nil {
+		return 0, err
+	}
+	sizeStr := strings.TrimSpace(string(out))
+	return strconv.ParseInt(sizeStr, 10, 64)
+}
+
+// Unmount unmounts all partitions under a device (e.g. /dev/sda -> /dev/sda1, /dev/sda2, etc.)
+func (native) Unmount(device string) error {
+	// Check if the device is mounted before attempting to unmount
+	if err := util.Command("sh", "-c", "mount | grep "+device).Run(); err != nil {
+		return nil
+	}
+	return util.Command("sh", "-c", "umount "+device+"*").Run()
+}
+
+func (p native) Eject(device string) error {
+	if err := p.Unmount(device); err != nil {
+		return err
+	}
+	return util.Command("eject", device).Run()
+}
+
+// Model returns the vendor and model sysfs reports for a device.
+func (native) Model(device string) string {
+	dir := filepath.Join("/sys/block", filepath.Base(device), "device")
+	var parts []string
+	for _, name := range []string{"vendor", "model"} {
+		if b, err := os.ReadFile(filepath.Join(dir, name)); err == nil {
+			if s := strings.TrimSpace(string(b)); s != "" {
+				parts = append(parts, s)
+			}
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// Serial returns the serial number lsblk reports for a device.
+func (native) Serial(device string) string {
+	out, err := util.Command("lsblk", "-dno", "SERIAL", device).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// WWN returns the World Wide Name lsblk reports for a device.
+func (native) WWN(device string) string {
+	out, err := util.Command("lsblk", "-dno", "WWN", device).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// Port returns the USB port path of the sysfs device behind a device.
+func (native) Port(device string) string {
+	target, err := filepath.EvalSymlinks(filepath.Join("/sys/block", filepath.Base(device)))
+	if err != nil {
+		return ""
+	}
+	return USBPort(target)
+}
+
+// ReadOnly reports the read-only flag sysfs keeps for a device, set by the lock
+// switch of SD cards, falling back to "blockdev --getro".
+func (native) ReadOnly(device string) (bool, error) {
+	b, err := os.ReadFile(filepath.Join("/sys/class/block", filepath.Base(device), "ro"))
+	if err != nil {
+		if b, err = util.Command("blockdev", "--getro", device).Output(); err != nil {
+			return false, err
+		}
+	}
+	return strings.TrimSpace(string(b)) == "1", nil
+}
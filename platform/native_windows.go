@@ -0,0 +1,233 @@
+package platform
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// ioctlDiskGetLengthInfo is IOCTL_DISK_GET_LENGTH_INFO from winioctl.h.
+const ioctlDiskGetLengthInfo = 0x0007405C
+
+// RequiredTools are the external commands used for device enumeration and .xz images.
+var RequiredTools = []string{"powershell", "xz"}
+
+// FeatureTools is empty: Check and backups are Linux-only.
+var FeatureTools []FeatureTool
+
+// native implements Platform with PowerShell (WMI and Storage cmdlets) and
+// DeviceIoControl.
+type native struct{}
+
+// windowsDrivesScript lists physical drives via WMI together with the number of
+// the disk holding the system drive, as a single JSON object.
+const windowsDrivesScript = `$sys = (Get-Partition -DriveLetter $env:SystemDrive.Substring(0,1)).DiskNumber
+$drives = @(Get-CimInstance -ClassName Win32_DiskDrive | Select-Object Index,DeviceID,Model,Size,InterfaceType,MediaType)
+@{ SystemDisk = $sys; Drives = $drives } | ConvertTo-Json -Depth 3 -Compress`
+
+// WindowsDrives is the output of windowsDrivesScript.
+type WindowsDrives struct {
+	SystemDisk int `json:"SystemDisk"`
+	Drives     []struct {
+		Index         int    `json:"Index"`
+		DeviceID      string `json:"DeviceID"`
+		Model         string `json:"Model"`
+		Size          int64  `json:"Size"`
+		InterfaceType string `json:"InterfaceType"`
+		MediaType     string `json:"MediaType"`
+	} `json:"Drives"`
+}
+
+// powershell runs a PowerShell script and returns its standard output.
+func powershell(script string) ([]byte, error) {
+	out, err := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", script).Output()
+	if err != nil {
+		return nil, fmt.Errorf("powershell: %v", err)
+	}
+	return out, nil
+}
+
+// drives runs windowsDrivesScript.
+func drives() (WindowsDrives, error) {
+	var data WindowsDrives
+	out, err := powershell(windowsDrivesScript)
+	if err != nil {
+		return data, err
+	}
+	err = json.Unmarshal(out, &data)
+	return data, err
+}
+
+// Devices lists physical drives (\\.\PHYSICALDRIVEn) other than the one
+// holding the system drive.
+func (native) Devices() ([]string, error) {
+	data, err := drives()
+	if err != nil {
+		return nil, err
+	}
+
+	var devices []string
+	for _, drive := range data.Drives {
+		if drive.Index == data.SystemDisk || drive.DeviceID == "" {
+			continue
+		}
+		devices = append(devices, drive.DeviceID)
+	}
+	return devices, nil
+}
+
+// diskNumber returns N for \\.\PHYSICALDRIVEN.
+func diskNumber(device string) (string, error) {
+	upper := strings.ToUpper(device)
+	const prefix = `\\.\PHYSICALDRIVE`
+	if !strings.HasPrefix(upper, prefix) || !isDigits(upper[len(prefix):]) {
+		return "", fmt.Errorf("%s is not a physical drive", device)
+	}
+	return upper[len(prefix):], nil
+}
+
+// driveLetters returns the drive letters of the volumes on a physical drive.
+func driveLetters(device string) ([]string, error) {
+	n, err := diskNumber(device)
+	if err != nil {
+		return nil, err
+	}
+	out, err := powershell(fmt.Sprintf(
+		"Get-Partition -DiskNumber %s | Where-Object DriveLetter | ForEach-Object { $_.DriveLetter }", n))
+	if err != nil {
+		return nil, err
+	}
+	var letters []string
+	for _, line := range strings.Fields(string(out)) {
+		if len(line) == 1 {
+			letters = append(letters, line)
+		}
+	}
+	return letters, nil
+}
+
+const (
+	// FSCTL codes from winioctl.h.
+	fsctlLockVolume     = 0x00090018
+	fsctlDismountVolume = 0x00090020
+)
+
+// LockVolumes locks and dismounts every volume on a physical drive so Windows
+// does not write to it while it is being flashed. The locks are released when
+// the returned handles are closed.
+func LockVolumes(device string) ([]*os.File, error) {
+	letters, err := driveLetters(device)
+	if err != nil {
+		return nil, err
+	}
+	var locked []*os.File
+	for _, letter := range letters {
+		vol, err := os.OpenFile(`\\.\`+letter+":", os.O_RDWR, 0)
+		if err != nil {
+			CloseAll(locked)
+			return nil, fmt.Errorf("failed to open volume %s: %v", letter, err)
+		}
+		var n uint32
+		for _, code := range []uint32{fsctlLockVolume, fsctlDismountVolume} {
+			if err := syscall.DeviceIoControl(syscall.Handle(vol.Fd()), code, nil, 0, nil, 0, &n, nil); err != nil {
+				vol.Close()
+				CloseAll(locked)
+				return nil, fmt.Errorf("failed to lock volume %s: (is it in use?) %v", letter, err)
+			}
+		}
+		locked = append(locked, vol)
+	}
+	return locked, nil
+}
+
+// CloseAll closes every file, releasing volume locks.
+func CloseAll(files []*os.File) {
+	for _, f := range files {
+		f.Close()
+	}
+}
+
+// Model returns the model WMI reports for a physical drive.
+func (native) Model(device string) string {
+	data, err := drives()
+	if err != nil {
+		return ""
+	}
+	for _, drive := range data.Drives {
+		if strings.EqualFold(drive.DeviceID, device) {
+			return strings.TrimSpace(drive.Model)
+		}
+	}
+	return ""
+}
+
+// DiskSize returns the size (in bytes) of a physical drive such as
+// \\.\PhysicalDrive1 using IOCTL_DISK_GET_LENGTH_INFO.
+func (native) DiskSize(device string) (int64, error) {
+	f, err := os.Open(device)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var length int64
+	var n uint32
+	err = syscall.DeviceIoControl(syscall.Handle(f.Fd()), ioctlDiskGetLengthInfo,
+		nil, 0, (*byte)(unsafe.Pointer(&length)), uint32(unsafe.Sizeof(length)), &n, nil)
+	if err != nil {
+		return 0, err
+	}
+	return length, nil
+}
+
+// Unmount dismounts every volume on the drive. Windows may remount a volume on
+// the next access; writers should hold LockVolumes for the duration instead.
+func (native) Unmount(device string) error {
+	locked, err := LockVolumes(device)
+	if err != nil {
+		return err
+	}
+	CloseAll(locked)
+	return nil
+}
+
+// Eject takes the disk offline so Windows releases it.
+func (native) Eject(device string) error {
+	n, err := diskNumber(device)
+	if err != nil {
+		return err
+	}
+	_, err = powershell(fmt.Sprintf("Set-Disk -Number %s -IsOffline $true", n))
+	return err
+}
+
+func (native) RootDevices() (map[string]bool, error) {
+	data, err := drives()
+	if err != nil {
+		return nil, err
+	}
+	roots := make(map[string]bool)
+	for _, drive := range data.Drives {
+		if drive.Index == data.SystemDisk {
+			roots[drive.DeviceID] = true
+		}
+	}
+	return roots, nil
+}
+
+// ReadOnly reports whether Windows sees the disk as read-only.
+func (native) ReadOnly(device string) (bool, error) {
+	n, err := diskNumber(device)
+	if err != nil {
+		return false, err
+	}
+	out, err := powershell("(Get-Disk -Number " + n + ").IsReadOnly")
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(string(out)) == "True", nil
+}
@@ -0,0 +1,105 @@
+// Package platform abstracts the host operations on block devices (listing,
+// sizing, unmounting, ejecting and root-device detection) so the UI works the
+// same on Linux, Windows and macOS and can be tested against a fake.
+package platform
+
+// FeatureTool is an external command that one feature needs, but flashing does not.
+type FeatureTool struct {
+	Tool    string
+	Feature string
+}
+
+// Platform is the set of block device operations the flasher needs from the host.
+type Platform interface {
+	// Devices lists the devices that may be flashed, excluding those backing
+	// the running system.
+	Devices() ([]string, error)
+	// DiskSize returns the size of a device in bytes.
+	DiskSize(device string) (int64, error)
+	// Unmount unmounts every filesystem on a device. Devices with nothing
+	// mounted are not an error.
+	Unmount(device string) error
+	// Eject prepares a device for safe removal.
+	Eject(device string) error
+	// RootDevices returns the names of the devices backing the running system.
+	RootDevices() (map[string]bool, error)
+}
+
+// Current is the platform of the running host. Tests may replace it.
+var Current Platform = native{}
+
+// Describer is implemented by platforms that can tell a device's hardware.
+type Describer interface {
+	// Model returns the vendor and model of a device, empty when unknown.
+	Model(device string) string
+}
+
+// Model returns the vendor and model of a device on the current platform, or
+// an empty string when the platform cannot tell.
+func Model(device string) string {
+	if d, ok := Current.(Describer); ok {
+		return d.Model(device)
+	}
+	return ""
+}
+
+// Identifier is implemented by platforms that can tell a device's serial
+// number and World Wide Name.
+type Identifier interface {
+	// Serial returns the serial number of a device, empty when unknown.
+	Serial(device string) string
+	// WWN returns the World Wide Name of a device, empty when unknown.
+	WWN(device string) string
+}
+
+// Serial returns the serial number of a device on the current platform, or an
+// empty string when the platform cannot tell.
+func Serial(device string) string {
+	if i, ok := Current.(Identifier); ok {
+		return i.Serial(device)
+	}
+	return ""
+}
+
+// WWN returns the World Wide Name of a device on the current platform, or an
+// empty string when the platform cannot tell. Most SATA and NVMe disks have
+// one; USB card readers seldom do.
+func WWN(device string) string {
+	if i, ok := Current.(Identifier); ok {
+		return i.WWN(device)
+	}
+	return ""
+}
+
+// WriteProtector is implemented by platforms that can tell a read-only device,
+// such as an SD card with its lock switch on.
+type WriteProtector interface {
+	// ReadOnly reports whether a device is write-protected.
+	ReadOnly(device string) (bool, error)
+}
+
+// ReadOnly reports whether a device is write-protected on the current
+// platform. It is false when the platform cannot tell.
+func ReadOnly(device string) (bool, error) {
+	if w, ok := Current.(WriteProtector); ok {
+		return w.ReadOnly(device)
+	}
+	return false, nil
+}
+
+// Locator is implemented by platforms that can tell which USB port a device
+// hangs off, such as a slot of a duplicator hub.
+type Locator interface {
+	// Port returns the USB port path of a device, e.g. "1-1.4.2", empty when
+	// it is not on USB.
+	Port(device string) string
+}
+
+// Port returns the USB port path of a device on the current platform, or an
+// empty string when the platform cannot tell.
+func Port(device string) string {
+	if l, ok := Current.(Locator); ok {
+		return l.Port(device)
+	}
+	return ""
+}
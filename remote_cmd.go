@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/husarion/husarion-os-flasher/internal/flash"
+)
+
+const remoteUsage = `Usage:
+  husarion-os-flasher remote --host HOST[,HOST...] [--port N] [--user USER] COMMAND [ARGS...]
+
+Runs a command on flashers started with --enable-ssh, using the ssh client.
+With several hosts the command runs on all of them at once and every output
+line is prefixed with its host.
+
+` + remoteCommandsUsage
+
+// remoteRun runs a command on one station through the ssh client. Output lines
+// are prefixed with prefix, if set. It returns the remote exit status.
+func remoteRun(host string, port int, user string, args []string, prefix string) int {
+	target := host
+	if user != "" {
+		target = user + "@" + host
+	}
+	cmd := exec.Command("ssh", "-p", strconv.Itoa(port), "-o", "LogLevel=ERROR", target, flash.ShellJoin(args))
+
+	var wg sync.WaitGroup
+	copyLines := func(dst io.Writer, src io.Reader) {
+		defer wg.Done()
+		scanner := bufio.NewScanner(src)
+		for scanner.Scan() {
+			fmt.Fprintf(dst, "%s%s\n", prefix, scanner.Text())
+		}
+	}
+	stdout, _ := cmd.StdoutPipe()
+	stderr, _ := cmd.StderrPipe()
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "%sError: %v\n", prefix, err)
+		return exitFailure
+	}
+	wg.Add(2)
+	go copyLines(os.Stdout, stdout)
+	go copyLines(os.Stderr, stderr)
+	wg.Wait()
+
+	err := cmd.Wait()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "%sError: %v\n", prefix, err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+// runRemoteCommand implements the "remote" tool mode and returns the exit code:
+// the highest exit status of the stations.
+func runRemoteCommand(args []string) int {
+	fs := flag.NewFlagSet("remote", flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, remoteUsage) }
+	hosts := fs.String("host", "", "Stations to run the command on, separated by commas")
+	port := fs.Int("port", 2222, "SSH port of the stations")
+	user := fs.String("user", "", "SSH user, recorded in the stations' audit logs")
+	if _, err := applyEnv(fs); err != nil {
+		return failed(err)
+	}
+	fs.Parse(args)
+	if *hosts == "" || fs.NArg() == 0 {
+		fmt.Fprint(os.Stderr, remoteUsage)
+		return exitUsage
+	}
+	if _, err := exec.LookPath("ssh"); err != nil {
+		fmt.Fprintln(os.Stderr, "Error: remote needs the ssh client")
+		return exitToolMissing
+	}
+
+	list := strings.Split(*hosts, ",")
+	if len(list) == 1 {
+		return remoteRun(list[0], *port, *user, fs.Args(), "")
+	}
+
+	codes := make([]int, len(list))
+	var wg sync.WaitGroup
+	for i, host := range list {
+		wg.Add(1)
+		go func(i int, host string) {
+			defer wg.Done()
+			codes[i] = remoteRun(host, *port, *user, fs.Args(), host+": ")
+		}(i, strings.TrimSpace(host))
+	}
+	wg.Wait()
+
+	code := exitOK
+	for _, c := range codes {
+		code = max(code, c)
+	}
+	return code
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/husarion/husarion-os-flasher/ui"
+)
+
+const replayUsage = `Usage:
+  husarion-os-flasher replay [--os-img-path DIR] [--speed N] [--max-wait DURATION] [RECORDING]
+
+Replays the output of a job, as recorded in DIR/logs/recordings, with its
+original timing. RECORDING is a path or the name of a recording in DIR; without
+it the recordings are listed, newest first. Recordings are asciicast v2 files,
+which asciinema play also replays.
+` + exitCodesUsage
+
+// runReplayCommand replays or lists job recordings.
+func runReplayCommand(args []string) int {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, replayUsage) }
+	osImgPath := fs.String("os-img-path", ".", "Path to OS image files directory")
+	speed := fs.Float64("speed", 1, "Replay this many times faster")
+	maxWait := fs.Duration("max-wait", 2*time.Second, "Shorten longer pauses to this (0 keeps them)")
+	if _, err := applyEnv(fs); err != nil {
+		return failed(err)
+	}
+	fs.Parse(args)
+	if fs.NArg() > 1 || *speed <= 0 {
+		fmt.Fprint(os.Stderr, replayUsage)
+		return exitUsage
+	}
+
+	dir := ui.RecordingsPath(*osImgPath)
+	if fs.NArg() == 0 {
+		names, err := recordings(dir)
+		if err != nil {
+			return failed(err)
+		}
+		for _, name := range names {
+			fmt.Println(name)
+		}
+		return exitOK
+	}
+
+	path := fs.Arg(0)
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		path = filepath.Join(dir, fs.Arg(0))
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			return failed(notFoundError{fmt.Errorf("no recording %s in %s", fs.Arg(0), dir)})
+		}
+	}
+	if err := ui.ReplayRecording(path, os.Stdout, *speed, *maxWait, interrupted()); err != nil {
+		return failed(err)
+	}
+	return exitOK
+}
+
+// recordings returns the names of the recordings in dir, newest first.
+func recordings(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	type recording struct {
+		name    string
+		modTime time.Time
+	}
+	var found []recording
+	for _, e := range entries {
+		if info, err := e.Info(); err == nil && strings.HasSuffix(e.Name(), ".cast") {
+			found = append(found, recording{e.Name(), info.ModTime()})
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].modTime.After(found[j].modTime) })
+	names := make([]string, len(found))
+	for i, r := range found {
+		names[i] = r.name
+	}
+	return names, nil
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/husarion/husarion-os-flasher/config"
+)
+
+const setupUsage = `Usage:
+  husarion-os-flasher setup [--config FILE] [--os-img-path DIR]
+
+Asks for the image directory, network access, SSH, the safety policy and the
+color theme, and writes them to the config file. It also runs on the first
+start in a terminal when there is no config file at the default path. An
+existing config is only replaced after confirmation.
+` + exitCodesUsage
+
+// runSetupCommand runs the setup wizard on demand.
+func runSetupCommand(args []string) int {
+	fs := flag.NewFlagSet("setup", flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, setupUsage) }
+	configPath := fs.String("config", config.DefaultPath, "Path to YAML config file")
+	osImgPath := fs.String("os-img-path", ".", "Path to OS image files directory, suggested as the image directory")
+	if _, err := applyEnv(fs); err != nil {
+		return failed(err)
+	}
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	in := bufio.NewReader(os.Stdin)
+	if _, err := os.Stat(*configPath); err == nil {
+		replace, err := askYesNo(in, os.Stdout, fmt.Sprintf("%s exists. Replace it?", *configPath), false)
+		if err != nil {
+			return failed(err)
+		}
+		if !replace {
+			return exitOK
+		}
+	}
+	if err := runSetup(*configPath, *osImgPath, in, os.Stdout); err != nil {
+		return failed(err)
+	}
+	return exitOK
+}
+
+// needsSetup reports whether the first-run setup should run: no config was
+// given, there is none at the default path and a person can answer.
+func needsSetup(fs *flag.FlagSet, path string, fromEnv map[string]bool) bool {
+	if explicitFlags(fs, fromEnv)["config"] || path != config.DefaultPath {
+		return false
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		return false
+	}
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// runSetup asks for the settings of a new station on out, reading the answers
+// from in, and writes them to the config file at path. osImgPath is suggested
+// as the image directory.
+func runSetup(path, osImgPath string, in *bufio.Reader, out io.Writer) error {
+	fmt.Fprintln(out, "Husarion OS Flasher setup")
+	fmt.Fprintf(out, "No answer keeps the default in brackets. The settings are written to %s.\n\n", path)
+
+	var cfg config.Config
+	dir, _ := filepath.Abs(osImgPath)
+	dir, err := ask(in, out, "Image directory", dir, func(s string) error {
+		if !filepath.IsAbs(s) {
+			return errors.New("give an absolute path")
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	cfg.ImageDir = dir
+
+	online, err := askYesNo(in, out, "Download images and sync them over the network?", true)
+	if err != nil {
+		return err
+	}
+	cfg.Offline = !online
+	if online {
+		cfg.Proxy, err = ask(in, out, "HTTP(S) proxy, empty for none", "", func(s string) error {
+			if s == "" {
+				return nil
+			}
+			u, err := url.Parse(s)
+			if err != nil || u.Host == "" {
+				return errors.New("give a URL such as http://proxy.lan:3128")
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if cfg.EnableSSH, err = askYesNo(in, out, "Serve the UI over SSH?", false); err != nil {
+		return err
+	}
+	if cfg.EnableSSH {
+		port, err := ask(in, out, "SSH port", "2222", func(s string) error {
+			if n, err := strconv.Atoi(s); err != nil || n < 1 || n > 65535 {
+				return errors.New("give a port between 1 and 65535")
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		cfg.SSHPort, _ = strconv.Atoi(port)
+	}
+
+	cfg.Verify, err = ask(in, out, "Check cards after flashing ("+strings.Join(config.VerifyModes, ", ")+")", "quick", oneOf(config.VerifyModes))
+	if err != nil {
+		return err
+	}
+	protected, err := ask(in, out, "Devices never to write, as path or model patterns separated by commas", "", func(s string) error {
+		for _, pattern := range splitList(s) {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return fmt.Errorf("%q: %w", pattern, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	cfg.ProtectedDevices = splitList(protected)
+
+	cfg.Theme, err = ask(in, out, "Color theme ("+strings.Join(config.Themes, ", ")+")", "default", oneOf(config.Themes))
+	if err != nil {
+		return err
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(cfg.ImageDir, 0o755); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(setupConfig(&cfg)), 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "\nWrote %s. Run husarion-os-flasher setup to change these settings, or edit the file.\n", path)
+	return nil
+}
+
+// setupConfig returns the config file written by the setup wizard.
+func setupConfig(cfg *config.Config) string {
+	var b strings.Builder
+	b.WriteString("# Written by husarion-os-flasher setup. See the README for every setting.\n\n")
+	fmt.Fprintf(&b, "# Directory of the OS images, unless --os-img-path is given.\nimage_dir: %s\n\n", strconv.Quote(cfg.ImageDir))
+	fmt.Fprintf(&b, "# Air-gapped sites: refuse downloads and skip the maintenance sync.\noffline: %t\n", cfg.Offline)
+	if cfg.Proxy != "" {
+		fmt.Fprintf(&b, "proxy: %s\n", strconv.Quote(cfg.Proxy))
+	}
+	fmt.Fprintf(&b, "\n# Serve the UI over SSH, unless --enable-ssh or --port are given.\nenable_ssh: %t\n", cfg.EnableSSH)
+	if cfg.SSHPort != 0 {
+		fmt.Fprintf(&b, "ssh_port: %d\n", cfg.SSHPort)
+	}
+	fmt.Fprintf(&b, "\n# Check run after every flash: none, quick, sampled or full.\nverify: %s\n", cfg.Verify)
+	b.WriteString("\n# Devices never written, by path or model pattern.\nprotected_devices:")
+	if len(cfg.ProtectedDevices) == 0 {
+		b.WriteString(" []\n")
+	} else {
+		b.WriteString("\n")
+		for _, pattern := range cfg.ProtectedDevices {
+			fmt.Fprintf(&b, "  - %s\n", strconv.Quote(pattern))
+		}
+	}
+	fmt.Fprintf(&b, "\n# Color theme: %s.\ntheme: %s\n", strings.Join(config.Themes, " or "), cfg.Theme)
+	return b.String()
+}
+
+// ask prints a question with its default answer and reads the answer until
+// valid accepts it. An empty answer is the default.
+func ask(in *bufio.Reader, out io.Writer, question, def string, valid func(string) error) (string, error) {
+	for {
+		fmt.Fprintf(out, "%s [%s]: ", question, def)
+		line, err := in.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return "", fmt.Errorf("setup cancelled: %w", err)
+		}
+		answer := strings.TrimSpace(line)
+		if answer == "" {
+			answer = def
+		}
+		if err := valid(answer); err != nil {
+			fmt.Fprintf(out, "  %v\n", err)
+			continue
+		}
+		return answer, nil
+	}
+}
+
+// askYesNo asks a yes or no question.
+func askYesNo(in *bufio.Reader, out io.Writer, question string, def bool) (bool, error) {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+	answer, err := ask(in, out, question, hint, func(s string) error {
+		if s != "Y/n" && s != "y/N" && !slices.Contains([]string{"y", "yes", "n", "no"}, strings.ToLower(s)) {
+			return errors.New("answer y or n")
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	switch strings.ToLower(answer) {
+	case "y", "yes":
+		return true, nil
+	case "n", "no":
+		return false, nil
+	}
+	return def, nil
+}
+
+// oneOf accepts the values of a list.
+func oneOf(values []string) func(string) error {
+	return func(s string) error {
+		if !slices.Contains(values, s) {
+			return fmt.Errorf("answer one of %s", strings.Join(values, ", "))
+		}
+		return nil
+	}
+}
+
+// splitList splits a comma-separated answer, dropping empty entries.
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// explicitFlags returns the flags of fs given on the command line or in the
+// environment, which the config does not override.
+func explicitFlags(fs *flag.FlagSet, fromEnv map[string]bool) map[string]bool {
+	explicit := make(map[string]bool)
+	for name := range fromEnv {
+		explicit[name] = true
+	}
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	return explicit
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	gossh "golang.org/x/crypto/ssh"
+
+	"github.com/husarion/husarion-os-flasher/cluster"
+	"github.com/husarion/husarion-os-flasher/config"
+	"github.com/husarion/husarion-os-flasher/internal/history"
+	"github.com/husarion/husarion-os-flasher/platform"
+	"github.com/husarion/husarion-os-flasher/ui"
+	"github.com/husarion/husarion-os-flasher/util"
+)
+
+const remoteCommandsUsage = `Commands:
+  version              print the flasher version
+  devices [--json]     list the devices that can be flashed
+  images [--json]      list the images in the image directory
+  jobs                 list the running jobs
+  pause                hold the jobs waiting to start, running ones finish
+  resume               start the jobs held by pause
+  abort-all            abort the jobs running in every session
+  stats [--csv]        summarize the flashes recorded on this station
+  failures [N]         list the failed jobs, or print the output of the N-th
+  flash IMAGE DEVICE   flash an image (a name from "images") to a device
+  backup [--no-compress] DEVICE
+                       copy a device to a new image in the image directory
+
+Coordinator commands (--coordinate):
+  stations                      list the stations reporting to this coordinator
+  dispatch STATION COMMAND ...  run one of the commands above on a station
+` + exitCodesUsage
+
+// commandServer answers SSH sessions that run a command instead of the UI.
+type commandServer struct {
+	osImgPath   string
+	cfg         *config.Config
+	hostKeyPath string // authenticates this station when dispatching to agents
+	coordinate  bool   // accept agent reports
+}
+
+// middleware serves command sessions, which is how the remote command and the
+// coordinator drive a station. Interactive sessions are passed on to the UI.
+func (c *commandServer) middleware() wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			args := s.Command()
+			if len(args) == 0 {
+				next(s)
+				return
+			}
+			code := c.serve(s, args)
+			_ = s.Exit(code)
+		}
+	}
+}
+
+// serve runs a command of a remote session and returns its exit status: 1 when
+// it failed, 2 for usage errors.
+func (c *commandServer) serve(s ssh.Session, args []string) int {
+	osImgPath, cfg := c.osImgPath, c.cfg
+	out, errOut := io.Writer(s), s.Stderr()
+	fail := func(err error) int {
+		fmt.Fprintln(errOut, "Error:", err)
+		return exitCode(err)
+	}
+
+	if !ui.Allowed(cfg, ui.KeyRole(cfg, s.PublicKey()), args[0]) {
+		fmt.Fprintf(errOut, "Error: %s is reserved to admins\n", args[0])
+		return exitDenied
+	}
+
+	switch args[0] {
+	case "version":
+		fmt.Fprintln(out, util.Version)
+	case "devices":
+		if len(args) > 2 || len(args) == 2 && args[1] != "--json" {
+			fmt.Fprint(errOut, remoteCommandsUsage)
+			return exitUsage
+		}
+		if len(args) == 2 {
+			devices, err := ui.ListDevices(osImgPath)
+			if err != nil {
+				return fail(err)
+			}
+			if err := writeJSON(out, devices); err != nil {
+				return fail(err)
+			}
+			break
+		}
+		devices, err := platform.Current.Devices()
+		if err != nil {
+			return fail(err)
+		}
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		for _, dev := range devices {
+			size := "?"
+			if n, err := platform.Current.DiskSize(dev); err == nil {
+				size = util.FormatBytes(n)
+			}
+			fmt.Fprintf(w, "%s\t%s\n", dev, size)
+		}
+		w.Flush()
+	case "images":
+		if len(args) > 2 || len(args) == 2 && args[1] != "--json" {
+			fmt.Fprint(errOut, remoteCommandsUsage)
+			return exitUsage
+		}
+		if len(args) == 2 {
+			images, err := ui.ListImages(osImgPath, cfg.Robot)
+			if err != nil {
+				return fail(err)
+			}
+			if err := writeJSON(out, images); err != nil {
+				return fail(err)
+			}
+			break
+		}
+		images, err := ui.ImageFiles(osImgPath)
+		if err != nil {
+			return fail(err)
+		}
+		for _, img := range images {
+			fmt.Fprintln(out, filepath.Base(img))
+		}
+	case "jobs":
+		if ui.QueuePaused() {
+			fmt.Fprintln(out, "Queue paused")
+		}
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		for _, job := range ui.RunningJobs() {
+			fmt.Fprintf(w, "#%d\t%s\t%s\t%s\t%s\t%s\n", job.ID, job.Kind, filepath.Base(job.Src), job.Dst,
+				util.FormatDuration(time.Since(job.Started)), job.Operator)
+		}
+		w.Flush()
+	case "pause", "resume", "abort-all":
+		if len(args) != 1 {
+			fmt.Fprint(errOut, remoteCommandsUsage)
+			return exitUsage
+		}
+		switch args[0] {
+		case "pause":
+			if !ui.PauseQueue(sshOperator(s)) {
+				fmt.Fprintln(out, "The queue is already paused")
+				break
+			}
+			fmt.Fprintln(out, "Queue paused: running jobs finish, the next ones wait")
+		case "resume":
+			if !ui.ResumeQueue(sshOperator(s)) {
+				fmt.Fprintln(out, "The queue is not paused")
+				break
+			}
+			fmt.Fprintln(out, "Queue resumed")
+		case "abort-all":
+			fmt.Fprintf(out, "Aborting %d running job(s)\n", ui.AbortAll(sshOperator(s)))
+		}
+	case "stats":
+		if len(args) > 2 || len(args) == 2 && args[1] != "--csv" {
+			fmt.Fprint(errOut, remoteCommandsUsage)
+			return exitUsage
+		}
+		entries, err := history.Load(ui.HistoryPath(osImgPath))
+		if err != nil {
+			return fail(err)
+		}
+		summary := history.Summarize(entries)
+		if len(args) == 2 {
+			if err := summary.WriteCSV(out); err != nil {
+				return fail(err)
+			}
+			break
+		}
+		for _, line := range summary.Lines() {
+			fmt.Fprintln(out, line)
+		}
+	case "failures":
+		if len(args) > 2 {
+			fmt.Fprint(errOut, remoteCommandsUsage)
+			return exitUsage
+		}
+		failed, err := ui.LoadFailures(osImgPath)
+		if err != nil {
+			return fail(err)
+		}
+		if len(args) == 2 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 || n > len(failed) {
+				return fail(fmt.Errorf("no failed job number %q", args[1]))
+			}
+			fmt.Fprintln(out, ui.FailureDetails(osImgPath, failed[n-1]))
+			break
+		}
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		for i, e := range failed {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", i+1, e.Finished.Format(time.DateTime), e.Kind, e.Image, e.Device, e.Error)
+		}
+		w.Flush()
+	case "flash":
+		if len(args) != 3 {
+			fmt.Fprint(errOut, remoteCommandsUsage)
+			return exitUsage
+		}
+		image, err := resolveImage(osImgPath, args[1])
+		if err != nil {
+			return fail(err)
+		}
+		device, err := resolveDevice(args[2])
+		if err != nil {
+			return fail(err)
+		}
+		// Closing the connection aborts the write, like the abort button
+		abort := abortOnClose(s)
+		if err := ui.RunFlash(cfg, image, device, sshOperator(s), out, abort); err != nil {
+			return fail(err)
+		}
+		fmt.Fprintf(out, "%s flashed successfully to %s\n", filepath.Base(image), device)
+	case "backup":
+		compress := true
+		if len(args) == 3 && args[1] == "--no-compress" {
+			compress = false
+			args = args[1:]
+		}
+		if len(args) != 2 {
+			fmt.Fprint(errOut, remoteCommandsUsage)
+			return exitUsage
+		}
+		device, err := resolveDevice(args[1])
+		if err != nil {
+			return fail(err)
+		}
+		// Closing the connection aborts the copy
+		abort := abortOnClose(s)
+		output := backupPath(osImgPath, device, compress)
+		if err := ui.BackupDevice(cfg, device, output, compress, false, sshOperator(s), out, abort); err != nil {
+			return fail(err)
+		}
+		fmt.Fprintf(out, "%s backed up to %s\n", device, filepath.Base(output))
+	case "agent-report", "stations", "dispatch":
+		if !c.coordinate {
+			return fail(errors.New("this station is not a coordinator (--coordinate)"))
+		}
+		return c.serveCoordinator(s, args)
+	default:
+		fmt.Fprint(errOut, remoteCommandsUsage)
+		return exitUsage
+	}
+	return exitOK
+}
+
+// serveCoordinator runs the commands of a coordinator.
+func (c *commandServer) serveCoordinator(s ssh.Session, args []string) int {
+	out, errOut := io.Writer(s), s.Stderr()
+	fail := func(err error) int {
+		fmt.Fprintln(errOut, "Error:", err)
+		return exitCode(err)
+	}
+
+	switch args[0] {
+	case "agent-report":
+		// Agents authenticate with their host key, which identifies them when
+		// the coordinator connects back
+		if s.PublicKey() == nil {
+			return fail(errors.New("agents must authenticate with their host key"))
+		}
+		var report cluster.Report
+		if err := json.NewDecoder(s).Decode(&report); err != nil {
+			return fail(err)
+		}
+		if report.Name == "" {
+			return fail(errors.New("report without a station name"))
+		}
+		host, _, _ := net.SplitHostPort(s.RemoteAddr().String())
+		if err := cluster.Register(report, host, gossh.FingerprintSHA256(s.PublicKey())); err != nil {
+			return fail(err)
+		}
+	case "stations":
+		now := time.Now()
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		for _, st := range cluster.Stations() {
+			state := "online"
+			if !st.Online(now) {
+				state = "offline since " + st.LastSeen.Format(time.TimeOnly)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d device(s)\t%d job(s)\n", st.Name, st.Address, state, len(st.Devices), len(st.Jobs))
+		}
+		w.Flush()
+	case "dispatch":
+		if len(args) < 3 {
+			fmt.Fprint(errOut, remoteCommandsUsage)
+			return exitUsage
+		}
+		st, ok := cluster.Lookup(args[1])
+		if !ok {
+			return fail(fmt.Errorf("no station named %q", args[1]))
+		}
+		signer, err := cluster.LoadSigner(c.hostKeyPath)
+		if err != nil {
+			return fail(err)
+		}
+		code, err := cluster.Run(st, s.User(), signer, args[2:], out, errOut)
+		if err != nil {
+			return fail(fmt.Errorf("%s: %v", st.Name, err))
+		}
+		return code
+	}
+	return exitOK
+}
+
+// abortOnClose returns a channel closed when the session's connection closes
+// or every job is aborted.
+func abortOnClose(s ssh.Session) <-chan struct{} {
+	abort := make(chan struct{})
+	aborted := ui.AbortAllRequested()
+	go func() {
+		select {
+		case <-s.Context().Done():
+		case <-aborted:
+		}
+		close(abort)
+	}()
+	return abort
+}
+
+// resolveImage returns the path of an image in the image directory given its
+// name. Only listed images are accepted so a remote command cannot read other
+// files.
+func resolveImage(osImgPath, name string) (string, error) {
+	images, err := ui.ImageFiles(osImgPath)
+	if err != nil {
+		return "", err
+	}
+	for _, img := range images {
+		if filepath.Base(img) == name || img == name {
+			return img, nil
+		}
+	}
+	return "", notFoundError{fmt.Errorf("no image named %q in %s", name, osImgPath)}
+}
+
+// resolveDevice checks that a device is one the UI would offer, never the system
+// disk.
+func resolveDevice(name string) (string, error) {
+	devices, err := platform.Current.Devices()
+	if err != nil {
+		return "", err
+	}
+	for _, dev := range devices {
+		if dev == name {
+			return dev, nil
+		}
+	}
+	return "", notFoundError{fmt.Errorf("%s is not a removable device (see devices: %s)", name, strings.Join(devices, ", "))}
+}
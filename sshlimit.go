@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/charmbracelet/ssh"
+)
+
+// autoBanDuration is how long an address that exceeded the connection rate is
+// refused.
+const autoBanDuration = 10 * time.Minute
+
+// maxTrackedAddrs bounds the per-address bookkeeping; beyond it stale entries are
+// dropped so a flood from many addresses cannot exhaust memory.
+const maxTrackedAddrs = 4096
+
+// connLimiter protects the SSH server: it caps concurrent connections, bans
+// addresses that connect too often and refuses addresses from the ban list.
+type connLimiter struct {
+	maxConns  int // 0 for no cap
+	perMinute int // connection attempts per address, 0 for no limit
+	banned    []*net.IPNet
+
+	mu          sync.Mutex
+	active      int
+	attempts    map[string][]time.Time
+	bannedUntil map[string]time.Time
+}
+
+// newConnLimiter creates a limiter, reading the ban list from banFile if set.
+func newConnLimiter(maxConns, perMinute int, banFile string) (*connLimiter, error) {
+	l := &connLimiter{
+		maxConns:    maxConns,
+		perMinute:   perMinute,
+		attempts:    make(map[string][]time.Time),
+		bannedUntil: make(map[string]time.Time),
+	}
+	if banFile != "" {
+		banned, err := readBanList(banFile)
+		if err != nil {
+			return nil, err
+		}
+		l.banned = banned
+	}
+	return l, nil
+}
+
+// readBanList parses a file with one IP address or CIDR range per line. Empty
+// lines and lines starting with # are ignored.
+func readBanList(path string) ([]*net.IPNet, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var nets []*net.IPNet
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !strings.Contains(line, "/") {
+			if ip := net.ParseIP(line); ip != nil && ip.To4() != nil {
+				line += "/32"
+			} else {
+				line += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid address %q", path, n, line)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, scanner.Err()
+}
+
+// admit decides whether a new connection from ip is accepted and, if so, counts
+// it as active. The reason is empty when the connection is accepted.
+func (l *connLimiter) admit(ip net.IP, now time.Time) (reason string) {
+	for _, n := range l.banned {
+		if n.Contains(ip) {
+			return "banned"
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.attempts)+len(l.bannedUntil) > maxTrackedAddrs {
+		l.sweep(now)
+	}
+	addr := ip.String()
+	if until, ok := l.bannedUntil[addr]; ok {
+		if now.Before(until) {
+			return "temporarily banned"
+		}
+		delete(l.bannedUntil, addr)
+	}
+
+	if l.perMinute > 0 {
+		recent := l.attempts[addr][:0]
+		for _, t := range l.attempts[addr] {
+			if now.Sub(t) < time.Minute {
+				recent = append(recent, t)
+			}
+		}
+		recent = append(recent, now)
+		l.attempts[addr] = recent
+		if len(recent) > l.perMinute {
+			delete(l.attempts, addr)
+			l.bannedUntil[addr] = now.Add(autoBanDuration)
+			return fmt.Sprintf("more than %d connections per minute, banned for %s", l.perMinute, autoBanDuration)
+		}
+	}
+
+	if l.maxConns > 0 && l.active >= l.maxConns {
+		return fmt.Sprintf("%d sessions already open", l.active)
+	}
+	l.active++
+	return ""
+}
+
+// sweep drops expired bans and addresses without recent attempts.
+func (l *connLimiter) sweep(now time.Time) {
+	for addr, times := range l.attempts {
+		if len(times) == 0 || now.Sub(times[len(times)-1]) >= time.Minute {
+			delete(l.attempts, addr)
+		}
+	}
+	for addr, until := range l.bannedUntil {
+		if !now.Before(until) {
+			delete(l.bannedUntil, addr)
+		}
+	}
+}
+
+// release counts an accepted connection as closed.
+func (l *connLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active--
+}
+
+// wrapConn is the ssh.ConnCallback of the limiter: refused connections are
+// closed before the SSH handshake.
+func (l *connLimiter) wrapConn(_ ssh.Context, conn net.Conn) net.Conn {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	ip := net.ParseIP(host)
+	if err != nil || ip == nil {
+		return conn
+	}
+	if reason := l.admit(ip, time.Now()); reason != "" {
+		log.Warn("Refused SSH connection", "remote-addr", host, "reason", reason)
+		return nil
+	}
+	return &limitedConn{Conn: conn, release: l.release}
+}
+
+// limitedConn releases its slot in the limiter when closed.
+type limitedConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *limitedConn) Close() error {
+	c.once.Do(c.release)
+	return c.Conn.Close()
+}
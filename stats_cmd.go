@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/husarion/husarion-os-flasher/internal/history"
+	"github.com/husarion/husarion-os-flasher/ui"
+)
+
+const statsUsage = `Usage:
+  husarion-os-flasher stats [--os-img-path DIR] [--csv]
+
+Summarizes the flashes recorded in DIR/logs/history.csv. --csv prints the
+statistics as CSV instead, one row per total, image, day and device model.
+`
+
+// runStatsCommand prints the flash statistics of an image directory.
+func runStatsCommand(args []string) int {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, statsUsage) }
+	osImgPath := fs.String("os-img-path", ".", "Path to OS image files directory")
+	asCSV := fs.Bool("csv", false, "Print the statistics as CSV")
+	if _, err := applyEnv(fs); err != nil {
+		return failed(err)
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fmt.Fprint(os.Stderr, statsUsage)
+		return exitUsage
+	}
+
+	entries, err := history.Load(ui.HistoryPath(*osImgPath))
+	if err != nil {
+		return failed(err)
+	}
+	summary := history.Summarize(entries)
+	if *asCSV {
+		if err := summary.WriteCSV(os.Stdout); err != nil {
+			return failed(err)
+		}
+		return exitOK
+	}
+	for _, line := range summary.Lines() {
+		fmt.Println(line)
+	}
+	return exitOK
+}
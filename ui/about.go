@@ -0,0 +1,98 @@
+package ui
+
+import (
+	"net/url"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/husarion/husarion-os-flasher/config"
+	"github.com/husarion/husarion-os-flasher/platform"
+	"github.com/husarion/husarion-os-flasher/util"
+)
+
+// aboutTools are the external tools whose versions are reported in the About overlay.
+var aboutTools = []string{"xz", "zstd", "bzip2"}
+
+// toolVersion returns the first line of `<tool> --version`, or "not found".
+func toolVersion(tool string) string {
+	if _, err := exec.LookPath(tool); err != nil {
+		return "not found"
+	}
+	out, err := util.Command(tool, "--version").CombinedOutput()
+	if err != nil && len(out) == 0 {
+		return "unknown"
+	}
+	line, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+	return line
+}
+
+// toolVersions returns the lines of the aboutTools' versions. They are looked
+// up once, as running every tool takes a moment and they do not change while
+// the flasher runs.
+var toolVersions = sync.OnceValue(func() []string {
+	var lines []string
+	for _, tool := range aboutTools {
+		lines = append(lines, "Tool "+tool+": "+strings.Repeat(" ", 6-len(tool))+toolVersion(tool))
+	}
+	return lines
+})
+
+// AboutMsg carries the environment block of the About overlay.
+type AboutMsg struct {
+	Lines []string
+}
+
+// aboutCmd reads the environment block off the UI goroutine.
+func aboutCmd(osImgPath string, cfg *config.Config) tea.Cmd {
+	return func() tea.Msg {
+		return AboutMsg{Lines: EnvironmentInfo(osImgPath, cfg)}
+	}
+}
+
+// withEnvironment returns a report with the environment block inserted after
+// its title line, for support tickets.
+func withEnvironment(lines []string, osImgPath string, cfg *config.Config) []string {
+	report := append([]string{lines[0]}, EnvironmentInfo(osImgPath, cfg)...)
+	return append(report, lines[1:]...)
+}
+
+// EnvironmentInfo returns the version and environment block shown in the About
+// overlay and at the top of crash reports, failure details and the composite
+// and provisioning reports.
+func EnvironmentInfo(osImgPath string, cfg *config.Config) []string {
+	host := runtime.GOOS + "/" + runtime.GOARCH
+	if model := util.BoardModel(); model != "" {
+		host += " (" + model + ")"
+	}
+	if platform.InContainer() {
+		host += " in a container"
+	}
+	lines := []string{
+		"Version:    " + util.Version,
+		"Commit:     " + util.BuildCommit(),
+		"Go:         " + runtime.Version(),
+		"Platform:   " + host,
+		"Images:     " + osImgPath,
+	}
+	if cfg != nil && cfg.Path != "" {
+		lines = append(lines, "Config:     "+cfg.Path)
+	} else {
+		lines = append(lines, "Config:     none (command-line flags only)")
+	}
+	switch {
+	case cfg != nil && cfg.Offline:
+		lines = append(lines, "Network:    offline")
+	case cfg != nil && cfg.Proxy != "":
+		// Hide the password of the proxy, as crash reports are shared
+		proxy := cfg.Proxy
+		if u, err := url.Parse(proxy); err == nil {
+			proxy = u.Redacted()
+		}
+		lines = append(lines, "Network:    proxy "+proxy)
+	}
+	return append(lines, toolVersions()...)
+}
@@ -0,0 +1,112 @@
+package ui
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/creack/pty"
+
+	"github.com/husarion/husarion-os-flasher/config"
+)
+
+// StartAction runs a config-defined shell command action, streaming its output into the log
+func (m *Model) StartAction(action config.Action) (tea.Model, tea.Cmd) {
+	if m.Busy() {
+		return m, nil
+	}
+
+	var imagePath, devicePath string
+	if item := m.ImageList.SelectedItem(); item != nil {
+		imagePath = item.(Item).value
+	}
+	if item := m.DeviceList.SelectedItem(); item != nil {
+		devicePath = item.(Item).value
+	}
+
+	jobID, err := beginJob("action", action.Label, devicePath, m.Operator)
+	if err != nil {
+		m.AddLog(fmt.Sprintf("Error: %v", err))
+		return m, nil
+	}
+
+	m.ProgressChan = make(chan tea.Msg, 100)
+	m.RunningAction = action.Label
+	m.Aborting = false
+	m.ActionCmd = nil
+	m.ActionPty = nil
+	m.JobID = jobID
+	m.AddLog(fmt.Sprintf("> Running %s...", action.Label))
+	m.FocusButton("abort-button")
+
+	return m, tea.Batch(
+		RunAction(action, imagePath, devicePath, m.OsImgPath, m.ProgressChan),
+		ListenProgress(m.ProgressChan),
+	)
+}
+
+// RunAction executes the action command under a pty. The selected image and device
+// are exported as IMAGE and DEVICE, the image directory as OS_IMG_PATH and the
+// connected robot as ROBOT_MODEL, ROBOT_REVISION and ROBOT_SERIAL.
+func RunAction(action config.Action, imagePath, devicePath, osImgPath string, progressChan chan tea.Msg) tea.Cmd {
+	return func() tea.Msg {
+		defer recoverJob(progressChan)
+
+		cmd := exec.Command("bash", "-c", action.Command)
+		cmd.Env = append(os.Environ(),
+			"IMAGE="+imagePath,
+			"DEVICE="+devicePath,
+			"OS_IMG_PATH="+osImgPath,
+		)
+		cmd.Env = append(cmd.Env, robotEnv(currentRobot())...)
+
+		err := startStreamed(cmd, progressChan, func(line string) tea.Msg { return ProgressMsg(line) },
+			func(ptmx *os.File) tea.Msg { return ActionStartedMsg{Cmd: cmd, Pty: ptmx} },
+			func(err error) tea.Msg { return ActionCompletedMsg{Label: action.Label, Err: err} })
+		if err != nil {
+			return ErrorMsg{Err: fmt.Errorf("failed to start %s: %v", action.Label, err)}
+		}
+
+		return nil
+	}
+}
+
+// startStreamed starts cmd under a pty, sends started, then streams every output
+// line through wrap and finally sends done with the command's exit error.
+func startStreamed(cmd *exec.Cmd, progressChan chan tea.Msg, wrap func(string) tea.Msg,
+	started func(*os.File) tea.Msg, done func(error) tea.Msg) error {
+	ptmx, err := pty.Start(cmd)
+	if err != nil {
+		return err
+	}
+	progressChan <- started(ptmx)
+
+	go func() {
+		defer recoverJob(progressChan)
+		defer ptmx.Close()
+
+		scanner := bufio.NewScanner(ptmx)
+		scanner.Split(splitCRLF)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+			select {
+			case progressChan <- wrap(line):
+			default:
+				return
+			}
+		}
+
+		err := cmd.Wait()
+		select {
+		case progressChan <- done(err):
+		default:
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,166 @@
+package ui
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/husarion/husarion-os-flasher/config"
+	"github.com/husarion/husarion-os-flasher/platform"
+	"github.com/husarion/husarion-os-flasher/util"
+)
+
+// maxApprovalTries is how many wrong PINs cancel an approval.
+const maxApprovalTries = 3
+
+// approval is a flash waiting for a second operator's PIN.
+type approval struct {
+	Image, Device string
+	Reason        string          // why the device needs approval
+	PIN           string          // typed so far
+	Tries         int             // wrong PINs entered
+	Approver      string          // set once approved
+	Snapshot      *deviceSnapshot // the device when the flash was requested, once read
+}
+
+// approvalReason explains why flashing a device needs a second operator under
+// the two-person policy, empty when it does not.
+func approvalReason(cfg *config.Config, device string) string {
+	if cfg == nil || cfg.TwoPerson == nil {
+		return ""
+	}
+	t := cfg.TwoPerson
+	if t.MinSizeGB > 0 {
+		if size, err := platform.Current.DiskSize(device); err == nil && size >= int64(t.MinSizeGB)*1_000_000_000 {
+			return fmt.Sprintf("it is %s, at least %d GB", util.FormatBytes(size), t.MinSizeGB)
+		}
+	}
+	model := platform.Model(device)
+	for _, pattern := range t.Devices {
+		if ok, _ := filepath.Match(pattern, device); ok {
+			return "it matches " + pattern
+		}
+		if ok, _ := filepath.Match(pattern, model); ok && model != "" {
+			return fmt.Sprintf("its model %s matches %s", model, pattern)
+		}
+	}
+	return ""
+}
+
+// approverFor returns the approver whose PIN this is. The operator who started
+// the flash cannot approve it.
+func approverFor(t *config.TwoPerson, pin, operator string) (string, bool) {
+	sum := sha256.Sum256([]byte(pin))
+	for _, a := range t.Approvers {
+		want, err := hex.DecodeString(a.PINSHA256)
+		if err != nil || subtle.ConstantTimeCompare(sum[:], want) != 1 {
+			continue
+		}
+		if sameOperator(operator, a.Name) {
+			return "", false
+		}
+		return a.Name, true
+	}
+	return "", false
+}
+
+// sameOperator reports whether an operator of the audit log, such as
+// "console (alice)" or "alice@10.0.0.5 (SHA256:...)", is the named person.
+func sameOperator(operator, name string) bool {
+	return operator == name || operator == "console ("+name+")" || strings.HasPrefix(operator, name+"@")
+}
+
+// approved reports whether the pending approval covers flashing image to
+// device, and takes it.
+func (m *Model) approved(image, device string) (string, bool) {
+	a := m.Approval
+	if a == nil || a.Approver == "" || a.Image != image || a.Device != device {
+		return "", false
+	}
+	m.Approval = nil
+	return a.Approver, true
+}
+
+// handleApprovalKey edits the PIN of the pending approval, checks it on Enter
+// and cancels it on Esc.
+func (m Model) handleApprovalKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	a := m.Approval
+	switch msg.Type {
+	case tea.KeyEsc:
+		m.cancelApproval("Approval cancelled.")
+		return m, nil
+	case tea.KeyBackspace:
+		if len(a.PIN) > 0 {
+			a.PIN = a.PIN[:len(a.PIN)-1]
+		}
+		return m, nil
+	case tea.KeyRunes:
+		a.PIN += string(msg.Runes)
+		return m, nil
+	case tea.KeyEnter:
+	default:
+		return m, nil
+	}
+
+	name, ok := approverFor(m.Config.TwoPerson, a.PIN, m.Operator)
+	a.PIN = ""
+	if !ok {
+		a.Tries++
+		writeAudit("deny", JobRecord{Kind: "flash", Src: a.Image, Dst: a.Device, Operator: m.Operator})
+		if a.Tries >= maxApprovalTries {
+			m.cancelApproval(fmt.Sprintf("Error: approval failed after %d wrong PINs.", a.Tries))
+		}
+		return m, nil
+	}
+	a.Approver = name
+	model, cmd := m.flashImage(a.Image, a.Device)
+	// A flash that could not start has logged why
+	mm := model.(*Model)
+	if mm.Approval != nil {
+		mm.cancelApproval("Approval cancelled.")
+	}
+	return mm, cmd
+}
+
+// cancelApproval drops the pending approval, failing the wizard step or
+// stopping the duplication that waited for it.
+func (m *Model) cancelApproval(reason string) {
+	m.Approval = nil
+	m.AddLog(reason)
+	m.wizardStepFinished("cancelled", nil)
+	m.slotFinished("cancelled", nil)
+}
+
+// renderApproval renders the PIN prompt of the pending approval.
+func (m Model) renderApproval() string {
+	styles := Styles()
+	a := m.Approval
+	header := styles.Header.Render(" Second operator approval ")
+
+	lines := []string{
+		fmt.Sprintf("Flash %s to %s", filepath.Base(a.Image), a.Device),
+		"needs the approval of a second operator: " + a.Reason + ".",
+		"",
+		"PIN: " + strings.Repeat("•", len(a.PIN)),
+	}
+	if a.Tries > 0 {
+		lines = append(lines, lipgloss.NewStyle().Foreground(lipgloss.Color(ColorError)).Render(
+			fmt.Sprintf("Wrong PIN, %d of %d tries left.", maxApprovalTries-a.Tries, maxApprovalTries)))
+	}
+	body := styles.Container.Render(styles.InfoPanel.Render(strings.Join(lines, "\n")))
+	footer := styles.FooterStyle.Render("A second operator enters their PIN • ENTER to approve • ESC to cancel")
+
+	return lipgloss.Place(
+		m.Width,
+		m.Height,
+		lipgloss.Center,
+		lipgloss.Center,
+		lipgloss.JoinVertical(lipgloss.Center, header, body, footer),
+	)
+}
@@ -0,0 +1,57 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// auditLogFile records who started and aborted each job, next to crash reports.
+const auditLogFile = "audit.log"
+
+// ConsoleOperator identifies the local console user in the audit log.
+func ConsoleOperator() string {
+	if user := os.Getenv("SUDO_USER"); user != "" {
+		return "console (" + user + ")"
+	}
+	return "console"
+}
+
+// writeAudit appends an action on a job to the audit log and the recent log ring.
+// Failures to write are ignored: auditing must not stop a flash.
+func writeAudit(action string, job JobRecord) {
+	operator := job.Operator
+	if operator == "" {
+		operator = "unknown"
+	}
+	line := fmt.Sprintf("%s %s %s %s", operator, action, job.Kind, job.Src)
+	if job.Dst != "" {
+		line += " -> " + job.Dst
+	}
+	rememberLog("audit: " + line)
+	writeAuditLine(line)
+}
+
+// writeAuditLine appends a line to the audit log, ignoring failures.
+func writeAuditLine(line string) {
+	crashState.Lock()
+	imgPath := crashState.imgPath
+	crashState.Unlock()
+	if imgPath == "" {
+		return
+	}
+	dir := crashDir(imgPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return
+	}
+	f, err := os.OpenFile(filepath.Join(dir, auditLogFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	if clockMark() != "" {
+		line += " [unsynced clock]"
+	}
+	fmt.Fprintf(f, "%s %s\n", time.Now().Format(time.RFC3339), line)
+}
@@ -0,0 +1,194 @@
+package ui
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/creack/pty"
+	gossh "golang.org/x/crypto/ssh"
+	"gopkg.in/yaml.v3"
+
+	"github.com/husarion/husarion-os-flasher/bmap"
+	"github.com/husarion/husarion-os-flasher/config"
+	"github.com/husarion/husarion-os-flasher/internal/sign"
+	"github.com/husarion/husarion-os-flasher/platform"
+	"github.com/husarion/husarion-os-flasher/util"
+)
+
+// BackupDevice copies a device to an image file without the UI, for the backup
+// and remote commands, compressing it with xz when compress is set. The image
+// is written to output.part and renamed once complete with its
+// <output>.meta.yaml sidecar, and a <output>.bmap when withBmap is set, then
+// signed when the config has a signing key. Progress lines are written to
+// out. Closing abort stops the copy, leaving no partial output behind.
+func BackupDevice(cfg *config.Config, device, output string, compress, withBmap bool, operator string, out io.Writer, abort <-chan struct{}) error {
+	if compress && withBmap {
+		return errors.New("a bmap can only be generated for an uncompressed backup")
+	}
+	// A bad key fails before the copy rather than after it
+	var signer gossh.Signer
+	var err error
+	if cfg.SigningKey != "" {
+		if signer, err = sign.LoadKey(cfg.SigningKey); err != nil {
+			return fmt.Errorf("cannot sign the backup: %v", err)
+		}
+	}
+	id, err := beginJob("backup", output, device, operator)
+	if err != nil {
+		return err
+	}
+	job, _ := runningJob(id)
+	defer endJob(id)
+	out = progressWriter(id, out)
+
+	err = backupDevice(device, output, compress, withBmap, out, abort)
+	if err == nil && signer != nil {
+		err = signImage(output, signer, out)
+	}
+	result := "success"
+	if errors.Is(err, ErrAborted) {
+		result = "aborted"
+	} else if err != nil {
+		result = "failure"
+	}
+	publishJobFinished(job, result, err, nil)
+	return err
+}
+
+// backupDevice runs the copy of BackupDevice. With withBmap the copy is
+// written sparse, so the blocks left empty on the device stay unmapped.
+func backupDevice(device, output string, compress, withBmap bool, out io.Writer, abort <-chan struct{}) error {
+	fmt.Fprintf(out, "Unmounting all partitions under %s if mounted...\n", device)
+	if err := platform.Current.Unmount(device); err != nil {
+		fmt.Fprintf(out, "Unmount error (ignored): %v\n", err)
+	}
+	size, err := platform.Current.DiskSize(device)
+	if err != nil {
+		return fmt.Errorf("backup failed: %v", err)
+	}
+
+	tempPath := output + ".part"
+	pipeline := fmt.Sprintf("set -o pipefail; pv -f -s %d %q > %q", size, device, tempPath)
+	if compress {
+		pipeline = fmt.Sprintf("set -o pipefail; pv -f -s %d %q | xz -T0 -c > %q", size, device, tempPath)
+	} else if withBmap {
+		pipeline = fmt.Sprintf("set -o pipefail; pv -f -s %d %q | dd of=%q bs=1M conv=sparse status=none", size, device, tempPath)
+	}
+	cmd := util.Command("bash", "-c", pipeline)
+	prioritize(cmd)
+	ptmx, err := pty.Start(cmd)
+	if err != nil {
+		return fmt.Errorf("failed to start backup command: %v", err)
+	}
+	fmt.Fprintf(out, "Backing up %s (%s) to %s...\n", device, util.FormatBytes(size), output)
+
+	done := make(chan struct{})
+	aborted := make(chan struct{})
+	go func() {
+		select {
+		case <-abort:
+			close(aborted)
+			_ = cmd.Process.Kill()
+			_ = ptmx.Close()
+		case <-done:
+		}
+	}()
+
+	var lines []string
+	scanner := bufio.NewScanner(ptmx)
+	scanner.Split(splitCRLF)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			fmt.Fprintln(out, stripANSI(line))
+			lines = append(lines, stripANSI(line))
+		}
+	}
+	err = cmd.Wait()
+	close(done)
+	_ = ptmx.Close()
+
+	select {
+	case <-aborted:
+		_ = os.Remove(tempPath)
+		return ErrAborted
+	default:
+	}
+	if err != nil {
+		_ = os.Remove(tempPath)
+		err = fmt.Errorf("backup failed: %v", err)
+		if hint, ok := diagnoseFailure(err, lines); ok {
+			fmt.Fprint(out, hint.Text())
+		}
+		return &JobError{Err: err, Output: lines}
+	}
+	if err := writeBackupSidecars(device, tempPath, output, withBmap, out); err != nil {
+		_ = os.Remove(tempPath)
+		_ = os.Remove(output + metaSuffix)
+		_ = os.Remove(output + ".bmap")
+		return err
+	}
+	_ = util.Command("sync").Run()
+	if err := os.Rename(tempPath, output); err != nil {
+		_ = os.Remove(tempPath)
+		return fmt.Errorf("failed to finalize backup: %v", err)
+	}
+	if st, err := os.Stat(output); err == nil {
+		fmt.Fprintf(out, "Backup complete. Final size: %s\n", util.FormatBytes(st.Size()))
+	}
+	return nil
+}
+
+// writeBackupSidecars writes the <output>.meta.yaml of a backup copied to
+// tempPath, describing the device it was copied from, and its <output>.bmap
+// when withBmap is set. They are written before the image is renamed into
+// place, so it never shows up without them.
+func writeBackupSidecars(device, tempPath, output string, withBmap bool, out io.Writer) error {
+	description := "Backup of " + device
+	if model := platform.Model(device); model != "" {
+		description += " (" + model + ")"
+	}
+	if serial := platform.Serial(device); serial != "" {
+		description += ", serial " + serial
+	}
+	meta, err := yaml.Marshal(ImageMeta{BuildDate: time.Now().Format("2006-01-02"), Description: description})
+	if err == nil {
+		err = os.WriteFile(output+metaSuffix, meta, 0644)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write the backup metadata: %v", err)
+	}
+	if !withBmap {
+		return nil
+	}
+	fmt.Fprintf(out, "Generating %s...\n", filepath.Base(output)+".bmap")
+	bm, err := bmap.Generate(tempPath, 4096)
+	if err != nil {
+		return fmt.Errorf("failed to generate the bmap: %v", err)
+	}
+	data, err := bm.Marshal()
+	if err == nil {
+		err = os.WriteFile(output+".bmap", data, 0644)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write the bmap: %v", err)
+	}
+	fmt.Fprintf(out, "Bmap maps %s of %s\n", util.FormatBytes(bm.MappedBytes()), util.FormatBytes(bm.ImageSize))
+	return nil
+}
+
+// signImage signs an image into its signature file.
+func signImage(image string, signer gossh.Signer, out io.Writer) error {
+	fmt.Fprintf(out, "Signing %s with %s...\n", filepath.Base(image), gossh.FingerprintSHA256(signer.PublicKey()))
+	sigPath, err := sign.File(image, signer)
+	if err != nil {
+		return fmt.Errorf("signing failed: %v", err)
+	}
+	fmt.Fprintf(out, "Signature written to %s\n", sigPath)
+	return nil
+}
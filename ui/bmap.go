@@ -0,0 +1,87 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/husarion/husarion-os-flasher/bmap"
+	"github.com/husarion/husarion-os-flasher/internal/flash"
+	"github.com/husarion/husarion-os-flasher/platform"
+	"github.com/husarion/husarion-os-flasher/util"
+)
+
+// flashWithBmap writes only the blocks listed in the image's bmap file. It
+// returns false, without writing anything, when the image has no usable bmap so
+// the caller falls back to a full dd write.
+func flashWithBmap(src, dst string, progressChan chan tea.Msg) bool {
+	bmapPath := bmap.Find(src, stripCompression(src))
+	if bmapPath == "" {
+		return false
+	}
+	bm, err := bmap.Load(bmapPath)
+	if err != nil {
+		progressChan <- ProgressMsg(fmt.Sprintf("Ignoring %s: %v", bmapPath, err))
+		return false
+	}
+	if size, err := platform.Current.DiskSize(dst); err == nil && size < bm.ImageSize {
+		progressChan <- ErrorMsg{Err: fmt.Errorf("image needs %s but %s is only %s",
+			util.FormatBytes(bm.ImageSize), dst, util.FormatBytes(size))}
+		return true
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY, 0)
+	if err != nil {
+		progressChan <- ErrorMsg{Err: fmt.Errorf("failed to open %s: %v", dst, err)}
+		return true
+	}
+
+	img, err := flash.OpenRaw(src)
+	if err != nil {
+		out.Close()
+		progressChan <- ErrorMsg{Err: err}
+		return true
+	}
+
+	progressChan <- ProgressMsg(fmt.Sprintf("Using block map %s: writing %s of %s",
+		bmapPath, util.FormatBytes(bm.MappedBytes()), util.FormatBytes(bm.ImageSize)))
+
+	cancel := make(chan struct{})
+	var once sync.Once
+	progressChan <- DDStartedMsg{Cancel: func() {
+		once.Do(func() {
+			close(cancel)
+			img.Kill()
+		})
+	}}
+
+	dev, done := deviceWriter(out, progressChan)
+	go func() {
+		defer recoverJob(progressChan)
+		defer out.Close()
+		defer done()
+
+		copyErr := bmap.Copy(bm, img.Reader, flash.SyncEvery(dev, syncInterval()), throttledProgress(progressChan, "mapped "), cancel)
+		// Trailing unmapped data is not needed; stop the decompressor
+		img.Close()
+
+		select {
+		case <-cancel:
+			// AbortOperation reports completion
+			return
+		default:
+		}
+
+		if copyErr != nil {
+			select {
+			case progressChan <- ErrorMsg{Err: img.Explain(copyErr)}:
+			default:
+			}
+			return
+		}
+		syncAndFinish(dev, src, dst, progressChan)
+	}()
+	return true
+}
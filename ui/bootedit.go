@@ -0,0 +1,357 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// bootTweak is a setting of a Raspberry Pi boot partition that can be turned
+// on and off after flashing.
+type bootTweak struct {
+	Label string
+	read  func(dir string) bool
+	set   func(dir string, on bool) error
+}
+
+// bootTweaks are the settings of the boot edit screen.
+var bootTweaks = []bootTweak{
+	{Label: "Enable SSH", read: readSSHFlag, set: setSSHFlag},
+	{Label: "Serial console on the UART", read: readUARTConsole, set: setUARTConsole},
+	{Label: "Camera", read: readCamera, set: setCamera},
+}
+
+// bootEdit is the boot edit screen: the settings read from the card, and
+// those the operator wants.
+type bootEdit struct {
+	Device  string
+	Current []bool
+	Wanted  []bool
+	Cursor  int
+}
+
+// BootOptionsMsg carries the settings read from a device's boot partition.
+type BootOptionsMsg struct {
+	Device  string
+	Options []bool
+	Err     error
+}
+
+// BootEditedMsg reports the settings changed on a device's boot partition.
+type BootEditedMsg struct {
+	Device  string
+	Changes []string
+	Err     error
+}
+
+// StartBootEdit reads the settings of the selected device's boot partition,
+// mounted read-only, and opens the boot edit screen.
+func (m *Model) StartBootEdit() (tea.Model, tea.Cmd) {
+	if m.DeviceList.SelectedItem() == nil || m.Busy() || m.Mounting {
+		return m, nil
+	}
+	device := m.DeviceList.SelectedItem().(Item).value
+	if pattern := protectedDevice(m.Config, device); pattern != "" {
+		m.AddLog(fmt.Sprintf("Error: %s is protected by the config (%s).", device, pattern))
+		return m, nil
+	}
+	jobID, err := beginJob("boot", "", device, m.Operator)
+	if err != nil {
+		m.AddLog(fmt.Sprintf("Error: %v", err))
+		return m, nil
+	}
+	m.Mounting = true
+	m.AddLog(fmt.Sprintf("> Reading the boot partition of %s...", device))
+	return m, func() tea.Msg {
+		defer endJob(jobID)
+		options := make([]bool, len(bootTweaks))
+		if demoMode {
+			time.Sleep(time.Second)
+			options[0] = true
+			return BootOptionsMsg{Device: device, Options: options}
+		}
+		err := withBootPartition(device, false, func(dir string) error {
+			for i, t := range bootTweaks {
+				options[i] = t.read(dir)
+			}
+			return nil
+		})
+		return BootOptionsMsg{Device: device, Options: options, Err: err}
+	}
+}
+
+// showBootEdit opens the boot edit screen with the settings read.
+func (m *Model) showBootEdit(msg BootOptionsMsg) {
+	m.Mounting = false
+	if msg.Err != nil {
+		m.AddLog(fmt.Sprintf("Error: reading the boot partition of %s failed: %v", msg.Device, msg.Err))
+		return
+	}
+	m.BootEdit = &bootEdit{Device: msg.Device, Current: msg.Options, Wanted: slices.Clone(msg.Options)}
+}
+
+// handleBootEditKey moves between the settings (↑↓), toggles one (space),
+// applies them (Enter) or closes the screen (Esc).
+func (m Model) handleBootEditKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	e := m.BootEdit
+	switch msg.String() {
+	case "up", "k":
+		if e.Cursor > 0 {
+			e.Cursor--
+		}
+	case "down", "j":
+		if e.Cursor < len(bootTweaks)-1 {
+			e.Cursor++
+		}
+	case " ", "x":
+		e.Wanted[e.Cursor] = !e.Wanted[e.Cursor]
+	case "enter":
+		return m.applyBootEdit()
+	case "esc":
+		m.BootEdit = nil
+	}
+	return m, nil
+}
+
+// applyBootEdit mounts the boot partition read-write, changes the settings
+// the operator toggled and unmounts it.
+func (m Model) applyBootEdit() (tea.Model, tea.Cmd) {
+	e := m.BootEdit
+	m.BootEdit = nil
+	if slices.Equal(e.Current, e.Wanted) {
+		m.AddLog("Boot partition left unchanged.")
+		return m, nil
+	}
+	jobID, err := beginJob("boot", "", e.Device, m.Operator)
+	if err != nil {
+		m.AddLog(fmt.Sprintf("Error: %v", err))
+		return m, nil
+	}
+	m.Mounting = true
+	m.AddLog(fmt.Sprintf("> Editing the boot partition of %s...", e.Device))
+	return m, func() tea.Msg {
+		defer endJob(jobID)
+		var changes []string
+		if demoMode {
+			time.Sleep(time.Second)
+			for i, t := range bootTweaks {
+				if e.Wanted[i] != e.Current[i] {
+					changes = append(changes, t.Label+" "+onOff(e.Wanted[i]))
+				}
+			}
+			return BootEditedMsg{Device: e.Device, Changes: changes}
+		}
+		err := withBootPartition(e.Device, true, func(dir string) error {
+			for i, t := range bootTweaks {
+				if e.Wanted[i] == e.Current[i] {
+					continue
+				}
+				if err := t.set(dir, e.Wanted[i]); err != nil {
+					return fmt.Errorf("%s: %w", strings.ToLower(t.Label), err)
+				}
+				changes = append(changes, t.Label+" "+onOff(e.Wanted[i]))
+			}
+			return nil
+		})
+		return BootEditedMsg{Device: e.Device, Changes: changes, Err: err}
+	}
+}
+
+// bootEdited logs the settings changed on a boot partition, also in the
+// audit log.
+func (m *Model) bootEdited(msg BootEditedMsg) {
+	m.Mounting = false
+	if len(msg.Changes) > 0 {
+		line := fmt.Sprintf("%s edited the boot partition of %s: %s", m.Operator, msg.Device, strings.Join(msg.Changes, ", "))
+		rememberLog("audit: " + line)
+		writeAuditLine(line)
+	}
+	if msg.Err != nil {
+		m.AddLog(fmt.Sprintf("Error: editing the boot partition of %s failed: %v", msg.Device, msg.Err))
+		return
+	}
+	m.AddLog(fmt.Sprintf("Boot partition of %s edited and unmounted: %s.", msg.Device, strings.Join(msg.Changes, ", ")))
+}
+
+// renderBootEdit renders the boot edit screen.
+func (m Model) renderBootEdit() string {
+	styles := Styles()
+	e := m.BootEdit
+	header := styles.Header.Render(" Boot options of " + e.Device + " ")
+
+	var lines []string
+	for i, t := range bootTweaks {
+		box := "[ ]"
+		if e.Wanted[i] {
+			box = "[x]"
+		}
+		line := box + " " + t.Label
+		if e.Wanted[i] != e.Current[i] {
+			line += " (changed)"
+		}
+		if i == e.Cursor {
+			line = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color(ColorPantone)).Render("> " + line)
+		} else {
+			line = "  " + line
+		}
+		lines = append(lines, line)
+	}
+	body := styles.Container.Render(styles.InfoPanel.Render(strings.Join(lines, "\n")))
+	footer := styles.FooterStyle.Render("↑↓ to move • SPACE to toggle • ENTER to write to the card • ESC to cancel")
+
+	return lipgloss.Place(
+		m.Width,
+		m.Height,
+		lipgloss.Center,
+		lipgloss.Center,
+		lipgloss.JoinVertical(lipgloss.Center, header, body, footer),
+	)
+}
+
+// onOff describes a setting.
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
+
+// readSSHFlag reports whether the boot partition asks Raspberry Pi OS to
+// enable SSH, with an ssh or ssh.txt file.
+func readSSHFlag(dir string) bool {
+	for _, name := range []string{"ssh", "ssh.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// setSSHFlag creates or removes the ssh file.
+func setSSHFlag(dir string, on bool) error {
+	if on {
+		return os.WriteFile(filepath.Join(dir, "ssh"), nil, 0o644)
+	}
+	for _, name := range []string{"ssh", "ssh.txt"} {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// serialConsole is the kernel argument of a console on the UART.
+const serialConsole = "console=serial0,115200"
+
+// readUARTConsole reports whether the UART is enabled and the kernel has a
+// console on it.
+func readUARTConsole(dir string) bool {
+	config, _ := os.ReadFile(filepath.Join(dir, "config.txt"))
+	cmdline, _ := os.ReadFile(filepath.Join(dir, "cmdline.txt"))
+	return configTxtValue(string(config), "enable_uart") == "1" &&
+		slices.ContainsFunc(strings.Fields(string(cmdline)), isSerialConsole)
+}
+
+// setUARTConsole enables the UART and adds a console on it to the kernel
+// arguments, or removes both.
+func setUARTConsole(dir string, on bool) error {
+	value := "0"
+	if on {
+		value = "1"
+	}
+	if err := editConfigTxt(dir, "enable_uart", value); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, "cmdline.txt")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	args := slices.DeleteFunc(strings.Fields(string(data)), isSerialConsole)
+	if on {
+		args = append([]string{serialConsole}, args...)
+	}
+	return os.WriteFile(path, []byte(strings.Join(args, " ")+"\n"), 0o644)
+}
+
+// isSerialConsole reports whether a kernel argument is a console on the UART.
+func isSerialConsole(arg string) bool {
+	return strings.HasPrefix(arg, "console=serial0") || strings.HasPrefix(arg, "console=ttyAMA0") ||
+		strings.HasPrefix(arg, "console=ttyS0")
+}
+
+// readCamera reports whether the firmware loads a camera: detecting it, or
+// with the legacy camera stack.
+func readCamera(dir string) bool {
+	config, _ := os.ReadFile(filepath.Join(dir, "config.txt"))
+	return configTxtValue(string(config), "camera_auto_detect") == "1" || configTxtValue(string(config), "start_x") == "1"
+}
+
+// setCamera turns camera detection on or off, and the legacy camera stack off.
+func setCamera(dir string, on bool) error {
+	if on {
+		return editConfigTxt(dir, "camera_auto_detect", "1")
+	}
+	if err := editConfigTxt(dir, "camera_auto_detect", "0"); err != nil {
+		return err
+	}
+	config, _ := os.ReadFile(filepath.Join(dir, "config.txt"))
+	if configTxtValue(string(config), "start_x") == "" {
+		return nil
+	}
+	return editConfigTxt(dir, "start_x", "0")
+}
+
+// configTxtValue returns the value config.txt sets a key to, the last one
+// when it is set several times, or "".
+func configTxtValue(text, key string) string {
+	value := ""
+	for _, line := range strings.Split(text, "\n") {
+		if k, v, ok := strings.Cut(strings.TrimSpace(line), "="); ok && strings.TrimSpace(k) == key {
+			value = strings.TrimSpace(v)
+		}
+	}
+	return value
+}
+
+// setConfigTxt sets a key of config.txt: every line setting it is changed,
+// or it is appended in an [all] section, as the file may end with a section
+// applying to some models only.
+func setConfigTxt(text, key, value string) string {
+	var lines []string
+	if text = strings.TrimRight(text, "\n"); text != "" {
+		lines = strings.Split(text, "\n")
+	}
+	found, sections := false, false
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		sections = sections || strings.HasPrefix(line, "[")
+		if k, _, ok := strings.Cut(line, "="); ok && strings.TrimSpace(k) == key {
+			lines[i] = key + "=" + value
+			found = true
+		}
+	}
+	if !found {
+		if sections {
+			lines = append(lines, "", "[all]")
+		}
+		lines = append(lines, key+"="+value)
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// editConfigTxt sets a key of the config.txt in dir.
+func editConfigTxt(dir, key, value string) error {
+	path := filepath.Join(dir, "config.txt")
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.WriteFile(path, []byte(setConfigTxt(string(data), key, value)), 0o644)
+}
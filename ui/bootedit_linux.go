@@ -0,0 +1,48 @@
+//go:build linux
+
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// withBootPartition mounts the Raspberry Pi boot partition of a device, the
+// first FAT filesystem holding config.txt or cmdline.txt, read-only unless
+// rw, runs fn on it and unmounts it.
+func withBootPartition(device string, rw bool, fn func(dir string) error) error {
+	parts, err := devicePartitions(device)
+	if err != nil {
+		return err
+	}
+	for _, p := range parts {
+		if p.FSType != "vfat" {
+			continue
+		}
+		dir, unmount, err := mountPartition(p, rw)
+		if err != nil {
+			return err
+		}
+		if !isBootPartition(dir) {
+			if err := unmount(); err != nil {
+				return err
+			}
+			continue
+		}
+		return errors.Join(fn(dir), unmount())
+	}
+	return fmt.Errorf("no Raspberry Pi boot partition found on %s", device)
+}
+
+// isBootPartition reports whether a mounted filesystem is a Raspberry Pi boot
+// partition.
+func isBootPartition(dir string) bool {
+	for _, name := range []string{"config.txt", "cmdline.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return true
+		}
+	}
+	return false
+}
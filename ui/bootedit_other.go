@@ -0,0 +1,10 @@
+//go:build !linux
+
+package ui
+
+import "errors"
+
+// withBootPartition is not supported: mounting filesystems needs Linux.
+func withBootPartition(device string, rw bool, fn func(dir string) error) error {
+	return errors.New("editing the boot partition is only supported on Linux")
+}
@@ -0,0 +1,155 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/husarion/husarion-os-flasher/internal/flash"
+	"github.com/husarion/husarion-os-flasher/platform"
+	"github.com/husarion/husarion-os-flasher/util"
+)
+
+// loggedBadSectors is how many bad sectors of a pass are logged.
+const loggedBadSectors = 20
+
+// StartBurnIn burns in the selected device: it is filled with pseudo-random
+// data and read back for the configured duration, destroying its contents.
+func (m *Model) StartBurnIn() (tea.Model, tea.Cmd) {
+	if m.DeviceList.SelectedItem() == nil || m.Busy() || m.Config == nil {
+		return m, nil
+	}
+	b := m.Config.BurnIn
+	if b == nil {
+		m.AddLog("Burn-in is not configured.")
+		return m, nil
+	}
+	devicePath := m.DeviceList.SelectedItem().(Item).value
+	if err := checkWritable(devicePath); err != nil {
+		m.AddLog(fmt.Sprintf("Error: %v", err))
+		if hint, ok := diagnoseFailure(err, nil); ok {
+			m.Failure = &Failure{Hint: hint, Err: err}
+		}
+		return m, nil
+	}
+	jobID, err := beginJob("burnin", devicePath, devicePath, m.Operator)
+	if err != nil {
+		m.AddLog(fmt.Sprintf("Error: %v", err))
+		return m, nil
+	}
+
+	m.ProgressChan = make(chan tea.Msg, 100)
+	m.BurningIn = true
+	m.Aborting = false
+	m.BurnInCancel = nil
+	m.FlashStartTime = time.Now()
+	m.JobID = jobID
+	m.ClearLogs()
+	if d := b.Length(); d > 0 {
+		m.AddLog(fmt.Sprintf("> Burning in %s for %s...", devicePath, util.FormatDuration(d)))
+	} else {
+		m.AddLog(fmt.Sprintf("> Burning in %s, one pass...", devicePath))
+	}
+	m.FocusButton("abort-button")
+
+	return m, tea.Batch(
+		BurnInDevice(devicePath, b.Length(), m.ProgressChan),
+		ListenProgress(m.ProgressChan),
+	)
+}
+
+// BurnInDevice unmounts dst and runs the burn-in passes on it, logging each
+// pass as it completes.
+func BurnInDevice(dst string, duration time.Duration, progressChan chan tea.Msg) tea.Cmd {
+	return func() tea.Msg {
+		defer recoverJob(progressChan)
+
+		progressChan <- ProgressMsg("Unmounting all partitions under " + dst + " if mounted...")
+		if err := platform.Current.Unmount(dst); err != nil {
+			progressChan <- ProgressMsg("Unmount error (ignored): " + err.Error())
+		}
+		size, err := platform.Current.DiskSize(dst)
+		if err != nil {
+			return ErrorMsg{Err: fmt.Errorf("burn-in failed: %v", err)}
+		}
+		dev, err := os.OpenFile(dst, os.O_RDWR, 0)
+		if err != nil {
+			return ErrorMsg{Err: fmt.Errorf("burn-in failed: %v", err)}
+		}
+
+		cancel := make(chan struct{})
+		var once sync.Once
+		progressChan <- BurnInStartedMsg{Cancel: func() {
+			once.Do(func() { close(cancel) })
+		}}
+
+		go func() {
+			defer recoverJob(progressChan)
+			defer dev.Close()
+
+			var last time.Time
+			progress := func(pass int, phase string, done, total int64, elapsed time.Duration) {
+				if done == total {
+					select {
+					case progressChan <- ProgressMsg(fmt.Sprintf("Pass %d: %s %s done in %s.", pass, phase, util.FormatBytes(total), util.FormatDuration(elapsed))):
+					default:
+					}
+					return
+				}
+				if time.Since(last) < time.Second {
+					return
+				}
+				last = time.Now()
+				select {
+				case progressChan <- ProgressMsg(progressLine(done, total, elapsed, fmt.Sprintf("pass %d %s ", pass, phase))):
+				default:
+				}
+			}
+
+			passes, err := flash.BurnIn(dev, size, duration, progress, cancel)
+			select {
+			case <-cancel:
+				// AbortOperation reports completion
+				return
+			default:
+			}
+			select {
+			case progressChan <- BurnInCompletedMsg{Device: dst, Passes: passes, Err: err}:
+			default:
+			}
+		}()
+
+		return nil
+	}
+}
+
+// burnInSummary logs the bad sectors of each failed pass and returns an error
+// when there were any or the burn-in could not complete.
+func (m *Model) burnInSummary(msg BurnInCompletedMsg) error {
+	var bad int64
+	for _, p := range msg.Passes {
+		if p.Bad == 0 {
+			continue
+		}
+		bad += p.Bad
+		sectors := make([]string, 0, loggedBadSectors)
+		for _, s := range p.BadSectors[:min(len(p.BadSectors), loggedBadSectors)] {
+			sectors = append(sectors, fmt.Sprint(s))
+		}
+		if p.Bad > int64(len(sectors)) {
+			sectors = append(sectors, "...")
+		}
+		m.AddLog(fmt.Sprintf("Error: pass %d found %d bad sectors: %s", p.Number, p.Bad, strings.Join(sectors, " ")))
+	}
+	if msg.Err != nil {
+		return fmt.Errorf("burn-in of %s failed: %v", msg.Device, msg.Err)
+	}
+	if bad > 0 {
+		return fmt.Errorf("burn-in of %s found %d bad sectors in %d passes", msg.Device, bad, len(msg.Passes))
+	}
+	return nil
+}
@@ -0,0 +1,243 @@
+package ui
+
+import (
+	"fmt"
+	"slices"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/husarion/husarion-os-flasher/config"
+	"github.com/husarion/husarion-os-flasher/util"
+)
+
+// ActiveButtons is the ActiveList value used when focus is on the button row;
+// the focused button is identified by Model.FocusedButton.
+const ActiveButtons = 3
+
+// Button is an entry in the button row. The row is rebuilt on every render from
+// the current state, so buttons may appear and disappear (Extract, Abort).
+type Button struct {
+	ID         string // zone id, also used to track focus
+	Label      string
+	BusyLabel  string
+	FocusColor string // background when focused
+	Action     string // name of config.Builtins it runs, for Config.Roles
+
+	// Busy reports whether this button's own operation is running.
+	Busy func(m *Model) bool
+	// Run starts the button's action. It is only called when the button is enabled.
+	Run func(m *Model) (tea.Model, tea.Cmd)
+}
+
+// Buttons returns the buttons currently shown, in display order.
+func (m *Model) Buttons() []Button {
+	var buttons []Button
+
+	buttons = append(buttons, Button{
+		ID: "flash-button", Label: "Flash", BusyLabel: "Flashing...", Action: "flash", FocusColor: ColorPantone,
+		Busy: func(m *Model) bool { return m.Flashing },
+		Run: func(m *Model) (tea.Model, tea.Cmd) {
+			if !m.Ready {
+				return m, nil
+			}
+			return m.StartFlashing()
+		},
+	})
+
+	if util.IsRaspberryPi() {
+		buttons = append(buttons, Button{
+			ID: "eeprom-button", Label: "Config EEPROM", BusyLabel: "Configuring...", Action: "eeprom", FocusColor: ColorLilac,
+			Busy: func(m *Model) bool { return m.ConfiguringEeprom },
+			Run:  func(m *Model) (tea.Model, tea.Cmd) { return m.ConfigEEPROM() },
+		})
+	}
+
+	if m.Config != nil && len(m.Config.Firmware) > 0 {
+		buttons = append(buttons, Button{
+			ID: "firmware-button", Label: "Firmware", BusyLabel: "Writing firmware...", Action: "firmware", FocusColor: ColorLilac,
+			Busy: func(m *Model) bool { return m.FlashingFirmware },
+			Run:  func(m *Model) (tea.Model, tea.Cmd) { return m.StartFirmware() },
+		})
+	}
+
+	if m.Config != nil && m.Config.CAN != nil {
+		buttons = append(buttons, Button{
+			ID: "can-button", Label: "CAN Update", BusyLabel: "Updating CAN...", Action: "can", FocusColor: ColorLilac,
+			Busy: func(m *Model) bool { return m.UpdatingCAN },
+			Run:  func(m *Model) (tea.Model, tea.Cmd) { return m.StartCANUpdate() },
+		})
+	}
+
+	if m.Config != nil && m.Config.BurnIn != nil {
+		buttons = append(buttons, Button{
+			ID: "burnin-button", Label: "Burn-in", BusyLabel: "Burning in...", Action: "burnin", FocusColor: ColorLilac,
+			Busy: func(m *Model) bool { return m.BurningIn },
+			Run:  func(m *Model) (tea.Model, tea.Cmd) { return m.StartBurnIn() },
+		})
+	}
+
+	if m.Config != nil && len(m.Config.Duplicators) > 0 {
+		buttons = append(buttons, Button{
+			ID: "duplicate-button", Label: "Flash all slots", BusyLabel: "Flashing slots...", Action: "duplicate", FocusColor: ColorLilac,
+			Busy: func(m *Model) bool { return m.Duplication != nil && m.Duplication.running() },
+			Run:  func(m *Model) (tea.Model, tea.Cmd) { return m.StartDuplication() },
+		})
+	}
+
+	// Extract button only when a compressed image is selected OR currently extracting
+	if m.IsCompressedImageSelected() || m.Extracting {
+		buttons = append(buttons, Button{
+			ID: "uncompress-button", Label: "Extract", BusyLabel: "Extracting...", Action: "extract", FocusColor: ColorLilac,
+			Busy: func(m *Model) bool { return m.Extracting },
+			Run:  func(m *Model) (tea.Model, tea.Cmd) { return m.UncompressImage() },
+		})
+	}
+
+	buttons = append(buttons, Button{
+		ID: "check-button", Label: " Check ", BusyLabel: "Checking...", Action: "check", FocusColor: ColorLilac,
+		Busy: func(m *Model) bool { return m.Checking },
+		Run:  func(m *Model) (tea.Model, tea.Cmd) { return m.StartIntegrityCheck() },
+	})
+
+	if m.Config != nil {
+		for i, action := range m.Config.Actions {
+			buttons = append(buttons, m.actionButton(i, action))
+		}
+	}
+
+	if m.Busy() {
+		buttons = append(buttons, Button{
+			ID: "abort-button", Label: "   Abort   ", BusyLabel: "Aborting...", FocusColor: ColorLightRed,
+			Busy: func(m *Model) bool { return m.Aborting },
+			Run:  func(m *Model) (tea.Model, tea.Cmd) { return m.AbortOperation() },
+		})
+	}
+
+	// Actions reserved to admins are hidden from operators
+	return slices.DeleteFunc(buttons, func(b Button) bool {
+		return b.Action != "" && !Allowed(m.Config, m.Role, b.Action)
+	})
+}
+
+// actionButton builds the button for a config-defined action.
+func (m *Model) actionButton(i int, action config.Action) Button {
+	b := Button{
+		ID:         fmt.Sprintf("action-%d-button", i),
+		Label:      action.Label,
+		BusyLabel:  action.Label + "...",
+		FocusColor: ColorLilac,
+		Busy:       func(m *Model) bool { return m.RunningAction == action.Label },
+	}
+	if action.Builtin != "" {
+		b.Action = action.Builtin
+		b.Busy = func(m *Model) bool { return false }
+		b.Run = func(m *Model) (tea.Model, tea.Cmd) { return m.RunBuiltin(action.Builtin) }
+	} else {
+		b.Run = func(m *Model) (tea.Model, tea.Cmd) { return m.StartAction(action) }
+	}
+	return b
+}
+
+// ButtonEnabled reports whether a button can be focused and pressed. While an
+// operation runs only Abort is enabled, Flash and Extract wait for maintenance
+// that reorganizes the image directory, and in monitor mode nothing is.
+func (m *Model) ButtonEnabled(b Button) bool {
+	if b.ID == "abort-button" {
+		return !m.Aborting
+	}
+	if m.Monitoring {
+		return false
+	}
+	if (b.ID == "flash-button" || b.ID == "uncompress-button") && maintenanceBlocksImages() {
+		return false
+	}
+	return !m.Busy() && !b.Busy(m)
+}
+
+// FocusButton moves focus to the button with the given id.
+func (m *Model) FocusButton(id string) {
+	m.ActiveList = ActiveButtons
+	m.FocusedButton = id
+}
+
+// PressFocusedButton runs the focused button's action if it is enabled.
+func (m *Model) PressFocusedButton() (tea.Model, tea.Cmd) {
+	for _, b := range m.Buttons() {
+		if b.ID == m.FocusedButton && m.ButtonEnabled(b) {
+			return b.Run(m)
+		}
+	}
+	return m, nil
+}
+
+// RunBuiltin runs a built-in action by name, as referenced from config actions.
+func (m *Model) RunBuiltin(name string) (tea.Model, tea.Cmd) {
+	if !m.allowed(name) {
+		return m, nil
+	}
+	switch name {
+	case "flash":
+		if m.Ready {
+			return m.StartFlashing()
+		}
+	case "extract":
+		return m.UncompressImage()
+	case "check":
+		return m.StartIntegrityCheck()
+	case "eeprom":
+		return m.ConfigEEPROM()
+	case "firmware":
+		return m.StartFirmware()
+	case "can":
+		return m.StartCANUpdate()
+	case "provision":
+		return m.StartWizard()
+	case "about":
+		m.AboutLines = []string{"Reading the tool versions..."}
+		m.ShowAbout = true
+		return m, aboutCmd(m.OsImgPath, m.Config)
+	case "prune":
+		return m.PreviewPrune()
+	case "dedup":
+		return m.PreviewDedup()
+	case "stations":
+		if m.Coordinator {
+			m.ShowStations = true
+		} else {
+			m.AddLog("The stations dashboard is only available on a coordinator (--coordinate).")
+		}
+	case "stats":
+		return m.OpenStats()
+	case "failures":
+		return m.OpenFailures()
+	case "burnin":
+		return m.StartBurnIn()
+	case "composite":
+		return m.StartComposite()
+	case "duplicate":
+		return m.StartDuplication()
+	case "preview":
+		return m.StartPreview()
+	case "boot":
+		return m.StartBootEdit()
+	}
+	return m, nil
+}
+
+// renderButton renders a single button according to its state and focus.
+func (m *Model) renderButton(style lipgloss.Style, b Button) string {
+	text := b.Label
+	switch {
+	case b.Busy(m):
+		text = b.BusyLabel
+		style = style.Background(lipgloss.Color(ColorDisabled))
+	case !m.ButtonEnabled(b):
+		style = style.Background(lipgloss.Color(ColorDisabled))
+	case m.ActiveList == ActiveButtons && m.FocusedButton == b.ID:
+		style = style.Background(lipgloss.Color(b.FocusColor))
+	default:
+		style = style.Background(lipgloss.Color(ColorAnthracite))
+	}
+	return m.Zones.Mark(b.ID, style.Render(text))
+}
@@ -0,0 +1,203 @@
+package ui
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/creack/pty"
+
+	"github.com/husarion/husarion-os-flasher/config"
+	"github.com/husarion/husarion-os-flasher/internal/flash"
+)
+
+// canPercent matches the progress an update command prints, e.g. "45%".
+var canPercent = regexp.MustCompile(`([0-9]+(?:\.[0-9]+)?) ?%`)
+
+// CANNodeResult is the outcome of updating one node.
+type CANNodeResult struct {
+	Node config.CANNode
+	Err  error
+}
+
+// canNodeLabel names a node in the log, e.g. "node 2 (rear driver)".
+func canNodeLabel(n config.CANNode) string {
+	if n.Name == "" {
+		return fmt.Sprintf("node %d", n.ID)
+	}
+	return fmt.Sprintf("node %d (%s)", n.ID, n.Name)
+}
+
+// StartCANUpdate updates the firmware of every configured CAN node in turn.
+func (m *Model) StartCANUpdate() (tea.Model, tea.Cmd) {
+	if m.Busy() || m.Config == nil {
+		return m, nil
+	}
+	c := m.Config.CAN
+	if c == nil {
+		m.AddLog("No CAN bus is configured.")
+		return m, nil
+	}
+	jobID, err := beginJob("can", c.Interface, c.Interface, m.Operator)
+	if err != nil {
+		m.AddLog(fmt.Sprintf("Error: %v", err))
+		return m, nil
+	}
+
+	m.ProgressChan = make(chan tea.Msg, 100)
+	m.UpdatingCAN = true
+	m.Aborting = false
+	m.CANCancel = nil
+	m.FlashStartTime = time.Now()
+	m.JobID = jobID
+	m.AddLog(fmt.Sprintf("> Updating %d CAN nodes on %s...", len(c.Nodes), c.Interface))
+	m.FocusButton("abort-button")
+
+	return m, tea.Batch(
+		UpdateCAN(c, m.OsImgPath, m.ProgressChan),
+		ListenProgress(m.ProgressChan),
+	)
+}
+
+// UpdateCAN brings up the CAN interface and runs the update command for each
+// node under a pty, reporting the progress of the node being updated. Aborting
+// stops the running command and skips the remaining nodes.
+func UpdateCAN(c *config.CAN, osImgPath string, progressChan chan tea.Msg) tea.Cmd {
+	return func() tea.Msg {
+		defer recoverJob(progressChan)
+
+		if err := bringUpCAN(c); err != nil {
+			return ErrorMsg{Err: err}
+		}
+
+		var mu sync.Mutex
+		var current *exec.Cmd
+		cancel := make(chan struct{})
+		var once sync.Once
+		progressChan <- CANStartedMsg{Cancel: func() {
+			once.Do(func() {
+				close(cancel)
+				mu.Lock()
+				if current != nil {
+					_ = current.Process.Kill()
+				}
+				mu.Unlock()
+			})
+		}}
+
+		go func() {
+			defer recoverJob(progressChan)
+
+			var results []CANNodeResult
+			for i, node := range c.Nodes {
+				select {
+				case <-cancel:
+					return
+				default:
+				}
+				select {
+				case progressChan <- ProgressMsg(fmt.Sprintf("Updating %s, %d of %d...", canNodeLabel(node), i+1, len(c.Nodes))):
+				default:
+					return
+				}
+
+				file := node.Firmware
+				if !filepath.IsAbs(file) {
+					file = filepath.Join(osImgPath, file)
+				}
+				if _, err := os.Stat(file); err != nil {
+					results = append(results, CANNodeResult{Node: node, Err: err})
+					continue
+				}
+				cmd := exec.Command("bash", "-c", c.Update)
+				cmd.Env = append(os.Environ(),
+					"CAN_INTERFACE="+c.Interface,
+					"NODE_ID="+strconv.Itoa(node.ID),
+					"NODE_NAME="+node.Name,
+					"FIRMWARE="+file,
+				)
+
+				mu.Lock()
+				ptmx, err := pty.Start(cmd)
+				if err == nil {
+					current = cmd
+				}
+				mu.Unlock()
+				if err == nil {
+					err = streamCANNode(cmd, ptmx, node, file, progressChan)
+				}
+
+				mu.Lock()
+				current = nil
+				mu.Unlock()
+				select {
+				case <-cancel:
+					return
+				default:
+				}
+				results = append(results, CANNodeResult{Node: node, Err: err})
+			}
+
+			select {
+			case progressChan <- CANCompletedMsg{Interface: c.Interface, Results: results}:
+			default:
+			}
+		}()
+
+		return nil
+	}
+}
+
+// streamCANNode forwards the output of a node's update command, turning
+// percentages into progress lines, and waits for it to exit.
+func streamCANNode(cmd *exec.Cmd, ptmx *os.File, node config.CANNode, file string, progressChan chan tea.Msg) error {
+	defer ptmx.Close()
+	size, _ := flash.FileSize(file)
+	start := time.Now()
+	label := fmt.Sprintf("%s ", canNodeLabel(node))
+
+	scanner := bufio.NewScanner(ptmx)
+	scanner.Split(splitCRLF)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		msg := ProgressMsg(line)
+		if m := canPercent.FindStringSubmatch(line); m != nil && size > 0 {
+			percent, _ := strconv.ParseFloat(m[1], 64)
+			msg = ProgressMsg(progressLine(int64(float64(size)*min(percent, 100)/100), size, time.Since(start), label))
+		}
+		select {
+		case progressChan <- msg:
+		default:
+		}
+	}
+	return cmd.Wait()
+}
+
+// canSummary logs the outcome of each node and returns an error naming the
+// nodes that failed.
+func (m *Model) canSummary(results []CANNodeResult) error {
+	var failed []string
+	for _, r := range results {
+		if r.Err != nil {
+			failed = append(failed, canNodeLabel(r.Node))
+			m.AddLog(fmt.Sprintf("Error: updating %s failed: %v", canNodeLabel(r.Node), r.Err))
+		} else {
+			m.AddLog(fmt.Sprintf("Updated %s.", canNodeLabel(r.Node)))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("updating %s failed", strings.Join(failed, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/husarion/husarion-os-flasher/config"
+	"github.com/husarion/husarion-os-flasher/util"
+)
+
+// bringUpCAN checks that the SocketCAN interface exists and, when it is down
+// and a bitrate is configured, brings it up.
+func bringUpCAN(c *config.CAN) error {
+	dir := filepath.Join("/sys/class/net", c.Interface)
+	if _, err := os.Stat(dir); err != nil {
+		return fmt.Errorf("CAN interface %s not found: is the adapter connected?", c.Interface)
+	}
+	state, _ := os.ReadFile(filepath.Join(dir, "operstate"))
+	if s := strings.TrimSpace(string(state)); s == "up" || s == "unknown" || c.Bitrate == 0 {
+		return nil
+	}
+	out, err := util.Command("ip", "link", "set", c.Interface, "up", "type", "can", "bitrate", strconv.Itoa(c.Bitrate)).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("bringing up %s: %v: %s", c.Interface, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
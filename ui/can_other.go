@@ -0,0 +1,14 @@
+//go:build !linux
+
+package ui
+
+import (
+	"errors"
+
+	"github.com/husarion/husarion-os-flasher/config"
+)
+
+// bringUpCAN fails: CAN updates use Linux SocketCAN.
+func bringUpCAN(c *config.CAN) error {
+	return errors.New("CAN updates need Linux SocketCAN")
+}
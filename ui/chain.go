@@ -0,0 +1,80 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/husarion/husarion-os-flasher/internal/flash"
+	"github.com/husarion/husarion-os-flasher/platform"
+	"github.com/husarion/husarion-os-flasher/util"
+)
+
+// chainedFlash is a flash of a compressed image that extracts it first, with
+// extract_before_flash.
+type chainedFlash struct {
+	Src      string // compressed image
+	Image    string // raw image extracted from it, then flashed
+	Device   string
+	Snapshot *deviceSnapshot // the device when Flash was pressed, once read
+}
+
+// extractBeforeFlash flashes the raw image of a compressed one: it extracts it
+// and flashes the result once extracted and verified. An image extracted
+// since the archive last changed is flashed right away. It reports false when
+// the archive should be flashed as it is: the config does not ask for it, the
+// image directory lacks room, or the user may not extract.
+func (m *Model) extractBeforeFlash(src, device string) (tea.Model, tea.Cmd, bool) {
+	if m.Config == nil || !m.Config.ExtractBeforeFlash || !flash.IsCompressed(src) ||
+		m.Wizard != nil || m.Composite != nil || m.Duplication != nil ||
+		!Allowed(m.Config, m.Role, "extract") {
+		return m, nil, false
+	}
+	c := &chainedFlash{Src: src, Image: flash.ExtractedPath(src), Device: device}
+	if extractedSince(c.Image, src) {
+		m.AddLog(fmt.Sprintf("> %s was extracted already, flashing it.", filepath.Base(c.Image)))
+		model, cmd := m.flashExtracted(c)
+		return model, cmd, true
+	}
+
+	size, _ := flash.RawSize(src)
+	if free, err := platform.FreeSpace(filepath.Dir(src)); err == nil && free < size {
+		m.AddLog(fmt.Sprintf("Not enough space to extract %s (%s needed, %s free), flashing it compressed.",
+			filepath.Base(src), util.FormatBytes(size), util.FormatBytes(free)))
+		return m, nil, false
+	}
+	model, cmd := m.UncompressImage()
+	if m.Extracting {
+		m.Chain = c
+		m.AddLog(fmt.Sprintf("%s is flashed to %s once extracted.", filepath.Base(c.Image), device))
+		// A card swapped during the extraction is caught before writing
+		cmd = tea.Batch(cmd, snapshotCmd(device))
+	}
+	return model, cmd, true
+}
+
+// extractedSince reports whether image exists and was written after src.
+func extractedSince(image, src string) bool {
+	info, err := os.Stat(image)
+	srcInfo, serr := os.Stat(src)
+	return err == nil && serr == nil && info.Mode().IsRegular() && info.ModTime().After(srcInfo.ModTime())
+}
+
+// flashExtracted verifies the image extracted for a chained flash and flashes
+// it. The decompressor has checked the archive's own checksums; the extracted
+// image must also have the size the archive records. The device must still
+// be the one Flash was pressed for.
+func (m *Model) flashExtracted(c *chainedFlash) (tea.Model, tea.Cmd) {
+	if size, exact := flash.RawSize(c.Src); exact {
+		if got, err := flash.FileSize(c.Image); err != nil || got != size {
+			m.AddLog(fmt.Sprintf("Error: %s is %s but %s records %s, not flashing it.",
+				filepath.Base(c.Image), util.FormatBytes(got), filepath.Base(c.Src), util.FormatBytes(size)))
+			return m, nil
+		}
+	}
+	m.Refresh()
+	selectItemByValue(&m.ImageList, c.Image)
+	return m.flashConfirmed(c.Image, c.Device, c.Snapshot)
+}
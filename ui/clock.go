@@ -0,0 +1,69 @@
+package ui
+
+import (
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/husarion/husarion-os-flasher/util"
+)
+
+// clockUnsynced marks the timestamps of history, integrity and audit records
+// written while the clock could not be trusted.
+const clockUnsynced = "unsynced"
+
+// minClock is a date every station is past. A Raspberry Pi without a
+// real-time clock boots at the last saved time, or in 1970, until NTP sets it.
+var minClock = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// clockState caches the clock check, which runs on every record written, and
+// remembers whether an NTP sync was asked for.
+var clockState = struct {
+	sync.Mutex
+	checked time.Time
+	synced  bool
+	reason  string
+	ntpOnce sync.Once
+}{}
+
+// ClockStatus reports whether the system clock can be trusted for the
+// timestamps of reports, and otherwise why not. It is trusted once NTP
+// synchronized it, or when the host keeps time in a real-time clock and the
+// date is plausible.
+func ClockStatus() (synced bool, reason string) {
+	clockState.Lock()
+	defer clockState.Unlock()
+	if time.Since(clockState.checked) < time.Minute && !clockState.checked.IsZero() {
+		return clockState.synced, clockState.reason
+	}
+	clockState.checked = time.Now()
+	clockState.synced, clockState.reason = true, ""
+	if now := time.Now(); now.Before(minClock) {
+		clockState.synced, clockState.reason = false, "the clock reads "+now.Format(time.DateOnly)
+	} else if ntp, known := ntpSynchronized(); known && !ntp && !hasRTC() {
+		clockState.synced, clockState.reason = false, "the clock is not synchronized with NTP and there is no real-time clock"
+	}
+	return clockState.synced, clockState.reason
+}
+
+// clockMark returns clockUnsynced when the clock cannot be trusted, else "".
+func clockMark() string {
+	if synced, _ := ClockStatus(); !synced {
+		return clockUnsynced
+	}
+	return ""
+}
+
+// requestNTPSync turns on NTP synchronization through systemd-timesyncd once
+// per process, when the clock cannot be trusted and the flasher runs as root.
+// It does not wait: records are marked unsynced until the clock is set.
+func requestNTPSync() {
+	if synced, _ := ClockStatus(); synced || !util.IsPrivileged() {
+		return
+	}
+	clockState.ntpOnce.Do(func() {
+		if _, err := exec.LookPath("timedatectl"); err == nil {
+			go func() { _ = util.Command("timedatectl", "set-ntp", "true").Run() }()
+		}
+	})
+}
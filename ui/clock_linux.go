@@ -0,0 +1,27 @@
+//go:build linux
+
+package ui
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// ntpSynchronized reports whether the kernel considers its clock synchronized,
+// as NTP daemons tell it.
+func ntpSynchronized() (synced, ok bool) {
+	var tx unix.Timex
+	state, err := unix.Adjtimex(&tx)
+	if err != nil {
+		return false, false
+	}
+	return state != unix.TIME_ERROR && tx.Status&unix.STA_UNSYNC == 0, true
+}
+
+// hasRTC reports whether the host has a real-time clock keeping time across
+// reboots.
+func hasRTC() bool {
+	_, err := os.Stat("/sys/class/rtc/rtc0")
+	return err == nil
+}
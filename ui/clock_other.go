@@ -0,0 +1,13 @@
+//go:build !linux
+
+package ui
+
+// ntpSynchronized is not known: only the date is checked.
+func ntpSynchronized() (synced, ok bool) {
+	return false, false
+}
+
+// hasRTC assumes desktops and laptops keep time across reboots.
+func hasRTC() bool {
+	return true
+}
@@ -0,0 +1,425 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/husarion/husarion-os-flasher/config"
+	"github.com/husarion/husarion-os-flasher/internal/flash"
+	"github.com/husarion/husarion-os-flasher/platform"
+	"github.com/husarion/husarion-os-flasher/util"
+)
+
+// Composite is a run of a composite profile: its images are flashed in
+// sequence, each to its own device or partition and verified as the verify
+// policy requires, then summarized in one report. It replaces the button row
+// while open.
+type Composite struct {
+	Index   int // of the profile in the config
+	Profile config.Composite
+	Parts   []CompositePart
+	Current int       // the part to flash next, len(Parts) once finished
+	Started time.Time // zero until the first part runs
+	Report  string    // summary report written when finished
+}
+
+// CompositePart is a part of a composite run and its outcome.
+type CompositePart struct {
+	Label     string
+	Image     string // empty when no image matches
+	Device    string // device or partition, empty when no device matches
+	Size      int64  // of the written image, its share of the overall progress
+	State     string // as for wizard steps
+	Detail    string // why it cannot run or failed
+	Verifying bool   // the write passed, its verification runs
+	Started   time.Time
+	Took      time.Duration
+}
+
+// running reports whether a part is being flashed.
+func (c *Composite) running() bool {
+	return c.Current < len(c.Parts) && c.Parts[c.Current].State == stepRunning
+}
+
+// finished reports whether every part was flashed.
+func (c *Composite) finished() bool {
+	return c.Current >= len(c.Parts)
+}
+
+// StartComposite opens the first composite profile of the config.
+func (m *Model) StartComposite() (tea.Model, tea.Cmd) {
+	if m.Busy() || m.Monitoring {
+		return m, nil
+	}
+	if m.Config == nil || len(m.Config.Composites) == 0 {
+		m.AddLog("No composite profiles are configured (composites in the config).")
+		return m, nil
+	}
+	m.openComposite(0)
+	return m, nil
+}
+
+// openComposite opens the composite profile at index i of the config.
+func (m *Model) openComposite(i int) {
+	profile := m.Config.Composites[i]
+	c := &Composite{Index: i, Profile: profile}
+	for j, p := range profile.Parts {
+		label := p.Label
+		if label == "" {
+			label = "part " + strconv.Itoa(j+1)
+		}
+		c.Parts = append(c.Parts, CompositePart{Label: label, State: stepPending})
+	}
+	m.Composite = c
+	m.resolveComposite()
+
+	var parts []string
+	for _, p := range c.Parts {
+		if p.Detail != "" {
+			parts = append(parts, fmt.Sprintf("%s: %s", p.Label, p.Detail))
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s: %s to %s", p.Label, filepath.Base(p.Image), p.Device))
+	}
+	m.AddLog(fmt.Sprintf("> Composite %s: %s.", profile.Name, strings.Join(parts, ", ")))
+}
+
+// resolveComposite finds the image and the device of the parts still to
+// flash, as images and devices come and go.
+func (m *Model) resolveComposite() {
+	c := m.Composite
+	images, _ := ImageFiles(m.OsImgPath)
+	var devices []string
+	for _, item := range m.DeviceList.Items() {
+		devices = append(devices, item.(Item).value)
+	}
+
+	taken := map[string]int{}
+	for i := range c.Parts {
+		p, spec := &c.Parts[i], c.Profile.Parts[i]
+		if i >= c.Current {
+			p.Image, p.Device, p.Detail = matchImage(spec.Image, images), matchDevice(spec.Device, devices), ""
+			switch {
+			case p.Image == "":
+				p.Detail = "no image matches " + spec.Image
+			case p.Device == "":
+				p.Detail = "no device matches " + spec.Device
+			default:
+				if spec.Partition > 0 {
+					p.Device = partitionPath(p.Device, spec.Partition)
+				}
+				p.Size, _ = flash.RawSize(p.Image)
+			}
+		}
+		if p.Device == "" {
+			continue
+		}
+		if other, ok := taken[p.Device]; ok && p.Detail == "" {
+			p.Detail = fmt.Sprintf("%s is also the target of %s", p.Device, c.Parts[other].Label)
+		}
+		taken[p.Device] = i
+	}
+}
+
+// matchImage returns the image whose file name matches pattern, the last in
+// name order when several do, which is usually the newest release.
+func matchImage(pattern string, images []string) string {
+	var matches []string
+	for _, img := range images {
+		if ok, _ := filepath.Match(pattern, filepath.Base(img)); ok {
+			matches = append(matches, img)
+		}
+	}
+	if len(matches) == 0 {
+		return ""
+	}
+	sort.Slice(matches, func(i, j int) bool { return filepath.Base(matches[i]) < filepath.Base(matches[j]) })
+	return matches[len(matches)-1]
+}
+
+// matchDevice returns the first device whose path or model matches pattern.
+func matchDevice(pattern string, devices []string) string {
+	for _, dev := range devices {
+		if ok, _ := filepath.Match(pattern, dev); ok {
+			return dev
+		}
+		if model := platform.Model(dev); model != "" {
+			if ok, _ := filepath.Match(pattern, model); ok {
+				return dev
+			}
+		}
+	}
+	return ""
+}
+
+// partitionPath returns the path of partition n of a device: /dev/sdb2, or
+// /dev/mmcblk0p2 for names ending in a digit.
+func partitionPath(device string, n int) string {
+	if last := device[len(device)-1]; last >= '0' && last <= '9' {
+		return fmt.Sprintf("%sp%d", device, n)
+	}
+	return fmt.Sprintf("%s%d", device, n)
+}
+
+// runCompositePart flashes the current part. The first part only starts once
+// every part has an image and a device of its own.
+func (m *Model) runCompositePart() (tea.Model, tea.Cmd) {
+	c := m.Composite
+	if c == nil || c.finished() || m.Busy() || m.holdQueue() {
+		return m, nil
+	}
+	m.resolveComposite()
+	for _, p := range c.Parts[c.Current:] {
+		if p.Detail != "" {
+			m.AddLog(fmt.Sprintf("Error: %s: %s.", p.Label, p.Detail))
+			return m, nil
+		}
+	}
+	if c.Started.IsZero() {
+		c.Started = time.Now()
+	}
+	p := &c.Parts[c.Current]
+	p.State, p.Started, p.Detail, p.Verifying = stepRunning, time.Now(), "", false
+
+	model, cmd := m.flashImage(p.Image, p.Device)
+	mm := model.(*Model)
+	mm.AddLog(fmt.Sprintf("Composite %s, %s (%d of %d).", c.Profile.Name, p.Label, c.Current+1, len(c.Parts)))
+	// A flash that could not start has logged why, one may wait for approval
+	if !mm.Busy() && mm.Approval == nil {
+		p.State, p.Detail = stepFailed, "could not start"
+	}
+	return mm, cmd
+}
+
+// compositeVerifying marks the running part as verifying once its write
+// passed.
+func (m *Model) compositeVerifying() {
+	if c := m.Composite; c != nil && c.running() {
+		c.Parts[c.Current].Verifying = true
+	}
+}
+
+// compositePartFinished records the result of the running part, if any:
+// success, failure or aborted. A part that succeeded starts the next one.
+func (m *Model) compositePartFinished(result string, err error) tea.Cmd {
+	c := m.Composite
+	if c == nil || !c.running() {
+		return nil
+	}
+	p := &c.Parts[c.Current]
+	p.Took = time.Since(p.Started)
+	switch {
+	case result == "success":
+		p.State = stepDone
+		c.Current++
+	case err != nil:
+		p.State, p.Detail = stepFailed, err.Error()
+	default:
+		p.State, p.Detail = stepFailed, result
+	}
+	if c.finished() {
+		m.finishComposite()
+		return nil
+	}
+	if p.State == stepFailed {
+		m.AddLog(fmt.Sprintf("Composite %s stopped at %s: ENTER to retry, X to close.", c.Profile.Name, p.Label))
+		return nil
+	}
+	_, cmd := m.runCompositePart()
+	return cmd
+}
+
+// closeComposite closes the composite run, writing its report if it had
+// started and not finished.
+func (m *Model) closeComposite() {
+	if c := m.Composite; !c.Started.IsZero() && !c.finished() {
+		m.finishComposite()
+	}
+	m.Composite = nil
+	m.QueueHeld = false
+	m.AddLog("Composite flashing closed.")
+}
+
+// finishComposite writes the summary report and logs it.
+func (m *Model) finishComposite() {
+	c := m.Composite
+	lines := c.reportLines(m.Operator)
+	for _, line := range lines[len(lines)-len(c.Parts)-1:] {
+		m.AddLog(line)
+	}
+
+	dir := crashDir(m.OsImgPath)
+	path := filepath.Join(dir, "composite-"+time.Now().Format("20060102-150405")+".txt")
+	err := os.MkdirAll(dir, 0755)
+	if err == nil {
+		report := withEnvironment(lines, m.OsImgPath, m.Config)
+		err = os.WriteFile(path, []byte(strings.Join(report, "\n")+"\n"), 0644)
+	}
+	if err != nil {
+		m.AddLog(fmt.Sprintf("Error: writing the composite report failed: %v", err))
+		return
+	}
+	c.Report = path
+	m.AddLog("Composite report written to " + path)
+}
+
+// reportLines returns the summary report, ending with the parts and the
+// overall result.
+func (c *Composite) reportLines(operator string) []string {
+	robot := "not detected"
+	if r := currentRobot(); r != nil {
+		robot = r.String()
+	}
+	finished := time.Now().Format(time.RFC3339)
+	if clockMark() != "" {
+		finished += " (unsynced clock)"
+	}
+	lines := []string{
+		"Composite flash report",
+		"Profile:  " + c.Profile.Name,
+		"Started:  " + c.Started.Format(time.RFC3339),
+		"Finished: " + finished,
+		"Operator: " + operator,
+		"Robot:    " + robot,
+		"",
+	}
+
+	complete := true
+	for _, p := range c.Parts {
+		line := fmt.Sprintf("  %-10s %-8s %s -> %s", p.Label, p.State, filepath.Base(p.Image), p.Device)
+		if p.State == stepDone {
+			line += " " + util.FormatDuration(p.Took)
+		}
+		if p.Detail != "" {
+			line += " " + p.Detail
+		}
+		lines = append(lines, line)
+		complete = complete && p.State == stepDone
+	}
+	if complete {
+		return append(lines, "Result: flashed, every part passed")
+	}
+	return append(lines, "Result: incomplete, some parts were not flashed")
+}
+
+// compositeProgress returns the progress of the whole run from 0 to 1. Each
+// part weighs its size, twice when it is verified.
+func (m *Model) compositeProgress() float64 {
+	c := m.Composite
+	var total, done float64
+	for i, p := range c.Parts {
+		phases := 1.0
+		if m.verifyMode(p.Image) != "none" {
+			phases = 2
+		}
+		weight := float64(max(p.Size, 1)) * phases
+		total += weight
+		if i < c.Current {
+			done += weight
+		}
+	}
+	if c.running() {
+		p := c.Parts[c.Current]
+		phase := 0.0
+		if p.Verifying {
+			phase = 1
+		}
+		done += float64(max(p.Size, 1)) * (phase + m.lastProgress())
+	}
+	return min(done/total, 1)
+}
+
+// lastProgress returns the percentage of the latest progress line of the log,
+// from 0 to 1.
+func (m *Model) lastProgress() float64 {
+	if len(m.Logs) == 0 || !isProgressLine(m.Logs[len(m.Logs)-1]) {
+		return 0
+	}
+	match := canPercent.FindStringSubmatch(stripANSI(m.Logs[len(m.Logs)-1]))
+	if match == nil {
+		return 0
+	}
+	pct, _ := strconv.ParseFloat(match[1], 64)
+	return pct / 100
+}
+
+// handleCompositeKey flashes the current part (Enter), switches to the next
+// profile before the first part ran (Tab) or aborts the running part (X),
+// which closes the run when no part is running.
+func (m Model) handleCompositeKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	c := m.Composite
+	switch msg.String() {
+	case "q":
+		return m, tea.Quit
+	case "enter":
+		return m.runCompositePart()
+	case "tab":
+		if c.Started.IsZero() && len(m.Config.Composites) > 1 {
+			m.openComposite((c.Index + 1) % len(m.Config.Composites))
+		}
+	case "+", "=":
+		m.ResizeLog(1)
+	case "-":
+		m.ResizeLog(-1)
+	case "h":
+		m.toggleQueue()
+	case "ctrl+x":
+		return m.abortAll()
+	case "x", "X":
+		if m.Busy() {
+			return m.AbortOperation()
+		}
+		m.closeComposite()
+	default:
+		// Scroll the log
+		vp, cmd := m.Viewport.Update(msg)
+		m.Viewport = vp
+		return m, cmd
+	}
+	return m, nil
+}
+
+// renderComposite renders the parts and the overall progress in place of the
+// button row.
+func (m Model) renderComposite() string {
+	c := m.Composite
+	var parts []string
+	for i, p := range c.Parts {
+		icon := map[string]string{stepPending: "○", stepRunning: "▶", stepDone: "✓", stepFailed: "✗"}[p.State]
+		style := lipgloss.NewStyle().Padding(0, 1).Margin(0, 1).Foreground(lipgloss.Color(ColorWhite)).Background(lipgloss.Color(ColorAnthracite))
+		switch {
+		case p.State == stepFailed || p.Detail != "":
+			style = style.Background(lipgloss.Color(ColorLightRed))
+		case i == c.Current:
+			style = style.Background(lipgloss.Color(ColorPantone))
+		case p.State == stepDone:
+			style = style.Background(lipgloss.Color(ColorLilac))
+		}
+		parts = append(parts, style.Render(fmt.Sprintf("%s %s → %s", icon, p.Label, filepath.Base(p.Device))))
+	}
+
+	var help string
+	switch {
+	case c.finished():
+		help = c.Profile.Name + " flashed • X to close"
+	case m.Busy():
+		help = fmt.Sprintf("%s: %.0f%% overall • X to abort", c.Profile.Name, m.compositeProgress()*100)
+	case c.Parts[c.Current].State == stepFailed:
+		help = c.Parts[c.Current].Label + " failed • ENTER to retry • X to close"
+	case c.Started.IsZero() && len(m.Config.Composites) > 1:
+		help = "ENTER to flash " + c.Profile.Name + " • TAB for the next profile • X to close"
+	default:
+		help = "ENTER to flash " + c.Profile.Name + " • X to close"
+	}
+	return lipgloss.JoinVertical(lipgloss.Center,
+		lipgloss.JoinHorizontal(lipgloss.Center, parts...),
+		lipgloss.NewStyle().Faint(true).Render(help))
+}
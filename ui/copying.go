@@ -0,0 +1,91 @@
+package ui
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/husarion/husarion-os-flasher/internal/flash"
+	"github.com/husarion/husarion-os-flasher/util"
+)
+
+// tempSuffixes mark files written under a temporary name, renamed once
+// complete: the flasher's own downloads, extractions and backups, and most
+// download and copy tools.
+var tempSuffixes = []string{".part", ".partial", ".tmp"}
+
+// rsyncTemp matches the temporary name rsync writes a file to, such as
+// ".rosbot.img.xz.Ab12Cd".
+var rsyncTemp = regexp.MustCompile(`^\.(.+)\.[A-Za-z0-9]{6}$`)
+
+// tempImageName returns the name of the image a file is the temporary copy of,
+// if it is one.
+func tempImageName(name string) (string, bool) {
+	if m := rsyncTemp.FindStringSubmatch(name); m != nil && isImageFileName(m[1]) {
+		return m[1], true
+	}
+	for _, suffix := range tempSuffixes {
+		if image, ok := strings.CutSuffix(name, suffix); ok && isImageFileName(image) {
+			return image, true
+		}
+	}
+	return "", false
+}
+
+// isImageFileName reports whether a file name is listed as an image.
+func isImageFileName(name string) bool {
+	return flash.IsImageName(name) || flash.IsZip(name)
+}
+
+// tempImages returns the temporary copies of images in dir.
+func tempImages(dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var paths []string
+	for _, entry := range entries {
+		if _, ok := tempImageName(entry.Name()); ok && !entry.IsDir() {
+			paths = append(paths, filepath.Join(dir, entry.Name()))
+		}
+	}
+	return paths
+}
+
+// copyingItem is the image list entry of an image still being copied, which
+// cannot be selected.
+func copyingItem(path string) Item {
+	name := filepath.Base(path)
+	if image, ok := tempImageName(name); ok {
+		name = image
+	}
+	desc := "Copying"
+	if info, err := os.Stat(path); err == nil {
+		desc += " • " + util.FormatBytes(info.Size()) + " so far"
+		// Such as an interrupted download, kept to be resumed
+		if idle := time.Since(info.ModTime()); idle > time.Minute {
+			desc += ", stalled for " + util.FormatDuration(idle)
+		}
+	}
+	return Item{title: name + " (copying…)", value: path, desc: desc, copying: true}
+}
+
+// imageSelected reports whether an image that can be used is selected, as
+// images still being copied cannot.
+func (m *Model) imageSelected() bool {
+	item, ok := m.ImageList.SelectedItem().(Item)
+	return ok && !item.copying
+}
+
+// skipCopyingImage moves the cursor of the image list off the images still
+// being copied, which are listed last.
+func (m *Model) skipCopyingImage() {
+	for m.ImageList.Index() > 0 {
+		if item, ok := m.ImageList.SelectedItem().(Item); !ok || !item.copying {
+			return
+		}
+		m.ImageList.CursorUp()
+	}
+}
@@ -0,0 +1,68 @@
+//go:build linux
+
+package ui
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// openForWriting returns which of paths a process has open for writing, from
+// the file descriptors listed in /proc.
+func openForWriting(paths []string) map[string]bool {
+	if len(paths) == 0 {
+		return nil
+	}
+	byAbs := make(map[string]string, len(paths))
+	for _, path := range paths {
+		if abs, err := filepath.Abs(path); err == nil {
+			byAbs[abs] = path
+		}
+	}
+	procs, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+	open := make(map[string]bool)
+	for _, proc := range procs {
+		if _, err := strconv.Atoi(proc.Name()); err != nil {
+			continue
+		}
+		fdDir := filepath.Join("/proc", proc.Name(), "fd")
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			target, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+			if err != nil {
+				continue
+			}
+			path, ok := byAbs[target]
+			if !ok || open[path] {
+				continue
+			}
+			if fdWritable(filepath.Join("/proc", proc.Name(), "fdinfo", fd.Name())) {
+				open[path] = true
+			}
+		}
+	}
+	return open
+}
+
+// fdWritable reports whether the flags of an fdinfo file allow writing.
+func fdWritable(fdinfo string) bool {
+	b, err := os.ReadFile(fdinfo)
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		if value, ok := strings.CutPrefix(line, "flags:"); ok {
+			flags, err := strconv.ParseUint(strings.TrimSpace(value), 8, 32)
+			return err == nil && flags&uint64(os.O_WRONLY|os.O_RDWR) != 0
+		}
+	}
+	return false
+}
@@ -0,0 +1,360 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"gopkg.in/yaml.v3"
+
+	"github.com/husarion/husarion-os-flasher/config"
+)
+
+const (
+	// crashLogLines is how many recent log lines are kept for crash reports.
+	crashLogLines = 200
+
+	// interruptedJobsFile records jobs that were running when the process crashed.
+	interruptedJobsFile = "interrupted-jobs.yaml"
+)
+
+// JobRecord describes a long-running operation for crash reports and resume offers.
+type JobRecord struct {
+	ID       int       `yaml:"-"`
+	Kind     string    `yaml:"kind"` // flash, extract, check, firmware, can, burnin or action
+	Src      string    `yaml:"src"`
+	Dst      string    `yaml:"dst,omitempty"`
+	Started  time.Time `yaml:"started"`
+	Operator string    `yaml:"operator,omitempty"` // who started it, see Model.Operator
+
+	// Robot connected over USB when the job started, if any
+	Robot         string `yaml:"robot,omitempty"`
+	RobotRevision string `yaml:"robot_revision,omitempty"`
+	RobotSerial   string `yaml:"robot_serial,omitempty"`
+
+	// Undervoltage is set when a Raspberry Pi reported a low supply voltage
+	// during a flash, see watchPower
+	Undervoltage bool `yaml:"undervoltage,omitempty"`
+}
+
+// crashState is shared by all sessions in the process (console and SSH).
+var crashState = struct {
+	sync.Mutex
+	imgPath string
+	cfg     *config.Config
+	logs    []string
+	jobs    map[int]JobRecord
+	nextID  int
+}{jobs: make(map[int]JobRecord)}
+
+// crashDir returns the directory crash reports are written to.
+func crashDir(osImgPath string) string {
+	return filepath.Join(osImgPath, "logs")
+}
+
+// setCrashContext sets the image directory whose logs/ subdirectory receives crash
+// reports, and the config described in the report header.
+func setCrashContext(osImgPath string, cfg *config.Config) {
+	crashState.Lock()
+	defer crashState.Unlock()
+	crashState.imgPath = osImgPath
+	crashState.cfg = cfg
+}
+
+// currentConfig returns the config of the process, for jobs running outside a
+// session.
+func currentConfig() *config.Config {
+	crashState.Lock()
+	defer crashState.Unlock()
+	return crashState.cfg
+}
+
+// rememberLog keeps a plain-text copy of a log line in the recent log ring.
+func rememberLog(line string) {
+	crashState.Lock()
+	defer crashState.Unlock()
+	crashState.logs = append(crashState.logs, time.Now().Format("15:04:05")+" "+stripANSI(line))
+	if over := len(crashState.logs) - crashLogLines; over > 0 {
+		crashState.logs = crashState.logs[over:]
+	}
+}
+
+// beginJob registers a running job, records it in the audit log and returns its
+// id. The job's destination (a device, or the file an extraction writes) is
+// reserved: while another job in any session writes to it, beginJob fails.
+func beginJob(kind, src, dst, operator string) (int, error) {
+	if err := errMonitoring(); err != nil {
+		return 0, err
+	}
+	job := JobRecord{Kind: kind, Src: src, Dst: dst, Started: time.Now(), Operator: operator}
+	if r := currentRobot(); r != nil {
+		job.Robot, job.RobotRevision, job.RobotSerial = r.Model, r.Controller.Revision, r.Controller.Serial
+	}
+
+	crashState.Lock()
+	if dst != "" {
+		for id, other := range crashState.jobs {
+			if other.Dst == dst {
+				crashState.Unlock()
+				if kind == "extract" || kind == "download" {
+					return 0, fmt.Errorf("%s busy (job #%d)", filepath.Base(dst), id)
+				}
+				return 0, fmt.Errorf("device busy (job #%d)", id)
+			}
+		}
+	}
+	crashState.nextID++
+	job.ID = crashState.nextID
+	crashState.jobs[job.ID] = job
+	crashState.Unlock()
+
+	writeJournal()
+	Events.Publish(JobStarted{Job: job})
+	if kind == "flash" {
+		watchPower()
+	}
+	return job.ID, nil
+}
+
+// runningJob returns the record of a running job.
+func runningJob(id int) (JobRecord, bool) {
+	crashState.Lock()
+	defer crashState.Unlock()
+	job, ok := crashState.jobs[id]
+	return job, ok
+}
+
+// endJob removes a job from the running set and returns its record.
+// Unknown ids yield ok == false.
+func endJob(id int) (job JobRecord, ok bool) {
+	crashState.Lock()
+	job, ok = crashState.jobs[id]
+	delete(crashState.jobs, id)
+	crashState.Unlock()
+
+	if ok {
+		writeJournal()
+		Events.Publish(JobEnded{Job: job})
+	}
+	return job, ok
+}
+
+// WriteCrashDump writes a crash report with the panic value, stack and recent
+// logs into the crash directory, plus a record of any jobs that were running.
+// It returns the report path.
+func WriteCrashDump(reason any, stack []byte) (string, error) {
+	return writeCrashDump(reason, stack, true)
+}
+
+// writeCrashDump writes a crash report, and the record of the running jobs
+// when interrupted: a crash that only ends an SSH session leaves them running.
+func writeCrashDump(reason any, stack []byte, interrupted bool) (string, error) {
+	crashState.Lock()
+	imgPath := crashState.imgPath
+	cfg := crashState.cfg
+	logs := append([]string(nil), crashState.logs...)
+	var jobs []JobRecord
+	for _, job := range crashState.jobs {
+		jobs = append(jobs, job)
+	}
+	crashState.Unlock()
+
+	dir := crashDir(imgPath)
+	if imgPath == "" {
+		dir = filepath.Join(os.TempDir(), "husarion-os-flasher")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Started.Before(jobs[j].Started) })
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Husarion OS Flasher crash report\n")
+	for _, line := range EnvironmentInfo(imgPath, cfg) {
+		b.WriteString(line + "\n")
+	}
+	fmt.Fprintf(&b, "Time: %s\n", time.Now().Format(time.RFC3339))
+	fmt.Fprintf(&b, "Panic: %v\n\n", reason)
+	b.WriteString("Running jobs:\n")
+	if len(jobs) == 0 {
+		b.WriteString("  none\n")
+	}
+	for _, job := range jobs {
+		fmt.Fprintf(&b, "  %s %s -> %s (started %s", job.Kind, job.Src, job.Dst, job.Started.Format(time.RFC3339))
+		if job.Operator != "" {
+			fmt.Fprintf(&b, " by %s", job.Operator)
+		}
+		b.WriteString(")\n")
+	}
+	b.WriteString("\nStack:\n")
+	b.Write(stack)
+	b.WriteString("\nRecent logs:\n")
+	for _, line := range logs {
+		b.WriteString(line + "\n")
+	}
+
+	path := filepath.Join(dir, "crash-"+time.Now().Format("20060102-150405")+".txt")
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		return "", err
+	}
+
+	if interrupted && len(jobs) > 0 {
+		if out, err := yaml.Marshal(jobs); err == nil {
+			_ = os.WriteFile(filepath.Join(dir, interruptedJobsFile), out, 0644)
+		}
+	}
+	return path, nil
+}
+
+// takeInterruptedJobs returns the jobs recorded by a previous crash and removes
+// the record so the offer is only made once.
+func takeInterruptedJobs(dir string) []JobRecord {
+	path := filepath.Join(dir, interruptedJobsFile)
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	_ = os.Remove(path)
+	var jobs []JobRecord
+	if yaml.Unmarshal(b, &jobs) != nil {
+		return nil
+	}
+	return jobs
+}
+
+// recoverJob is deferred in job goroutines. A panic is turned into a crash report
+// and an ErrorMsg so the UI keeps running and the job is marked as failed.
+func recoverJob(progressChan chan tea.Msg) {
+	if r := recover(); r != nil {
+		err := fmt.Errorf("internal error: %v", r)
+		if path, werr := WriteCrashDump(r, debug.Stack()); werr == nil {
+			err = fmt.Errorf("internal error: %v (crash report: %s)", r, path)
+		}
+		select {
+		case progressChan <- ErrorMsg{Err: err}:
+		default:
+		}
+	}
+}
+
+// RecoverProgram is deferred around tea.Program.Run when the program was created
+// with tea.WithoutCatchPanics. It restores the terminal, writes a crash report
+// and exits.
+func RecoverProgram(p *tea.Program) {
+	if r := recover(); r != nil {
+		if p != nil {
+			p.Kill()
+		}
+		reportCrash(r, debug.Stack(), true)
+		os.Exit(2)
+	}
+}
+
+// CrashSession handles the panic r recovered from the program of an SSH
+// session: it stops p, when not nil, which restores its terminal, and writes a
+// crash report. The jobs of the other sessions keep running.
+func CrashSession(p *tea.Program, r any) {
+	if p != nil {
+		p.Kill()
+	}
+	reportCrash(r, debug.Stack(), false)
+}
+
+// reportCrash writes the crash report of the panic r and says where on
+// stderr. interrupted records the running jobs, for a crash that exits.
+func reportCrash(r any, stack []byte, interrupted bool) {
+	fmt.Fprintf(os.Stderr, "husarion-os-flasher crashed: %v\n", r)
+	if path, err := writeCrashDump(r, stack, interrupted); err == nil {
+		fmt.Fprintf(os.Stderr, "Crash report written to %s\n", path)
+	} else {
+		fmt.Fprintf(os.Stderr, "Failed to write crash report: %v\n%s", err, stack)
+	}
+}
+
+// sessionModel guards the model of an SSH session. A panic in the model or in
+// one of its commands writes a crash report and quits that session only, so
+// the server keeps serving the other sessions and their jobs.
+type sessionModel struct {
+	tea.Model
+	crashed *atomic.Bool
+}
+
+// GuardSession wraps the model of an SSH session in a sessionModel. Its
+// program keeps Bubble Tea's own panic catching for the commands of
+// tea.Sequence, which cannot be wrapped.
+func GuardSession(m tea.Model) tea.Model {
+	return sessionModel{Model: m, crashed: new(atomic.Bool)}
+}
+
+// recover turns a panic into a crash report, once per session, and quits.
+func (s sessionModel) recover(r any) tea.Cmd {
+	if s.crashed.CompareAndSwap(false, true) {
+		reportCrash(r, debug.Stack(), false)
+	}
+	return tea.Quit
+}
+
+func (s sessionModel) Init() (cmd tea.Cmd) {
+	defer func() {
+		if r := recover(); r != nil {
+			cmd = s.recover(r)
+		}
+	}()
+	return s.guard(s.Model.Init())
+}
+
+func (s sessionModel) Update(msg tea.Msg) (next tea.Model, cmd tea.Cmd) {
+	if s.crashed.Load() {
+		return s, tea.Quit
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			next, cmd = s, s.recover(r)
+		}
+	}()
+	m, cmd := s.Model.Update(msg)
+	return sessionModel{Model: m, crashed: s.crashed}, s.guard(cmd)
+}
+
+func (s sessionModel) View() (view string) {
+	if s.crashed.Load() {
+		return ""
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			view = ""
+			s.recover(r)
+		}
+	}()
+	return s.Model.View()
+}
+
+// guard wraps a command, and those of the batch it returns, so that a panic
+// in it quits the session.
+func (s sessionModel) guard(cmd tea.Cmd) tea.Cmd {
+	if cmd == nil {
+		return nil
+	}
+	return func() (msg tea.Msg) {
+		defer func() {
+			if r := recover(); r != nil {
+				s.recover(r)
+				msg = tea.QuitMsg{}
+			}
+		}()
+		msg = cmd()
+		if batch, ok := msg.(tea.BatchMsg); ok {
+			for i := range batch {
+				batch[i] = s.guard(batch[i])
+			}
+		}
+		return msg
+	}
+}
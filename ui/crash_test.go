@@ -0,0 +1,54 @@
+package ui
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// panicModel panics in Update, or in the command it returns when inCmd is set.
+type panicModel struct{ inCmd bool }
+
+func (m panicModel) Init() tea.Cmd { return nil }
+
+func (m panicModel) Update(tea.Msg) (tea.Model, tea.Cmd) {
+	if m.inCmd {
+		return m, tea.Batch(func() tea.Msg { panic("command") })
+	}
+	panic("update")
+}
+
+func (m panicModel) View() string { return "" }
+
+func TestGuardSession(t *testing.T) {
+	dir := t.TempDir()
+	setCrashContext(dir, nil)
+	defer setCrashContext("", nil)
+	id, err := beginJob("flash", "a.img", "/dev/guard-test", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer endJob(id)
+
+	for _, inCmd := range []bool{false, true} {
+		m := GuardSession(panicModel{inCmd: inCmd})
+		_, cmd := m.Update(nil)
+		msg := cmd()
+		if batch, ok := msg.(tea.BatchMsg); ok {
+			msg = batch[0]()
+		}
+		if _, ok := msg.(tea.QuitMsg); !ok {
+			t.Fatalf("inCmd=%v: expected the session to quit, got %#v", inCmd, msg)
+		}
+	}
+	reports, _ := filepath.Glob(filepath.Join(dir, "logs", "crash-*.txt"))
+	if len(reports) == 0 {
+		t.Error("no crash report written")
+	}
+	// The other sessions' jobs keep running: they are not recorded as interrupted
+	if _, err := os.Stat(filepath.Join(dir, "logs", interruptedJobsFile)); !os.IsNotExist(err) {
+		t.Errorf("running jobs recorded as interrupted: %v", err)
+	}
+}
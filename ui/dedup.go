@@ -0,0 +1,114 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/husarion/husarion-os-flasher/internal/flash"
+	"github.com/husarion/husarion-os-flasher/util"
+)
+
+// storedHash returns the SHA-256 recorded in integrity.yaml for an image, or ""
+// when there is none or the file changed after it was checked.
+func storedHash(imagePath string) string {
+	entry, ok := loadIntegrityEntry(imagePath)
+	if !ok || entry.Actual == "" {
+		return ""
+	}
+	checked, err := time.Parse(time.RFC3339, entry.CheckedAt)
+	info, serr := os.Stat(imagePath)
+	if err != nil || serr != nil || info.ModTime().After(checked) {
+		return ""
+	}
+	return entry.Actual
+}
+
+// PreviewDedup lists images stored more than once and asks how to deduplicate them.
+func (m *Model) PreviewDedup() (tea.Model, tea.Cmd) {
+	if m.Busy() {
+		return m, nil
+	}
+	if err := errMonitoring(); err != nil {
+		m.AddLog(fmt.Sprintf("Error: %v", err))
+		return m, nil
+	}
+	groups, err := flash.FindDuplicates(m.OsImgPath, storedHash)
+	if err != nil {
+		m.AddLog(fmt.Sprintf("Error: %v", err))
+		return m, nil
+	}
+	if len(groups) == 0 {
+		m.AddLog("No duplicate images found. Only images with a recorded checksum (run Check) are compared.")
+		return m, nil
+	}
+	m.DuplicateGroups = groups
+	return m, nil
+}
+
+// confirmDedup handles the answer to the deduplication preview.
+func (m *Model) confirmDedup(key string) (tea.Model, tea.Cmd) {
+	groups := m.DuplicateGroups
+	m.DuplicateGroups = nil
+
+	var apply func(flash.DuplicateGroup) error
+	var done string
+	switch strings.ToLower(key) {
+	case "l":
+		apply, done = flash.DuplicateGroup.Hardlink, "hard-linked"
+	case "x":
+		apply, done = flash.DuplicateGroup.Delete, "deleted"
+	default:
+		m.AddLog("Deduplication cancelled.")
+		return m, nil
+	}
+	if maintenanceBlocksImages() {
+		m.AddLog("Deduplication is paused while maintenance reorganizes the image directory.")
+		return m, nil
+	}
+
+	var freed int64
+	for _, g := range groups {
+		if err := apply(g); err != nil {
+			m.AddLog(fmt.Sprintf("Error: deduplicating %s: %v", filepath.Base(g.Files[0]), err))
+			continue
+		}
+		freed += g.Reclaimable()
+		m.AddLog(fmt.Sprintf("Duplicates of %s %s.", filepath.Base(g.Files[0]), done))
+	}
+	m.AddLog(fmt.Sprintf("Freed %s.", util.FormatBytes(freed)))
+	m.Refresh()
+	return m, nil
+}
+
+// renderDedup renders the deduplication preview.
+func (m Model) renderDedup() string {
+	styles := Styles()
+	header := styles.Header.Render(" Duplicate images ")
+
+	var lines []string
+	var freed int64
+	for _, g := range m.DuplicateGroups {
+		freed += g.Reclaimable()
+		lines = append(lines, fmt.Sprintf("%s (%s, sha256 %s...)", filepath.Base(g.Files[0]), util.FormatBytes(g.Size), g.Hash[:12]))
+		for _, f := range g.Files[1:] {
+			lines = append(lines, "  = "+filepath.Base(f))
+		}
+	}
+	lines = append(lines, "", fmt.Sprintf("Deduplicating frees %s.", util.FormatBytes(freed)))
+	body := styles.Container.Render(styles.InfoPanel.Render(strings.Join(lines, "\n")))
+	footer := styles.FooterStyle.Render("L to replace duplicates with hard links • X to delete them • any other key to cancel")
+
+	return lipgloss.Place(
+		m.Width,
+		m.Height,
+		lipgloss.Center,
+		lipgloss.Center,
+		lipgloss.JoinVertical(lipgloss.Center, header, body, footer),
+	)
+}
@@ -0,0 +1,163 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"gopkg.in/yaml.v3"
+
+	"github.com/husarion/husarion-os-flasher/internal/flash"
+	"github.com/husarion/husarion-os-flasher/platform"
+)
+
+// demoMode is set by StartDemo: jobs are simulated.
+var demoMode bool
+
+// demoJobTime is how long a simulated flash or check takes, whatever the size
+// of the image, to keep demonstrations short.
+const demoJobTime = 20 * time.Second
+
+// demoImages are the images StartDemo creates, with their metadata.
+var demoImages = []struct {
+	name string
+	size int64
+	meta ImageMeta
+}{
+	{"husarion-rosbot-xl-humble-2.1.0.img", 7 << 30, ImageMeta{Version: "2.1.0", BuildDate: "2026-09-14", Description: "ROS 2 Humble", Robot: "rosbot-xl"}},
+	{"husarion-rosbot-jazzy-1.4.0.img", 6 << 30, ImageMeta{Version: "1.4.0", BuildDate: "2026-08-02", Description: "ROS 2 Jazzy", Robot: "rosbot"}},
+	{"husarion-panther-humble-3.0.2.img", 8 << 30, ImageMeta{Version: "3.0.2", BuildDate: "2026-07-21", Description: "ROS 2 Humble", Robot: "panther"}},
+}
+
+// StartDemo switches to the demo mode, which shows the UI without root or
+// hardware: devices are made up, flashing, verifying, checking and the EEPROM
+// configuration only simulate their progress, and Esc quits instead of
+// powering off. It returns a temporary image directory of empty images, which
+// also receives the logs and history; the caller removes it. Call it before
+// creating a model.
+func StartDemo() (string, error) {
+	dir, err := os.MkdirTemp("", "husarion-flasher-demo-")
+	if err != nil {
+		return "", err
+	}
+	var c catalog
+	c.Images = map[string]ImageMeta{}
+	for _, img := range demoImages {
+		// Sparse files, they take no space
+		f, err := os.Create(filepath.Join(dir, img.name))
+		if err == nil {
+			err = f.Truncate(img.size)
+			f.Close()
+		}
+		if err != nil {
+			os.RemoveAll(dir)
+			return "", err
+		}
+		c.Images[img.name] = img.meta
+	}
+	b, err := yaml.Marshal(c)
+	if err == nil {
+		err = os.WriteFile(filepath.Join(dir, catalogFile), b, 0644)
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+
+	demoMode = true
+	platform.Current = platform.Demo
+	return dir, nil
+}
+
+// demoTransfer simulates copying an image of size bytes in demoJobTime,
+// sending pv-style progress lines described by what and then done. It can be
+// aborted like an in-process write.
+func demoTransfer(size int64, what string, done tea.Msg, progressChan chan tea.Msg) {
+	cancel := make(chan struct{})
+	var once sync.Once
+	progressChan <- DDStartedMsg{Cancel: func() {
+		once.Do(func() { close(cancel) })
+	}}
+
+	go func() {
+		progress := throttledProgress(progressChan, what)
+		start := time.Now()
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		for written := int64(0); written < size; {
+			select {
+			case <-cancel:
+				// AbortOperation reports completion
+				return
+			case <-ticker.C:
+			}
+			elapsed := time.Since(start)
+			written = min(size, int64(float64(size)*elapsed.Seconds()/demoJobTime.Seconds()))
+			progress(written, size, elapsed)
+		}
+		select {
+		case progressChan <- done:
+		default:
+		}
+	}()
+}
+
+// demoWrite simulates WriteImage.
+func demoWrite(src, dst string, progressChan chan tea.Msg) {
+	size, _ := flash.RawSize(src)
+	progressChan <- ProgressMsg("Unmounting all partitions under " + dst + " if mounted...")
+	progressChan <- ProgressMsg(fmt.Sprintf("Flashing %s (demo, nothing is written)...", filepath.Base(src)))
+	demoTransfer(size, "", DoneMsg{Src: src, Dst: dst}, progressChan)
+}
+
+// demoVerify simulates VerifyWrite.
+func demoVerify(src, dst, mode string, progressChan chan tea.Msg) {
+	size, _ := flash.RawSize(src)
+	progressChan <- ProgressMsg(fmt.Sprintf("Verifying %s (%s)...", dst, mode))
+	demoTransfer(size, "verified ", DoneMsg{Src: src, Dst: dst, Verified: true}, progressChan)
+}
+
+// demoCheck simulates CheckIntegrity. It cannot be aborted.
+func demoCheck(image string, progressChan chan tea.Msg) {
+	size, _ := flash.RawSize(image)
+	go func() {
+		progress := throttledProgress(progressChan, "hashed ")
+		start := time.Now()
+		for written := int64(0); written < size; {
+			time.Sleep(100 * time.Millisecond)
+			elapsed := time.Since(start)
+			written = min(size, int64(float64(size)*elapsed.Seconds()/demoJobTime.Seconds()))
+			progress(written, size, elapsed)
+		}
+		select {
+		case progressChan <- CheckCompletedMsg{File: image, Ok: true}:
+		default:
+		}
+	}()
+}
+
+// demoEEPROM simulates the output of rpi-eeprom-config.
+func demoEEPROM(bootConf string) tea.Msg {
+	time.Sleep(2 * time.Second)
+	return EEPROMConfigMsg{Output: []string{
+		"Updating bootloader EEPROM",
+		" image: /lib/firmware/raspberrypi/bootloader-2712/default/pieeprom.bin",
+		"config: " + bootConf,
+		"EEPROM update pending (demo, nothing was changed).",
+	}}
+}
+
+// demoPreview simulates the contents of a flashed card.
+func demoPreview(device string) tea.Msg {
+	time.Sleep(time.Second)
+	return PreviewMsg{Device: device, Text: device + "1  vfat  512M  system-boot\n" +
+		"  cmdline.txt  config.txt  network-config  user-data\n\n" +
+		"  /cmdline.txt:\n    console=serial0,115200 console=tty1 root=LABEL=writable rootfstype=ext4 rootwait\n\n" +
+		device + "2  ext4  7.5G  writable\n" +
+		"  bin  boot/  etc/  home/  lib  opt/  root/  usr/  var/\n\n" +
+		"  /etc/os-release:\n    PRETTY_NAME=\"Ubuntu 24.04 LTS\"\n    VERSION_ID=\"24.04\"\n\n" +
+		"  /etc/hostname:\n    husarion\n"}
+}
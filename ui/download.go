@@ -0,0 +1,96 @@
+package ui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/husarion/husarion-os-flasher/config"
+	"github.com/husarion/husarion-os-flasher/internal/download"
+)
+
+// ErrOffline is returned by the features that reach the internet when the
+// config sets offline.
+var ErrOffline = errors.New("offline mode: network features are turned off in the config")
+
+// DownloadImages downloads images listed with mirrors in the catalog of
+// osImgPath, for the download command: the named ones, or else every one
+// missing from the directory, through the configured proxy. It returns the
+// paths of the downloaded images. Progress lines are written to out. Closing
+// abort stops the download, keeping the part downloaded so far for the next
+// attempt.
+func DownloadImages(cfg *config.Config, osImgPath string, names []string, operator string, out io.Writer, abort <-chan struct{}) ([]string, error) {
+	if cfg.Offline {
+		return nil, ErrOffline
+	}
+	client, err := download.NewClient(cfg.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	images := loadCatalog(osImgPath).Images
+	if len(names) == 0 {
+		for name, meta := range images {
+			if _, err := os.Stat(filepath.Join(osImgPath, name)); len(meta.Mirrors) > 0 && os.IsNotExist(err) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+	}
+	for _, name := range names {
+		if len(images[name].Mirrors) == 0 {
+			return nil, fmt.Errorf("%s has no mirrors in %s", name, catalogFile)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-abort:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	var paths []string
+	for _, name := range names {
+		meta := images[name]
+		path, err := downloadImage(ctx, client, osImgPath, download.Source{Name: name, SHA256: meta.SHA256, Mirrors: meta.Mirrors}, operator, out)
+		if ctx.Err() != nil {
+			return paths, ErrAborted
+		}
+		if err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// downloadImage downloads one image as a job of its own.
+func downloadImage(ctx context.Context, client *http.Client, osImgPath string, src download.Source, operator string, out io.Writer) (string, error) {
+	dst := filepath.Join(osImgPath, src.Name)
+	id, err := beginJob("download", src.Mirrors[0], dst, operator)
+	if err != nil {
+		return "", err
+	}
+	job, _ := runningJob(id)
+	defer endJob(id)
+	out = progressWriter(id, out)
+
+	fmt.Fprintf(out, "Downloading %s from %d mirror(s)...\n", src.Name, len(src.Mirrors))
+	path, err := download.Fetch(ctx, client, src, osImgPath, out)
+	result := "success"
+	if errors.Is(err, context.Canceled) {
+		result = "aborted"
+	} else if err != nil {
+		result = "failure"
+	}
+	publishJobFinished(job, result, err, nil)
+	return path, err
+}
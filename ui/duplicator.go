@@ -0,0 +1,417 @@
+package ui
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/husarion/husarion-os-flasher/config"
+	"github.com/husarion/husarion-os-flasher/platform"
+	"github.com/husarion/husarion-os-flasher/util"
+)
+
+// Slot is the slot of a duplicator a device sits in.
+type Slot struct {
+	Duplicator string
+	Number     int // from 1
+}
+
+// String returns e.g. "Tower slot 3".
+func (s Slot) String() string {
+	return fmt.Sprintf("%s slot %d", s.Duplicator, s.Number)
+}
+
+// deviceSlots returns the slot of each device connected below a duplicator's
+// hub. Without configured ports, the devices of a duplicator are numbered in
+// port order.
+func deviceSlots(cfg *config.Config, devices []string) map[string]Slot {
+	slots := map[string]Slot{}
+	if cfg == nil || len(cfg.Duplicators) == 0 {
+		return slots
+	}
+	ports := map[string]string{}
+	for _, dev := range devices {
+		ports[dev] = platform.Port(dev)
+	}
+	for _, d := range cfg.Duplicators {
+		var below []string // devices below the hub
+		for _, dev := range devices {
+			if strings.HasPrefix(ports[dev], d.Hub+".") {
+				below = append(below, dev)
+			}
+		}
+		sort.Slice(below, func(i, j int) bool { return portLess(ports[below[i]], ports[below[j]]) })
+		for i, dev := range below {
+			rel := strings.TrimPrefix(ports[dev], d.Hub+".")
+			if len(d.Ports) == 0 {
+				slots[dev] = Slot{Duplicator: d.Name, Number: i + 1}
+				continue
+			}
+			// A reader may sit behind a hub of its own inside the slot
+			for n, p := range d.Ports {
+				if rel == p || strings.HasPrefix(rel, p+".") {
+					slots[dev] = Slot{Duplicator: d.Name, Number: n + 1}
+					break
+				}
+			}
+		}
+	}
+	return slots
+}
+
+// portLess orders USB port paths by their port numbers, so 1-1.2 comes
+// before 1-1.10.
+func portLess(a, b string) bool {
+	as, bs := strings.FieldsFunc(a, isPortSeparator), strings.FieldsFunc(b, isPortSeparator)
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		x, _ := strconv.Atoi(as[i])
+		y, _ := strconv.Atoi(bs[i])
+		if x != y {
+			return x < y
+		}
+	}
+	return len(as) < len(bs)
+}
+
+func isPortSeparator(r rune) bool { return r == '-' || r == '.' }
+
+// deviceItems returns the device list entries: devices outside duplicators
+// first, then the slots of each duplicator in order, described by their slot.
+func deviceItems(cfg *config.Config, devices []string) []list.Item {
+	slots := deviceSlots(cfg, devices)
+	var items []list.Item
+	for _, dev := range devices {
+		if protectedDevice(cfg, dev) != "" {
+			delete(slots, dev)
+			continue
+		}
+		if _, ok := slots[dev]; !ok {
+			items = append(items, deviceItem(dev))
+		}
+	}
+	if cfg == nil {
+		return items
+	}
+	for _, d := range cfg.Duplicators {
+		var grouped []string
+		for _, dev := range devices {
+			if s, ok := slots[dev]; ok && s.Duplicator == d.Name {
+				grouped = append(grouped, dev)
+			}
+		}
+		sort.Slice(grouped, func(i, j int) bool { return slots[grouped[i]].Number < slots[grouped[j]].Number })
+		for _, dev := range grouped {
+			item := deviceItem(dev)
+			item.desc = slots[dev].String() + " • " + item.desc
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Duplication is a run flashing the selected image to every slot of a
+// duplicator, one slot after another. A slot that fails is marked and the
+// run goes on with the next, so one bad card or reader does not hold up the
+// others. It replaces the button row while open.
+type Duplication struct {
+	Index   int // of the duplicator in the config
+	Name    string
+	Image   string
+	Slots   []SlotRun
+	Current int       // the running slot, -1 when none runs
+	Started time.Time // zero until the first slot runs
+}
+
+// SlotRun is a slot of a duplication run and its outcome.
+type SlotRun struct {
+	Number  int
+	Device  string
+	State   string // as for wizard steps
+	Detail  string // why it failed
+	Started time.Time
+	Took    time.Duration
+}
+
+// running reports whether a slot is being flashed.
+func (d *Duplication) running() bool {
+	return d.Current >= 0
+}
+
+// counts returns how many slots were flashed and how many failed.
+func (d *Duplication) counts() (done, failed int) {
+	for _, s := range d.Slots {
+		switch s.State {
+		case stepDone:
+			done++
+		case stepFailed:
+			failed++
+		}
+	}
+	return done, failed
+}
+
+// StartDuplication opens a run flashing the selected image to the slots of
+// the duplicator holding the selected device, or of the first duplicator with
+// cards in it.
+func (m *Model) StartDuplication() (tea.Model, tea.Cmd) {
+	if m.Busy() || m.Monitoring {
+		return m, nil
+	}
+	if m.Config == nil || len(m.Config.Duplicators) == 0 {
+		m.AddLog("No duplicators are configured (duplicators in the config).")
+		return m, nil
+	}
+	if !m.imageSelected() {
+		m.AddLog("Select the image to flash to the slots first.")
+		return m, nil
+	}
+	slots := deviceSlots(m.Config, m.connectedDevices())
+	index := -1
+	if m.DeviceList.SelectedItem() != nil {
+		if s, ok := slots[m.DeviceList.SelectedItem().(Item).value]; ok {
+			index = m.duplicatorIndex(s.Duplicator)
+		}
+	}
+	for i := 0; index < 0 && i < len(m.Config.Duplicators); i++ {
+		for _, s := range slots {
+			if s.Duplicator == m.Config.Duplicators[i].Name {
+				index = i
+			}
+		}
+	}
+	if index < 0 {
+		m.AddLog("No cards are in the slots of the duplicators.")
+		return m, nil
+	}
+	m.openDuplication(index)
+	return m, nil
+}
+
+// duplicatorIndex returns the index of the named duplicator in the config.
+func (m *Model) duplicatorIndex(name string) int {
+	for i, d := range m.Config.Duplicators {
+		if d.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// connectedDevices returns the devices of the device list.
+func (m *Model) connectedDevices() []string {
+	var devices []string
+	for _, item := range m.DeviceList.Items() {
+		devices = append(devices, item.(Item).value)
+	}
+	return devices
+}
+
+// openDuplication opens a run for the duplicator at index i of the config
+// with the slots holding a card now.
+func (m *Model) openDuplication(i int) {
+	name := m.Config.Duplicators[i].Name
+	d := &Duplication{Index: i, Name: name, Image: m.ImageList.SelectedItem().(Item).value, Current: -1}
+	for dev, s := range deviceSlots(m.Config, m.connectedDevices()) {
+		if s.Duplicator == name {
+			d.Slots = append(d.Slots, SlotRun{Number: s.Number, Device: dev, State: stepPending})
+		}
+	}
+	sort.Slice(d.Slots, func(i, j int) bool { return d.Slots[i].Number < d.Slots[j].Number })
+	m.Duplication = d
+
+	var slots []string
+	for _, s := range d.Slots {
+		slots = append(slots, fmt.Sprintf("%d (%s)", s.Number, s.Device))
+	}
+	if len(slots) == 0 {
+		slots = append(slots, "none")
+	}
+	m.AddLog(fmt.Sprintf("> %s: %s to slots %s.", name, filepath.Base(d.Image), strings.Join(slots, ", ")))
+}
+
+// runSlots flashes the pending slots in order, retrying those that failed
+// when none is pending.
+func (m *Model) runSlots() (tea.Model, tea.Cmd) {
+	d := m.Duplication
+	if d == nil || d.running() || m.Busy() {
+		return m, nil
+	}
+	pending := false
+	for _, s := range d.Slots {
+		pending = pending || s.State == stepPending
+	}
+	if !pending {
+		for i := range d.Slots {
+			if d.Slots[i].State == stepFailed {
+				d.Slots[i].State, d.Slots[i].Detail = stepPending, ""
+			}
+		}
+	}
+	if d.Started.IsZero() {
+		d.Started = time.Now()
+	}
+	return m.runNextSlot()
+}
+
+// runNextSlot flashes the next pending slot, skipping those that cannot
+// start, and finishes the run when none is left.
+func (m *Model) runNextSlot() (tea.Model, tea.Cmd) {
+	d := m.Duplication
+	for _, s := range d.Slots {
+		if s.State == stepPending && m.holdQueue() {
+			return m, nil
+		}
+	}
+	slots := deviceSlots(m.Config, m.connectedDevices())
+	for i := range d.Slots {
+		s := &d.Slots[i]
+		if s.State != stepPending {
+			continue
+		}
+		// The card of a slot may have been pulled or replaced since
+		if slot, ok := slots[s.Device]; !ok || slot != (Slot{Duplicator: d.Name, Number: s.Number}) {
+			s.State, s.Detail = stepFailed, "not connected"
+			m.AddLog(fmt.Sprintf("Error: slot %d: %s is not connected.", s.Number, s.Device))
+			continue
+		}
+		d.Current = i
+		s.State, s.Started = stepRunning, time.Now()
+		model, cmd := m.flashImage(d.Image, s.Device)
+		mm := model.(*Model)
+		mm.AddLog(fmt.Sprintf("%s slot %d (%d of %d).", d.Name, s.Number, i+1, len(d.Slots)))
+		// A flash that could not start has logged why, one may wait for approval
+		if mm.Busy() || mm.Approval != nil {
+			return mm, cmd
+		}
+		s.State, s.Detail = stepFailed, "could not start"
+		d.Current = -1
+	}
+	m.finishDuplication()
+	return m, nil
+}
+
+// slotFinished records the result of the running slot, if any, and starts
+// the next one unless the job was aborted.
+func (m *Model) slotFinished(result string, err error) tea.Cmd {
+	d := m.Duplication
+	if d == nil || !d.running() {
+		return nil
+	}
+	s := &d.Slots[d.Current]
+	s.Took = time.Since(s.Started)
+	d.Current = -1
+	switch {
+	case result == "success":
+		s.State = stepDone
+	case result == "aborted" || result == "cancelled":
+		s.State, s.Detail = stepFailed, result
+		m.AddLog(fmt.Sprintf("%s stopped at slot %d: ENTER to flash the remaining slots, X to close.", d.Name, s.Number))
+		return nil
+	case err != nil:
+		s.State, s.Detail = stepFailed, err.Error()
+	default:
+		s.State, s.Detail = stepFailed, result
+	}
+	_, cmd := m.runNextSlot()
+	return cmd
+}
+
+// finishDuplication logs the result of every slot.
+func (m *Model) finishDuplication() {
+	d := m.Duplication
+	done, failed := d.counts()
+	m.AddLog(fmt.Sprintf("%s: %s flashed to %d of %d slots in %s.", d.Name, filepath.Base(d.Image), done, len(d.Slots), util.FormatDuration(time.Since(d.Started))))
+	for _, s := range d.Slots {
+		if s.State == stepFailed {
+			m.AddLog(fmt.Sprintf("Error: slot %d (%s) failed: %s", s.Number, s.Device, s.Detail))
+		}
+	}
+	if failed > 0 {
+		m.AddLog("ENTER to retry the failed slots, X to close.")
+	}
+}
+
+// handleDuplicationKey flashes the slots (Enter), switches to the next
+// duplicator before the first slot ran (Tab) or aborts the running slot (X),
+// which closes the run when no slot is running.
+func (m Model) handleDuplicationKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	d := m.Duplication
+	switch msg.String() {
+	case "q":
+		return m, tea.Quit
+	case "enter":
+		return m.runSlots()
+	case "tab":
+		if d.Started.IsZero() && len(m.Config.Duplicators) > 1 {
+			m.openDuplication((d.Index + 1) % len(m.Config.Duplicators))
+		}
+	case "+", "=":
+		m.ResizeLog(1)
+	case "-":
+		m.ResizeLog(-1)
+	case "h":
+		m.toggleQueue()
+	case "ctrl+x":
+		return m.abortAll()
+	case "x", "X":
+		if m.Busy() {
+			return m.AbortOperation()
+		}
+		m.Duplication = nil
+		m.QueueHeld = false
+		m.AddLog("Duplication closed.")
+	default:
+		// Scroll the log
+		vp, cmd := m.Viewport.Update(msg)
+		m.Viewport = vp
+		return m, cmd
+	}
+	return m, nil
+}
+
+// renderDuplication renders the slots colored by their result in place of
+// the button row.
+func (m Model) renderDuplication() string {
+	d := m.Duplication
+	var slots []string
+	for i, s := range d.Slots {
+		style := lipgloss.NewStyle().Padding(0, 1).Margin(0, 1).Foreground(lipgloss.Color(ColorWhite)).Background(lipgloss.Color(ColorAnthracite))
+		switch {
+		case s.State == stepFailed:
+			style = style.Background(lipgloss.Color(ColorLightRed))
+		case i == d.Current:
+			style = style.Background(lipgloss.Color(ColorPantone))
+		case s.State == stepDone:
+			style = style.Background(lipgloss.Color(ColorLilac))
+		}
+		icon := map[string]string{stepPending: "○", stepRunning: "▶", stepDone: "✓", stepFailed: "✗"}[s.State]
+		slots = append(slots, style.Render(fmt.Sprintf("%s %d", icon, s.Number)))
+	}
+
+	done, failed := d.counts()
+	var help string
+	switch {
+	case len(d.Slots) == 0:
+		help = d.Name + ": no cards in the slots • X to close"
+	case d.running():
+		help = fmt.Sprintf("%s: slot %d • %d flashed, %d failed • X to abort", d.Name, d.Slots[d.Current].Number, done, failed)
+	case d.Started.IsZero() && len(m.Config.Duplicators) > 1:
+		help = "ENTER to flash all slots of " + d.Name + " • TAB for the next duplicator • X to close"
+	case d.Started.IsZero():
+		help = "ENTER to flash all slots of " + d.Name + " • X to close"
+	case failed > 0 || done < len(d.Slots):
+		help = fmt.Sprintf("%d flashed, %d failed • ENTER to flash the rest • X to close", done, failed)
+	default:
+		help = fmt.Sprintf("All %d slots flashed • X to close", done)
+	}
+	return lipgloss.JoinVertical(lipgloss.Center,
+		lipgloss.JoinHorizontal(lipgloss.Center, slots...),
+		lipgloss.NewStyle().Faint(true).Render(filepath.Base(d.Image)+" • "+help))
+}
@@ -0,0 +1,185 @@
+package ui
+
+import (
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/husarion/husarion-os-flasher/internal/events"
+	"github.com/husarion/husarion-os-flasher/platform"
+	"github.com/husarion/husarion-os-flasher/util"
+)
+
+// Events is the bus of the process, shared by all sessions. Integrations
+// subscribe to it with events.Subscribe.
+var Events = events.New()
+
+// Events published on Events.
+type (
+	// JobStarted is published when a job is registered, before it runs.
+	JobStarted struct{ Job JobRecord }
+
+	// JobProgress is published for each line a job logs.
+	JobProgress struct {
+		ID   int
+		Line string // may be styled
+	}
+
+	// JobEnded is published when a job leaves the running set, whether or not
+	// it ran.
+	JobEnded struct{ Job JobRecord }
+
+	// JobFinished is published with the result of a job that ran, after
+	// JobEnded in the UI.
+	JobFinished struct {
+		Job    JobRecord
+		Result string // success, failure or aborted
+		Err    error
+		Output []string // the job's log lines, unstyled
+	}
+
+	// DeviceAdded is published when a device appears in the device list.
+	DeviceAdded struct{ Device string }
+
+	// DeviceRemoved is published when a device leaves the device list.
+	DeviceRemoved struct{ Device string }
+
+	// ImageAdded is published when an image appears in the image directory.
+	ImageAdded struct{ Image string }
+
+	// ImageRemoved is published when an image leaves the image directory.
+	ImageRemoved struct{ Image string }
+)
+
+func init() {
+	events.Subscribe(Events, func(e JobStarted) { writeAudit("start", e.Job) })
+	events.Subscribe(Events, func(JobStarted) { publishJobs() })
+	events.Subscribe(Events, func(JobEnded) { publishJobs() })
+
+	events.Subscribe(Events, func(e JobStarted) { startRecording(e.Job) })
+	events.Subscribe(Events, func(e JobProgress) { recordLog(e.ID, e.Line) })
+	events.Subscribe(Events, func(e JobEnded) { stopRecording(e.Job.ID) })
+	events.Subscribe(Events, func(e JobFinished) { recordResult(e.Job, e.Result, e.Err) })
+
+	events.Subscribe(Events, func(e JobFinished) { recordHistory(e.Job, e.Result, e.Err, e.Output) })
+
+	events.Subscribe(Events, func(e DeviceAdded) {
+		line := "Device connected: " + e.Device
+		if size, err := platform.Current.DiskSize(e.Device); err == nil {
+			line += " (" + util.FormatBytes(size) + ")"
+		}
+		if model := platform.Model(e.Device); model != "" {
+			line += " " + model
+		}
+		logInventory(line)
+	})
+	events.Subscribe(Events, func(e DeviceRemoved) { logInventory("Device removed: " + e.Device) })
+	events.Subscribe(Events, func(e ImageAdded) { logInventory("Image added: " + filepath.Base(e.Image)) })
+	events.Subscribe(Events, func(e ImageRemoved) { logInventory("Image removed: " + filepath.Base(e.Image)) })
+}
+
+// inventoryLogLines is how many device and image changes are kept for the
+// sessions to log.
+const inventoryLogLines = 50
+
+// inventoryState tracks the devices and images of the process to publish their
+// changes, and keeps the resulting log lines until every session has logged
+// them.
+var inventoryState = struct {
+	sync.Mutex
+	polled  time.Time
+	devices []string // nil before the first poll
+	images  []string
+	lines   []string // most recent change last
+	seq     int      // number of lines ever logged
+}{}
+
+// pollInventory publishes the devices and images that appeared or left since
+// the last poll of any session, at most once a second. The first poll only
+// takes stock.
+func pollInventory(osImgPath string) {
+	inventoryState.Lock()
+	if time.Since(inventoryState.polled) < time.Second {
+		inventoryState.Unlock()
+		return
+	}
+	inventoryState.polled = time.Now()
+	inventoryState.Unlock()
+
+	devices, devErr := platform.Current.Devices()
+	images, imgErr := ImageFiles(osImgPath)
+
+	inventoryState.Lock()
+	first := inventoryState.devices == nil
+	oldDevices, oldImages := inventoryState.devices, inventoryState.images
+	if devErr == nil {
+		inventoryState.devices = append([]string{}, devices...)
+	}
+	if imgErr == nil {
+		inventoryState.images = images
+	}
+	inventoryState.Unlock()
+	if first {
+		return
+	}
+
+	if devErr == nil {
+		publishChanges(oldDevices, devices, func(d string) any { return DeviceAdded{d} }, func(d string) any { return DeviceRemoved{d} })
+	}
+	if imgErr == nil {
+		publishChanges(oldImages, images, func(i string) any { return ImageAdded{i} }, func(i string) any { return ImageRemoved{i} })
+	}
+}
+
+// publishChanges publishes the entries added to and removed from a list.
+func publishChanges(old, current []string, added, removed func(string) any) {
+	for _, entry := range current {
+		if !slices.Contains(old, entry) {
+			Events.Publish(added(entry))
+		}
+	}
+	for _, entry := range old {
+		if !slices.Contains(current, entry) {
+			Events.Publish(removed(entry))
+		}
+	}
+}
+
+// logInventory keeps a device or image change for the sessions to log.
+func logInventory(line string) {
+	inventoryState.Lock()
+	defer inventoryState.Unlock()
+	inventoryState.lines = append(inventoryState.lines, line)
+	if over := len(inventoryState.lines) - inventoryLogLines; over > 0 {
+		inventoryState.lines = inventoryState.lines[over:]
+	}
+	inventoryState.seq++
+}
+
+// inventorySeq returns the number of device and image changes logged so far.
+func inventorySeq() int {
+	inventoryState.Lock()
+	defer inventoryState.Unlock()
+	return inventoryState.seq
+}
+
+// logInventoryChanges logs the device and image changes this session has not
+// logged yet.
+func (m *Model) logInventoryChanges() {
+	inventoryState.Lock()
+	seq := inventoryState.seq
+	unseen := min(seq-m.InventorySeen, len(inventoryState.lines))
+	lines := append([]string(nil), inventoryState.lines[len(inventoryState.lines)-unseen:]...)
+	inventoryState.Unlock()
+
+	m.InventorySeen = seq
+	for _, line := range lines {
+		m.AddLog(line)
+	}
+}
+
+// publishJobFinished publishes the result of a job.
+func publishJobFinished(job JobRecord, result string, err error, output []string) {
+	Events.Publish(JobFinished{Job: job, Result: result, Err: err, Output: output})
+}
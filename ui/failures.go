@@ -0,0 +1,124 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/husarion/husarion-os-flasher/internal/history"
+	"github.com/husarion/husarion-os-flasher/util"
+)
+
+// LoadFailures returns the failed jobs of the history, newest first.
+func LoadFailures(osImgPath string) ([]history.Entry, error) {
+	entries, err := history.Load(HistoryPath(osImgPath))
+	var failed []history.Entry
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].Result == "failure" {
+			failed = append(failed, entries[i])
+		}
+	}
+	return failed, err
+}
+
+// FailureDetails returns the saved error and output of a failed job, such as
+// the messages of xz and dd, or its error alone when nothing was saved.
+func FailureDetails(osImgPath string, e history.Entry) string {
+	if e.Details != "" {
+		if b, err := os.ReadFile(filepath.Join(crashDir(osImgPath), e.Details)); err == nil {
+			return string(b)
+		}
+	}
+	return "Error: " + e.Error + "\n\nThe output of this job was not saved."
+}
+
+// OpenFailures shows the details screen of the failed jobs, newest first.
+func (m *Model) OpenFailures() (tea.Model, tea.Cmd) {
+	failed, err := LoadFailures(m.OsImgPath)
+	if err != nil {
+		m.AddLog(fmt.Sprintf("Error: %v", err))
+		return m, nil
+	}
+	if len(failed) == 0 {
+		m.AddLog("No job has failed.")
+		return m, nil
+	}
+	m.FailedJobs = failed
+	m.ShowFailures = true
+	m.showFailure(0)
+	return m, nil
+}
+
+// showFailure loads the details of the i-th failed job into the screen.
+func (m *Model) showFailure(i int) {
+	m.FailedIndex = i
+	m.FailureView = viewport.New(min(m.Width-4, 120), max(m.Height-10, 5))
+	m.FailureView.SetContent(wrapDetails(FailureDetails(m.OsImgPath, m.FailedJobs[i]), m.FailureView.Width))
+}
+
+// handleFailuresKey scrolls the details (↑↓), moves to older and newer failed
+// jobs (←→) and closes the screen on any other key but quit.
+func (m Model) handleFailuresKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "q":
+		return m, tea.Quit
+	case "up", "down", "pgup", "pgdown", "k", "j", "home", "end":
+		var cmd tea.Cmd
+		m.FailureView, cmd = m.FailureView.Update(msg)
+		return m, cmd
+	case "right":
+		if m.FailedIndex+1 < len(m.FailedJobs) {
+			m.showFailure(m.FailedIndex + 1)
+		}
+		return m, nil
+	case "left":
+		if m.FailedIndex > 0 {
+			m.showFailure(m.FailedIndex - 1)
+		}
+		return m, nil
+	}
+	m.ShowFailures = false
+	m.FailedJobs = nil
+	return m, nil
+}
+
+// renderFailures renders the details screen of the failed jobs.
+func (m Model) renderFailures() string {
+	styles := Styles()
+	e := m.FailedJobs[m.FailedIndex]
+	header := styles.Header.Render(" Failure Details ")
+	finished := e.Finished.Format(time.DateTime)
+	if e.Clock == clockUnsynced {
+		finished += " (unsynced clock)"
+	}
+	if e.Power != "" {
+		finished += ", " + e.Power
+	}
+	title := styles.InfoPanel.Render(fmt.Sprintf("%d of %d: %s of %s to %s, %s",
+		m.FailedIndex+1, len(m.FailedJobs), e.Kind, e.Image, e.Device, finished))
+	body := styles.Container.Render(m.FailureView.View())
+	footer := styles.FooterStyle.Render("↑↓ to scroll • ←→ for newer and older failures • any key to close")
+
+	return lipgloss.Place(
+		m.Width,
+		m.Height,
+		lipgloss.Center,
+		lipgloss.Center,
+		lipgloss.JoinVertical(lipgloss.Center, header, title, body, footer),
+	)
+}
+
+// wrapDetails wraps each line of the details to width.
+func wrapDetails(details string, width int) string {
+	lines := strings.Split(details, "\n")
+	for i, line := range lines {
+		lines[i] = util.WrapText(line, width)
+	}
+	return strings.Join(lines, "\n")
+}
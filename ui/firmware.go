@@ -0,0 +1,120 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/husarion/husarion-os-flasher/config"
+	"github.com/husarion/husarion-os-flasher/internal/firmware"
+	"github.com/husarion/husarion-os-flasher/internal/flash"
+	"github.com/husarion/husarion-os-flasher/util"
+)
+
+// firmwareFor returns the configured firmware for the target robot: the first
+// entry naming it, or naming no robot.
+func (m *Model) firmwareFor() (config.Firmware, bool) {
+	if m.Config == nil {
+		return config.Firmware{}, false
+	}
+	for _, f := range m.Config.Firmware {
+		if f.Robot == "" || robotMatches(f.Robot, m.TargetRobot) {
+			return f, true
+		}
+	}
+	return config.Firmware{}, false
+}
+
+// firmwareJob resolves the file and serial port of a configured firmware. The
+// port defaults to the one of the detected robot.
+func (m *Model) firmwareJob(f config.Firmware) (firmware.Job, error) {
+	job := firmware.Job{Tool: f.Tool, File: f.File, Port: f.Port, Baud: f.Baud, Address: f.Address}
+	if !filepath.IsAbs(job.File) {
+		job.File = filepath.Join(m.OsImgPath, job.File)
+	}
+	if _, err := os.Stat(job.File); err != nil {
+		return job, fmt.Errorf("firmware %s: %w", f.File, err)
+	}
+	if job.Port == "" && m.DetectedRobot != nil {
+		job.Port = m.DetectedRobot.Controller.Port
+	}
+	if job.Port == "" {
+		return job, fmt.Errorf("no serial port for the firmware: connect the robot or set port in the config")
+	}
+	return job, nil
+}
+
+// StartFirmware writes the target robot's controller firmware, as a job with
+// progress, abort and history like a flash.
+func (m *Model) StartFirmware() (tea.Model, tea.Cmd) {
+	if m.Busy() {
+		return m, nil
+	}
+	f, ok := m.firmwareFor()
+	if !ok && m.TargetRobot == "" {
+		m.AddLog("No firmware is configured without a target robot: choose it with B or connect the robot.")
+		return m, nil
+	}
+	if !ok {
+		m.AddLog(fmt.Sprintf("No firmware is configured for %s.", m.TargetRobot))
+		return m, nil
+	}
+	job, err := m.firmwareJob(f)
+	if err != nil {
+		m.AddLog(fmt.Sprintf("Error: %v", err))
+		return m, nil
+	}
+	jobID, err := beginJob("firmware", job.File, job.Port, m.Operator)
+	if err != nil {
+		m.AddLog(fmt.Sprintf("Error: %v", err))
+		return m, nil
+	}
+
+	m.ProgressChan = make(chan tea.Msg, 100)
+	m.FlashingFirmware = true
+	m.Aborting = false
+	m.FirmwareCmd = nil
+	m.FirmwarePty = nil
+	m.FlashStartTime = time.Now()
+	m.JobID = jobID
+	m.AddLog(fmt.Sprintf("> Writing firmware %s to %s with %s...", filepath.Base(job.File), job.Port, job.Tool))
+	m.FocusButton("abort-button")
+
+	return m, tea.Batch(
+		WriteFirmware(job, m.ProgressChan),
+		ListenProgress(m.ProgressChan),
+	)
+}
+
+// WriteFirmware runs the firmware tool under a pty. Its progress output is
+// turned into progress lines like those of image writes.
+func WriteFirmware(job firmware.Job, progressChan chan tea.Msg) tea.Cmd {
+	return func() tea.Msg {
+		defer recoverJob(progressChan)
+
+		name, args, err := job.Command()
+		if err != nil {
+			return ErrorMsg{Err: err}
+		}
+		size, _ := flash.FileSize(job.File)
+		start := time.Now()
+
+		cmd := util.Command(name, args...)
+		err = startStreamed(cmd, progressChan,
+			func(line string) tea.Msg {
+				if percent, ok := firmware.Progress(line); ok && size > 0 {
+					return ProgressMsg(progressLine(int64(float64(size)*percent/100), size, time.Since(start), "firmware "))
+				}
+				return ProgressMsg(line)
+			},
+			func(ptmx *os.File) tea.Msg { return FirmwareStartedMsg{Cmd: cmd, Pty: ptmx} },
+			func(err error) tea.Msg { return FirmwareCompletedMsg{File: job.File, Port: job.Port, Err: err} })
+		if err != nil {
+			return ErrorMsg{Err: fmt.Errorf("failed to start %s: %v", name, err)}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,62 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/husarion/husarion-os-flasher/internal/flash"
+	"github.com/husarion/husarion-os-flasher/platform"
+	"github.com/husarion/husarion-os-flasher/util"
+)
+
+// rawDevice returns the unbuffered node for a disk, e.g. /dev/rdisk4 for
+// /dev/disk4, which is many times faster to write than the buffered one.
+func rawDevice(dst string) string {
+	return strings.Replace(dst, "/dev/disk", "/dev/rdisk", 1)
+}
+
+// platformFlash unmounts the disk with diskutil and writes the image to its
+// rdisk node in-process. xz and zstd images need xz or zstd on PATH (e.g. from
+// Homebrew); bzip2 comes with macOS.
+func platformFlash(src, dst string, progressChan chan tea.Msg) bool {
+	if tool := flash.DecompressTool(src); tool != "" {
+		if _, err := exec.LookPath(tool); err != nil {
+			progressChan <- ErrorMsg{Err: fmt.Errorf("cannot decompress %s: %s utility not found (brew install %s)", filepath.Base(src), tool, tool)}
+			return true
+		}
+	}
+
+	size, exact := flash.RawSize(src)
+	if disk, err := platform.Current.DiskSize(dst); err == nil && exact && disk < size {
+		progressChan <- ErrorMsg{Err: fmt.Errorf("image needs %s but %s is only %s",
+			util.FormatBytes(size), dst, util.FormatBytes(disk))}
+		return true
+	}
+
+	progressChan <- ProgressMsg("Unmounting " + dst + "...")
+	if err := platform.Current.Unmount(dst); err != nil {
+		progressChan <- ErrorMsg{Err: err}
+		return true
+	}
+
+	out, err := os.OpenFile(rawDevice(dst), os.O_WRONLY, 0)
+	if err != nil {
+		progressChan <- ErrorMsg{Err: fmt.Errorf("failed to open %s: %v", rawDevice(dst), err)}
+		return true
+	}
+	img, err := flash.OpenRaw(src)
+	if err != nil {
+		out.Close()
+		progressChan <- ErrorMsg{Err: err}
+		return true
+	}
+
+	progressChan <- ProgressMsg(fmt.Sprintf("Flashing %s to %s (size: %s)...", src, rawDevice(dst), util.FormatBytes(size)))
+	startRawWrite(img, out, src, dst, size, exact, progressChan, func() {})
+	return true
+}
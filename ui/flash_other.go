@@ -0,0 +1,11 @@
+//go:build !windows && !darwin
+
+package ui
+
+import tea "github.com/charmbracelet/bubbletea"
+
+// platformFlash writes images on platforms whose disks need their own
+// handling. Here WriteImage writes them, so it never handles the write.
+func platformFlash(src, dst string, progressChan chan tea.Msg) bool {
+	return false
+}
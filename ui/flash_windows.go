@@ -0,0 +1,59 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/husarion/husarion-os-flasher/internal/flash"
+	"github.com/husarion/husarion-os-flasher/platform"
+	"github.com/husarion/husarion-os-flasher/util"
+)
+
+// platformFlash writes the image to \\.\PhysicalDriveN in-process, since bash,
+// pv and dd are not available on Windows. xz, zstd and bzip2 images need
+// xz.exe, zstd.exe or bzip2.exe on PATH.
+func platformFlash(src, dst string, progressChan chan tea.Msg) bool {
+	if tool := flash.DecompressTool(src); tool != "" {
+		if _, err := exec.LookPath(tool); err != nil {
+			progressChan <- ErrorMsg{Err: fmt.Errorf("cannot decompress %s: %s.exe not found in PATH", filepath.Base(src), tool)}
+			return true
+		}
+	}
+
+	size, exact := flash.RawSize(src)
+	if disk, err := platform.Current.DiskSize(dst); err == nil && exact && disk < size {
+		progressChan <- ErrorMsg{Err: fmt.Errorf("image needs %s but %s is only %s",
+			util.FormatBytes(size), dst, util.FormatBytes(disk))}
+		return true
+	}
+
+	progressChan <- ProgressMsg("Locking and dismounting volumes on " + dst + "...")
+	volumes, err := platform.LockVolumes(dst)
+	if err != nil {
+		progressChan <- ErrorMsg{Err: err}
+		return true
+	}
+
+	out, err := os.OpenFile(dst, os.O_RDWR, 0)
+	if err != nil {
+		platform.CloseAll(volumes)
+		progressChan <- ErrorMsg{Err: fmt.Errorf("failed to open %s: %v", dst, err)}
+		return true
+	}
+	img, err := flash.OpenRaw(src)
+	if err != nil {
+		out.Close()
+		platform.CloseAll(volumes)
+		progressChan <- ErrorMsg{Err: err}
+		return true
+	}
+
+	progressChan <- ProgressMsg(fmt.Sprintf("Flashing %s to %s (size: %s)...", src, dst, util.FormatBytes(size)))
+
+	startRawWrite(img, out, src, dst, size, exact, progressChan, func() { platform.CloseAll(volumes) })
+	return true
+}
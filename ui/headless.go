@@ -0,0 +1,264 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/husarion/husarion-os-flasher/config"
+)
+
+// ErrAborted is returned by headless jobs stopped through their abort channel.
+var ErrAborted = errors.New("aborted")
+
+// JobError is the error of a headless job with its output, where tools such as
+// dd report the cause of their failure.
+type JobError struct {
+	Err    error
+	Output []string
+}
+
+func (e *JobError) Error() string { return e.Err.Error() }
+
+func (e *JobError) Unwrap() error { return e.Err }
+
+// RunningJobs returns the jobs running in any session, oldest first.
+func RunningJobs() []JobRecord {
+	crashState.Lock()
+	jobs := make([]JobRecord, 0, len(crashState.jobs))
+	for _, job := range crashState.jobs {
+		jobs = append(jobs, job)
+	}
+	crashState.Unlock()
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Started.Before(jobs[j].Started) })
+	return jobs
+}
+
+// RunFlash writes image to device without the UI, for remote commands. Progress
+// lines and hook output are written to out. Closing abort stops the write.
+func RunFlash(cfg *config.Config, image, device, operator string, out io.Writer, abort <-chan struct{}) error {
+	if maintenanceBlocksImages() {
+		return errors.New("flashing is paused while maintenance reorganizes the image directory")
+	}
+
+	if err := waitQueue(out, abort); err != nil {
+		return err
+	}
+	detectRobot(cfg)
+	if pattern := protectedDevice(cfg, device); pattern != "" {
+		return fmt.Errorf("%s is protected by the config (%s) and is never written", device, pattern)
+	}
+	if reason := approvalReason(cfg, device); reason != "" {
+		return fmt.Errorf("flashing %s needs a second operator (%s), approve it in the UI", device, reason)
+	}
+	if err := checkWritable(device); err != nil {
+		if hint, ok := diagnoseFailure(err, nil); ok {
+			fmt.Fprint(out, hint.Text())
+		}
+		return err
+	}
+	id, err := beginJob("flash", image, device, operator)
+	if err != nil {
+		return err
+	}
+	job, _ := runningJob(id)
+	defer endJob(id)
+	out = progressWriter(id, out)
+
+	ch := make(chan tea.Msg, 100)
+	var output []string
+	go func() {
+		if msg := WriteImage(image, device, ch)(); msg != nil {
+			ch <- msg
+		}
+	}()
+
+	var stop func()
+	aborting := false
+	err = func() error {
+		for {
+			select {
+			case msg := <-ch:
+				switch msg := msg.(type) {
+				case ProgressMsg:
+					fmt.Fprintln(out, stripANSI(string(msg)))
+					output = append(output, stripANSI(string(msg)))
+				case DDStartedMsg:
+					stop = func() {
+						if msg.Cancel != nil {
+							msg.Cancel()
+							return
+						}
+						_ = msg.Cmd.Process.Kill()
+						_ = msg.Pty.Close()
+					}
+					if aborting {
+						stop()
+						return ErrAborted
+					}
+				case DoneMsg:
+					if mode := verifyPolicy(cfg, image); mode != "none" && !msg.Verified {
+						stop = nil
+						go func() {
+							if msg := VerifyWrite(image, device, mode, ch)(); msg != nil {
+								ch <- msg
+							}
+						}()
+						break
+					}
+					if !msg.Plugins && hasPluginSteps(true) {
+						stop = nil
+						go func() {
+							if msg := RunPluginSteps(msg, true, ch)(); msg != nil {
+								ch <- msg
+							}
+						}()
+						break
+					}
+					clearSuspect(device)
+					return nil
+				case ErrorMsg:
+					return msg.Err
+				}
+			case <-abort:
+				abort = nil
+				writeAudit("abort", job)
+				// Before the write starts there is nothing to stop yet
+				aborting = true
+				if stop != nil {
+					stop()
+					return ErrAborted
+				}
+			}
+		}
+	}()
+
+	result := "success"
+	if errors.Is(err, ErrAborted) {
+		result = "aborted"
+	} else if err != nil {
+		result = "failure"
+		if hint, ok := diagnoseFailure(err, output); ok {
+			fmt.Fprint(out, hint.Text())
+		}
+	}
+	publishJobFinished(job, result, err, output)
+	if path, rerr := verifyReport(cfg, job, result, err); rerr != nil {
+		fmt.Fprintf(out, "Writing the verification report failed: %v\n", rerr)
+	} else if path != "" {
+		fmt.Fprintf(out, "Verification report written to %s\n", path)
+	}
+	if name, command, env := hookFor(cfg, job, result, err); command != "" {
+		fmt.Fprintf(out, "Running %s hook...\n", name)
+		hookChan := make(chan tea.Msg, 100)
+		RunHook(name, command, env, hookChan)()
+		for done := false; !done; {
+			switch msg := (<-hookChan).(type) {
+			case HookOutputMsg:
+				fmt.Fprintln(out, stripANSI(string(msg)))
+			case HookCompletedMsg:
+				if msg.Err != nil {
+					fmt.Fprintf(out, "%s hook failed: %v\n", msg.Name, msg.Err)
+				}
+				done = true
+			case ErrorMsg:
+				fmt.Fprintf(out, "%s hook failed: %v\n", name, msg.Err)
+				done = true
+			}
+		}
+	}
+	if result == "failure" {
+		return &JobError{Err: err, Output: output}
+	}
+	return err
+}
+
+// CheckImage checks the integrity of an image without the UI, for the verify
+// command, and reports whether it passed. Progress lines are written to out.
+// Closing abort stops the check.
+func CheckImage(image string, out io.Writer, abort <-chan struct{}) (bool, error) {
+	msg, err := runStreamed(func(ch chan tea.Msg) tea.Cmd { return CheckIntegrity(image, ch) }, out, abort)
+	if err != nil {
+		return false, err
+	}
+	return msg.(CheckCompletedMsg).Ok, nil
+}
+
+// ExtractImage decompresses an image to output without the UI, for the extract
+// command. Progress lines are written to out. Closing abort stops the
+// extraction, leaving no partial output behind.
+func ExtractImage(image, output string, out io.Writer, abort <-chan struct{}) error {
+	if _, err := os.Stat(output); err == nil {
+		fmt.Fprintf(out, "Output file %s already exists. Removing...\n", filepath.Base(output))
+		if err := os.Remove(output); err != nil {
+			return fmt.Errorf("failed to remove existing file: %v", err)
+		}
+	}
+	_, err := runStreamed(func(ch chan tea.Msg) tea.Cmd { return ExtractWithProgress(image, output, ch) }, out, abort)
+	return err
+}
+
+// runStreamed runs a check or an extraction, created to report on the given
+// channel, and prints its progress lines to out. It returns the message that
+// completed the job, a JobError when it failed, or ErrAborted once abort was
+// closed and the job stopped.
+func runStreamed(start func(chan tea.Msg) tea.Cmd, out io.Writer, abort <-chan struct{}) (tea.Msg, error) {
+	ch := make(chan tea.Msg, 100)
+	go func() {
+		if msg := start(ch)(); msg != nil {
+			ch <- msg
+		}
+	}()
+
+	var stop func()
+	var output []string
+	aborting := false
+	started := func(cancel func()) {
+		stop = cancel
+		if aborting {
+			stop()
+		}
+	}
+	for {
+		select {
+		case msg := <-ch:
+			switch msg := msg.(type) {
+			case ProgressMsg:
+				fmt.Fprintln(out, stripANSI(string(msg)))
+				output = append(output, stripANSI(string(msg)))
+			case CheckStartedMsg:
+				started(func() {
+					_ = msg.Cmd.Process.Kill()
+					_ = msg.Pty.Close()
+				})
+			case ExtractStartedMsg:
+				started(msg.Cancel)
+			case CheckCompletedMsg, ExtractCompletedMsg:
+				if aborting {
+					return nil, ErrAborted
+				}
+				return msg, nil
+			case ErrorMsg:
+				// A killed job reports its failure once it has cleaned up
+				if aborting {
+					return nil, ErrAborted
+				}
+				if hint, ok := diagnoseFailure(msg.Err, output); ok {
+					fmt.Fprint(out, hint.Text())
+				}
+				return nil, &JobError{Err: msg.Err, Output: output}
+			}
+		case <-abort:
+			abort = nil
+			aborting = true
+			if stop != nil {
+				stop()
+			}
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package ui
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// ErrorHint explains a known kind of failure and what to do about it.
+type ErrorHint struct {
+	Title       string
+	Explanation string
+	Steps       []string // suggested next steps, in order
+}
+
+// Failure is the last failed job and its hint, shown in the error panel.
+type Failure struct {
+	Hint ErrorHint
+	Err  error
+}
+
+// errorHints maps the signatures of common failures, found in the error or the
+// job's output, to their hints. The first match wins.
+var errorHints = []struct {
+	signature *regexp.Regexp
+	hint      ErrorHint
+}{
+	{
+		regexp.MustCompile(`(?i)write-protected|read-only file system|\bEROFS\b`),
+		ErrorHint{
+			Title:       "The card is write-protected",
+			Explanation: "The device refuses writes, usually because the lock switch of the SD card or its adapter is on.",
+			Steps:       []string{"Eject the card and slide its lock switch away from LOCK.", "Reinsert the card and flash again."},
+		},
+	},
+	{
+		regexp.MustCompile(`(?i)compressed data is corrupt|file format not recognized|unexpected end of input|compressed file error`),
+		ErrorHint{
+			Title:       "The image file is corrupt",
+			Explanation: "The compressed image could not be decompressed: it is damaged or was not downloaded completely.",
+			Steps:       []string{"Run Check on the image to confirm it.", "Download the image again and compare its checksum."},
+		},
+	},
+	{
+		regexp.MustCompile(`(?i)no space left on device|\bENOSPC\b`),
+		ErrorHint{
+			Title:       "Not enough space",
+			Explanation: "The image is larger than the card, or the disk holding the images filled up.",
+			Steps:       []string{"Use a larger card.", "Free up space in the image directory, e.g. with P to prune old images."},
+		},
+	},
+	{
+		regexp.MustCompile(`(?i)input/output error|\bEIO\b`),
+		ErrorHint{
+			Title:       "The card or the reader failed",
+			Explanation: "The device could not be read or written, which usually means a worn-out card or a loose reader.",
+			Steps:       []string{"Reseat the card and the reader, then try again.", "Try another card and retire this one if it fails again."},
+		},
+	},
+	{
+		regexp.MustCompile(`(?i)device or resource busy|target is busy|\bEBUSY\b`),
+		ErrorHint{
+			Title:       "The device is in use",
+			Explanation: "Something still has the device open, usually a mounted partition or another program writing to it.",
+			Steps:       []string{"Eject the card, reinsert it and try again.", "Make sure no other session or program is using the device."},
+		},
+	},
+	{
+		regexp.MustCompile(`(?i)changed since the flash was confirmed`),
+		ErrorHint{
+			Title:       "The device changed",
+			Explanation: "The device is not the one that was confirmed: its size, serial number or partition table changed, usually because cards were swapped.",
+			Steps:       []string{"Check which card is in the reader.", "Select the device again and flash again."},
+		},
+	},
+	{
+		regexp.MustCompile(`(?i)permission denied|operation not permitted|\bEACCES\b|\bEPERM\b`),
+		ErrorHint{
+			Title:       "Permission denied",
+			Explanation: "The flasher is not allowed to open the device or the file.",
+			Steps:       []string{"Run the flasher as root, e.g. with sudo.", "Check that the image directory is readable."},
+		},
+	},
+}
+
+// diagnoseFailure returns the hint for a failure, looking at its error and the
+// output of the job.
+func diagnoseFailure(err error, output []string) (ErrorHint, bool) {
+	text := strings.Join(output, "\n")
+	if err != nil {
+		text += "\n" + err.Error()
+	}
+	for _, h := range errorHints {
+		if h.signature.MatchString(text) {
+			return h.hint, true
+		}
+	}
+	return ErrorHint{}, false
+}
+
+// Text returns the hint as plain lines, for headless output.
+func (h ErrorHint) Text() string {
+	text := h.Title + ": " + h.Explanation + "\n"
+	for i, step := range h.Steps {
+		text += fmt.Sprintf("  %d. %s\n", i+1, step)
+	}
+	return text
+}
+
+// jobOutput returns the plain log lines of the last job, since its "> " line.
+func (m *Model) jobOutput() []string {
+	start := len(m.Logs)
+	for start > 0 && !strings.HasPrefix(stripANSI(m.Logs[start-1]), "> ") {
+		start--
+	}
+	lines := make([]string, 0, len(m.Logs)-start)
+	for _, line := range m.Logs[start:] {
+		lines = append(lines, stripANSI(line))
+	}
+	return lines
+}
+
+// diagnose shows the hint for a failed job in the error panel, and hides the
+// panel once a job succeeds.
+func (m *Model) diagnose(result string, err error) {
+	m.Failure = nil
+	if result != "failure" {
+		return
+	}
+	if hint, ok := diagnoseFailure(err, m.jobOutput()); ok {
+		m.Failure = &Failure{Hint: hint, Err: err}
+	}
+}
+
+// errorPanel renders the hint for the last failure in place of the info panel.
+func (m Model) errorPanel(width int) string {
+	f := m.Failure
+	title := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color(ColorError)).Render("✗ " + f.Hint.Title)
+	lines := []string{title, f.Hint.Explanation}
+	for i, step := range f.Hint.Steps {
+		lines = append(lines, fmt.Sprintf("  %d. %s", i+1, step))
+	}
+	if f.Err != nil {
+		lines = append(lines, lipgloss.NewStyle().Faint(true).Render(f.Err.Error()))
+	}
+	lines = append(lines, lipgloss.NewStyle().Faint(true).Render("E for the full output"))
+	return lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(lipgloss.Color(ColorError)).
+		Padding(0, 1).
+		Width(width).
+		Render(strings.Join(lines, "\n"))
+}
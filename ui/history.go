@@ -0,0 +1,109 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/husarion/husarion-os-flasher/internal/flash"
+	"github.com/husarion/husarion-os-flasher/internal/history"
+	"github.com/husarion/husarion-os-flasher/platform"
+)
+
+// HistoryPath returns the job history file of an image directory.
+func HistoryPath(osImgPath string) string {
+	return filepath.Join(crashDir(osImgPath), history.FileName)
+}
+
+// failuresDir keeps the output of failed jobs, in the log directory.
+const failuresDir = "failures"
+
+// recordHistory appends a finished job to the history file, with the output
+// of a failed job saved for the details view. It may block on asking the
+// platform for the device model.
+func recordHistory(job JobRecord, result string, jobErr error, output []string) {
+	crashState.Lock()
+	imgPath := crashState.imgPath
+	crashState.Unlock()
+	if imgPath == "" {
+		return
+	}
+
+	e := history.Entry{
+		Finished: time.Now(),
+		Kind:     job.Kind,
+		Image:    filepath.Base(job.Src),
+		Device:   job.Dst,
+		Result:   result,
+		Duration: time.Since(job.Started),
+		Operator: job.Operator,
+		Robot:    job.Robot,
+		Revision: job.RobotRevision,
+		Serial:   job.RobotSerial,
+		Clock:    clockMark(),
+	}
+	if job.Undervoltage {
+		e.Power = history.PowerUndervoltage
+	}
+	if jobErr != nil {
+		e.Error = jobErr.Error()
+	}
+	switch job.Kind {
+	case "flash":
+		e.Model = platform.Model(job.Dst)
+		e.Bytes, _ = flash.RawSize(job.Src)
+	case "burnin":
+		// Burn-ins qualify batches of cards, told apart by their model
+		e.Model = platform.Model(job.Dst)
+	}
+
+	if err := os.MkdirAll(crashDir(imgPath), 0755); err != nil {
+		return
+	}
+	if result == "failure" {
+		if name, err := writeFailure(imgPath, job, e, output); err != nil {
+			rememberLog(fmt.Sprintf("Error: saving the output of the failed job failed: %v", err))
+		} else {
+			e.Details = name
+		}
+	}
+	if err := history.Append(HistoryPath(imgPath), e); err != nil {
+		rememberLog(fmt.Sprintf("Error: recording the job history failed: %v", err))
+	}
+}
+
+// writeFailure saves the error and output of a failed job, and returns its
+// file name relative to the log directory.
+func writeFailure(imgPath string, job JobRecord, e history.Entry, output []string) (string, error) {
+	name := filepath.Join(failuresDir, fmt.Sprintf("%s-%s-%d.txt", job.Kind, e.Finished.Format("20060102-150405"), job.ID))
+	if err := os.MkdirAll(filepath.Join(crashDir(imgPath), failuresDir), 0755); err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, line := range EnvironmentInfo(imgPath, currentConfig()) {
+		b.WriteString(line + "\n")
+	}
+	b.WriteString("\n")
+	fmt.Fprintf(&b, "Job:      %s\n", job.Kind)
+	fmt.Fprintf(&b, "Image:    %s\n", job.Src)
+	fmt.Fprintf(&b, "Device:   %s\n", job.Dst)
+	fmt.Fprintf(&b, "Operator: %s\n", job.Operator)
+	fmt.Fprintf(&b, "Started:  %s\n", job.Started.Format(time.RFC3339))
+	fmt.Fprintf(&b, "Finished: %s\n", e.Finished.Format(time.RFC3339))
+	fmt.Fprintf(&b, "Error:    %s\n", e.Error)
+	if e.Power != "" {
+		fmt.Fprintf(&b, "Power:    %s during the job\n", e.Power)
+	}
+	recording := filepath.Join(crashDir(imgPath), recordingName(job))
+	if _, err := os.Stat(recording); err == nil {
+		fmt.Fprintf(&b, "Replay:   husarion-os-flasher replay %s\n", recording)
+	}
+	b.WriteString("\n")
+	for _, line := range output {
+		b.WriteString(line + "\n")
+	}
+	return name, os.WriteFile(filepath.Join(crashDir(imgPath), name), []byte(b.String()), 0644)
+}
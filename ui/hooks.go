@@ -0,0 +1,112 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/husarion/husarion-os-flasher/config"
+)
+
+// jobHook returns a command running the configured on_success or on_failure hook
+// for a finished job, or nil when no hook applies. result is "success", "failure"
+// or "aborted"; jobErr is the failure reason, if any. The wizard step, composite
+// part or duplicator slot running the job, if any, ends with it, and a failure
+// shows its hint in the error panel. The command also starts the next part or
+// slot.
+func (m *Model) jobHook(job JobRecord, ok bool, result string, jobErr error) tea.Cmd {
+	m.powerFinished(job, ok)
+	if ok {
+		m.writeVerifyReport(job, result, jobErr)
+	}
+	m.wizardStepFinished(result, jobErr)
+	m.diagnose(result, jobErr)
+	if ok {
+		go publishJobFinished(job, result, jobErr, m.jobOutput())
+	}
+	next := tea.Batch(m.compositePartFinished(result, jobErr), m.slotFinished(result, jobErr))
+	if !ok {
+		return next
+	}
+	name, command, env := hookFor(m.Config, job, result, jobErr)
+	if command == "" {
+		return next
+	}
+
+	if m.HookChan == nil {
+		m.HookChan = make(chan tea.Msg, 100)
+	}
+	m.AddLog(fmt.Sprintf("> Running %s hook...", name))
+	m.HookRunning++
+
+	// Only one listener is kept on the hook channel however many hooks run
+	if m.HookRunning > 1 {
+		return tea.Batch(next, RunHook(name, command, env, m.HookChan))
+	}
+	return tea.Batch(next, RunHook(name, command, env, m.HookChan), ListenProgress(m.HookChan))
+}
+
+// hookFor returns the hook configured for a finished job and its environment.
+// command is empty when no hook applies.
+func hookFor(cfg *config.Config, job JobRecord, result string, jobErr error) (name, command string, env []string) {
+	// Custom actions are user commands themselves and do not trigger hooks
+	if cfg == nil || job.Kind == "action" {
+		return "", "", nil
+	}
+
+	_, onSuccess, onFailure := liveConfig(cfg)
+	name, command = "on_success", onSuccess
+	if result != "success" {
+		name, command = "on_failure", onFailure
+	}
+	if command == "" {
+		return "", "", nil
+	}
+
+	env = []string{
+		"JOB=" + job.Kind,
+		"RESULT=" + result,
+		"IMAGE=" + job.Src,
+		"DEVICE=" + job.Dst,
+		"DURATION=" + strconv.Itoa(int(time.Since(job.Started).Seconds())),
+		"ROBOT_MODEL=" + job.Robot,
+		"ROBOT_REVISION=" + job.RobotRevision,
+		"ROBOT_SERIAL=" + job.RobotSerial,
+	}
+	if entry, found := loadIntegrityEntry(job.Src); found {
+		env = append(env, "CHECKSUM="+entry.Actual)
+	} else {
+		env = append(env, "CHECKSUM=")
+	}
+	if meta := LoadImageMeta(job.Src); meta != nil {
+		env = append(env, "IMAGE_VERSION="+meta.Version, "IMAGE_BUILD_DATE="+meta.BuildDate)
+	}
+	if jobErr != nil {
+		env = append(env, "ERROR="+jobErr.Error())
+	} else {
+		env = append(env, "ERROR=")
+	}
+	return name, command, env
+}
+
+// RunHook runs a hook command with bash -c, streaming its output as HookOutputMsg
+func RunHook(name, command string, env []string, hookChan chan tea.Msg) tea.Cmd {
+	return func() tea.Msg {
+		defer recoverJob(hookChan)
+
+		cmd := exec.Command("bash", "-c", command)
+		cmd.Env = append(os.Environ(), env...)
+
+		err := startStreamed(cmd, hookChan, func(line string) tea.Msg { return HookOutputMsg(name + ": " + line) },
+			func(*os.File) tea.Msg { return HookOutputMsg(name + " hook started") },
+			func(err error) tea.Msg { return HookCompletedMsg{Name: name, Err: err} })
+		if err != nil {
+			hookChan <- HookCompletedMsg{Name: name, Err: err}
+		}
+		return nil
+	}
+}
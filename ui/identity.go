@@ -0,0 +1,153 @@
+package ui
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/husarion/husarion-os-flasher/platform"
+	"github.com/husarion/husarion-os-flasher/util"
+)
+
+// deviceSnapshot is what the operator saw of a device when confirming a
+// flash, compared again right before it is written.
+type deviceSnapshot struct {
+	Size      int64
+	Serial    string
+	Signature string // partition table identifier, see partitionSignature
+}
+
+// snapshotDevice returns the current size, serial and partition signature of
+// a device.
+func snapshotDevice(device string) deviceSnapshot {
+	size, _ := platform.Current.DiskSize(device)
+	return deviceSnapshot{Size: size, Serial: platform.Serial(device), Signature: partitionSignature(device)}
+}
+
+// DeviceSnapshotMsg carries a snapshot of a device read off the UI, for a
+// flash confirmed before an approval dialog or an extraction.
+type DeviceSnapshotMsg struct {
+	Device   string
+	Snapshot deviceSnapshot
+}
+
+// snapshotCmd reads a snapshot of a device.
+func snapshotCmd(device string) tea.Cmd {
+	return func() tea.Msg {
+		return DeviceSnapshotMsg{Device: device, Snapshot: snapshotDevice(device)}
+	}
+}
+
+// keepSnapshot gives a snapshot read off the UI to the approval or chained
+// flash of its device still waiting for it.
+func (m *Model) keepSnapshot(msg DeviceSnapshotMsg) {
+	if a := m.Approval; a != nil && a.Device == msg.Device && a.Snapshot == nil {
+		a.Snapshot = &msg.Snapshot
+	}
+	if c := m.Chain; c != nil && c.Device == msg.Device && c.Snapshot == nil {
+		c.Snapshot = &msg.Snapshot
+	}
+}
+
+// partitionSignature identifies the partition table of a device: the disk
+// GUID of a GPT, the disk signature of an MBR, "none" without either and empty
+// when the device cannot be read. GPT headers are looked for after 512 and
+// 4096-byte sectors.
+func partitionSignature(device string) string {
+	f, err := os.Open(device)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	buf := make([]byte, 8192)
+	if _, err := io.ReadFull(f, buf); err != nil {
+		return ""
+	}
+	for _, lba := range []int{512, 4096} {
+		if string(buf[lba:lba+8]) == "EFI PART" {
+			return "GPT " + guidString(buf[lba+56:lba+72])
+		}
+	}
+	if buf[510] == 0x55 && buf[511] == 0xaa {
+		return fmt.Sprintf("MBR %08x", binary.LittleEndian.Uint32(buf[440:444]))
+	}
+	return "none"
+}
+
+// guidString formats a GUID stored in the mixed-endian layout of GPT.
+func guidString(b []byte) string {
+	return fmt.Sprintf("%08x-%04x-%04x-%s-%s",
+		binary.LittleEndian.Uint32(b[0:4]), binary.LittleEndian.Uint16(b[4:6]), binary.LittleEndian.Uint16(b[6:8]),
+		hex.EncodeToString(b[8:10]), hex.EncodeToString(b[10:16]))
+}
+
+// changes lists how now differs from s, leaving out what could not be read
+// either time.
+func (s deviceSnapshot) changes(now deviceSnapshot) []string {
+	var changes []string
+	if s.Size > 0 && now.Size != s.Size {
+		changes = append(changes, fmt.Sprintf("size was %s, now %s", util.FormatBytes(s.Size), util.FormatBytes(now.Size)))
+	}
+	if s.Serial != "" && now.Serial != s.Serial {
+		changes = append(changes, fmt.Sprintf("serial was %s, now %s", s.Serial, orUnknown(now.Serial)))
+	}
+	if s.Signature != "" && now.Signature != s.Signature {
+		changes = append(changes, fmt.Sprintf("partition table was %s, now %s", s.Signature, orUnknown(now.Signature)))
+	}
+	return changes
+}
+
+// orUnknown returns s, or "unknown" when it is empty.
+func orUnknown(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
+
+// confirmedState holds the snapshots of the devices whose flash was confirmed
+// and has not started writing yet, by device path.
+var confirmedState = struct {
+	sync.Mutex
+	devices map[string]deviceSnapshot
+}{devices: make(map[string]deviceSnapshot)}
+
+// confirmDevice records what a device looked like when its flash was
+// confirmed.
+func confirmDevice(device string, s deviceSnapshot) {
+	confirmedState.Lock()
+	defer confirmedState.Unlock()
+	confirmedState.devices[device] = s
+}
+
+// forgetDevice drops the confirmation of a device's flash.
+func forgetDevice(device string) {
+	confirmedState.Lock()
+	defer confirmedState.Unlock()
+	delete(confirmedState.devices, device)
+}
+
+// recheckDevice fails when a device changed since its flash was confirmed,
+// e.g. because the cards were swapped while the approval dialog was open. It
+// is called right before the device is opened for writing; writes that were
+// not confirmed in the UI, such as headless ones, are not checked.
+func recheckDevice(device string) error {
+	confirmedState.Lock()
+	s, ok := confirmedState.devices[device]
+	delete(confirmedState.devices, device)
+	confirmedState.Unlock()
+	if !ok {
+		return nil
+	}
+	if changes := s.changes(snapshotDevice(device)); len(changes) > 0 {
+		return fmt.Errorf("%s changed since the flash was confirmed (%s): nothing was written",
+			device, strings.Join(changes, "; "))
+	}
+	return nil
+}
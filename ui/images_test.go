@@ -0,0 +1,42 @@
+package ui
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestSplitCRLF(t *testing.T) {
+	input := "first\r 10%\r 20%\nlast"
+	scanner := bufio.NewScanner(strings.NewReader(input))
+	scanner.Split(splitCRLF)
+	var got []string
+	for scanner.Scan() {
+		got = append(got, scanner.Text())
+	}
+	want := []string{"first", " 10%", " 20%", "last"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("tokens = %q, want %q", got, want)
+	}
+}
+
+func FuzzProgressLines(f *testing.F) {
+	f.Add([]byte(" 1.02GiB 0:00:12 [85.3MiB/s] [=====>      ] 25% ETA 0:00:36\r"))
+	f.Add([]byte("\r\r\n\n"))
+	f.Add([]byte("xz: (stdin): Compressed data is corrupt\n"))
+	f.Add([]byte("\x1b[31merror\x1b[0m 50% 1B/s"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		scanner := bufio.NewScanner(strings.NewReader(string(data)))
+		scanner.Split(splitCRLF)
+
+		var m Model
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				m.AddLog(line)
+			}
+		}
+		if len(m.Logs) > strings.Count(string(data), "\r")+strings.Count(string(data), "\n")+1 {
+			t.Errorf("AddLog produced %d entries from %d input lines", len(m.Logs), strings.Count(string(data), "\n")+1)
+		}
+	})
+}
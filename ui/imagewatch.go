@@ -0,0 +1,169 @@
+package ui
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/husarion/husarion-os-flasher/internal/flash"
+)
+
+// imageSettleTime is how long a file must go unwritten before it is listed,
+// when its writer was not seen closing it.
+const imageSettleTime = 5 * time.Second
+
+// watchOp is what happened to a file of a watched directory.
+type watchOp int
+
+const (
+	watchWrite watchOp = iota // created or written to
+	watchDone                 // closed after writing, renamed in or removed
+	watchLost                 // the directory itself went away
+)
+
+// imageDir is the cached listing of an image directory.
+type imageDir struct {
+	watched bool                 // changes are reported by watchDir
+	gen     int                  // changes seen so far
+	listed  int                  // gen when images was listed
+	images  []string             // complete images
+	copying []string             // images still being written
+	writing map[string]time.Time // files being written, by their last write
+	changed chan struct{}        // closed on the next change
+}
+
+// imageDirState caches the listing of each image directory, shared by every
+// session, as the image list is refreshed every second. Where the directory
+// can be watched (inotify on Linux) it is only read again after it changed;
+// elsewhere it is read on every refresh. Files still being written are left
+// out until they are closed, or unwritten for imageSettleTime.
+var imageDirState = struct {
+	sync.Mutex
+	dirs map[string]*imageDir
+}{dirs: make(map[string]*imageDir)}
+
+// imageDirFor returns the state of a directory, watching it when possible.
+// It is called with imageDirState locked.
+func imageDirFor(dir string) *imageDir {
+	d, ok := imageDirState.dirs[dir]
+	if !ok {
+		d = &imageDir{gen: 1, writing: make(map[string]time.Time), changed: make(chan struct{})}
+		imageDirState.dirs[dir] = d
+	}
+	if !d.watched && watchDir(dir, func(path string, op watchOp) { imageDirEvent(dir, path, op) }) == nil {
+		d.watched = true
+		d.gen++
+	}
+	return d
+}
+
+// imageDirEvent records a change reported by watchDir. Writes only count the
+// first time, as a copy reports thousands of them.
+func imageDirEvent(dir, path string, op watchOp) {
+	imageDirState.Lock()
+	defer imageDirState.Unlock()
+	d := imageDirState.dirs[dir]
+	switch op {
+	case watchWrite:
+		_, known := d.writing[path]
+		d.writing[path] = time.Now()
+		if known {
+			return
+		}
+	case watchDone:
+		delete(d.writing, path)
+	case watchLost:
+		d.watched = false
+	}
+	d.gen++
+	close(d.changed)
+	d.changed = make(chan struct{})
+}
+
+// listImages returns the complete images of a directory, reading it only when
+// it changed since the last call. The images still being written, told by
+// their temporary name, their recent writes or a writer holding them open,
+// are left for copyingImages.
+func listImages(dir string) ([]string, error) {
+	imageDirState.Lock()
+	d := imageDirFor(dir)
+	now := time.Now()
+	for path, last := range d.writing {
+		if now.Sub(last) >= imageSettleTime {
+			delete(d.writing, path)
+			d.gen++
+		}
+	}
+	if d.watched && d.gen == d.listed {
+		images := d.images
+		imageDirState.Unlock()
+		return images, nil
+	}
+	gen, first := d.gen, d.listed == 0
+	imageDirState.Unlock()
+
+	images, err := flash.GetImageFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	copying := tempImages(dir)
+	open := openForWriting(images)
+
+	imageDirState.Lock()
+	defer imageDirState.Unlock()
+	var complete []string
+	for _, image := range images {
+		if _, ok := d.writing[image]; ok || open[image] {
+			copying = append(copying, image)
+			continue
+		}
+		// Without a watch, or for copies started before it, a recent
+		// modification time is all there is to go by
+		if !d.watched || first {
+			if info, err := os.Stat(image); err == nil && now.Sub(info.ModTime()) < imageSettleTime {
+				if d.watched {
+					d.writing[image] = info.ModTime()
+				}
+				copying = append(copying, image)
+				continue
+			}
+		}
+		complete = append(complete, image)
+	}
+	if d.gen == gen {
+		d.listed = gen
+	}
+	d.images, d.copying = complete, copying
+	return complete, nil
+}
+
+// copyingImages returns the images of a directory still being written, as of
+// the last listImages.
+func copyingImages(dir string) []string {
+	imageDirState.Lock()
+	defer imageDirState.Unlock()
+	if d, ok := imageDirState.dirs[dir]; ok {
+		return d.copying
+	}
+	return nil
+}
+
+// waitImageChange waits for the next change of a watched image directory, and
+// does nothing for directories that cannot be watched.
+func waitImageChange(dir string) tea.Cmd {
+	imageDirState.Lock()
+	d := imageDirFor(dir)
+	changed, watched := d.changed, d.watched
+	imageDirState.Unlock()
+	if !watched {
+		return nil
+	}
+	return func() tea.Msg {
+		<-changed
+		// Let a burst of changes, such as a sync, settle into one refresh
+		time.Sleep(100 * time.Millisecond)
+		return ImagesChangedMsg{}
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package ui
+
+import "errors"
+
+// watchDir is not supported: the image directory is read on every refresh.
+func watchDir(dir string, changed func(path string, op watchOp)) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,96 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/husarion/husarion-os-flasher/internal/instance"
+)
+
+// instanceState tracks whether this process holds the instance lock or only
+// monitors the process that does. It is shared by all sessions in the process.
+var instanceState = struct {
+	sync.Mutex
+	lock  *instance.Lock  // held lock, nil in monitor mode or without locking
+	path  string          // lock file watched in monitor mode
+	other instance.Status // last status published by the lock holder
+}{}
+
+// SetInstanceLock makes this process publish its running jobs through lock.
+func SetInstanceLock(lock *instance.Lock) {
+	instanceState.Lock()
+	defer instanceState.Unlock()
+	instanceState.lock = lock
+	instanceState.path = ""
+}
+
+// MonitorInstance starts read-only monitor mode: no job may be started while
+// another process holds the lock at path. Monitor mode ends once that process
+// exits and this one takes the lock over.
+func MonitorInstance(path string) {
+	instanceState.Lock()
+	defer instanceState.Unlock()
+	instanceState.path = path
+	instanceState.other, _ = instance.ReadStatus(path)
+}
+
+// monitorStatus returns the status of the process holding the lock and whether
+// this process is in monitor mode.
+func monitorStatus() (instance.Status, bool) {
+	instanceState.Lock()
+	defer instanceState.Unlock()
+	return instanceState.other, instanceState.path != ""
+}
+
+// errMonitoring returns the error for jobs refused in monitor mode, or nil.
+func errMonitoring() error {
+	if other, monitoring := monitorStatus(); monitoring {
+		return fmt.Errorf("another flasher instance (pid %d) controls the devices; this one only monitors", other.PID)
+	}
+	return nil
+}
+
+// pollInstance refreshes the status of the other instance in monitor mode and
+// takes the lock over once it is free, reading the journal the other process
+// left.
+func pollInstance() {
+	instanceState.Lock()
+	if instanceState.path == "" {
+		instanceState.Unlock()
+		return
+	}
+	lock, err := instance.Acquire(instanceState.path)
+	if errors.Is(err, instance.ErrLocked) {
+		instanceState.other, _ = instance.ReadStatus(instanceState.path)
+	}
+	if err != nil {
+		instanceState.Unlock()
+		return
+	}
+	instanceState.lock = lock
+	instanceState.path = ""
+	instanceState.other = instance.Status{}
+	instanceState.Unlock()
+
+	loadJournal()
+}
+
+// publishJobs publishes the running jobs for processes in monitor mode.
+func publishJobs() {
+	var jobs []string
+	for _, job := range RunningJobs() {
+		line := fmt.Sprintf("%s %s", job.Kind, filepath.Base(job.Src))
+		if job.Dst != "" {
+			line += " -> " + job.Dst
+		}
+		jobs = append(jobs, line)
+	}
+
+	instanceState.Lock()
+	defer instanceState.Unlock()
+	if instanceState.lock != nil {
+		_ = instanceState.lock.Publish(jobs)
+	}
+}
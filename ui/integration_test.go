@@ -0,0 +1,363 @@
+//go:build integration
+
+package ui
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// destructiveEnv must be set to "1" to run tests that attach loop devices and
+// write to them. Without it only the file-based pipelines are exercised.
+const destructiveEnv = "HUSARION_FLASHER_DESTRUCTIVE_TESTS"
+
+// pipelineTimeout bounds how long a single pipeline may run in tests.
+const pipelineTimeout = 2 * time.Minute
+
+// requireTools skips the test when any of the external tools are missing.
+func requireTools(t *testing.T, tools ...string) {
+	t.Helper()
+	for _, tool := range tools {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s not available: %v", tool, err)
+		}
+	}
+}
+
+// requireDestructive skips the test unless destructive tests were explicitly enabled.
+func requireDestructive(t *testing.T) {
+	t.Helper()
+	if os.Getenv(destructiveEnv) != "1" {
+		t.Skipf("set %s=1 to run loop device tests", destructiveEnv)
+	}
+	if os.Geteuid() != 0 {
+		t.Skip("loop device tests must run as root")
+	}
+	requireTools(t, "losetup")
+}
+
+// writeRandomImage creates an image file of the given size filled with random data.
+func writeRandomImage(t *testing.T, dir, name string, size int) (string, []byte) {
+	t.Helper()
+	data := make([]byte, size)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatalf("generating image data: %v", err)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("writing image: %v", err)
+	}
+	return path, data
+}
+
+// compressXZ compresses path with xz, keeping the original, and returns the .xz path.
+func compressXZ(t *testing.T, path string) string {
+	t.Helper()
+	if out, err := exec.Command("xz", "-k", "-T1", path).CombinedOutput(); err != nil {
+		t.Fatalf("xz -k %s: %v: %s", path, err, out)
+	}
+	return path + ".xz"
+}
+
+// compressZip stores path in a zip archive next to it, as vendors distribute
+// images, and returns the .zip path.
+func compressZip(t *testing.T, path string) string {
+	t.Helper()
+	archive := strings.TrimSuffix(path, filepath.Ext(path)) + ".zip"
+	out, err := os.Create(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	zw := zip.NewWriter(out)
+	w, err := zw.Create(filepath.Base(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return archive
+}
+
+// attachLoopDevice creates a sparse backing file and attaches it to a free loop device.
+func attachLoopDevice(t *testing.T, size int64) string {
+	t.Helper()
+	backing := filepath.Join(t.TempDir(), "loop.bin")
+	f, err := os.Create(backing)
+	if err != nil {
+		t.Fatalf("creating loop backing file: %v", err)
+	}
+	if err := f.Truncate(size); err != nil {
+		f.Close()
+		t.Fatalf("sizing loop backing file: %v", err)
+	}
+	f.Close()
+
+	out, err := exec.Command("losetup", "--find", "--show", backing).Output()
+	if err != nil {
+		t.Fatalf("losetup: %v", err)
+	}
+	dev := strings.TrimSpace(string(out))
+	t.Cleanup(func() {
+		_ = exec.Command("losetup", "-d", dev).Run()
+	})
+	return dev
+}
+
+// readPrefix reads the first n bytes of a file or device.
+func readPrefix(t *testing.T, path string, n int) []byte {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("opening %s: %v", path, err)
+	}
+	defer f.Close()
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(f, buf); err != nil {
+		t.Fatalf("reading %s: %v", path, err)
+	}
+	return buf
+}
+
+// runPipeline executes cmd and collects every message emitted on progressChan
+// until a terminal message arrives. The terminal message is returned separately.
+func runPipeline(t *testing.T, cmd tea.Cmd, progressChan chan tea.Msg) ([]tea.Msg, tea.Msg) {
+	t.Helper()
+	returned := make(chan tea.Msg, 1)
+	go func() { returned <- cmd() }()
+
+	var msgs []tea.Msg
+	deadline := time.After(pipelineTimeout)
+	for {
+		select {
+		case msg := <-returned:
+			// Commands return nil once their worker goroutine took over;
+			// anything else is an early failure.
+			if msg != nil {
+				return msgs, msg
+			}
+		case msg := <-progressChan:
+			switch msg.(type) {
+			case DoneMsg, ErrorMsg, ExtractCompletedMsg, CheckCompletedMsg:
+				return msgs, msg
+			}
+			msgs = append(msgs, msg)
+		case <-deadline:
+			t.Fatalf("pipeline did not finish within %v; messages so far: %v", pipelineTimeout, msgs)
+		}
+	}
+}
+
+// hasProgress reports whether any collected message is a ProgressMsg containing substr.
+func hasProgress(msgs []tea.Msg, substr string) bool {
+	for _, msg := range msgs {
+		if p, ok := msg.(ProgressMsg); ok && strings.Contains(string(p), substr) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestIntegrationExtract(t *testing.T) {
+	requireTools(t, "xz", "unzip")
+	for _, compress := range []func(*testing.T, string) string{compressXZ, compressZip} {
+		dir := t.TempDir()
+		raw, data := writeRandomImage(t, dir, "test.img", 4<<20)
+		compressed := compress(t, raw)
+		if err := os.Remove(raw); err != nil {
+			t.Fatal(err)
+		}
+		t.Run(filepath.Ext(compressed), func(t *testing.T) {
+			testExtract(t, compressed, raw, data)
+		})
+	}
+}
+
+func TestIntegrationExtractBrokenArchive(t *testing.T) {
+	requireTools(t, "xz")
+	dir := t.TempDir()
+	raw, _ := writeRandomImage(t, dir, "test.img", 4<<20)
+	archive, err := os.ReadFile(compressXZ(t, raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupt := append([]byte(nil), archive...)
+	corrupt[len(corrupt)/2] ^= 0xff
+	broken := map[string][]byte{"truncated.img.xz": archive[:len(archive)/2], "corrupt.img.xz": corrupt}
+	for name, content := range broken {
+		t.Run(name, func(t *testing.T) {
+			src := filepath.Join(dir, name)
+			if err := os.WriteFile(src, content, 0644); err != nil {
+				t.Fatal(err)
+			}
+			out := strings.TrimSuffix(src, ".xz")
+			ch := make(chan tea.Msg, 100)
+			_, final := runPipeline(t, ExtractWithProgress(src, out, ch), ch)
+			if _, ok := final.(ErrorMsg); !ok {
+				t.Fatalf("expected ErrorMsg, got %#v", final)
+			}
+			for _, path := range []string{out, out + ".part"} {
+				if _, err := os.Stat(path); !os.IsNotExist(err) {
+					t.Errorf("%s left behind: %v", filepath.Base(path), err)
+				}
+			}
+		})
+	}
+}
+
+// testExtract extracts compressed to raw and compares the result with data.
+func testExtract(t *testing.T, compressed, raw string, data []byte) {
+	t.Helper()
+	ch := make(chan tea.Msg, 100)
+	msgs, final := runPipeline(t, ExtractWithProgress(compressed, raw, ch), ch)
+
+	done, ok := final.(ExtractCompletedMsg)
+	if !ok {
+		t.Fatalf("expected ExtractCompletedMsg, got %#v", final)
+	}
+	if done.Src != compressed || done.Dst != raw {
+		t.Errorf("unexpected completion paths: %+v", done)
+	}
+	if !hasProgress(msgs, "Extraction complete") {
+		t.Errorf("missing completion progress message in %v", msgs)
+	}
+	if _, err := os.Stat(raw + ".part"); !os.IsNotExist(err) {
+		t.Errorf("temporary .part file left behind: %v", err)
+	}
+	got, err := os.ReadFile(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("extracted image differs from original")
+	}
+}
+
+func TestIntegrationCheckRawImage(t *testing.T) {
+	requireTools(t, "bash", "pv", "sha256sum")
+	dir := t.TempDir()
+	raw, data := writeRandomImage(t, dir, "test.img", 1<<20)
+	sum := sha256.Sum256(data)
+	if err := os.WriteFile(raw+".checksum", []byte(hex.EncodeToString(sum[:])+"  test.img\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ch := make(chan tea.Msg, 100)
+	_, final := runPipeline(t, CheckIntegrity(raw, ch), ch)
+
+	res, ok := final.(CheckCompletedMsg)
+	if !ok || !res.Ok {
+		t.Fatalf("expected successful CheckCompletedMsg, got %#v", final)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "integrity.yaml")); err != nil {
+		t.Errorf("integrity.yaml not written: %v", err)
+	}
+}
+
+func TestIntegrationCheckCorruptArchive(t *testing.T) {
+	requireTools(t, "bash", "xz", "pv", "sha256sum")
+	dir := t.TempDir()
+	raw, _ := writeRandomImage(t, dir, "test.img", 1<<20)
+	compressed := compressXZ(t, raw)
+
+	// Flip bytes in the middle of the stream to corrupt it.
+	b, err := os.ReadFile(compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := len(b) / 2; i < len(b)/2+16; i++ {
+		b[i] ^= 0xFF
+	}
+	if err := os.WriteFile(compressed, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ch := make(chan tea.Msg, 100)
+	_, final := runPipeline(t, CheckIntegrity(compressed, ch), ch)
+
+	res, ok := final.(CheckCompletedMsg)
+	if !ok {
+		t.Fatalf("expected CheckCompletedMsg, got %#v", final)
+	}
+	if res.Ok {
+		t.Error("corrupt archive passed integrity check")
+	}
+}
+
+func TestIntegrationFlashLoopDevice(t *testing.T) {
+	requireDestructive(t)
+	requireTools(t, "xz")
+
+	const imageSize = 8 << 20
+	dir := t.TempDir()
+	raw, data := writeRandomImage(t, dir, "test.img", imageSize)
+	compressed := compressXZ(t, raw)
+	zipped := compressZip(t, raw)
+
+	for _, src := range []string{raw, compressed, zipped} {
+		t.Run(filepath.Base(src), func(t *testing.T) {
+			dev := attachLoopDevice(t, 4*imageSize)
+
+			ch := make(chan tea.Msg, 100)
+			msgs, final := runPipeline(t, WriteImage(src, dev, ch), ch)
+
+			done, ok := final.(DoneMsg)
+			if !ok {
+				t.Fatalf("expected DoneMsg, got %#v", final)
+			}
+			if done.Src != src || done.Dst != dev {
+				t.Errorf("unexpected done paths: %+v", done)
+			}
+			if !hasProgress(msgs, "Sync completed successfully") {
+				t.Errorf("missing sync message in %v", msgs)
+			}
+			if got := readPrefix(t, dev, imageSize); !bytes.Equal(got, data) {
+				t.Error("device content differs from image")
+			}
+		})
+	}
+	// A broken archive fails the flash: its decompressor exits with an error
+	// after writing what it could
+	archive, err := os.ReadFile(compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupt := append([]byte(nil), archive...)
+	corrupt[len(corrupt)/2] ^= 0xff
+	broken := map[string][]byte{"truncated.img.xz": archive[:len(archive)/2], "corrupt.img.xz": corrupt}
+	for name, content := range broken {
+		t.Run(name, func(t *testing.T) {
+			src := filepath.Join(dir, name)
+			if err := os.WriteFile(src, content, 0644); err != nil {
+				t.Fatal(err)
+			}
+			dev := attachLoopDevice(t, 4*imageSize)
+
+			ch := make(chan tea.Msg, 100)
+			_, final := runPipeline(t, WriteImage(src, dev, ch), ch)
+			if _, ok := final.(ErrorMsg); !ok {
+				t.Fatalf("expected ErrorMsg, got %#v", final)
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// journalFile records the running jobs on disk, synced before and after every
+// job, so that after a power loss the next start knows what was being written.
+const journalFile = "journal.yaml"
+
+// SuspectDevice is a device whose write was cut short. Its contents are unknown
+// until it is flashed again.
+type SuspectDevice struct {
+	Device string    `yaml:"device"`
+	Image  string    `yaml:"image"`
+	Since  time.Time `yaml:"since"` // start of the interrupted write
+}
+
+// journal is the content of the journal file.
+type journal struct {
+	Running []JobRecord     `yaml:"running,omitempty"`
+	Suspect []SuspectDevice `yaml:"suspect,omitempty"`
+}
+
+// journalState is the journal of the process, shared by all sessions.
+var journalState = struct {
+	sync.Mutex
+	loaded  bool
+	suspect []SuspectDevice
+	lost    []JobRecord // jobs found running at start, until a session takes them
+}{}
+
+// loadJournal reads the journal left by the previous process, once. Jobs that
+// were still running were cut short: the devices they wrote become suspect and
+// partial extractions and backups are removed. It must not run while another process holds
+// the instance lock, as that process's jobs are still running.
+func loadJournal() {
+	if errMonitoring() != nil {
+		return
+	}
+	crashState.Lock()
+	imgPath := crashState.imgPath
+	crashState.Unlock()
+
+	journalState.Lock()
+	if journalState.loaded || imgPath == "" {
+		journalState.Unlock()
+		return
+	}
+	journalState.loaded = true
+
+	var j journal
+	if b, err := os.ReadFile(filepath.Join(crashDir(imgPath), journalFile)); err == nil {
+		_ = yaml.Unmarshal(b, &j)
+	}
+	journalState.suspect = j.Suspect
+	for _, job := range j.Running {
+		switch job.Kind {
+		case "flash", "burnin", "action":
+			if job.Dst != "" {
+				journalState.suspect = append(journalState.suspect,
+					SuspectDevice{Device: job.Dst, Image: job.Src, Since: job.Started})
+			}
+		case "extract":
+			_ = os.Remove(job.Dst + ".part")
+		case "backup":
+			_ = os.Remove(job.Src + ".part")
+		}
+	}
+	journalState.lost = j.Running
+	journalState.Unlock()
+
+	writeJournal()
+}
+
+// takeLostJobs returns the jobs cut short in the previous process. Only the
+// first session gets them.
+func takeLostJobs() []JobRecord {
+	journalState.Lock()
+	defer journalState.Unlock()
+	lost := journalState.lost
+	journalState.lost = nil
+	return lost
+}
+
+// suspectDevice returns the record of a suspect device.
+func suspectDevice(device string) (SuspectDevice, bool) {
+	journalState.Lock()
+	defer journalState.Unlock()
+	for _, s := range journalState.suspect {
+		if s.Device == device {
+			return s, true
+		}
+	}
+	return SuspectDevice{}, false
+}
+
+// clearSuspect forgets that a device is suspect, once it was written completely.
+func clearSuspect(device string) {
+	journalState.Lock()
+	kept := journalState.suspect[:0]
+	for _, s := range journalState.suspect {
+		if s.Device != device {
+			kept = append(kept, s)
+		}
+	}
+	journalState.suspect = kept
+	journalState.Unlock()
+
+	writeJournal()
+}
+
+// writeJournal replaces the journal with the running jobs and suspect devices,
+// syncing it to disk before returning.
+func writeJournal() {
+	crashState.Lock()
+	imgPath := crashState.imgPath
+	var j journal
+	for _, job := range crashState.jobs {
+		j.Running = append(j.Running, job)
+	}
+	crashState.Unlock()
+	if imgPath == "" || errMonitoring() != nil {
+		return
+	}
+
+	journalState.Lock()
+	defer journalState.Unlock()
+	if !journalState.loaded {
+		return
+	}
+	j.Suspect = journalState.suspect
+
+	dir := crashDir(imgPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return
+	}
+	if err := writeSynced(filepath.Join(dir, journalFile), j); err != nil {
+		rememberLog(fmt.Sprintf("Error: writing the journal failed: %v", err))
+	}
+}
+
+// writeSynced atomically replaces path with v as YAML, syncing the file and its
+// directory so the change survives a power loss.
+func writeSynced(path string, v any) error {
+	out, err := yaml.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(out); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	if d, err := os.Open(filepath.Dir(path)); err == nil {
+		_ = d.Sync()
+		d.Close()
+	}
+	return nil
+}
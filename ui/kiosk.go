@@ -0,0 +1,50 @@
+package ui
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/husarion/husarion-os-flasher/util"
+)
+
+// KioskIdleTimeout is how long a kiosk stays without input before the idle
+// screen is shown. Running jobs keep the main screen up.
+const KioskIdleTimeout = 5 * time.Minute
+
+// idle reports whether the kiosk idle screen should be shown.
+func (m Model) idle() bool {
+	return m.Kiosk && !m.Busy() && !m.LastInput.IsZero() && time.Since(m.LastInput) > KioskIdleTimeout
+}
+
+// wake records user input. It reports whether the input only woke the kiosk from
+// its idle screen, in which case it must not be acted on.
+func (m *Model) wake() bool {
+	wasIdle := m.idle()
+	m.LastInput = time.Now()
+	return wasIdle
+}
+
+// renderIdle renders the branded screen shown while a kiosk is idle.
+func (m Model) renderIdle() string {
+	styles := Styles()
+	header := styles.Header.Padding(0, 2).Render(" Husarion OS Flasher ")
+
+	devices := len(m.DeviceList.Items())
+	images := len(m.ImageList.Items())
+	body := lipgloss.NewStyle().
+		Foreground(lipgloss.Color(ColorWhite)).
+		Padding(1, 4).
+		Align(lipgloss.Center).
+		Render(fmt.Sprintf("%d image(s) • %d device(s) connected\n\nPress any key to start", images, devices))
+	footer := styles.FooterStyle.Render(util.Version)
+
+	return lipgloss.Place(
+		m.Width,
+		m.Height,
+		lipgloss.Center,
+		lipgloss.Center,
+		lipgloss.JoinVertical(lipgloss.Center, header, styles.Container.Render(body), footer),
+	)
+}
@@ -0,0 +1,179 @@
+package ui
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"gopkg.in/yaml.v3"
+)
+
+// layoutFile keeps the layout preferences of each terminal size class, next to
+// the job history.
+const layoutFile = "layout.yaml"
+
+// DefaultLogLines is the height of the log viewport unless chosen otherwise.
+const DefaultLogLines = 7
+
+// minLogLines is the smallest the log viewport can be made.
+const minLogLines = 3
+
+// Layout is how the screen is arranged, remembered per terminal size class so
+// that a small SSH window and the console each keep their own.
+type Layout struct {
+	Lists    string `yaml:"lists,omitempty"`     // "horizontal", "vertical" or empty to follow the width
+	LogLines int    `yaml:"log_lines,omitempty"` // log viewport height, 0 for DefaultLogLines
+	Compact  bool   `yaml:"compact,omitempty"`   // hides the info panel and the scroll indicator
+}
+
+// logDrag is where a drag of the log viewport's top border started.
+type logDrag struct {
+	y     int // row the border was grabbed at
+	lines int // height of the viewport then
+}
+
+// sizeClass groups terminal sizes that share a layout.
+func sizeClass(width, height int) string {
+	switch {
+	case width < 100 || height < 30:
+		return "small"
+	case width < 160 || height < 50:
+		return "medium"
+	}
+	return "large"
+}
+
+// layoutState holds the layouts of the process, loaded once from the layout
+// file and shared by all sessions.
+var layoutState = struct {
+	sync.Mutex
+	loaded  bool
+	layouts map[string]Layout
+}{}
+
+// loadLayout returns the layout remembered for a size class.
+func loadLayout(osImgPath, class string) Layout {
+	layoutState.Lock()
+	defer layoutState.Unlock()
+	if !layoutState.loaded {
+		layoutState.loaded = true
+		layoutState.layouts = map[string]Layout{}
+		if b, err := os.ReadFile(filepath.Join(crashDir(osImgPath), layoutFile)); err == nil {
+			_ = yaml.Unmarshal(b, &layoutState.layouts)
+		}
+	}
+	return layoutState.layouts[class]
+}
+
+// saveLayout remembers the layout of a size class. Failing to write it only
+// loses the preference.
+func saveLayout(osImgPath, class string, l Layout) {
+	layoutState.Lock()
+	defer layoutState.Unlock()
+	if layoutState.layouts == nil {
+		layoutState.layouts = map[string]Layout{}
+	}
+	layoutState.layouts[class] = l
+	b, err := yaml.Marshal(layoutState.layouts)
+	if err != nil || os.MkdirAll(crashDir(osImgPath), 0755) != nil {
+		return
+	}
+	_ = os.WriteFile(filepath.Join(crashDir(osImgPath), layoutFile), b, 0644)
+}
+
+// applyLayout switches to the layout remembered for the current terminal size.
+func (m *Model) applyLayout() {
+	m.LayoutClass = sizeClass(m.Width, m.Height)
+	m.Layout = loadLayout(m.OsImgPath, m.LayoutClass)
+	m.Viewport.Height = min(m.logLines(), m.maxLogLines())
+}
+
+// logLines returns the height of the log viewport.
+func (m *Model) logLines() int {
+	if m.Layout.LogLines > 0 {
+		return m.Layout.LogLines
+	}
+	return DefaultLogLines
+}
+
+// verticalLists reports whether the device and image lists are stacked.
+func (m *Model) verticalLists() bool {
+	switch m.Layout.Lists {
+	case "vertical":
+		return true
+	case "horizontal":
+		return false
+	}
+	return m.Width < 80
+}
+
+// ToggleLists stacks the lists or puts them side by side, and remembers it.
+func (m *Model) ToggleLists() {
+	if m.verticalLists() {
+		m.Layout.Lists = "horizontal"
+	} else {
+		m.Layout.Lists = "vertical"
+	}
+	saveLayout(m.OsImgPath, m.LayoutClass, m.Layout)
+	m.AddLog("Lists are now " + m.Layout.Lists + " in " + m.LayoutClass + " terminals.")
+}
+
+// ToggleCompact hides or shows the info panel, and remembers it.
+func (m *Model) ToggleCompact() {
+	m.Layout.Compact = !m.Layout.Compact
+	saveLayout(m.OsImgPath, m.LayoutClass, m.Layout)
+	if m.Layout.Compact {
+		m.AddLog("Compact mode on in " + m.LayoutClass + " terminals.")
+	} else {
+		m.AddLog("Compact mode off in " + m.LayoutClass + " terminals.")
+	}
+}
+
+// maxLogLines is the largest the log viewport can be made, leaving room for
+// the rest of the last render, or 20 rows before the first.
+func (m *Model) maxLogLines() int {
+	chrome := 20
+	if m.info != nil && m.info.chrome > 0 {
+		chrome = m.info.chrome
+	}
+	return max(m.Height-chrome, DefaultLogLines)
+}
+
+// setLogLines resizes the log viewport within its bounds.
+func (m *Model) setLogLines(n int) {
+	n = min(max(n, minLogLines), m.maxLogLines())
+	m.Layout.LogLines = n
+	m.Viewport.Height = n
+	m.Viewport.SetYOffset(m.Viewport.YOffset)
+}
+
+// ResizeLog grows or shrinks the log viewport by delta lines, and remembers its
+// height.
+func (m *Model) ResizeLog(delta int) {
+	m.setLogLines(m.logLines() + delta)
+	saveLayout(m.OsImgPath, m.LayoutClass, m.Layout)
+}
+
+// dragLogBorder resizes the log viewport while its top border is dragged with
+// the left button, and remembers its height on release. It reports whether the
+// mouse event was used.
+func (m *Model) dragLogBorder(msg tea.MouseMsg) bool {
+	switch {
+	case msg.Action == tea.MouseActionPress && msg.Button == tea.MouseButtonLeft:
+		z := m.Zones.Get("viewport-view")
+		if z == nil || z.IsZero() || msg.Y != z.StartY || msg.X < z.StartX || msg.X > z.EndX {
+			return false
+		}
+		m.LogDrag = &logDrag{y: msg.Y, lines: m.logLines()}
+		return true
+	case m.LogDrag == nil:
+		return false
+	case msg.Action == tea.MouseActionMotion:
+		m.setLogLines(m.LogDrag.lines + m.LogDrag.y - msg.Y)
+		return true
+	}
+	m.LogDrag = nil
+	saveLayout(m.OsImgPath, m.LayoutClass, m.Layout)
+	return true
+}
@@ -0,0 +1,92 @@
+package ui
+
+import (
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/husarion/husarion-os-flasher/internal/flash"
+	"github.com/husarion/husarion-os-flasher/platform"
+)
+
+// DeviceInfo is a device as the device list shows it, for scripts.
+type DeviceInfo struct {
+	Path        string `json:"path"`
+	Description string `json:"description"`
+	Size        int64  `json:"size"` // 0 when unknown
+	Model       string `json:"model,omitempty"`
+	Serial      string `json:"serial,omitempty"`
+	ReadOnly    bool   `json:"read_only"`
+	Suspect     bool   `json:"suspect"` // a previous write to it was cut short
+}
+
+// ImageInfo is an image as the image list shows it, for scripts.
+type ImageInfo struct {
+	Name        string `json:"name"`
+	Path        string `json:"path"`
+	Description string `json:"description"`
+	Size        int64  `json:"size"`               // of the file
+	RawSize     int64  `json:"raw_size,omitempty"` // once written, 0 when unknown
+	Compressed  bool   `json:"compressed"`
+	Version     string `json:"version,omitempty"`
+	Robot       string `json:"robot,omitempty"`
+	Recommended bool   `json:"recommended"` // built for the target robot
+}
+
+// ListDevices returns the devices that can be flashed without starting the UI.
+// Suspect devices are taken from the journal of osImgPath, which is left as it
+// is.
+func ListDevices(osImgPath string) ([]DeviceInfo, error) {
+	devices, err := platform.Current.Devices()
+	if err != nil {
+		return nil, err
+	}
+	var j journal
+	if b, err := os.ReadFile(filepath.Join(crashDir(osImgPath), journalFile)); err == nil {
+		_ = yaml.Unmarshal(b, &j)
+	}
+
+	infos := make([]DeviceInfo, 0, len(devices))
+	for _, dev := range devices {
+		info := DeviceInfo{Path: dev, Model: platform.Model(dev), Serial: platform.Serial(dev)}
+		if size, err := platform.Current.DiskSize(dev); err == nil {
+			info.Size = size
+		}
+		info.ReadOnly, _ = platform.ReadOnly(dev)
+		for _, s := range j.Suspect {
+			if s.Device == dev {
+				info.Suspect = true
+			}
+		}
+		info.Description = deviceDescription(info.Suspect)
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// ListImages returns the images of osImgPath without starting the UI, marking
+// those built for the target robot.
+func ListImages(osImgPath, target string) ([]ImageInfo, error) {
+	images, err := ImageFiles(osImgPath)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]ImageInfo, 0, len(images))
+	for _, img := range images {
+		info := ImageInfo{Name: filepath.Base(img), Path: img, Compressed: flash.IsCompressed(img)}
+		if st, err := os.Stat(img); err == nil {
+			info.Size = st.Size()
+		}
+		if size, ok := flash.RawSize(img); ok {
+			info.RawSize = size
+		}
+		if meta := LoadImageMeta(img); meta != nil {
+			info.Version = meta.Version
+			info.Robot = meta.Robot
+		}
+		info.Description, info.Recommended = imageDescription(img, target)
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
@@ -0,0 +1,203 @@
+package ui
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/husarion/husarion-os-flasher/config"
+	"github.com/husarion/husarion-os-flasher/internal/flash"
+)
+
+// maintenanceLogFile receives the output of maintenance runs, next to crash reports.
+const maintenanceLogFile = "maintenance.log"
+
+// maintenanceStep is one task of a maintenance run.
+type maintenanceStep struct {
+	name        string // shown in the banner
+	reorganizes bool   // changes the image directory, so flashing must wait
+	run         func(log io.Writer) error
+}
+
+// maintenanceState is shared by all sessions in the process so the nightly run
+// happens once however many consoles are open.
+var maintenanceState = struct {
+	sync.Mutex
+	step    *maintenanceStep // running step, nil when idle
+	lastRun time.Time        // start of the window the last run belonged to
+}{}
+
+// maintenanceSteps returns the tasks of a maintenance run, in order.
+func maintenanceSteps(osImgPath string, cfg *config.Config) []maintenanceStep {
+	mt := cfg.Maintenance
+	var steps []maintenanceStep
+	if mt.Sync != "" && !cfg.Offline {
+		steps = append(steps, maintenanceStep{
+			name:        "syncing images",
+			reorganizes: true,
+			run: func(log io.Writer) error {
+				cmd := exec.Command("bash", "-c", mt.Sync)
+				cmd.Env = append(os.Environ(), "OS_IMG_PATH="+osImgPath)
+				if cfg.Proxy != "" {
+					cmd.Env = append(cmd.Env, proxyEnv(cfg.Proxy)...)
+				}
+				cmd.Stdout = log
+				cmd.Stderr = log
+				return cmd.Run()
+			},
+		})
+	}
+	if mt.Prune && cfg.Retention != nil {
+		steps = append(steps, maintenanceStep{
+			name:        "pruning old images",
+			reorganizes: true,
+			run: func(log io.Writer) error {
+				plan, err := planPrune(osImgPath, cfg.Retention)
+				if err != nil {
+					return err
+				}
+				for _, c := range plan {
+					fmt.Fprintf(log, "pruning %s: %s\n", c.Image, strings.Join(c.Files, " "))
+				}
+				return flash.Prune(plan)
+			},
+		})
+	}
+	if mt.RecompressXZ {
+		steps = append(steps, maintenanceStep{
+			name:        "recompressing images",
+			reorganizes: true,
+			run: func(log io.Writer) error {
+				return recompressImages(osImgPath, log)
+			},
+		})
+	}
+	return steps
+}
+
+// recompressImages recompresses the single-block xz images of the image
+// directory in blocks, so that flashing them decompresses on every core.
+// Images that cannot be recompressed are logged and skipped.
+func recompressImages(osImgPath string, log io.Writer) error {
+	images, err := flash.GetImageFiles(osImgPath)
+	if err != nil {
+		return err
+	}
+	for _, img := range images {
+		if !flash.IsXZ(img) || flash.IsSplit(img) {
+			continue
+		}
+		if blocks, ok := flash.XZBlocks(img); !ok || blocks > 1 {
+			continue
+		}
+		fmt.Fprintf(log, "recompressing %s\n", img)
+		// The new archive has other bytes: its recorded SHA-256 and check no
+		// longer hold, and it keeps the image's mtime, so drop them
+		forget := func() error {
+			return updateIntegrityEntry(img, func(e IntegrityEntry) IntegrityEntry {
+				return IntegrityEntry{RawSize: e.RawSize, RawSizeOf: e.RawSizeOf}
+			})
+		}
+		if err := flash.RecompressXZ(img, log, forget, prioritize); err != nil {
+			fmt.Fprintf(log, "not recompressed: %v\n", err)
+		}
+	}
+	return nil
+}
+
+// proxyEnv returns the environment variables pointing curl, wget, rsync and
+// the like at proxy.
+func proxyEnv(proxy string) []string {
+	var env []string
+	for _, name := range []string{"http_proxy", "https_proxy", "HTTP_PROXY", "HTTPS_PROXY"} {
+		env = append(env, name+"="+proxy)
+	}
+	return env
+}
+
+// maybeStartMaintenance starts the maintenance run when the configured window
+// is open, it has not run in this window yet, no job is running in any session
+// and this process controls the devices. It is called on every tick.
+func maybeStartMaintenance(osImgPath string, cfg *config.Config, now time.Time) {
+	if cfg == nil || cfg.Maintenance == nil || errMonitoring() != nil {
+		return
+	}
+	windowStart, open := cfg.Maintenance.WindowStart(now)
+	if !open {
+		return
+	}
+
+	crashState.Lock()
+	jobsRunning := len(crashState.jobs) > 0
+	crashState.Unlock()
+	if jobsRunning {
+		return
+	}
+
+	maintenanceState.Lock()
+	defer maintenanceState.Unlock()
+	if maintenanceState.step != nil || !maintenanceState.lastRun.Before(windowStart) {
+		return
+	}
+	maintenanceState.lastRun = windowStart
+
+	steps := maintenanceSteps(osImgPath, cfg)
+	if len(steps) == 0 {
+		return
+	}
+	maintenanceState.step = &steps[0]
+	go runMaintenance(osImgPath, steps)
+}
+
+// runMaintenance runs the steps in order, logging to the maintenance log.
+func runMaintenance(osImgPath string, steps []maintenanceStep) {
+	defer func() {
+		maintenanceState.Lock()
+		maintenanceState.step = nil
+		maintenanceState.Unlock()
+	}()
+
+	log := io.Discard
+	if err := os.MkdirAll(crashDir(osImgPath), 0755); err == nil {
+		if f, err := os.OpenFile(filepath.Join(crashDir(osImgPath), maintenanceLogFile),
+			os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644); err == nil {
+			defer f.Close()
+			log = f
+		}
+	}
+
+	for i := range steps {
+		maintenanceState.Lock()
+		maintenanceState.step = &steps[i]
+		maintenanceState.Unlock()
+
+		fmt.Fprintf(log, "%s %s\n", time.Now().Format(time.RFC3339), steps[i].name)
+		if err := steps[i].run(log); err != nil {
+			fmt.Fprintf(log, "%s %s failed: %v\n", time.Now().Format(time.RFC3339), steps[i].name, err)
+		}
+	}
+	fmt.Fprintf(log, "%s maintenance finished\n", time.Now().Format(time.RFC3339))
+}
+
+// maintenanceStatus returns the running maintenance step, if any, and whether it
+// reorganizes the image directory.
+func maintenanceStatus() (name string, reorganizes bool) {
+	maintenanceState.Lock()
+	defer maintenanceState.Unlock()
+	if maintenanceState.step == nil {
+		return "", false
+	}
+	return maintenanceState.step.name, maintenanceState.step.reorganizes
+}
+
+// maintenanceBlocksImages reports whether jobs that read or write the image
+// directory (flash and extract) must wait for maintenance.
+func maintenanceBlocksImages() bool {
+	_, reorganizes := maintenanceStatus()
+	return reorganizes
+}
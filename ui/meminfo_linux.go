@@ -0,0 +1,54 @@
+package ui
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// meminfo returns the named fields of /proc/meminfo in bytes, reporting whether
+// all of them were found.
+func meminfo(names ...string) (map[string]int64, bool) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+
+	all := map[string]int64{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// e.g. "Dirty:             1234 kB"
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		if kb, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+			all[strings.TrimSuffix(fields[0], ":")] = kb << 10
+		}
+	}
+
+	values := map[string]int64{}
+	for _, name := range names {
+		v, ok := all[name]
+		if !ok {
+			return nil, false
+		}
+		values[name] = v
+	}
+	return values, true
+}
+
+// pendingWriteback returns how many bytes of the page cache are dirty or being
+// written back.
+func pendingWriteback() (int64, bool) {
+	v, ok := meminfo("Dirty", "Writeback")
+	return v["Dirty"] + v["Writeback"], ok
+}
+
+// availableMemory returns the memory available without swapping and the total.
+func availableMemory() (available, total int64, ok bool) {
+	v, ok := meminfo("MemAvailable", "MemTotal")
+	return v["MemAvailable"], v["MemTotal"], ok
+}
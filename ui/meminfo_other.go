@@ -0,0 +1,14 @@
+//go:build !linux
+
+package ui
+
+// pendingWriteback is not known: the sync is only reported as it starts and
+// ends.
+func pendingWriteback() (int64, bool) {
+	return 0, false
+}
+
+// availableMemory is not known: memory is not watched.
+func availableMemory() (available, total int64, ok bool) {
+	return 0, 0, false
+}
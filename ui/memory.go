@@ -0,0 +1,29 @@
+package ui
+
+import (
+	"fmt"
+
+	"github.com/husarion/husarion-os-flasher/util"
+)
+
+// lowMemory is the available memory below which jobs warn: a tenth of the
+// total, and at least 64 MiB.
+func lowMemory(total int64) int64 {
+	return max(total/10, 64<<20)
+}
+
+// checkMemory warns when memory runs low while a job runs, as on a 512 MB
+// Raspberry Pi whose page cache filled up with the image. It warns again only
+// once memory recovered.
+func (m *Model) checkMemory() {
+	available, total, ok := availableMemory()
+	if !ok {
+		return
+	}
+	low := available < lowMemory(total)
+	if low && !m.LowMemory && m.Busy() {
+		m.AddLog(fmt.Sprintf("Warning: only %s of %s memory is available; close other programs or the station may run out of memory.",
+			util.FormatBytes(available), util.FormatBytes(total)))
+	}
+	m.LowMemory = low
+}
@@ -3,9 +3,13 @@ package ui
 import (
 	"os"
 	"os/exec"
+	"strings"
+	"sync"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/husarion/husarion-os-flasher/internal/flash"
 )
 
 // Message types for the UI
@@ -15,8 +19,10 @@ type (
 	
 	// DoneMsg is sent when flashing is complete
 	DoneMsg struct {
-		Src string
-		Dst string
+		Src      string
+		Dst      string
+		Verified bool // the verify policy's check passed
+		Plugins  bool // the plugins' verify and post_flash steps ran
 	}
 	
 	// ErrorMsg is sent when an error occurs
@@ -24,11 +30,17 @@ type (
 	
 	// TickMsg is sent periodically to update UI
 	TickMsg time.Time
+
+	// ImagesChangedMsg is sent when an image was added to, finished copying
+	// to or removed from a watched image directory
+	ImagesChangedMsg struct{}
 	
-	// DDStartedMsg carries the dd command pointer for aborting
+	// DDStartedMsg carries what aborts a flash: the command of a pipeline, or
+	// Cancel for the in-process writes.
 	DDStartedMsg struct {
-		Cmd *exec.Cmd
-		Pty *os.File
+		Cmd    *exec.Cmd
+		Pty    *os.File
+		Cancel func()
 	}
 	
 	// EEPROMConfigMsg is sent with EEPROM configuration results
@@ -45,10 +57,9 @@ type (
 		Dst string
 	}
 	
-	// ExtractStartedMsg is sent when extraction starts
+	// ExtractStartedMsg is sent when extraction starts, with what aborts it
 	ExtractStartedMsg struct {
-		Cmd *exec.Cmd
-		Pty *os.File
+		Cancel func()
 	}
 
 	// CheckStartedMsg is sent when integrity check starts
@@ -57,6 +68,63 @@ type (
 		Pty *os.File
 	}
 
+	// FirmwareStartedMsg is sent when a firmware tool starts
+	FirmwareStartedMsg struct {
+		Cmd *exec.Cmd
+		Pty *os.File
+	}
+
+	// FirmwareCompletedMsg is sent when a firmware tool exits
+	FirmwareCompletedMsg struct {
+		File string
+		Port string
+		Err  error
+	}
+
+	// CANStartedMsg is sent when a CAN update starts
+	CANStartedMsg struct {
+		Cancel func()
+	}
+
+	// CANCompletedMsg is sent when every CAN node was updated or failed
+	CANCompletedMsg struct {
+		Interface string
+		Results   []CANNodeResult
+	}
+
+	// BurnInStartedMsg is sent when a burn-in starts
+	BurnInStartedMsg struct {
+		Cancel func()
+	}
+
+	// BurnInCompletedMsg is sent when a burn-in ran its passes or failed
+	BurnInCompletedMsg struct {
+		Device string
+		Passes []flash.BurnInPass
+		Err    error
+	}
+
+	// ActionStartedMsg is sent when a custom action command starts
+	ActionStartedMsg struct {
+		Cmd *exec.Cmd
+		Pty *os.File
+	}
+
+	// ActionCompletedMsg is sent when a custom action command finishes
+	ActionCompletedMsg struct {
+		Label string
+		Err   error
+	}
+
+	// HookOutputMsg carries a line of output from an on_success/on_failure hook
+	HookOutputMsg string
+
+	// HookCompletedMsg is sent when a hook command exits
+	HookCompletedMsg struct {
+		Name string
+		Err  error
+	}
+
 	// CheckCompletedMsg is sent when integrity check finishes
 	CheckCompletedMsg struct {
 		File string
@@ -64,9 +132,70 @@ type (
 	}
 )
 
-// ListenProgress returns a command that listens for messages on a channel
+// progressInterval is the minimum time between two progress lines reaching the
+// UI. Every delivered message causes a full render, which over slow SSH links
+// and on small boards cannot keep up with the tools' output.
+const progressInterval = 200 * time.Millisecond
+
+// progressCoalescer tracks a progress stream between ListenProgress calls.
+type progressCoalescer struct {
+	mu      sync.Mutex // listeners on one channel take turns
+	last    time.Time // when the last progress line was delivered
+	pending tea.Msg   // message received while coalescing, delivered next
+}
+
+// coalescers holds the state of channels inside a run of progress lines.
+var coalescers sync.Map // chan tea.Msg -> *progressCoalescer
+
+// isProgressLine reports whether a log line is a pv-style progress update that
+// replaces the previous one.
+func isProgressLine(line string) bool {
+	return strings.Contains(line, "%") && strings.Contains(line, "B/s")
+}
+
+// ListenProgress returns a command that listens for messages on a channel.
+// Progress lines arriving faster than progressInterval are coalesced, only the
+// newest one is delivered; other messages are never dropped or reordered.
 func ListenProgress(ch chan tea.Msg) tea.Cmd {
 	return func() tea.Msg {
-		return <-ch
+		v, _ := coalescers.LoadOrStore(ch, &progressCoalescer{})
+		c := v.(*progressCoalescer)
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.pending != nil {
+			msg := c.pending
+			c.pending = nil
+			coalescers.Delete(ch)
+			return msg
+		}
+
+		msg := <-ch
+		if p, ok := msg.(ProgressMsg); !ok || !isProgressLine(string(p)) {
+			coalescers.Delete(ch)
+			return msg
+		}
+		wait := time.Until(c.last.Add(progressInterval))
+		if wait <= 0 {
+			c.last = time.Now()
+			return msg
+		}
+
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		for {
+			select {
+			case next := <-ch:
+				if p, ok := next.(ProgressMsg); ok && isProgressLine(string(p)) {
+					msg = next
+					continue
+				}
+				c.pending = next
+				c.last = time.Now()
+				return msg
+			case <-timer.C:
+				c.last = time.Now()
+				return msg
+			}
+		}
 	}
 }
@@ -0,0 +1,161 @@
+package ui
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/husarion/husarion-os-flasher/internal/flash"
+)
+
+// metaSuffix is appended to an image filename to form its provenance sidecar.
+const metaSuffix = ".meta.yaml"
+
+// catalogFile describes several images of a directory at once, keyed by file
+// name, for images without a sidecar.
+const catalogFile = "catalog.yaml"
+
+// ImageMeta is the provenance metadata stored in <image>.meta.yaml or in the
+// directory's catalog.yaml
+type ImageMeta struct {
+	Version      string `yaml:"version"`
+	BuildDate    string `yaml:"build_date"`
+	ChangelogURL string `yaml:"changelog_url,omitempty"`
+	MinHardware  string `yaml:"min_hardware,omitempty"`
+	DefaultUser  string `yaml:"default_user,omitempty"`
+	Description  string `yaml:"description,omitempty"`    // e.g. "ROS 2 Humble"
+	Robot        string `yaml:"robot,omitempty"`          // robot the image is built for
+	Profile      string `yaml:"verify_profile,omitempty"` // verification profile, see config.VerifyProfile
+
+	// Catalog entries only: where to download the image from
+	SHA256  string   `yaml:"sha256,omitempty"`
+	Mirrors []string `yaml:"mirrors,omitempty"` // URLs of the image, tried in order
+}
+
+// catalog is the content of catalogFile.
+type catalog struct {
+	Images map[string]ImageMeta `yaml:"images"`
+}
+
+// catalogCache keeps the parsed catalog of each directory until it changes, as
+// the image list is refreshed every second.
+var catalogCache = struct {
+	sync.Mutex
+	entries map[string]cachedCatalog
+}{entries: make(map[string]cachedCatalog)}
+
+type cachedCatalog struct {
+	modTime time.Time
+	catalog catalog
+}
+
+// loadCatalog returns the catalog of an image directory, empty when it has none.
+func loadCatalog(dir string) catalog {
+	path := filepath.Join(dir, catalogFile)
+	info, err := os.Stat(path)
+	if err != nil {
+		return catalog{}
+	}
+	catalogCache.Lock()
+	defer catalogCache.Unlock()
+	if c, ok := catalogCache.entries[dir]; ok && c.modTime.Equal(info.ModTime()) {
+		return c.catalog
+	}
+	var c catalog
+	if b, err := os.ReadFile(path); err == nil {
+		_ = yaml.Unmarshal(b, &c)
+	}
+	catalogCache.entries[dir] = cachedCatalog{modTime: info.ModTime(), catalog: c}
+	return c
+}
+
+// stripCompression returns the raw image path for a compressed image path
+func stripCompression(imagePath string) string {
+	return flash.ExtractedPath(imagePath)
+}
+
+// metaPaths returns the sidecar locations checked for an image, most specific first.
+// A compressed image falls back to the sidecar of its raw image.
+func metaPaths(imagePath string) []string {
+	paths := []string{imagePath + metaSuffix}
+	if raw := stripCompression(imagePath); raw != imagePath {
+		paths = append(paths, raw+metaSuffix)
+	}
+	return paths
+}
+
+// LoadImageMeta reads the provenance sidecar for an image, or else its catalog
+// entry. It returns nil when the image has neither or the sidecar cannot be
+// parsed.
+func LoadImageMeta(imagePath string) *ImageMeta {
+	for _, path := range metaPaths(imagePath) {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var meta ImageMeta
+		if yaml.Unmarshal(b, &meta) != nil {
+			return nil
+		}
+		return &meta
+	}
+	images := loadCatalog(filepath.Dir(imagePath)).Images
+	for _, path := range metaPaths(imagePath) {
+		if meta, ok := images[filepath.Base(strings.TrimSuffix(path, metaSuffix))]; ok {
+			return &meta
+		}
+	}
+	return nil
+}
+
+// copyImageMeta copies the sidecar of src (if any) next to dst
+func copyImageMeta(src, dst string) error {
+	for _, path := range metaPaths(src) {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		return os.WriteFile(dst+metaSuffix, b, 0644)
+	}
+	return nil
+}
+
+// Label returns the description shown under the image in the list, such as
+// "ROS 2 Humble, Panther, built 2024-06-01".
+func (meta *ImageMeta) Label() string {
+	var parts []string
+	for _, part := range []string{meta.Description, meta.Robot} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) == 0 && meta.Version != "" {
+		parts = append(parts, "v"+strings.TrimPrefix(meta.Version, "v"))
+	}
+	if meta.BuildDate != "" {
+		parts = append(parts, "built "+meta.BuildDate)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Summary returns a one-line description such as "v1.2.0 • built 2024-06-01 • min HW: ROSbot 2R"
+func (meta *ImageMeta) Summary() string {
+	var parts []string
+	if meta.Version != "" {
+		parts = append(parts, "v"+strings.TrimPrefix(meta.Version, "v"))
+	}
+	if meta.BuildDate != "" {
+		parts = append(parts, "built "+meta.BuildDate)
+	}
+	if meta.MinHardware != "" {
+		parts = append(parts, "min HW: "+meta.MinHardware)
+	}
+	if meta.DefaultUser != "" {
+		parts = append(parts, "user: "+meta.DefaultUser)
+	}
+	return strings.Join(parts, " • ")
+}
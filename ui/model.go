@@ -13,6 +13,11 @@ import (
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	zone "github.com/lrstanley/bubblezone"
+	"github.com/husarion/husarion-os-flasher/config"
+	"github.com/husarion/husarion-os-flasher/internal/flash"
+	"github.com/husarion/husarion-os-flasher/internal/history"
+	"github.com/husarion/husarion-os-flasher/internal/robot"
+	"github.com/husarion/husarion-os-flasher/platform"
 	"github.com/husarion/husarion-os-flasher/util"
 )
 
@@ -34,9 +39,9 @@ type Model struct {
 	Height            int
 	ProgressChan      chan tea.Msg  // For streaming dd logs
 	DdCmd             *exec.Cmd     // dd command pointer for aborting
-	ExtractCmd        *exec.Cmd     // extraction command pointer for aborting
 	DdPty             *os.File      // pty for dd command (for proper cleanup)
-	ExtractPty        *os.File      // pty for extraction command (for proper cleanup)
+	DdCancel          func()        // stops an in-process (block map) write
+	ExtractCancel     func()        // stops the extraction
 	Zones             *zone.Manager // Add zone manager to the model
 	OsImgPath         string        // Store the image path for refreshes
 	FlashStartTime    time.Time     // Track when flashing started
@@ -46,17 +51,167 @@ type Model struct {
 	ExtractOutputPath string // final .img path
 	ExtractTempPath   string // temporary .part path
 
+	// Flash started by the running extraction, nil for a plain extraction
+	Chain *chainedFlash
+
 	// Integrity check state
 	Checking  bool
 	CheckCmd  *exec.Cmd
 	CheckPty  *os.File
+
+	// Controller firmware flash state
+	FlashingFirmware bool
+	FirmwareCmd      *exec.Cmd
+	FirmwarePty      *os.File
+
+	// CAN node update state
+	UpdatingCAN bool
+	CANCancel   func() // stops the running node update and skips the rest
+
+	// Burn-in state
+	BurningIn    bool
+	BurnInCancel func() // stops the burn-in after the current chunk
+
+	// Config and button row
+	Config        *config.Config
+	FocusedButton string // id of the focused button when ActiveList == ActiveButtons
+
+	// Custom action state
+	RunningAction string // label of the running config action
+	ActionCmd     *exec.Cmd
+	ActionPty     *os.File
+
+	// Post-job hooks
+	HookChan    chan tea.Msg // output of on_success/on_failure hooks
+	HookRunning int          // number of hooks still running
+
+	// About overlay
+	ShowAbout  bool
+	AboutLines []string
+
+	// Robot or board being provisioned, from the config or chosen with B
+	TargetRobot string
+
+	// Screen arrangement, remembered per terminal size class
+	Layout      Layout
+	LayoutClass string
+	LogDrag     *logDrag // set while the log viewport's border is dragged
+
+	// Search of the log, nil when closed
+	LogSearch *logSearch
+
+	// Set while available memory is low, see checkMemory
+	LowMemory bool
+
+	// Image this session last asked to pre-warm, see prewarmSelected
+	Prewarmed string
+
+	// Last failed job with a known cause, nil once a job succeeds
+	Failure *Failure
+
+	// Provisioning wizard, nil when closed
+	Wizard *Wizard
+
+	// Composite flashing run, nil when closed
+	Composite *Composite
+
+	// Run flashing every slot of a duplicator, nil when closed
+	Duplication *Duplication
+
+	// Queue controls, see queueState: QueueHeld is set while the next part or
+	// slot of a run waits for the queue to resume, AbortsSeen counts the
+	// AbortAll calls this session has applied
+	QueueHeld  bool
+	AbortsSeen int
+
+	// Undervoltage is set once the running job was warned about a low supply
+	// voltage, see pollPower
+	Undervoltage bool
+
+	// Check run after the current flash, see verifyMode
+	VerifyMode string
+
+	// Robot whose controller is connected over USB, nil when none is
+	DetectedRobot *robot.Robot
+
+	// Statistics screen, built from the job history when opened
+	ShowStats  bool
+	StatsLines []string
+
+	// Failure details screen, the failed jobs of the history newest first
+	ShowFailures bool
+	FailedJobs   []history.Entry
+	FailedIndex  int
+	FailureView  viewport.Model
+
+	// Preview screen of a device's contents, and boot options being edited
+	Preview  *devicePreview
+	BootEdit *bootEdit
+	// A device's partitions are mounted for a preview or a boot edit
+	Mounting bool
+
+	// Read-only while another flasher process holds the instance lock
+	Monitoring bool
+
+	// Cluster dashboard, available on coordinators
+	Coordinator  bool
+	ShowStations bool
+
+	// Prune and deduplication previews, shown while non-empty
+	PrunePlan       []flash.PruneCandidate
+	DuplicateGroups []flash.DuplicateGroup
+
+	// Selected device and its identity, see followSelectedDevice, and the
+	// device list it was last checked against
+	SelectedDevice   string
+	SelectedDeviceID string
+	ListedDevices    []string
+
+	// Crash tracking
+	JobID          int        // id of the running job in the crash registry
+	InterruptedJob *JobRecord // job interrupted by a previous crash, offered for resume
+
+	// Wrapped and styled copy of Logs for the viewport, see AddLog
+	wrappedLogs  []string
+	wrappedWidth int
+
+	// Info panel cache, shared by copies of the model
+	info *infoCache
+
+	// Operator identifies who drives this session in the audit log: the SSH
+	// user, address and key fingerprint, or the console
+	Operator string
+
+	// SSH is set for sessions served over SSH, whose terminal title shows the
+	// progress of the running job, see terminalTitle
+	SSH   bool
+	title string // terminal title last set
+
+	// Device and image changes logged by this session, see logInventoryChanges
+	InventorySeen int
+
+	// Config reloads logged by this session, see logConfigChanges
+	ConfigSeen int
+
+	// Approval is a flash waiting for a second operator, see Config.TwoPerson
+	Approval *approval
+
+	// Role of the user, see Config.Roles. Unlock is the admin PIN being typed.
+	Role   string
+	Unlock *adminUnlock
+
+	// Kiosk mode
+	Kiosk             bool      // show the idle screen after KioskIdleTimeout
+	LastInput         time.Time // last key press or click
+	ShutdownRequested bool      // the user powered off, the kiosk must not restart the UI
 }
 
 // Item represents an entry in a list (device or image)
 type Item struct {
-	title string // Display name (for images, just the base filename)
-	value string // Actual value (full path)
-	desc  string
+	title   string // Display name (for images, just the base filename)
+	value   string // Actual value (full path)
+	desc    string
+	copying bool // an image still being copied, which cannot be selected
 }
 
 // Title implements the list.Item interface
@@ -68,13 +223,18 @@ func (i Item) Description() string { return i.desc }
 // FilterValue implements the list.Item interface
 func (i Item) FilterValue() string { return i.title }
 
-// IsCompressedImageSelected checks if the selected image is a .img.xz file
+// IsCompressedImageSelected checks if the selected image is xz-compressed or a zip archive
 func (m Model) IsCompressedImageSelected() bool {
-	if m.ImageList.SelectedItem() == nil {
+	if !m.imageSelected() {
 		return false
 	}
 	imagePath := m.ImageList.SelectedItem().(Item).value
-	return strings.HasSuffix(imagePath, ".img.xz")
+	return flash.IsCompressed(imagePath)
+}
+
+// Busy reports whether a long-running operation (which can be aborted) is in progress
+func (m Model) Busy() bool {
+	return m.Flashing || m.Extracting || m.Checking || m.FlashingFirmware || m.UpdatingCAN || m.BurningIn || m.RunningAction != ""
 }
 
 // AddLog adds a log entry with overflow protection
@@ -89,11 +249,10 @@ func (m *Model) AddLog(msg string) {
 	}
 
 	// Check if this is a progress message from pv
-	if strings.Contains(msg, "%") && strings.Contains(msg, "B/s") {
+	if isProgressLine(msg) {
 		// If we already have logs and the last one was a progress message,
 		// replace it instead of adding a new log entry
-		if len(m.Logs) > 0 && strings.Contains(m.Logs[len(m.Logs)-1], "%") &&
-			strings.Contains(m.Logs[len(m.Logs)-1], "B/s") {
+		if len(m.Logs) > 0 && isProgressLine(m.Logs[len(m.Logs)-1]) {
 			m.Logs[len(m.Logs)-1] = msg // Replace the last progress entry
 		} else {
 			// First progress message or previous entry was not a progress message
@@ -102,89 +261,152 @@ func (m *Model) AddLog(msg string) {
 	} else {
 		// Regular log message, just append
 		m.Logs = append(m.Logs, msg)
+		rememberLog(msg)
+	}
+	if m.JobID != 0 {
+		Events.Publish(JobProgress{ID: m.JobID, Line: msg})
 	}
 
-	// Update the viewport content with all logs, applying word wrapping
-	var wrappedLogs []string
-	// Get the viewport width, minus some padding for borders
+	// Only the changed entry is wrapped and styled again, unless the width changed
 	logWidth := m.Viewport.Width - 2
 	if logWidth < 10 {
 		logWidth = 50 // Fallback minimum width
 	}
-	
-	for _, log := range m.Logs {
-		// Check if this log has ANSI color codes (styled text)
-		hasColor := strings.Contains(log, "\x1b[")
-		
-		if hasColor {
-			// Extract the style information and plain text
-			plainText := stripANSI(log)
-			wrapped := util.WrapText(plainText, logWidth)
-			
-			// Detect the original color from the log message
-			var originalColor string
-			if strings.Contains(log, "38;2;0;255;0") || strings.Contains(log, "\x1b[32m") {
-				originalColor = "#00FF00" // Green
-			} else if strings.Contains(log, "38;2;255;204;0") || strings.Contains(log, "\x1b[33m") || strings.Contains(log, "38;2;255;255;0") {
-				originalColor = "#FFCC00" // Yellow
-			} else if strings.Contains(log, "38;2;255;0;0") || strings.Contains(log, "\x1b[31m") {
-				originalColor = "#FF0000" // Red
-			} else {
-				// Case-insensitive keyword heuristics
-				p := strings.ToLower(plainText)
-				if strings.Contains(p, "operation aborted") || strings.Contains(p, "aborted") {
-					originalColor = "#FFCC00" // Yellow
-				} else if strings.Contains(p, "successfully") || strings.Contains(p, "completed") || strings.Contains(p, "ok") {
-					originalColor = "#00FF00" // Green
-				} else if strings.Contains(p, "error") || strings.Contains(p, "failed") || strings.Contains(p, "failure") {
-					originalColor = "#FF0000" // Red
-				} else {
-					originalColor = "#00FF00" // Fallback to green
-				}
-			}
-			
-			// Apply the original styling to each wrapped line
-			wrappedLines := strings.Split(wrapped, "\n")
-			var styledLines []string
-			for _, line := range wrappedLines {
-				if strings.TrimSpace(line) != "" {
-					styledLine := lipgloss.NewStyle().
-						Foreground(lipgloss.Color(originalColor)).
-						Bold(true).
-						Render(line)
-					styledLines = append(styledLines, styledLine)
-				}
-			}
-			wrappedLogs = append(wrappedLogs, strings.Join(styledLines, "\n"))
+	switch {
+	case logWidth == m.wrappedWidth && len(m.wrappedLogs) == len(m.Logs):
+		m.wrappedLogs[len(m.wrappedLogs)-1] = renderLogEntry(m.Logs[len(m.Logs)-1], logWidth)
+	case logWidth == m.wrappedWidth && len(m.wrappedLogs) == len(m.Logs)-1:
+		m.wrappedLogs = append(m.wrappedLogs, renderLogEntry(m.Logs[len(m.Logs)-1], logWidth))
+	default:
+		m.wrappedLogs = make([]string, 0, len(m.Logs))
+		for _, log := range m.Logs {
+			m.wrappedLogs = append(m.wrappedLogs, renderLogEntry(log, logWidth))
+		}
+		m.wrappedWidth = logWidth
+	}
+
+	m.Viewport.SetContent(m.logContent())
+	if m.LogSearch == nil {
+		m.Viewport.GotoBottom()
+	}
+}
+
+// ClearLogs empties the log viewport.
+func (m *Model) ClearLogs() {
+	m.Logs = nil
+	m.wrappedLogs = nil
+}
+
+// renderLogEntry wraps a log entry to width, keeping the color of styled entries.
+func renderLogEntry(log string, width int) string {
+	// Check if this log has ANSI color codes (styled text)
+	hasColor := strings.Contains(log, "\x1b[")
+	if !hasColor {
+		// Regular text, just wrap normally
+		return util.WrapText(log, width)
+	}
+
+	// Extract the style information and plain text
+	plainText := stripANSI(log)
+	wrapped := util.WrapText(plainText, width)
+
+	// Detect the original color from the log message
+	var originalColor string
+	if strings.Contains(log, "38;2;0;255;0") || strings.Contains(log, "\x1b[32m") {
+		originalColor = "#00FF00" // Green
+	} else if strings.Contains(log, "38;2;255;204;0") || strings.Contains(log, "\x1b[33m") || strings.Contains(log, "38;2;255;255;0") {
+		originalColor = "#FFCC00" // Yellow
+	} else if strings.Contains(log, "38;2;255;0;0") || strings.Contains(log, "\x1b[31m") {
+		originalColor = "#FF0000" // Red
+	} else {
+		// Case-insensitive keyword heuristics
+		p := strings.ToLower(plainText)
+		if strings.Contains(p, "operation aborted") || strings.Contains(p, "aborted") {
+			originalColor = "#FFCC00" // Yellow
+		} else if strings.Contains(p, "successfully") || strings.Contains(p, "completed") || strings.Contains(p, "ok") {
+			originalColor = "#00FF00" // Green
+		} else if strings.Contains(p, "error") || strings.Contains(p, "failed") || strings.Contains(p, "failure") {
+			originalColor = "#FF0000" // Red
 		} else {
-			// Regular text, just wrap normally
-			wrapped := util.WrapText(log, logWidth)
-			wrappedLogs = append(wrappedLogs, wrapped)
+			originalColor = "#00FF00" // Fallback to green
 		}
 	}
 	
-	m.Viewport.SetContent("Logs:\n" + strings.Join(wrappedLogs, "\n"))
-	m.Viewport.GotoBottom()
+	// Apply the original styling to each wrapped line
+	wrappedLines := strings.Split(wrapped, "\n")
+	var styledLines []string
+	for _, line := range wrappedLines {
+		if strings.TrimSpace(line) != "" {
+			styledLine := lipgloss.NewStyle().
+				Foreground(lipgloss.Color(originalColor)).
+				Bold(true).
+				Render(line)
+			styledLines = append(styledLines, styledLine)
+		}
+	}
+	return strings.Join(styledLines, "\n")
+}
+
+// deviceItem returns the device list entry of a device, flagged when a previous
+// write to it was cut short.
+func deviceItem(dev string) Item {
+	_, suspect := suspectDevice(dev)
+	return Item{title: dev, value: dev, desc: deviceDescription(suspect)}
+}
+
+// deviceDescription returns the description of a device in the device list.
+func deviceDescription(suspect bool) string {
+	if suspect {
+		return "Suspect - verify before use"
+	}
+	return "Storage Device"
+}
+
+// imageItem returns the image list entry of an image.
+func imageItem(img, target string) Item {
+	desc, _ := imageDescription(img, target)
+	return Item{title: filepath.Base(img), value: img, desc: desc}
+}
+
+// imageItems returns the entries of the image list: the images, then the
+// images of osImgPath still being copied.
+func imageItems(osImgPath string, images []string, target string) []list.Item {
+	var items []list.Item
+	for _, img := range images {
+		items = append(items, imageItem(img, target))
+	}
+	for _, img := range copyingImages(osImgPath) {
+		items = append(items, copyingItem(img))
+	}
+	return items
+}
+
+// imageDescription describes an image by its metadata when it has any, marked
+// when it is built for the target robot, and reports whether it is.
+func imageDescription(img, target string) (string, bool) {
+	desc := "OS Image"
+	meta := LoadImageMeta(img)
+	if meta != nil && meta.Label() != "" {
+		desc = meta.Label()
+	}
+	if meta != nil && target != "" && robotMatches(meta.Robot, target) {
+		return "★ Recommended • " + desc, true
+	}
+	return desc, false
 }
 
 // Refresh updates the device and image lists
 func (m *Model) Refresh() {
-	devices, err := GetAvailableDevices()
+	devices, err := platform.Current.Devices()
 	if err == nil {
-		var deviceItems []list.Item
-		for _, dev := range devices {
-			deviceItems = append(deviceItems, Item{title: dev, value: dev, desc: "Storage Device"})
-		}
-		m.DeviceList.SetItems(deviceItems)
+		m.DeviceList.SetItems(deviceItems(m.Config, devices))
+		m.followSelectedDevice(devices)
 	}
 
-	images, err := GetImageFiles(m.OsImgPath)
+	images, err := ImageFiles(m.OsImgPath)
 	if err == nil {
-		var imageItems []list.Item
-		for _, img := range images {
-			imageItems = append(imageItems, Item{title: filepath.Base(img), value: img, desc: "OS Image"})
-		}
-		m.ImageList.SetItems(imageItems)
+		m.ImageList.SetItems(imageItems(m.OsImgPath, images, m.TargetRobot))
+		m.skipCopyingImage()
 	}
 }
 
@@ -218,10 +440,12 @@ func (m *Model) HandleMouseWheel(msg tea.MouseMsg) (tea.Model, tea.Cmd) {
 		if msg.Button == tea.MouseButtonWheelUp {
 			keyMsg = tea.KeyMsg{Type: tea.KeyUp}
 			m.DeviceList, _ = m.DeviceList.Update(keyMsg)
+			m.followSelectedDevice(nil)
 			return m, nil
 		} else if msg.Button == tea.MouseButtonWheelDown {
 			keyMsg = tea.KeyMsg{Type: tea.KeyDown}
 			m.DeviceList, _ = m.DeviceList.Update(keyMsg)
+			m.followSelectedDevice(nil)
 			return m, nil
 		}
 	}
@@ -231,10 +455,12 @@ func (m *Model) HandleMouseWheel(msg tea.MouseMsg) (tea.Model, tea.Cmd) {
 		if msg.Button == tea.MouseButtonWheelUp {
 			keyMsg = tea.KeyMsg{Type: tea.KeyUp}
 			m.ImageList, _ = m.ImageList.Update(keyMsg)
+			m.skipCopyingImage()
 			return m, nil
 		} else if msg.Button == tea.MouseButtonWheelDown {
 			keyMsg = tea.KeyMsg{Type: tea.KeyDown}
 			m.ImageList, _ = m.ImageList.Update(keyMsg)
+			m.skipCopyingImage()
 			return m, nil
 		}
 	}
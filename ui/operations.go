@@ -2,56 +2,120 @@ package ui
 
 import (
 	"bufio"
-	"bytes"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
-	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/charmbracelet/bubbles/list"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/creack/pty"
+	"github.com/husarion/husarion-os-flasher/internal/flash"
 	"github.com/husarion/husarion-os-flasher/util"
 	"gopkg.in/yaml.v3"
 )
 
 // StartFlashing initiates the flashing process
 func (m *Model) StartFlashing() (tea.Model, tea.Cmd) {
-	if m.DeviceList.SelectedItem() == nil || m.ImageList.SelectedItem() == nil || m.Flashing {
+	if m.DeviceList.SelectedItem() == nil || !m.imageSelected() || m.selectedDeviceChanged() {
 		return m, nil
 	}
+	image, device := m.ImageList.SelectedItem().(Item).value, m.DeviceList.SelectedItem().(Item).value
+	if model, cmd, ok := m.extractBeforeFlash(image, device); ok {
+		return model, cmd
+	}
+	return m.flashImage(image, device)
+}
 
-	imagePath := m.ImageList.SelectedItem().(Item).value
-	devicePath := m.DeviceList.SelectedItem().(Item).value
+// flashImage flashes imagePath to devicePath, which may be a partition,
+// once the two-person policy is satisfied.
+func (m *Model) flashImage(imagePath, devicePath string) (tea.Model, tea.Cmd) {
+	return m.flashConfirmed(imagePath, devicePath, nil)
+}
+
+// flashConfirmed flashes imagePath to devicePath as flashImage does. snapshot
+// is the device when the operator confirmed the flash, compared again right
+// before writing; when nil, it is read as the write starts.
+func (m *Model) flashConfirmed(imagePath, devicePath string, snapshot *deviceSnapshot) (tea.Model, tea.Cmd) {
+	if m.Busy() {
+		return m, nil
+	}
+	if maintenanceBlocksImages() {
+		m.AddLog("Flashing is paused while maintenance reorganizes the image directory.")
+		return m, nil
+	}
+	if pattern := protectedDevice(m.Config, devicePath); pattern != "" {
+		m.AddLog(fmt.Sprintf("Error: %s is protected by the config (%s) and is never written.", devicePath, pattern))
+		return m, nil
+	}
+
+	if err := checkWritable(devicePath); err != nil {
+		m.AddLog(fmt.Sprintf("Error: %v", err))
+		if hint, ok := diagnoseFailure(err, nil); ok {
+			m.Failure = &Failure{Hint: hint, Err: err}
+		}
+		return m, nil
+	}
+	// The device as the operator confirmed it, before any approval dialog
+	if a := m.Approval; a != nil && a.Device == devicePath && a.Snapshot != nil {
+		snapshot = a.Snapshot
+	}
+	approver, approved := m.approved(imagePath, devicePath)
+	if !approved {
+		if reason := approvalReason(m.Config, devicePath); reason != "" {
+			m.Approval = &approval{Image: imagePath, Device: devicePath, Reason: reason, Snapshot: snapshot}
+			m.AddLog(fmt.Sprintf("Flashing %s needs a second operator: %s.", devicePath, reason))
+			if snapshot == nil {
+				return m, snapshotCmd(devicePath)
+			}
+			return m, nil
+		}
+	}
+	jobID, err := beginJob("flash", imagePath, devicePath, m.Operator)
+	if err != nil {
+		m.AddLog(fmt.Sprintf("Error: %v", err))
+		return m, nil
+	}
+	if approved {
+		writeAudit("approve", JobRecord{Kind: "flash", Src: imagePath, Dst: devicePath, Operator: approver})
+	}
 
 	// Create a new buffered progress channel for this run
 	m.ProgressChan = make(chan tea.Msg, 100)
 	m.Flashing = true
 	m.FlashStartTime = time.Now() // Record the start time
-	m.Logs = nil
+	m.JobID = jobID
+	// The log of a composite or duplication run covers all its parts
+	if (m.Composite == nil || m.Composite.Current == 0) && m.Duplication == nil {
+		m.ClearLogs()
+	}
 	m.AddLog(fmt.Sprintf("> Starting to flash %s to %s...", imagePath, devicePath))
-
-	// Set focus directly to the Abort button based on system type and layout
-	hasCompressedImage := m.IsCompressedImageSelected()
-	if util.IsRaspberryPi() {
-		if hasCompressedImage {
-			m.ActiveList = 6
-		} else {
-			m.ActiveList = 5
-		}
-	} else {
-		if hasCompressedImage {
-			m.ActiveList = 5
-		} else {
-			m.ActiveList = 4
-		}
+	if warning := robotWarning(imagePath, m.TargetRobot); warning != "" {
+		m.AddLog("Warning: " + warning)
+	}
+	if approved {
+		m.AddLog("Approved by " + approver + ".")
 	}
+	m.logExpectedDuration(imagePath, devicePath)
+
+	// Set focus directly to the Abort button
+	m.FocusButton("abort-button")
 
+	write := WriteImage(imagePath, devicePath, m.ProgressChan)
 	return m, tea.Batch(
-		WriteImage(imagePath, devicePath, m.ProgressChan),
+		func() tea.Msg {
+			// Reading the device may be slow: not in Update
+			if snapshot == nil {
+				now := snapshotDevice(devicePath)
+				snapshot = &now
+			}
+			confirmDevice(devicePath, *snapshot)
+			return write()
+		},
 		ListenProgress(m.ProgressChan),
 	)
 }
@@ -62,13 +126,24 @@ func (m *Model) ConfigEEPROM() (tea.Model, tea.Cmd) {
 		return m, nil
 	}
 
-	m.AddLog("> Starting EEPROM configuration...")
+	// A detected robot may need its own configuration
+	bootConf := "/etc/boot.conf"
+	if m.DetectedRobot != nil && m.DetectedRobot.EEPROM != "" {
+		bootConf = m.DetectedRobot.EEPROM
+		m.AddLog(fmt.Sprintf("> Starting EEPROM configuration for %s (%s)...", m.DetectedRobot.Model, bootConf))
+	} else {
+		m.AddLog("> Starting EEPROM configuration...")
+	}
 	m.ConfiguringEeprom = true
 
 	// Create a function to run the EEPROM configuration command and capture its output
 	return m, func() tea.Msg {
+		if demoMode {
+			return demoEEPROM(bootConf)
+		}
+
 		// Replace this with actual EEPROM configuration command
-		cmd := exec.Command("rpi-eeprom-config", "--apply", "/etc/boot.conf")
+		cmd := util.Command("rpi-eeprom-config", "--apply", bootConf)
 
 		output, err := cmd.CombinedOutput()
 		if err != nil {
@@ -85,9 +160,13 @@ func (m *Model) ConfigEEPROM() (tea.Model, tea.Cmd) {
 func (m *Model) AbortOperation() (tea.Model, tea.Cmd) {
 	// Log the abort attempt for debugging
 	m.AddLog("> Attempting to abort operation...")
+	if job, ok := runningJob(m.JobID); ok {
+		job.Operator = m.Operator
+		writeAudit("abort", job)
+	}
 	
 	// Check if we're flashing and have a command to abort
-	if m.Flashing && m.DdCmd != nil {
+	if m.Flashing && (m.DdCmd != nil || m.DdCancel != nil) {
 		m.Aborting = true
 		m.AddLog("Aborting flashing process... (please wait)")
 
@@ -96,6 +175,10 @@ func (m *Model) AbortOperation() (tea.Model, tea.Cmd) {
 				return nil 
 			}),
 			tea.Tick(500*time.Millisecond, func(time.Time) tea.Msg {
+				if m.DdCancel != nil {
+					m.DdCancel()
+					return AbortCompletedMsg{}
+				}
 				err := m.DdCmd.Process.Kill()
 				if err != nil {
 					return ErrorMsg{Err: fmt.Errorf("error aborting flash: %v", err)}
@@ -111,18 +194,14 @@ func (m *Model) AbortOperation() (tea.Model, tea.Cmd) {
 	}
 	
 	// Check if we're extracting and have a command to abort
-	if m.Extracting && m.ExtractCmd != nil {
+	if m.Extracting && m.ExtractCancel != nil {
 		m.Aborting = true
 		m.AddLog("Aborting extraction process... (please wait)")
 
 		return m, tea.Sequence(
 			tea.Tick(10*time.Millisecond, func(time.Time) tea.Msg { return nil }),
 			tea.Tick(500*time.Millisecond, func(time.Time) tea.Msg {
-				// Kill the process
-				if err := m.ExtractCmd.Process.Kill(); err != nil {
-					return ErrorMsg{Err: fmt.Errorf("error aborting extraction: %v", err)}
-				}
-				if m.ExtractPty != nil { _ = m.ExtractPty.Close() }
+				m.ExtractCancel()
 
 				// Remove temp and partial files
 				if m.ExtractTempPath != "" { _ = os.Remove(m.ExtractTempPath) }
@@ -150,13 +229,145 @@ func (m *Model) AbortOperation() (tea.Model, tea.Cmd) {
 		)
 	}
 	
+	// Check if we're writing firmware and have a command to abort
+	if m.FlashingFirmware && m.FirmwareCmd != nil {
+		m.Aborting = true
+		m.AddLog("Aborting firmware write... (please wait)")
+
+		return m, tea.Sequence(
+			tea.Tick(10*time.Millisecond, func(time.Time) tea.Msg { return nil }),
+			tea.Tick(500*time.Millisecond, func(time.Time) tea.Msg {
+				if err := m.FirmwareCmd.Process.Kill(); err != nil {
+					return ErrorMsg{Err: fmt.Errorf("error aborting firmware write: %v", err)}
+				}
+				if m.FirmwarePty != nil { _ = m.FirmwarePty.Close() }
+				return AbortCompletedMsg{}
+			}),
+		)
+	}
+
+	// Check if we're updating CAN nodes and can stop them
+	if m.UpdatingCAN && m.CANCancel != nil {
+		m.Aborting = true
+		m.AddLog("Aborting CAN update... (please wait)")
+
+		return m, tea.Sequence(
+			tea.Tick(10*time.Millisecond, func(time.Time) tea.Msg { return nil }),
+			tea.Tick(500*time.Millisecond, func(time.Time) tea.Msg {
+				m.CANCancel()
+				return AbortCompletedMsg{}
+			}),
+		)
+	}
+
+	// Check if we're burning in a card and can stop it
+	if m.BurningIn && m.BurnInCancel != nil {
+		m.Aborting = true
+		m.AddLog("Aborting burn-in... (please wait)")
+
+		return m, tea.Sequence(
+			tea.Tick(10*time.Millisecond, func(time.Time) tea.Msg { return nil }),
+			tea.Tick(500*time.Millisecond, func(time.Time) tea.Msg {
+				m.BurnInCancel()
+				return AbortCompletedMsg{}
+			}),
+		)
+	}
+
+	// Check if we're running a custom action and have a command to abort
+	if m.RunningAction != "" && m.ActionCmd != nil {
+		m.Aborting = true
+		m.AddLog(fmt.Sprintf("Aborting %s... (please wait)", m.RunningAction))
+
+		return m, tea.Sequence(
+			tea.Tick(10*time.Millisecond, func(time.Time) tea.Msg { return nil }),
+			tea.Tick(500*time.Millisecond, func(time.Time) tea.Msg {
+				if err := m.ActionCmd.Process.Kill(); err != nil {
+					return ErrorMsg{Err: fmt.Errorf("error aborting %s: %v", m.RunningAction, err)}
+				}
+				if m.ActionPty != nil { _ = m.ActionPty.Close() }
+				return AbortCompletedMsg{}
+			}),
+		)
+	}
+
 	m.AddLog("No operation to abort.")
 	return m, nil
 }
 
-// ExtractWithProgress performs extraction with progress reporting using pv
+// finishJob removes the current job from the crash registry and returns its record
+func (m *Model) finishJob() (JobRecord, bool) {
+	job, ok := endJob(m.JobID)
+	m.JobID = 0
+	return job, ok
+}
+
+// ResumeInterruptedJob restarts the job recorded by a previous crash, provided its
+// image (and device, for flashing) are still available.
+func (m *Model) ResumeInterruptedJob() (tea.Model, tea.Cmd) {
+	job := m.InterruptedJob
+	if job == nil || m.Busy() || !m.allowed(job.Kind) {
+		return m, nil
+	}
+	m.InterruptedJob = nil
+
+	// Firmware and CAN jobs write the robot's controllers and burn-in jobs
+	// write a card, not an image
+	switch job.Kind {
+	case "firmware":
+		return m.StartFirmware()
+	case "can":
+		return m.StartCANUpdate()
+	case "burnin":
+		if !selectItemByValue(&m.DeviceList, job.Dst) {
+			m.AddLog(fmt.Sprintf("Error: cannot resume, device %s is not connected", job.Dst))
+			return m, nil
+		}
+		return m.StartBurnIn()
+	}
+
+	if !selectItemByValue(&m.ImageList, job.Src) {
+		m.AddLog(fmt.Sprintf("Error: cannot resume, image %s is no longer available", filepath.Base(job.Src)))
+		return m, nil
+	}
+
+	switch job.Kind {
+	case "flash", "verify":
+		if !selectItemByValue(&m.DeviceList, job.Dst) {
+			m.AddLog(fmt.Sprintf("Error: cannot resume, device %s is not connected", job.Dst))
+			return m, nil
+		}
+		m.Ready = true
+		if job.Kind == "verify" {
+			return m.StartVerify(m.verifyMode(job.Src))
+		}
+		return m.StartFlashing()
+	case "extract":
+		return m.UncompressImage()
+	case "check":
+		return m.StartIntegrityCheck()
+	}
+	return m, nil
+}
+
+// selectItemByValue selects the list item with the given value, reporting whether it was found
+func selectItemByValue(l *list.Model, value string) bool {
+	for i, item := range l.Items() {
+		if item.(Item).value == value {
+			l.Select(i)
+			return true
+		}
+	}
+	return false
+}
+
+// ExtractWithProgress decompresses an image in-process, like flashNative
+// writes one: flash.OpenRaw reads it and the bytes are counted on their way to
+// outputPath.part, renamed to outputPath once complete.
 func ExtractWithProgress(compressedPath, outputPath string, progressChan chan tea.Msg) tea.Cmd {
 	return func() tea.Msg {
+		defer recoverJob(progressChan)
+
 		// Send an initial message to ensure the progress listener is active
 		progressChan <- ProgressMsg("Preparing extraction...")
 
@@ -164,164 +375,141 @@ func ExtractWithProgress(compressedPath, outputPath string, progressChan chan te
 		tempPath := outputPath + ".part"
 		_ = os.Remove(tempPath) // best-effort cleanup from previous runs
 
-		// Get compressed file size for initial info
-		fileInfo, err := os.Stat(compressedPath)
+		compressedSize, err := flash.FileSize(compressedPath)
 		if err != nil {
 			return ErrorMsg{Err: fmt.Errorf("failed to get file info: %v", err)}
 		}
-		compressedSize := fileInfo.Size()
-
-		// Get uncompressed size using xz -l for accurate progress
-		sizeCmd := exec.Command("xz", "-l", compressedPath)
-		sizeOutput, err := sizeCmd.Output()
-		
-		var uncompressedSize int64
-		if err == nil {
-			// Parse xz -l output to get uncompressed size
-			lines := strings.Split(string(sizeOutput), "\n")
-			for _, line := range lines {
-				// Look for the data line (contains the filename)
-				if strings.Contains(line, filepath.Base(compressedPath)) {
-					fields := strings.Fields(line)
-					if len(fields) >= 5 {
-						// Parse the uncompressed size field (e.g., "14.3" + "GiB")
-						sizeStr := strings.ReplaceAll(fields[4], ",", "") // Remove commas
-						unitStr := fields[5] // Unit
-						
-						if sizeValue, parseErr := strconv.ParseFloat(sizeStr, 64); parseErr == nil {
-							if unitStr == "GiB" {
-								uncompressedSize = int64(sizeValue * 1024 * 1024 * 1024)
-							} else if unitStr == "MiB" {
-								uncompressedSize = int64(sizeValue * 1024 * 1024)
-							} else if unitStr == "KiB" {
-								uncompressedSize = int64(sizeValue * 1024)
-							} else if unitStr == "B" {
-								uncompressedSize = int64(sizeValue)
-							}
-						}
-						break
-					}
-				}
+		if tool := flash.DecompressTool(compressedPath); tool != "" {
+			if _, err := exec.LookPath(tool); err != nil {
+				return ErrorMsg{Err: fmt.Errorf("cannot decompress %s: %s utility not found", filepath.Base(compressedPath), tool)}
 			}
 		}
-
-		// Fallback: estimate uncompressed size as 3-5x compressed size
-		if uncompressedSize == 0 {
-			uncompressedSize = compressedSize * 4
-			progressChan <- ProgressMsg("Using estimated uncompressed size for progress")
-		}
-
-		// Show initial size information
-		progressChan <- ProgressMsg(fmt.Sprintf("Compressed: %s → Estimated uncompressed: %s", 
-			util.FormatBytes(compressedSize), util.FormatBytes(uncompressedSize)))
-
-		// Use the same pattern as flashing: xz to decompress and pv to show progress
-		// Key fix: write to temp file and rename on success
-		var cmd *exec.Cmd
-		if uncompressedSize > 0 {
-			progressChan <- ProgressMsg(fmt.Sprintf("Extracting (size: %s) → %s", util.FormatBytes(uncompressedSize), filepath.Base(tempPath)))
-			cmd = exec.Command("bash", "-c", fmt.Sprintf("set -o pipefail; xz -dc '%s' | pv -f -s %d | dd of='%s' bs=16M", 
-				compressedPath, uncompressedSize, tempPath))
+		size, exact := flash.RawSize(compressedPath)
+		if exact {
+			progressChan <- ProgressMsg(fmt.Sprintf("Compressed: %s → Uncompressed: %s",
+				util.FormatBytes(compressedSize), util.FormatBytes(size)))
 		} else {
-			progressChan <- ProgressMsg("Extracting (no size info)...")
-			cmd = exec.Command("bash", "-c", fmt.Sprintf("set -o pipefail; xz -dc '%s' | pv -f | dd of='%s' bs=16M", 
-				compressedPath, tempPath))
+			progressChan <- ProgressMsg(fmt.Sprintf("Compressed: %s → Estimated uncompressed: %s",
+				util.FormatBytes(compressedSize), util.FormatBytes(size)))
 		}
 
-		// Use pty.Start like flashing does to capture the progress bar
-		ptmx, err := pty.Start(cmd)
+		out, err := os.OpenFile(tempPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			return ErrorMsg{Err: fmt.Errorf("failed to create %s: %v", filepath.Base(tempPath), err)}
+		}
+		img, err := flash.OpenRaw(compressedPath, prioritize)
 		if err != nil {
-			return ErrorMsg{Err: fmt.Errorf("failed to start extraction command: %v", err)}
+			out.Close()
+			_ = os.Remove(tempPath)
+			return ErrorMsg{Err: err}
 		}
 
-		// Send ExtractStartedMsg so the model stores the command pointer for aborting
-		progressChan <- ExtractStartedMsg{Cmd: cmd, Pty: ptmx}
+		cancel := make(chan struct{})
+		var once sync.Once
+		progressChan <- ExtractStartedMsg{Cancel: func() {
+			once.Do(func() {
+				close(cancel)
+				img.Kill()
+			})
+		}}
+		progressChan <- ProgressMsg(fmt.Sprintf("Extracting (size: %s) → %s", util.FormatBytes(size), filepath.Base(tempPath)))
 
-		// Use the same scanning pattern as flashing
 		go func() {
-			defer ptmx.Close() // Ensure pty is closed when goroutine exits
-			
-			scanner := bufio.NewScanner(ptmx)
-			// Custom split function: split on carriage return OR newline (same as flashing)
-			scanner.Split(func(data []byte, atEOF bool) (advance int, token []byte, err error) {
-				if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
-					return i + 1, data[:i], nil
-				}
-				if atEOF && len(data) > 0 {
-					return len(data), data, nil
-				}
-				return 0, nil, nil
-			})
+			defer recoverJob(progressChan)
+			defer img.Close()
+			defer out.Close()
 
-			for scanner.Scan() {
-				line := scanner.Text()
-				trimmed := strings.TrimSpace(line)
-				if len(trimmed) > 0 {
-					// Safe send to progress channel
-					select {
-					case progressChan <- ProgressMsg(trimmed):
-					default:
-						// Channel might be closed, exit gracefully
-						return
-					}
+			fail := func(err error) {
+				_ = out.Close()
+				_ = os.Remove(tempPath)
+				select {
+				case progressChan <- ErrorMsg{Err: fmt.Errorf("extraction failed: %v", err)}:
+				default:
 				}
 			}
 
-			if err := cmd.Wait(); err != nil {
-				// On failure, ensure temp file is removed
+			// WriteAligned pads the last write to a whole sector: the file is
+			// cut back to the bytes read
+			written, err := flash.WriteAligned(img, out, size, throttledProgress(progressChan, ""), cancel)
+			if err == nil {
+				err = img.Wait()
+			}
+			select {
+			case <-cancel:
+				fail(ErrAborted)
+				return
+			default:
+			}
+			if err != nil {
+				fail(img.Explain(err))
+				return
+			}
+			if exact && written != size {
+				fail(fmt.Errorf("image ended after %s of %s", util.FormatBytes(written), util.FormatBytes(size)))
+				return
+			}
+			if err := out.Truncate(written); err != nil {
+				fail(err)
+				return
+			}
+			if err := out.Sync(); err != nil {
+				fail(err)
+				return
+			}
+			if err := os.Rename(tempPath, outputPath); err != nil {
 				_ = os.Remove(tempPath)
-				// Safe send to progress channel
 				select {
-				case progressChan <- ErrorMsg{Err: fmt.Errorf("extraction failed: %v", err)}:
+				case progressChan <- ErrorMsg{Err: fmt.Errorf("failed to finalize extracted image: %v", err)}:
 				default:
-					// Channel might be closed, exit gracefully
-					return
-				}
-			} else {
-				// Sync and atomically move temp to final name
-				_ = exec.Command("sync").Run()
-				if err := os.Rename(tempPath, outputPath); err != nil {
-					_ = os.Remove(tempPath)
-					// Safe send to progress channel
-					select {
-					case progressChan <- ErrorMsg{Err: fmt.Errorf("failed to finalize extracted image: %v", err)}:
-					default:
-						return
-					}
-					return
 				}
+				return
+			}
 
-				// Get final size and notify
-				if finalInfo, err := os.Stat(outputPath); err == nil {
-					finalSize := finalInfo.Size()
-					select {
-					case progressChan <- ProgressMsg(fmt.Sprintf("Extraction complete. Final size: %s", util.FormatBytes(finalSize))):
-					default:
-						return
-					}
-				}
+			// Keep provenance metadata with the extracted image
+			if err := copyImageMeta(compressedPath, outputPath); err != nil {
 				select {
-				case progressChan <- ExtractCompletedMsg{Src: compressedPath, Dst: outputPath}:
+				case progressChan <- ProgressMsg(fmt.Sprintf("Warning: failed to copy metadata: %v", err)):
 				default:
-					return
 				}
 			}
+
+			flash.RememberSize(compressedPath, written)
+			select {
+			case progressChan <- ProgressMsg(fmt.Sprintf("Extraction complete. Final size: %s", util.FormatBytes(written))):
+			default:
+				return
+			}
+			select {
+			case progressChan <- ExtractCompletedMsg{Src: compressedPath, Dst: outputPath}:
+			default:
+			}
 		}()
 
 		return nil
 	}
 }
 
-// UncompressImage extracts a .img.xz file
+// UncompressImage extracts an xz-, zstd- or bzip2-compressed image (.img.xz,
+// .wic.zst, .img.bz2, ...) or the image inside a .zip archive
 func (m *Model) UncompressImage() (tea.Model, tea.Cmd) {
-	if !m.IsCompressedImageSelected() || m.Extracting {
+	if !m.IsCompressedImageSelected() || m.Busy() {
+		return m, nil
+	}
+	if maintenanceBlocksImages() {
+		m.AddLog("Extraction is paused while maintenance reorganizes the image directory.")
 		return m, nil
 	}
 
 	compressedPath := m.ImageList.SelectedItem().(Item).value
-	outputPath := strings.TrimSuffix(compressedPath, ".xz")
+	outputPath := flash.ExtractedPath(compressedPath)
+	jobID, err := beginJob("extract", compressedPath, outputPath, m.Operator)
+	if err != nil {
+		m.AddLog(fmt.Sprintf("Error: %v", err))
+		return m, nil
+	}
 
 	// Track paths on the model for abort cleanup
+	m.Chain = nil
 	m.ExtractOutputPath = outputPath
 	m.ExtractTempPath = outputPath + ".part"
 	_ = os.Remove(m.ExtractTempPath)
@@ -332,6 +520,7 @@ func (m *Model) UncompressImage() (tea.Model, tea.Cmd) {
 		m.AddLog(fmt.Sprintf("> Output file %s already exists. Removing...", filepath.Base(outputPath)))
 		// Remove the existing file
 		if err := os.Remove(outputPath); err != nil {
+			endJob(jobID)
 			return m, func() tea.Msg {
 				return ErrorMsg{Err: fmt.Errorf("failed to remove existing file: %v", err)}
 			}
@@ -341,22 +530,18 @@ func (m *Model) UncompressImage() (tea.Model, tea.Cmd) {
 	// Set extraction state immediately
 	m.Extracting = true
 	m.ExtractStartTime = time.Now() // Record the start time
+	m.JobID = jobID
 	m.AddLog(fmt.Sprintf("> Uncompressing %s to %s...", filepath.Base(compressedPath), filepath.Base(outputPath)))
 
 	// Force cleanup of any previous state
-	m.ExtractCmd = nil
-	m.ExtractPty = nil
+	m.ExtractCancel = nil
 	m.Aborting = false  // Clear aborting state
 	
 	// Create a new buffered progress channel for this operation (like flashing does)
 	m.ProgressChan = make(chan tea.Msg, 100)
 
-	// Set focus to the Abort button based on system type
-	if util.IsRaspberryPi() {
-		m.ActiveList = 6 // Abort button index on Pi
-	} else {
-		m.ActiveList = 5 // Abort button index on non-Pi
-	}
+	// Set focus to the Abort button
+	m.FocusButton("abort-button")
 
 	// Start the extraction with progress reporting
 	return m, tea.Batch(
@@ -372,32 +557,27 @@ func (m *Model) UncompressImage() (tea.Model, tea.Cmd) {
 
 // StartIntegrityCheck initializes integrity checking for the selected image
 func (m *Model) StartIntegrityCheck() (tea.Model, tea.Cmd) {
-	if m.ImageList.SelectedItem() == nil || m.Checking || m.Flashing || m.Extracting {
+	if !m.imageSelected() || m.Busy() {
 		return m, nil
 	}
 
 	imagePath := m.ImageList.SelectedItem().(Item).value
 
+	jobID, err := beginJob("check", imagePath, "", m.Operator)
+	if err != nil {
+		m.AddLog(fmt.Sprintf("Error: %v", err))
+		return m, nil
+	}
+
 	// Prepare state
 	m.ProgressChan = make(chan tea.Msg, 100)
 	m.Checking = true
 	m.Aborting = false
+	m.JobID = jobID
 	m.AddLog(fmt.Sprintf("> Checking integrity of %s...", filepath.Base(imagePath)))
 
 	// Focus Abort
-	if util.IsRaspberryPi() {
-		if m.IsCompressedImageSelected() {
-			m.ActiveList = 6
-		} else {
-			m.ActiveList = 5
-		}
-	} else {
-		if m.IsCompressedImageSelected() {
-			m.ActiveList = 5
-		} else {
-			m.ActiveList = 4
-		}
-	}
+	m.FocusButton("abort-button")
 
 	return m, tea.Batch(
 		CheckIntegrity(imagePath, m.ProgressChan),
@@ -406,45 +586,69 @@ func (m *Model) StartIntegrityCheck() (tea.Model, tea.Cmd) {
 }
 
 // CheckIntegrity streams progress while verifying the selected image
-// - For .img.xz: runs `xz -tv <file>` and streams its progress
-// - For .img: compares sha256sum of file against `<file>.checksum`; streams pv progress
+// - For .xz images: runs `xz -tv <file>` (`unzip -tq` for .zip) and streams its progress
+// - For raw .img/.wic/.iso: compares sha256sum of file against a checksum sidecar
+//   (see flash.SidecarChecksum); streams pv progress
 func CheckIntegrity(imagePath string, progressChan chan tea.Msg) tea.Cmd {
 	return func() tea.Msg {
-		isCompressed := strings.HasSuffix(imagePath, ".img.xz")
+		defer recoverJob(progressChan)
+
+		if demoMode {
+			demoCheck(imagePath, progressChan)
+			return nil
+		}
+
+		isCompressed := flash.IsCompressed(imagePath)
+		testCmd, method := fmt.Sprintf("xz -T0 -tv '%s'", imagePath), "xz -tv"
+		if flash.IsZip(imagePath) {
+			testCmd, method = fmt.Sprintf("unzip -tq '%s'", imagePath), "unzip -tq"
+		} else if flash.IsZstd(imagePath) {
+			testCmd, method = fmt.Sprintf("zstd -tv '%s'", imagePath), "zstd -tv"
+		} else if flash.IsBzip2(imagePath) {
+			testCmd, method = fmt.Sprintf("bzip2 -tv '%s'", imagePath), "bzip2 -tv"
+		}
+		// pv over the file (or the joined parts of a split image) for hashing
+		readCmd, err := flash.PVShell(imagePath)
+		if err != nil {
+			return ErrorMsg{Err: err}
+		}
+		if flash.IsSplit(imagePath) && flash.IsXZ(imagePath) {
+			testCmd = readCmd + " | xz -T0 -t"
+		} else if flash.IsSplit(imagePath) && flash.IsZstd(imagePath) {
+			testCmd = readCmd + " | zstd -tq"
+		} else if flash.IsSplit(imagePath) && flash.IsBzip2(imagePath) {
+			testCmd = readCmd + " | bzip2 -t"
+		}
 
 		var cmd *exec.Cmd
 		var haveExpected bool
 		var expectedFromSidecar string
 		if isCompressed {
-			cmd = exec.Command("bash", "-c", fmt.Sprintf("set -o pipefail; xz -tv '%s'", imagePath))
+			cmd = util.Command("bash", "-c", "set -o pipefail; "+testCmd)
 		} else {
-			checksumPath := imagePath + ".checksum"
-			if data, err := os.ReadFile(checksumPath); err == nil {
-				expectedFromSidecar = strings.TrimSpace(string(data))
-				if sp := strings.Fields(expectedFromSidecar); len(sp) > 0 { expectedFromSidecar = sp[0] }
+			if sum, checksumPath := flash.SidecarChecksum(imagePath); checksumPath != "" {
+				expectedFromSidecar = sum
 				if matched, _ := regexp.MatchString(`^[0-9a-fA-F]{64}$`, expectedFromSidecar); matched {
 					haveExpected = true
 				} else {
 					progressChan <- ProgressMsg(fmt.Sprintf("Warning: invalid checksum format in %s; will compute actual hash only", filepath.Base(checksumPath)))
 				}
 			} else {
-				progressChan <- ProgressMsg(fmt.Sprintf("No %s found; computing actual SHA-256 only", filepath.Base(checksumPath)))
+				progressChan <- ProgressMsg(fmt.Sprintf("No %s.checksum or SHA256SUMS entry found; computing actual SHA-256 only", filepath.Base(imagePath)))
 			}
-			cmd = exec.Command("bash", "-c", fmt.Sprintf("set -o pipefail; pv -f '%s' | sha256sum", imagePath))
+			cmd = util.Command("bash", "-c", "set -o pipefail; "+readCmd+" | sha256sum")
 		}
+		prioritize(cmd)
 
 		ptmx, err := pty.Start(cmd)
 		if err != nil { return ErrorMsg{Err: fmt.Errorf("failed to start integrity command: %v", err)} }
 		progressChan <- CheckStartedMsg{Cmd: cmd, Pty: ptmx}
 
 		go func() {
+			defer recoverJob(progressChan)
 			defer ptmx.Close()
 			scanner := bufio.NewScanner(ptmx)
-			scanner.Split(func(data []byte, atEOF bool) (advance int, token []byte, err error) {
-				if i := bytes.IndexAny(data, "\r\n"); i >= 0 { return i + 1, data[:i], nil }
-				if atEOF && len(data) > 0 { return len(data), data, nil }
-				return 0, nil, nil
-			})
+			scanner.Split(splitCRLF)
 
 			var finalHash string
 			hashRe := regexp.MustCompile(`^[0-9a-fA-F]{64}`)
@@ -462,14 +666,22 @@ func CheckIntegrity(imagePath string, progressChan chan tea.Msg) tea.Cmd {
 			if isCompressed {
 				ok := (err == nil)
 				if ok {
+					// The size of a sound archive is worth keeping for flashing it
+					if flash.IsXZ(imagePath) {
+						flash.XZUncompressedSize(imagePath)
+						if blocks, ok := flash.XZBlocks(imagePath); ok && blocks == 1 {
+							select { case progressChan <- ProgressMsg("Note: this archive is a single xz block and decompresses on one core. Recompressing it with xz -T0 (or recompress_xz in maintenance) lets it decompress on every core."): default: }
+						}
+					}
 					// Also compute sha256 for the compressed file to record actual
 					finalHash = ""
 					select { case progressChan <- ProgressMsg("Integrity OK. Computing SHA-256 of compressed file..."): default: }
-					hashCmd := exec.Command("bash", "-c", fmt.Sprintf("set -o pipefail; pv -f '%s' | sha256sum", imagePath))
+					hashCmd := util.Command("bash", "-c", "set -o pipefail; "+readCmd+" | sha256sum")
+					prioritize(hashCmd)
 					hashPty, herr := pty.Start(hashCmd)
 					if herr != nil {
 						// Save ok status without actual if hashing can't start
-						_ = saveIntegrityResult(imagePath, IntegrityEntry{ Type: "compressed", Method: "xz -tv", Status: "ok", CheckedAt: time.Now().Format(time.RFC3339) })
+						_ = saveIntegrityResult(imagePath, IntegrityEntry{ Type: "compressed", Method: method, Status: "ok", CheckedAt: time.Now().Format(time.RFC3339) })
 						select { case progressChan <- ErrorMsg{Err: fmt.Errorf("failed to start sha256sum: %v", herr)}: default: }
 						select { case progressChan <- CheckCompletedMsg{File: imagePath, Ok: true}: default: }
 						return
@@ -479,11 +691,7 @@ func CheckIntegrity(imagePath string, progressChan chan tea.Msg) tea.Cmd {
 
 					// Scan hash progress and capture final hash
 					hScanner := bufio.NewScanner(hashPty)
-					hScanner.Split(func(data []byte, atEOF bool) (advance int, token []byte, err error) {
-						if i := bytes.IndexAny(data, "\r\n"); i >= 0 { return i + 1, data[:i], nil }
-						if atEOF && len(data) > 0 { return len(data), data, nil }
-						return 0, nil, nil
-					})
+					hScanner.Split(splitCRLF)
 					for hScanner.Scan() {
 						line := strings.TrimSpace(hScanner.Text())
 						if line == "" { continue }
@@ -497,7 +705,7 @@ func CheckIntegrity(imagePath string, progressChan chan tea.Msg) tea.Cmd {
 					_ = hashPty.Close()
 
 					// Save ok status with actual hash (if captured)
-					if werr := saveIntegrityResult(imagePath, IntegrityEntry{ Type: "compressed", Method: "xz -tv", Status: "ok", CheckedAt: time.Now().Format(time.RFC3339), Actual: finalHash }); werr != nil {
+					if werr := saveIntegrityResult(imagePath, IntegrityEntry{ Type: "compressed", Method: method, Status: "ok", CheckedAt: time.Now().Format(time.RFC3339), Actual: finalHash }); werr != nil {
 						select { case progressChan <- ErrorMsg{Err: fmt.Errorf("failed to write integrity.yaml: %v", werr)}: default: }
 					} else {
 						select { case progressChan <- ProgressMsg(fmt.Sprintf("Saved integrity record to %s", filepath.Join(filepath.Dir(imagePath), "integrity.yaml"))): default: }
@@ -508,11 +716,12 @@ func CheckIntegrity(imagePath string, progressChan chan tea.Msg) tea.Cmd {
 
 				// Failed xz -tv: compute sha256sum to capture actual checksum
 				select { case progressChan <- ProgressMsg("Integrity failed. Computing SHA-256 of compressed file..."): default: }
-				hashCmd := exec.Command("bash", "-c", fmt.Sprintf("set -o pipefail; pv -f '%s' | sha256sum", imagePath))
+				hashCmd := util.Command("bash", "-c", "set -o pipefail; "+readCmd+" | sha256sum")
+				prioritize(hashCmd)
 				hashPty, herr := pty.Start(hashCmd)
 				if herr != nil {
 					// Couldn't start hashing; still save failed status without actual
-					_ = saveIntegrityResult(imagePath, IntegrityEntry{ Type: "compressed", Method: "xz -tv", Status: "failed", CheckedAt: time.Now().Format(time.RFC3339) })
+					_ = saveIntegrityResult(imagePath, IntegrityEntry{ Type: "compressed", Method: method, Status: "failed", CheckedAt: time.Now().Format(time.RFC3339) })
 					select { case progressChan <- ErrorMsg{Err: fmt.Errorf("failed to start sha256sum: %v", herr)}: default: }
 					select { case progressChan <- CheckCompletedMsg{File: imagePath, Ok: false}: default: }
 					return
@@ -522,11 +731,7 @@ func CheckIntegrity(imagePath string, progressChan chan tea.Msg) tea.Cmd {
 
 				// Scan hash progress and capture final hash
 				hScanner := bufio.NewScanner(hashPty)
-				hScanner.Split(func(data []byte, atEOF bool) (advance int, token []byte, err error) {
-					if i := bytes.IndexAny(data, "\r\n"); i >= 0 { return i + 1, data[:i], nil }
-					if atEOF && len(data) > 0 { return len(data), data, nil }
-					return 0, nil, nil
-				})
+				hScanner.Split(splitCRLF)
 				for hScanner.Scan() {
 					line := strings.TrimSpace(hScanner.Text())
 					if line == "" { continue }
@@ -540,7 +745,7 @@ func CheckIntegrity(imagePath string, progressChan chan tea.Msg) tea.Cmd {
 				_ = hashPty.Close()
 
 				// Save failed status with actual hash (if captured)
-				if werr := saveIntegrityResult(imagePath, IntegrityEntry{ Type: "compressed", Method: "xz -tv", Status: "failed", CheckedAt: time.Now().Format(time.RFC3339), Actual: finalHash }); werr != nil {
+				if werr := saveIntegrityResult(imagePath, IntegrityEntry{ Type: "compressed", Method: method, Status: "failed", CheckedAt: time.Now().Format(time.RFC3339), Actual: finalHash }); werr != nil {
 					select { case progressChan <- ErrorMsg{Err: fmt.Errorf("failed to write integrity.yaml: %v", werr)}: default: }
 				} else {
 					select { case progressChan <- ProgressMsg(fmt.Sprintf("Saved integrity record to %s", filepath.Join(filepath.Dir(imagePath), "integrity.yaml"))): default: }
@@ -581,9 +786,46 @@ type IntegrityEntry struct {
 	CheckedAt string `yaml:"checked_at"`
 	Expected  string `yaml:"expected,omitempty"`
 	Actual    string `yaml:"actual,omitempty"`
+	Clock     string `yaml:"clock,omitempty"` // "unsynced" when CheckedAt may be wrong
+
+	// Uncompressed size of an xz image, kept by integritySizes
+	RawSize   int64  `yaml:"raw_size,omitempty"`
+	RawSizeOf string `yaml:"raw_size_of,omitempty"` // archiveStamp of the image it was found for
+}
+
+// loadIntegrityEntry returns the integrity.yaml record for an image, if any
+func loadIntegrityEntry(imagePath string) (IntegrityEntry, bool) {
+	yamlPath := filepath.Join(filepath.Dir(imagePath), "integrity.yaml")
+	b, err := os.ReadFile(yamlPath)
+	if err != nil {
+		return IntegrityEntry{}, false
+	}
+	var doc IntegrityFile
+	if yaml.Unmarshal(b, &doc) != nil || doc.Files == nil {
+		return IntegrityEntry{}, false
+	}
+	entry, ok := doc.Files[filepath.Base(imagePath)]
+	return entry, ok
 }
 
 func saveIntegrityResult(imagePath string, entry IntegrityEntry) error {
+	entry.Clock = clockMark()
+	return updateIntegrityEntry(imagePath, func(old IntegrityEntry) IntegrityEntry {
+		// A check keeps the cached size
+		entry.RawSize, entry.RawSizeOf = old.RawSize, old.RawSizeOf
+		return entry
+	})
+}
+
+// integrityMu serializes updates of integrity.yaml files: sessions check images
+// and cache their sizes at the same time.
+var integrityMu sync.Mutex
+
+// updateIntegrityEntry replaces the integrity.yaml record of an image by what
+// update makes of it.
+func updateIntegrityEntry(imagePath string, update func(IntegrityEntry) IntegrityEntry) error {
+	integrityMu.Lock()
+	defer integrityMu.Unlock()
 	dir := filepath.Dir(imagePath)
 	yamlPath := filepath.Join(dir, "integrity.yaml")
 
@@ -592,13 +834,18 @@ func saveIntegrityResult(imagePath string, entry IntegrityEntry) error {
 		_ = yaml.Unmarshal(b, &doc)
 	}
 	if doc.Files == nil { doc.Files = make(map[string]IntegrityEntry) }
-	doc.Files[filepath.Base(imagePath)] = entry
+	doc.Files[filepath.Base(imagePath)] = update(doc.Files[filepath.Base(imagePath)])
 
 	out, err := yaml.Marshal(&doc)
 	if err != nil { return err }
-	tmp := yamlPath + ".tmp"
-	if err := os.WriteFile(tmp, out, 0644); err != nil { return err }
-	return os.Rename(tmp, yamlPath)
+	tmp, err := os.CreateTemp(dir, ".integrity-*.yaml")
+	if err != nil { return err }
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(out)
+	if cerr := tmp.Close(); err == nil { err = cerr }
+	if err == nil { err = os.Chmod(tmp.Name(), 0644) }
+	if err != nil { return err }
+	return os.Rename(tmp.Name(), yamlPath)
 }
 
 func ternary[T any](cond bool, a, b T) T { if cond { return a }; return b }
@@ -0,0 +1,214 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/husarion/husarion-os-flasher/internal/plugin"
+	"github.com/husarion/husarion-os-flasher/util"
+)
+
+// Plugin request timeouts. The images request is made in the background while
+// the image list refreshes; verify and post_flash requests may do real work on
+// the device.
+const (
+	pluginImagesTimeout = 10 * time.Second
+	pluginStepTimeout   = 10 * time.Minute
+)
+
+// pluginImagesInterval is how long the images of the plugins are kept before
+// they are requested again.
+const pluginImagesInterval = 10 * time.Second
+
+// pluginState holds the plugins of the process, shared by all sessions.
+var pluginState = struct {
+	sync.Mutex
+	plugins  []*plugin.Plugin
+	images   []string
+	fetched  time.Time // zero before the first images request
+	fetching bool
+	failures map[string]string // last images error of each plugin
+}{failures: make(map[string]string)}
+
+// LoadPlugins starts the plugins in dir. Plugins that fail to start are
+// returned as errors and left out.
+func LoadPlugins(dir string) []error {
+	plugins, errs := plugin.Load(dir, util.Version)
+	pluginState.Lock()
+	pluginState.plugins = plugins
+	pluginState.Unlock()
+	return errs
+}
+
+// ClosePlugins stops the plugins.
+func ClosePlugins() {
+	pluginState.Lock()
+	plugins := pluginState.plugins
+	pluginState.plugins = nil
+	pluginState.Unlock()
+	for _, p := range plugins {
+		p.Close()
+	}
+}
+
+// pluginsWith returns the plugins that declared a capability.
+func pluginsWith(capability string) []*plugin.Plugin {
+	pluginState.Lock()
+	defer pluginState.Unlock()
+	var plugins []*plugin.Plugin
+	for _, p := range pluginState.plugins {
+		if p.Has(capability) {
+			plugins = append(plugins, p)
+		}
+	}
+	return plugins
+}
+
+// ImageFiles lists the images that can be flashed: those of osImgPath that are
+// not being written, and those the plugins add.
+func ImageFiles(osImgPath string) ([]string, error) {
+	images, err := listImages(osImgPath)
+	if err != nil {
+		return nil, err
+	}
+	images = slices.Clone(images)
+	for _, img := range pluginImages() {
+		if !slices.Contains(images, img) {
+			images = append(images, img)
+		}
+	}
+	return images, nil
+}
+
+// pluginImages returns the images the plugins add. They are requested on the
+// first call, then again in the background once pluginImagesInterval passed,
+// so a slow plugin does not hold up the image list.
+func pluginImages() []string {
+	pluginState.Lock()
+	if len(pluginState.plugins) == 0 {
+		pluginState.Unlock()
+		return nil
+	}
+	first := pluginState.fetched.IsZero()
+	stale := time.Since(pluginState.fetched) >= pluginImagesInterval && !pluginState.fetching
+	if stale {
+		pluginState.fetching = true
+	}
+	images := pluginState.images
+	pluginState.Unlock()
+
+	if first && stale {
+		fetchPluginImages()
+		pluginState.Lock()
+		defer pluginState.Unlock()
+		return pluginState.images
+	} else if stale {
+		go fetchPluginImages()
+	}
+	return images
+}
+
+// fetchPluginImages requests the images of the plugins. Images that do not
+// exist are left out. A failing plugin is logged to the sessions once, until
+// it fails differently.
+func fetchPluginImages() {
+	var images []string
+	for _, p := range pluginsWith(plugin.Images) {
+		var list []plugin.Image
+		err := p.Call("images", nil, &list, pluginImagesTimeout)
+		pluginState.Lock()
+		failure := ""
+		if err != nil {
+			failure = err.Error()
+		}
+		changed := pluginState.failures[p.Name] != failure
+		pluginState.failures[p.Name] = failure
+		pluginState.Unlock()
+		if err != nil {
+			if changed {
+				logInventory("Images unavailable: " + failure)
+			}
+			continue
+		}
+		for _, img := range list {
+			if !filepath.IsAbs(img.Path) {
+				continue
+			}
+			if st, err := os.Stat(img.Path); err == nil && st.Mode().IsRegular() {
+				images = append(images, img.Path)
+			}
+		}
+	}
+
+	pluginState.Lock()
+	defer pluginState.Unlock()
+	pluginState.images = images
+	pluginState.fetched = time.Now()
+	pluginState.fetching = false
+}
+
+// hasPluginSteps reports whether a plugin acts after a flash, or only after a
+// verify job when flashed is false.
+func hasPluginSteps(flashed bool) bool {
+	return len(pluginsWith(plugin.Verify)) > 0 || flashed && len(pluginsWith(plugin.PostFlash)) > 0
+}
+
+// RunPluginSteps runs the verify step of the plugins on a device that passed
+// the flasher's own checks, then, if flashed, their post_flash step. It sends
+// done with Plugins set when every plugin succeeded, or the first failure. An
+// abort stops it between two steps.
+func RunPluginSteps(done DoneMsg, flashed bool, progressChan chan tea.Msg) tea.Cmd {
+	return func() tea.Msg {
+		defer recoverJob(progressChan)
+
+		cancel := make(chan struct{})
+		var once sync.Once
+		progressChan <- DDStartedMsg{Cancel: func() {
+			once.Do(func() { close(cancel) })
+		}}
+
+		methods := []string{plugin.Verify}
+		if flashed {
+			methods = append(methods, plugin.PostFlash)
+		}
+		params := map[string]string{"image": done.Src, "device": done.Dst}
+		for _, method := range methods {
+			for _, p := range pluginsWith(method) {
+				select {
+				case <-cancel:
+					// AbortOperation reports completion
+					return nil
+				case progressChan <- ProgressMsg(fmt.Sprintf("Running %s of plugin %s on %s...", method, p.Name, done.Dst)):
+				}
+				var res plugin.Result
+				err := p.Call(method, params, &res, pluginStepTimeout)
+				if err == nil && !res.OK {
+					err = fmt.Errorf("plugin %s: %s failed", p.Name, method)
+					if res.Message != "" {
+						err = fmt.Errorf("%v: %s", err, res.Message)
+					}
+				}
+				select {
+				case <-cancel:
+					return nil
+				default:
+				}
+				if err != nil {
+					return ErrorMsg{Err: err}
+				}
+				if res.Message != "" {
+					progressChan <- ProgressMsg(res.Message)
+				}
+			}
+		}
+
+		done.Plugins = true
+		return done
+	}
+}
@@ -0,0 +1,321 @@
+package ui
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	gossh "golang.org/x/crypto/ssh"
+
+	"github.com/husarion/husarion-os-flasher/config"
+	"github.com/husarion/husarion-os-flasher/internal/flash"
+	"github.com/husarion/husarion-os-flasher/internal/sign"
+	"github.com/husarion/husarion-os-flasher/platform"
+)
+
+// errPolicyAborted is returned by checkImagePolicy when the job was aborted.
+var errPolicyAborted = errors.New("aborted")
+
+// imageProfile returns the name of the verification profile of an image: the
+// one its metadata names, else the station's. It is empty for neither.
+func imageProfile(cfg *config.Config, image string) string {
+	if meta := LoadImageMeta(image); meta != nil && meta.Profile != "" {
+		return meta.Profile
+	}
+	if cfg == nil {
+		return ""
+	}
+	return cfg.VerifyProfile
+}
+
+// verifyProfile returns the verification profile of an image, nil when it has
+// none or names one the config does not define, which checkImagePolicy
+// refuses.
+func verifyProfile(cfg *config.Config, image string) *config.VerifyProfile {
+	return cfg.VerifyProfileNamed(imageProfile(cfg, image))
+}
+
+// verifyPolicy returns the check run after flashing an image: that of its
+// verification profile, else the verify policy of the config.
+func verifyPolicy(cfg *config.Config, image string) string {
+	if p := verifyProfile(cfg, image); p != nil {
+		if p.Verify == "" {
+			return "none"
+		}
+		return p.Verify
+	}
+	return cfg.VerifyPolicy()
+}
+
+// policyResult is what checkImagePolicy found about an image, for the
+// verification report.
+type policyResult struct {
+	Hashes    []string // "<algorithm>:<hex digest>"
+	Signature string   // fingerprint of the key that signed the image
+}
+
+// policyState holds the results of checkImagePolicy until the report of the
+// flash is written, by device: a device is written by one job at a time.
+var policyState = struct {
+	sync.Mutex
+	results map[string]policyResult
+}{results: make(map[string]policyResult)}
+
+// takePolicyResult returns and forgets the result of checkImagePolicy for the
+// flash to device.
+func takePolicyResult(device string) policyResult {
+	policyState.Lock()
+	defer policyState.Unlock()
+	r := policyState.results[device]
+	delete(policyState.results, device)
+	return r
+}
+
+// checkImagePolicy applies the verification profile of src before it is
+// written to dst: it hashes the image file with the profile's algorithms,
+// compares the SHA-256 with a checksum sidecar and checks the signature when
+// the profile requires one. The image is read once, and the job can be
+// aborted meanwhile.
+func checkImagePolicy(src, dst string, progressChan chan tea.Msg) error {
+	cfg := currentConfig()
+	name := imageProfile(cfg, src)
+	if name == "" {
+		return nil
+	}
+	p := cfg.VerifyProfileNamed(name)
+	if p == nil {
+		return fmt.Errorf("%s needs verification profile %q, which the config does not define", filepath.Base(src), name)
+	}
+	var keys []gossh.PublicKey
+	if p.RequireSignature {
+		var err error
+		if keys, err = sign.LoadKeys(p.Signers); err != nil {
+			return fmt.Errorf("verification profile %s: %w", p.Name, err)
+		}
+		if _, err := os.Stat(flash.SplitBase(src) + sign.Suffix); err != nil {
+			return fmt.Errorf("verification profile %s requires a signed image, %s has no %s", p.Name, filepath.Base(src), sign.Suffix)
+		}
+	}
+
+	algorithms := append([]string(nil), p.Hashes...)
+	if p.RequireSignature {
+		// ssh-keygen signs a SHA-512 by default, the flasher always does
+		algorithms = append(algorithms, "sha256", "sha512")
+	}
+	var result policyResult
+	if len(algorithms) > 0 {
+		sums, err := hashImage(src, algorithms, progressChan)
+		if err != nil {
+			return err
+		}
+		for _, alg := range p.Hashes {
+			result.Hashes = append(result.Hashes, alg+":"+hex.EncodeToString(sums[alg]))
+		}
+		if want, sidecar := flash.SidecarChecksum(src); want != "" && !flash.IsCompressed(src) && sums["sha256"] != nil {
+			if got := hex.EncodeToString(sums["sha256"]); !strings.EqualFold(got, want) {
+				return fmt.Errorf("SHA-256 of %s is %s, %s expects %s", filepath.Base(src), got, filepath.Base(sidecar), want)
+			}
+			progressChan <- ProgressMsg("SHA-256 matches " + filepath.Base(sidecar) + ".")
+		}
+		if p.RequireSignature {
+			key, err := sign.Verify(flash.SplitBase(src), sums, keys)
+			if err != nil {
+				return fmt.Errorf("signature of %s: %w", filepath.Base(src), err)
+			}
+			result.Signature = gossh.FingerprintSHA256(key)
+			progressChan <- ProgressMsg("Signature verified, signed by " + result.Signature + ".")
+		}
+	}
+
+	policyState.Lock()
+	policyState.results[dst] = result
+	policyState.Unlock()
+	return nil
+}
+
+// hashImage computes the digests of an image file, joining split parts, with
+// each of algorithms. It can be aborted like a write.
+func hashImage(src string, algorithms []string, progressChan chan tea.Msg) (map[string][]byte, error) {
+	hashes := make(map[string]hash.Hash)
+	var writers []io.Writer
+	for _, alg := range algorithms {
+		if hashes[alg] != nil {
+			continue
+		}
+		switch alg {
+		case "sha256":
+			hashes[alg] = sha256.New()
+		case "sha512":
+			hashes[alg] = sha512.New()
+		}
+		writers = append(writers, hashes[alg])
+	}
+	size, _ := flash.FileSize(src)
+	f, err := flash.OpenFile(src)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cancel := make(chan struct{})
+	var once sync.Once
+	progressChan <- DDStartedMsg{Cancel: func() { once.Do(func() { close(cancel) }) }}
+	progressChan <- ProgressMsg(fmt.Sprintf("Hashing %s (%s)...", filepath.Base(src), strings.Join(algorithms, ", ")))
+
+	progress := throttledProgress(progressChan, "hashed ")
+	w := io.MultiWriter(writers...)
+	buf := make([]byte, 4<<20)
+	var done int64
+	start := time.Now()
+	for {
+		select {
+		case <-cancel:
+			return nil, errPolicyAborted
+		default:
+		}
+		n, err := f.Read(buf)
+		if n > 0 {
+			w.Write(buf[:n])
+			done += int64(n)
+			progress(done, max(size, done), time.Since(start))
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	sums := make(map[string][]byte)
+	for alg, h := range hashes {
+		sums[alg] = h.Sum(nil)
+	}
+	return sums, nil
+}
+
+// writeVerifyReport writes the verification report of a flash whose profile
+// asks for one, logging where.
+func (m *Model) writeVerifyReport(job JobRecord, result string, jobErr error) {
+	path, err := verifyReport(m.Config, job, result, jobErr)
+	if err != nil {
+		m.AddLog(fmt.Sprintf("Error: writing the verification report failed: %v", err))
+	} else if path != "" {
+		m.AddLog("Verification report written to " + path)
+	}
+}
+
+// verifyReport writes the verification report of a flash whose profile asks
+// for one, with the fields of the profile in their order, into the log
+// directory. It returns the path of the report, empty when the flash needs
+// none.
+func verifyReport(cfg *config.Config, job JobRecord, result string, jobErr error) (string, error) {
+	policy := takePolicyResult(job.Dst)
+	p := verifyProfile(cfg, job.Src)
+	crashState.Lock()
+	imgPath := crashState.imgPath
+	crashState.Unlock()
+	if p == nil || len(p.Report) == 0 || job.Kind != "flash" || imgPath == "" {
+		return "", nil
+	}
+	finished := time.Now().Format(time.RFC3339)
+	if clockMark() != "" {
+		finished += " (unsynced clock)"
+	}
+	if jobErr != nil {
+		result += ": " + jobErr.Error()
+	}
+	lines := []string{"Verification report", ""}
+	for _, field := range p.Report {
+		var label, value string
+		switch field {
+		case "image":
+			label, value = "Image", filepath.Base(job.Src)
+		case "version":
+			label, value = "Version", "unknown"
+			if meta := LoadImageMeta(job.Src); meta != nil && meta.Summary() != "" {
+				value = meta.Summary()
+			}
+		case "device":
+			label, value = "Device", job.Dst
+			if model := platform.Model(job.Dst); model != "" {
+				value += " (" + model + ")"
+			}
+		case "device_serial":
+			label, value = "Device serial", orUnknown(platform.Serial(job.Dst))
+		case "operator":
+			label, value = "Operator", job.Operator
+		case "robot":
+			label, value = "Robot", "not detected"
+			if job.Robot != "" {
+				value = strings.TrimSpace(job.Robot + " " + job.RobotRevision + " " + job.RobotSerial)
+			}
+		case "profile":
+			label, value = "Profile", p.Name
+		case "verify":
+			label, value = "Verify", verifyPolicy(cfg, job.Src)
+		case "hashes":
+			label, value = "Hashes", "none"
+			if len(policy.Hashes) > 0 {
+				value = strings.Join(policy.Hashes, "\n"+strings.Repeat(" ", 15))
+			}
+		case "signature":
+			label, value = "Signature", "not required"
+			if p.RequireSignature {
+				value = orUnknown(policy.Signature)
+			}
+		case "started":
+			label, value = "Started", job.Started.Format(time.RFC3339)
+		case "finished":
+			label, value = "Finished", finished
+		case "result":
+			label, value = "Result", result
+		}
+		lines = append(lines, fmt.Sprintf("%-14s %s", label+":", value))
+	}
+
+	dir := crashDir(imgPath)
+	path := filepath.Join(dir, fmt.Sprintf("verification-%s-%d.txt", time.Now().Format("20060102-150405"), job.ID))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	return path, os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
+
+// verifyProfileLine describes the verification of the selected image in the
+// info panel.
+func (m *Model) verifyProfileLine(image string) string {
+	mode := verifyPolicy(m.Config, image)
+	line := "Verify policy: " + mode + " (" + verifyDescriptions[mode] + ")"
+	name := imageProfile(m.Config, image)
+	if name == "" {
+		return line
+	}
+	p := m.Config.VerifyProfileNamed(name)
+	if p == nil {
+		return line + "\nProfile: " + name + " (not defined in the config, flashing is refused)"
+	}
+	var needs []string
+	if len(p.Hashes) > 0 {
+		needs = append(needs, strings.Join(p.Hashes, ", "))
+	}
+	if p.RequireSignature {
+		needs = append(needs, "signature required")
+	}
+	if len(p.Report) > 0 {
+		needs = append(needs, "report")
+	}
+	if len(needs) == 0 {
+		return line + "\nProfile: " + p.Name
+	}
+	return line + "\nProfile: " + p.Name + " (" + strings.Join(needs, ", ") + ")"
+}
@@ -0,0 +1,164 @@
+package ui
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/husarion/husarion-os-flasher/util"
+)
+
+// Bits of the throttled state reported by vcgencmd get_throttled on a
+// Raspberry Pi.
+const (
+	throttledUndervoltage     = 1 << 0  // the supply voltage is low now
+	throttledUndervoltageSeen = 1 << 16 // it was low at some point since boot
+)
+
+// undervoltageWarning is logged once for a flash during which the supply
+// voltage dropped.
+const undervoltageWarning = "Warning: the supply voltage dropped during this flash; writes made on low voltage may be corrupt, verify the card."
+
+// powerState runs one monitor for every flash job of the process, see
+// watchPower. unavailable is set when vcgencmd is missing or fails, as on
+// anything but a Raspberry Pi.
+var powerState = struct {
+	sync.Mutex
+	running     bool
+	unavailable bool
+}{}
+
+// parseThrottled parses the output of vcgencmd get_throttled, such as
+// "throttled=0x50005".
+func parseThrottled(out string) (uint64, error) {
+	value, ok := strings.CutPrefix(strings.TrimSpace(out), "throttled=")
+	if !ok {
+		return 0, fmt.Errorf("unexpected vcgencmd output %q", strings.TrimSpace(out))
+	}
+	return strconv.ParseUint(value, 0, 64)
+}
+
+// readThrottled returns the throttled state of a Raspberry Pi.
+func readThrottled() (uint64, error) {
+	out, err := util.Command("vcgencmd", "get_throttled").Output()
+	if err != nil {
+		return 0, err
+	}
+	return parseThrottled(string(out))
+}
+
+// watchPower polls the throttled state of a Raspberry Pi every second while
+// flash jobs run, and marks them when the supply voltage is low or dropped
+// since the last poll. It is called when a flash job begins and returns at
+// once when the monitor already runs.
+func watchPower() {
+	powerState.Lock()
+	defer powerState.Unlock()
+	if powerState.running || powerState.unavailable || demoMode {
+		return
+	}
+	if _, err := exec.LookPath("vcgencmd"); err != nil {
+		powerState.unavailable = true
+		return
+	}
+	powerState.running = true
+	go monitorPower()
+}
+
+// monitorPower is the loop of watchPower.
+func monitorPower() {
+	prev, err := readThrottled()
+	if err != nil {
+		powerState.Lock()
+		powerState.running, powerState.unavailable = false, true
+		powerState.Unlock()
+		return
+	}
+	for {
+		time.Sleep(time.Second)
+		// The check for running flashes and the end of the monitor are one
+		// step for watchPower, so a flash beginning now is not missed
+		powerState.Lock()
+		if !flashRunning() {
+			powerState.running = false
+			powerState.Unlock()
+			return
+		}
+		powerState.Unlock()
+
+		now, err := readThrottled()
+		if err != nil {
+			continue
+		}
+		if now&throttledUndervoltage != 0 || (now&throttledUndervoltageSeen != 0 && prev&throttledUndervoltageSeen == 0) {
+			markUndervoltage()
+		}
+		prev = now
+	}
+}
+
+// flashRunning reports whether a flash job runs in any session.
+func flashRunning() bool {
+	crashState.Lock()
+	defer crashState.Unlock()
+	for _, job := range crashState.jobs {
+		if job.Kind == "flash" {
+			return true
+		}
+	}
+	return false
+}
+
+// markUndervoltage marks the running flash jobs as having seen a low supply
+// voltage.
+func markUndervoltage() {
+	crashState.Lock()
+	var marked []int
+	for id, job := range crashState.jobs {
+		if job.Kind == "flash" && !job.Undervoltage {
+			job.Undervoltage = true
+			crashState.jobs[id] = job
+			marked = append(marked, id)
+		}
+	}
+	crashState.Unlock()
+	for _, id := range marked {
+		rememberLog(fmt.Sprintf("Under-voltage during job #%d", id))
+	}
+}
+
+// pollPower warns once when the running job of the session saw a low supply
+// voltage.
+func (m *Model) pollPower() {
+	if job, ok := runningJob(m.JobID); ok && job.Undervoltage && !m.Undervoltage {
+		m.Undervoltage = true
+		m.AddLog(undervoltageWarning)
+	}
+}
+
+// powerFinished warns about a finished job that saw a low supply voltage,
+// unless pollPower did, and notes it on the wizard step, composite part or
+// duplicator slot of the job, for their reports.
+func (m *Model) powerFinished(job JobRecord, ok bool) {
+	seen := m.Undervoltage
+	m.Undervoltage = false
+	if !ok || !job.Undervoltage {
+		return
+	}
+	if !seen {
+		m.AddLog(undervoltageWarning)
+	}
+	const detail = "under-voltage during the write"
+	if w := m.Wizard; w != nil && !w.finished() && w.Steps[w.Current].State == stepRunning {
+		w.Steps[w.Current].Detail = detail
+	}
+	if c := m.Composite; c != nil && c.running() {
+		c.Parts[c.Current].Detail = detail
+	}
+	if d := m.Duplication; d != nil && d.running() {
+		d.Slots[d.Current].Detail = detail
+	}
+}
@@ -0,0 +1,86 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// progressLines passes the lines written to it on to a job's progress
+// channel, to run a headless job inside another one.
+type progressLines chan tea.Msg
+
+func (c progressLines) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		c <- ProgressMsg(line)
+	}
+	return len(p), nil
+}
+
+// cachedCheck returns the check of an image recorded in integrity.yaml, if it
+// is conclusive and the image has not changed since.
+func cachedCheck(image string) (IntegrityEntry, bool) {
+	entry, ok := loadIntegrityEntry(image)
+	if !ok || (entry.Status != "ok" && entry.Status != "failed") {
+		return entry, false
+	}
+	checked, err := time.Parse(time.RFC3339, entry.CheckedAt)
+	info, serr := os.Stat(image)
+	// CheckedAt is in whole seconds
+	if err != nil || serr != nil || info.ModTime().Truncate(time.Second).After(checked) {
+		return entry, false
+	}
+	return entry, true
+}
+
+// checkBeforeFlash checks the integrity of src as Check does before it is
+// written, when the config asks for it, and fails for a corrupt image, which
+// it moves to quarantine. A conclusive check recorded since the image last
+// changed is reused. Raw images without a checksum cannot be checked and are
+// flashed. The check can be aborted like a write.
+func checkBeforeFlash(src string, progressChan chan tea.Msg) error {
+	cfg := currentConfig()
+	if cfg == nil || !cfg.CheckBeforeFlash {
+		return nil
+	}
+	corrupt := func() error {
+		if line := quarantineImage(src, 1); line != "" {
+			progressChan <- ProgressMsg(line)
+		}
+		return fmt.Errorf("%s failed its integrity check, not flashing it", filepath.Base(src))
+	}
+	if entry, ok := cachedCheck(src); ok {
+		if entry.Status == "failed" {
+			return corrupt()
+		}
+		progressChan <- ProgressMsg(fmt.Sprintf("Integrity of %s checked on %s, not checking again.", filepath.Base(src), entry.CheckedAt))
+		return nil
+	}
+
+	abort := make(chan struct{})
+	var once sync.Once
+	progressChan <- DDStartedMsg{Cancel: func() { once.Do(func() { close(abort) }) }}
+	progressChan <- ProgressMsg(fmt.Sprintf("Checking the integrity of %s before flashing...", filepath.Base(src)))
+	msg, err := runStreamed(func(ch chan tea.Msg) tea.Cmd { return CheckIntegrity(src, ch) }, progressLines(progressChan), abort)
+	if errors.Is(err, ErrAborted) {
+		return errPolicyAborted
+	}
+	if err != nil {
+		return err
+	}
+	if msg.(CheckCompletedMsg).Ok {
+		progressChan <- ProgressMsg("Integrity OK")
+		return nil
+	}
+	if entry, ok := loadIntegrityEntry(src); ok && entry.Status == "failed" {
+		return corrupt()
+	}
+	progressChan <- ProgressMsg(fmt.Sprintf("Warning: %s has no checksum to check against, flashing it unchecked", filepath.Base(src)))
+	return nil
+}
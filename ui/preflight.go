@@ -0,0 +1,161 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/husarion/husarion-os-flasher/config"
+	"github.com/husarion/husarion-os-flasher/platform"
+	"github.com/husarion/husarion-os-flasher/util"
+)
+
+// protectedDevice returns the pattern of the protected devices of the config
+// matching the path or the model of a device, empty when it may be written.
+func protectedDevice(cfg *config.Config, device string) string {
+	patterns, _, _ := liveConfig(cfg)
+	if len(patterns) == 0 {
+		return ""
+	}
+	model := platform.Model(device)
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, device); ok {
+			return pattern
+		}
+		if ok, _ := filepath.Match(pattern, model); ok && model != "" {
+			return pattern
+		}
+	}
+	return ""
+}
+
+// checkWritable fails when a device is write-protected, e.g. an SD card with
+// its lock switch on, before a write fails several seconds in. The platform is
+// asked first, then the device is opened for writing.
+func checkWritable(device string) error {
+	if demoMode {
+		return nil
+	}
+	if ro, err := platform.ReadOnly(device); err == nil && ro {
+		return fmt.Errorf("%s is write-protected", device)
+	}
+	f, err := os.OpenFile(device, os.O_WRONLY, 0)
+	if errors.Is(err, syscall.EROFS) {
+		return fmt.Errorf("%s is write-protected", device)
+	}
+	if err == nil {
+		f.Close()
+	}
+	return nil
+}
+
+// Capacities SD cards are sold in, in decimal gigabytes. Genuine cards report
+// a little less than their class, never much less.
+var capacityClasses = []int64{1, 2, 4, 8, 16, 32, 64, 128, 256, 512, 1024, 2048}
+
+// capacityLabel finds a capacity in a device model, e.g. "SD 64GB".
+var capacityLabel = regexp.MustCompile(`(?i)\b([0-9]+) ?([GT])B\b`)
+
+// sdCard recognizes SD card readers and MMC devices by name or model.
+var sdCard = regexp.MustCompile(`(?i)\bSD\b|SD/MMC|\bMMC|SDHC|SDXC|microSD|card ?reader`)
+
+const (
+	// speedProbeSize is written to time a card before flashing it.
+	speedProbeSize = 16 << 20
+	// class10Speed is the sustained write speed of Class 10 cards, in bytes per
+	// second.
+	class10Speed = 10_000_000
+)
+
+// isSDCard reports whether a device is an SD card, from its name or model.
+func isSDCard(device, model string) bool {
+	return strings.HasPrefix(filepath.Base(device), "mmcblk") || sdCard.MatchString(model)
+}
+
+// capacityWarning explains why the size of an SD card is suspicious: smaller
+// than the capacity in its model name, or much smaller than any capacity cards
+// are sold in, as counterfeit cards often are. It is empty when the size fits.
+func capacityWarning(size int64, model string) string {
+	if m := capacityLabel.FindStringSubmatch(model); m != nil {
+		label, _ := strconv.ParseInt(m[1], 10, 64)
+		label *= 1_000_000_000
+		if strings.EqualFold(m[2], "T") {
+			label *= 1000
+		}
+		if size < label*85/100 {
+			return fmt.Sprintf("the card reports %s but is labeled %sB: it may be counterfeit", util.FormatBytes(size), m[1]+strings.ToUpper(m[2]))
+		}
+		return ""
+	}
+	for _, class := range capacityClasses {
+		class *= 1_000_000_000
+		if size > class {
+			continue
+		}
+		if size < class*85/100 {
+			return fmt.Sprintf("the card reports %s, which matches no card capacity: it may be counterfeit", util.FormatBytes(size))
+		}
+		break
+	}
+	return ""
+}
+
+// probeWriteSpeed times a synchronous write at the start of a device, which is
+// overwritten by the flash anyway, and returns the speed in bytes per second.
+func probeWriteSpeed(device string) (float64, error) {
+	f, err := os.OpenFile(device, os.O_WRONLY|os.O_SYNC, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	chunk := make([]byte, 1<<20)
+	start := time.Now()
+	for written := 0; written < speedProbeSize; written += len(chunk) {
+		if _, err := f.Write(chunk); err != nil {
+			return 0, err
+		}
+	}
+	if err := f.Sync(); err != nil {
+		return 0, err
+	}
+	return speedProbeSize / time.Since(start).Seconds(), nil
+}
+
+// preflightCard warns about SD cards that look counterfeit or too slow before a
+// long flash: from their size, then from a short timed write unless disabled.
+// Warnings never stop the flash.
+func preflightCard(device string, progressChan chan tea.Msg) {
+	model := platform.Model(device)
+	if !isSDCard(device, model) {
+		return
+	}
+	if size, err := platform.Current.DiskSize(device); err == nil {
+		if warning := capacityWarning(size, model); warning != "" {
+			progressChan <- ProgressMsg("Warning: " + warning)
+		}
+	}
+
+	if !currentConfig().ProbeSpeed() {
+		return
+	}
+	progressChan <- ProgressMsg("Probing the write speed of the card...")
+	speed, err := probeWriteSpeed(device)
+	if err != nil {
+		progressChan <- ProgressMsg("Write speed probe failed (ignored): " + err.Error())
+		return
+	}
+	if speed < class10Speed {
+		progressChan <- ProgressMsg(fmt.Sprintf("Warning: the card writes at %.1f MB/s, slower than Class 10 (10 MB/s): flashing will be slow and it may be counterfeit", speed/1e6))
+	} else {
+		progressChan <- ProgressMsg(fmt.Sprintf("The card writes at %.1f MB/s.", speed/1e6))
+	}
+}
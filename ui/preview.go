@@ -0,0 +1,195 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// previewFiles are the files shown of each partition of a previewed device,
+// when present: what an operator checks before shipping a card.
+var previewFiles = []string{"etc/os-release", "etc/hostname", "cmdline.txt", "config.txt", "user-data", "network-config"}
+
+// previewMaxLines is how many lines of each file and entries of each
+// partition's top directory are shown.
+const previewMaxLines = 30
+
+// devicePreview is the screen showing the contents of a device.
+type devicePreview struct {
+	Device string
+	View   viewport.Model
+}
+
+// PreviewMsg carries the contents of a previewed device, read with its
+// partitions mounted read-only and unmounted again.
+type PreviewMsg struct {
+	Device string
+	Text   string
+	Err    error
+}
+
+// StartPreview mounts the partitions of the selected device read-only, reads
+// their key files and unmounts them, then shows what was read. The device is
+// reserved meanwhile, so no session writes to it.
+func (m *Model) StartPreview() (tea.Model, tea.Cmd) {
+	if m.DeviceList.SelectedItem() == nil || m.Busy() || m.Mounting {
+		return m, nil
+	}
+	device := m.DeviceList.SelectedItem().(Item).value
+	if pattern := protectedDevice(m.Config, device); pattern != "" {
+		m.AddLog(fmt.Sprintf("Error: %s is protected by the config (%s).", device, pattern))
+		return m, nil
+	}
+	jobID, err := beginJob("preview", "", device, m.Operator)
+	if err != nil {
+		m.AddLog(fmt.Sprintf("Error: %v", err))
+		return m, nil
+	}
+	m.Mounting = true
+	m.AddLog(fmt.Sprintf("> Mounting %s read-only to preview it...", device))
+	return m, func() tea.Msg {
+		defer endJob(jobID)
+		if demoMode {
+			return demoPreview(device)
+		}
+		text, err := previewDevice(device)
+		return PreviewMsg{Device: device, Text: text, Err: err}
+	}
+}
+
+// showPreview opens the preview screen for what was read of a device.
+func (m *Model) showPreview(msg PreviewMsg) {
+	m.Mounting = false
+	if msg.Err != nil {
+		m.AddLog(fmt.Sprintf("Error: preview of %s failed: %v", msg.Device, msg.Err))
+		return
+	}
+	m.AddLog(fmt.Sprintf("%s unmounted.", msg.Device))
+	view := viewport.New(min(m.Width-4, 120), max(m.Height-8, 5))
+	view.SetContent(wrapDetails(msg.Text, view.Width))
+	m.Preview = &devicePreview{Device: msg.Device, View: view}
+}
+
+// handlePreviewKey scrolls the preview (↑↓) and closes it on any other key
+// but quit.
+func (m Model) handlePreviewKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "q":
+		return m, tea.Quit
+	case "up", "down", "pgup", "pgdown", "k", "j", "home", "end":
+		var cmd tea.Cmd
+		m.Preview.View, cmd = m.Preview.View.Update(msg)
+		return m, cmd
+	}
+	m.Preview = nil
+	return m, nil
+}
+
+// renderPreview renders the preview screen.
+func (m Model) renderPreview() string {
+	styles := Styles()
+	header := styles.Header.Render(" Preview of " + m.Preview.Device + " ")
+	body := styles.Container.Render(m.Preview.View.View())
+	footer := styles.FooterStyle.Render("Read-only, already unmounted • ↑↓ to scroll • any key to close")
+
+	return lipgloss.Place(
+		m.Width,
+		m.Height,
+		lipgloss.Center,
+		lipgloss.Center,
+		lipgloss.JoinVertical(lipgloss.Center, header, body, footer),
+	)
+}
+
+// readPreview describes the filesystem mounted at root: its top directory and
+// the previewFiles it holds.
+func readPreview(root string) string {
+	var b strings.Builder
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		fmt.Fprintf(&b, "  cannot list: %v\n", err)
+	}
+	var names []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() {
+			name += "/"
+		}
+		names = append(names, name)
+	}
+	if len(names) > previewMaxLines {
+		names = append(names[:previewMaxLines], fmt.Sprintf("... %d more", len(names)-previewMaxLines))
+	}
+	if len(names) > 0 {
+		b.WriteString("  " + strings.Join(names, "  ") + "\n")
+	}
+
+	for _, rel := range previewFiles {
+		data, err := readConfined(root, rel)
+		if err != nil {
+			continue
+		}
+		lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+		if len(lines) > previewMaxLines {
+			lines = append(lines[:previewMaxLines], fmt.Sprintf("... %d more lines", len(lines)-previewMaxLines))
+		}
+		fmt.Fprintf(&b, "\n  /%s:\n", rel)
+		for _, line := range lines {
+			b.WriteString("    " + line + "\n")
+		}
+	}
+	return b.String()
+}
+
+// readConfined reads the regular file rel of the filesystem mounted at root,
+// following symlinks as the card's own system would: absolute links point
+// into root, never at the station's files.
+func readConfined(root, rel string) ([]byte, error) {
+	path := "/"
+	parts := strings.Split(rel, "/")
+	for hops := 0; len(parts) > 0; {
+		name := parts[0]
+		parts = parts[1:]
+		switch name {
+		case "", ".":
+			continue
+		case "..":
+			path = filepath.Dir(path)
+			continue
+		}
+		next := filepath.Join(path, name)
+		info, err := os.Lstat(filepath.Join(root, next))
+		if err != nil {
+			return nil, err
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			path = next
+			continue
+		}
+		if hops++; hops > 8 {
+			return nil, errors.New("too many links")
+		}
+		target, err := os.Readlink(filepath.Join(root, next))
+		if err != nil {
+			return nil, err
+		}
+		if filepath.IsAbs(target) {
+			path = "/"
+		}
+		parts = append(strings.Split(target, "/"), parts...)
+	}
+	info, err := os.Stat(filepath.Join(root, path))
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s is not a regular file", rel)
+	}
+	return os.ReadFile(filepath.Join(root, path))
+}
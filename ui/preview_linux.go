@@ -0,0 +1,104 @@
+//go:build linux
+
+package ui
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/husarion/husarion-os-flasher/util"
+)
+
+// partition is a filesystem of a device, as lsblk lists it.
+type partition struct {
+	Path       string `json:"path"`
+	FSType     string `json:"fstype"`
+	Label      string `json:"label"`
+	Size       string `json:"size"`
+	Mountpoint string `json:"mountpoint"`
+}
+
+// devicePartitions returns the filesystems of a device, the device itself
+// when it has no partition table. Swap is left out.
+func devicePartitions(device string) ([]partition, error) {
+	// The partition table may just have been written: have the kernel read it again
+	_ = util.Command("blockdev", "--rereadpt", device).Run()
+
+	out, err := util.Command("lsblk", "--json", "--list", "-o", "PATH,FSTYPE,LABEL,SIZE,MOUNTPOINT", device).Output()
+	if err != nil {
+		return nil, fmt.Errorf("listing the partitions: %w", err)
+	}
+	var list struct {
+		Blockdevices []partition `json:"blockdevices"`
+	}
+	if err := json.Unmarshal(out, &list); err != nil {
+		return nil, fmt.Errorf("listing the partitions: %w", err)
+	}
+	var parts []partition
+	for _, p := range list.Blockdevices {
+		if p.FSType != "" && p.FSType != "swap" {
+			parts = append(parts, p)
+		}
+	}
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("no filesystem found on %s", device)
+	}
+	return parts, nil
+}
+
+// mountPartition mounts a partition in a temporary directory, read-only
+// unless rw, and returns the directory and the function unmounting it. A
+// partition mounted already is used where it is. Read-only mounts replay no
+// journal, so the card is left exactly as written.
+func mountPartition(p partition, rw bool) (string, func() error, error) {
+	if p.Mountpoint != "" {
+		return p.Mountpoint, func() error { return nil }, nil
+	}
+	dir, err := os.MkdirTemp("", "flasher-mount-")
+	if err != nil {
+		return "", nil, err
+	}
+	opts := "nosuid,nodev,noexec"
+	if !rw {
+		opts = "ro," + opts
+		if p.FSType == "ext3" || p.FSType == "ext4" {
+			opts += ",noload"
+		}
+	}
+	if out, err := util.Command("mount", "-t", p.FSType, "-o", opts, p.Path, dir).CombinedOutput(); err != nil {
+		os.Remove(dir)
+		return "", nil, fmt.Errorf("mounting %s: %s", p.Path, strings.TrimSpace(string(out)))
+	}
+	unmount := func() error {
+		if out, err := util.Command("umount", dir).CombinedOutput(); err != nil {
+			return fmt.Errorf("unmounting %s: %s", p.Path, strings.TrimSpace(string(out)))
+		}
+		return os.Remove(dir)
+	}
+	return dir, unmount, nil
+}
+
+// previewDevice mounts each filesystem of a device read-only, reads it with
+// readPreview and unmounts it.
+func previewDevice(device string) (string, error) {
+	parts, err := devicePartitions(device)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for _, p := range parts {
+		fmt.Fprintf(&b, "%s  %s  %s  %s\n", p.Path, p.FSType, p.Size, p.Label)
+		dir, unmount, err := mountPartition(p, false)
+		if err != nil {
+			fmt.Fprintf(&b, "  cannot mount: %v\n\n", err)
+			continue
+		}
+		b.WriteString(readPreview(dir) + "\n")
+		if err := unmount(); err != nil {
+			return "", err
+		}
+	}
+	return b.String(), nil
+}
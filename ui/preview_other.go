@@ -0,0 +1,10 @@
+//go:build !linux
+
+package ui
+
+import "errors"
+
+// previewDevice is not supported: mounting filesystems read-only needs Linux.
+func previewDevice(device string) (string, error) {
+	return "", errors.New("previewing a device is only supported on Linux")
+}
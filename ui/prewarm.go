@@ -0,0 +1,91 @@
+package ui
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/husarion/husarion-os-flasher/internal/flash"
+	"github.com/husarion/husarion-os-flasher/util"
+)
+
+// prewarmState is the image being read into the page cache, shared by every
+// session since they share the cache. Only one image is read at a time.
+var prewarmState = struct {
+	sync.Mutex
+	image  string
+	read   int64 // bytes read so far
+	limit  int64 // bytes to read: the image, or what fits in free memory
+	cancel context.CancelFunc
+}{}
+
+// prewarmSelected starts reading the selected image into the page cache when
+// the config asks for it and the selection of this session changed, stopping
+// the previous read. A running job stops it, so that it does not compete with
+// the job for the disk.
+func (m *Model) prewarmSelected() {
+	if m.Config == nil || !m.Config.Prewarm {
+		return
+	}
+	var image string
+	if m.ImageList.SelectedItem() != nil && !m.Busy() && !demoMode {
+		image = m.ImageList.SelectedItem().(Item).value
+	}
+	if image == m.Prewarmed {
+		return
+	}
+	m.Prewarmed = image
+
+	prewarmState.Lock()
+	defer prewarmState.Unlock()
+	if image == prewarmState.image {
+		return
+	}
+	if prewarmState.cancel != nil {
+		prewarmState.cancel()
+	}
+	prewarmState.image, prewarmState.read, prewarmState.limit, prewarmState.cancel = image, 0, 0, nil
+	if image == "" {
+		return
+	}
+	size, err := flash.FileSize(image)
+	available, total, ok := availableMemory()
+	if err != nil || !ok {
+		return
+	}
+	// Leave the memory that jobs warn about untouched
+	limit := min(size, available-lowMemory(total))
+	if limit <= 0 {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	prewarmState.limit, prewarmState.cancel = limit, cancel
+	go func() {
+		flash.Prewarm(ctx, image, limit, func(n int64) {
+			prewarmState.Lock()
+			if prewarmState.image == image {
+				prewarmState.read = n
+			}
+			prewarmState.Unlock()
+		})
+	}()
+}
+
+// prewarmLine describes how much of an image was read into the page cache, or
+// is empty when it is not being pre-warmed.
+func prewarmLine(image string) string {
+	prewarmState.Lock()
+	defer prewarmState.Unlock()
+	if image != prewarmState.image || prewarmState.limit == 0 {
+		return ""
+	}
+	size, err := flash.FileSize(image)
+	if err != nil || size == 0 {
+		return ""
+	}
+	line := fmt.Sprintf("Pre-warmed: %s of %s in memory", util.FormatBytes(prewarmState.read), util.FormatBytes(size))
+	if prewarmState.limit < size {
+		line += " (limited by free memory)"
+	}
+	return line
+}
@@ -0,0 +1,32 @@
+package ui
+
+import (
+	"os/exec"
+	"strconv"
+)
+
+// prioritize runs cmd at the configured CPU and I/O priority, by prefixing it
+// with nice and ionice. Both exec the command, so its pid is kept for aborting.
+// A missing tool leaves its priority as it was.
+func prioritize(cmd *exec.Cmd) {
+	cfg := currentConfig()
+	if cfg == nil || cfg.Priority == nil {
+		return
+	}
+	var prefix []string
+	if cfg.Priority.Nice != 0 {
+		if _, err := exec.LookPath("nice"); err == nil {
+			prefix = append(prefix, "nice", "-n", strconv.Itoa(cfg.Priority.Nice))
+		}
+	}
+	prefix = append(prefix, ioniceArgs(cfg.Priority)...)
+	if len(prefix) == 0 {
+		return
+	}
+	path, err := exec.LookPath(prefix[0])
+	if err != nil {
+		return
+	}
+	cmd.Args = append(prefix, cmd.Args...)
+	cmd.Path = path
+}
@@ -0,0 +1,27 @@
+package ui
+
+import (
+	"os/exec"
+	"strconv"
+
+	"github.com/husarion/husarion-os-flasher/config"
+)
+
+// ioniceClasses are the ionice -c numbers of config.IOClasses.
+var ioniceClasses = map[string]string{"realtime": "1", "best-effort": "2", "idle": "3"}
+
+// ioniceArgs returns the ionice command setting the configured I/O priority,
+// or nothing when none is configured or ionice is not installed.
+func ioniceArgs(p *config.Priority) []string {
+	if p.IOClass == "" {
+		return nil
+	}
+	if _, err := exec.LookPath("ionice"); err != nil {
+		return nil
+	}
+	args := []string{"ionice", "-c", ioniceClasses[p.IOClass]}
+	if p.IOClass != "idle" {
+		args = append(args, "-n", strconv.Itoa(p.IOLevel))
+	}
+	return args
+}
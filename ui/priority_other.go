@@ -0,0 +1,10 @@
+//go:build !linux
+
+package ui
+
+import "github.com/husarion/husarion-os-flasher/config"
+
+// ioniceArgs returns nothing: I/O priorities are set with Linux's ionice.
+func ioniceArgs(p *config.Priority) []string {
+	return nil
+}
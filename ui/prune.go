@@ -0,0 +1,111 @@
+package ui
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/husarion/husarion-os-flasher/config"
+	"github.com/husarion/husarion-os-flasher/internal/flash"
+	"github.com/husarion/husarion-os-flasher/util"
+)
+
+// runningImages returns the images used by jobs running in any session, which
+// pruning must keep.
+func runningImages() []string {
+	crashState.Lock()
+	defer crashState.Unlock()
+	var images []string
+	for _, job := range crashState.jobs {
+		images = append(images, job.Src)
+	}
+	return images
+}
+
+// planPrune applies the retention policy to the image directory without deleting.
+func planPrune(osImgPath string, r *config.Retention) ([]flash.PruneCandidate, error) {
+	return flash.PlanPrune(osImgPath, r.KeepLast, r.Favorites, runningImages())
+}
+
+// PreviewPrune shows the images the retention policy would delete and asks for
+// confirmation.
+func (m *Model) PreviewPrune() (tea.Model, tea.Cmd) {
+	if m.Busy() {
+		return m, nil
+	}
+	if err := errMonitoring(); err != nil {
+		m.AddLog(fmt.Sprintf("Error: %v", err))
+		return m, nil
+	}
+	if m.Config == nil || m.Config.Retention == nil {
+		m.AddLog("No retention policy configured.")
+		return m, nil
+	}
+	plan, err := planPrune(m.OsImgPath, m.Config.Retention)
+	if err != nil {
+		m.AddLog(fmt.Sprintf("Error: %v", err))
+		return m, nil
+	}
+	if len(plan) == 0 {
+		m.AddLog("Nothing to prune: every image is within the retention policy.")
+		return m, nil
+	}
+	m.PrunePlan = plan
+	return m, nil
+}
+
+// confirmPrune handles the answer to the prune preview.
+func (m *Model) confirmPrune(key string) (tea.Model, tea.Cmd) {
+	plan := m.PrunePlan
+	m.PrunePlan = nil
+	if key != "y" && key != "Y" {
+		m.AddLog("Pruning cancelled.")
+		return m, nil
+	}
+	if maintenanceBlocksImages() {
+		m.AddLog("Pruning is paused while maintenance reorganizes the image directory.")
+		return m, nil
+	}
+
+	var freed int64
+	for _, c := range plan {
+		freed += c.Size
+	}
+	if err := flash.Prune(plan); err != nil {
+		m.AddLog(fmt.Sprintf("Error: pruning failed: %v", err))
+	} else {
+		m.AddLog(fmt.Sprintf("Pruned %d image(s), freed %s.", len(plan), util.FormatBytes(freed)))
+	}
+	m.Refresh()
+	return m, nil
+}
+
+// renderPrune renders the prune preview.
+func (m Model) renderPrune() string {
+	styles := Styles()
+	header := styles.Header.Render(" Prune old images ")
+
+	var lines []string
+	var freed int64
+	for _, c := range m.PrunePlan {
+		freed += c.Size
+		lines = append(lines, fmt.Sprintf("%s (%s, %s)", filepath.Base(c.Image), c.Family, util.FormatBytes(c.Size)))
+		for _, f := range c.Files {
+			lines = append(lines, "  "+filepath.Base(f))
+		}
+	}
+	lines = append(lines, "", fmt.Sprintf("%d image(s) will be deleted, freeing %s.", len(m.PrunePlan), util.FormatBytes(freed)))
+	body := styles.Container.Render(styles.InfoPanel.Render(strings.Join(lines, "\n")))
+	footer := styles.FooterStyle.Render("Press Y to delete, any other key to cancel.")
+
+	return lipgloss.Place(
+		m.Width,
+		m.Height,
+		lipgloss.Center,
+		lipgloss.Center,
+		lipgloss.JoinVertical(lipgloss.Center, header, body, footer),
+	)
+}
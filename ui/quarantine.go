@@ -0,0 +1,35 @@
+package ui
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/husarion/husarion-os-flasher/internal/flash"
+)
+
+// quarantineImage moves an image whose check failed out of the image list, so
+// the next operator cannot flash it, and returns the line to log. own is the
+// number of running jobs of the caller using the image; images other jobs are
+// using are left in place.
+func quarantineImage(image string, own int) string {
+	if demoMode {
+		return ""
+	}
+	if entry, ok := loadIntegrityEntry(image); !ok || entry.Status != "failed" {
+		return ""
+	}
+	users := 0
+	for _, running := range runningImages() {
+		if running == image {
+			users++
+		}
+	}
+	if users > own {
+		return fmt.Sprintf("Warning: %s is used by a running job and stays in the image list despite the failed check", filepath.Base(image))
+	}
+	moved, err := flash.Quarantine(image)
+	if err != nil {
+		return fmt.Sprintf("Error: moving %s to quarantine failed: %v", filepath.Base(image), err)
+	}
+	return fmt.Sprintf("Moved %s to %s so that it cannot be flashed", filepath.Base(image), filepath.Dir(moved))
+}
@@ -0,0 +1,166 @@
+package ui
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// queueState holds the controls of the job queue, shared by every session of
+// the process. While paused, running jobs finish but composite parts,
+// duplicator slots and remote flashes wait for the queue to resume. AbortAll
+// closes the aborted channel, which every session and remote job watches, and
+// replaces it for the next time.
+var queueState = struct {
+	sync.Mutex
+	paused  bool
+	resumed chan struct{} // closed when the queue resumes
+	aborted chan struct{} // closed by AbortAll
+	aborts  int           // AbortAll calls so far
+}{resumed: make(chan struct{}), aborted: make(chan struct{})}
+
+// QueuePaused reports whether the queue is paused.
+func QueuePaused() bool {
+	queueState.Lock()
+	defer queueState.Unlock()
+	return queueState.paused
+}
+
+// PauseQueue holds the jobs waiting to start until ResumeQueue, and reports
+// whether the queue was running.
+func PauseQueue(operator string) bool {
+	queueState.Lock()
+	defer queueState.Unlock()
+	if queueState.paused {
+		return false
+	}
+	queueState.paused = true
+	writeAudit("pause", JobRecord{Kind: "queue", Operator: operator})
+	return true
+}
+
+// ResumeQueue starts the jobs held by PauseQueue, and reports whether the
+// queue was paused.
+func ResumeQueue(operator string) bool {
+	queueState.Lock()
+	defer queueState.Unlock()
+	if !queueState.paused {
+		return false
+	}
+	queueState.paused = false
+	close(queueState.resumed)
+	queueState.resumed = make(chan struct{})
+	writeAudit("resume", JobRecord{Kind: "queue", Operator: operator})
+	return true
+}
+
+// AbortAll aborts the jobs running in every session and returns how many were
+// running. Each stops and cleans up as if its own abort was pressed.
+func AbortAll(operator string) int {
+	running := len(RunningJobs())
+	queueState.Lock()
+	defer queueState.Unlock()
+	close(queueState.aborted)
+	queueState.aborted = make(chan struct{})
+	queueState.aborts++
+	writeAudit("abort-all", JobRecord{Kind: "queue", Operator: operator})
+	return running
+}
+
+// AbortAllRequested returns a channel closed by the next AbortAll.
+func AbortAllRequested() <-chan struct{} {
+	queueState.Lock()
+	defer queueState.Unlock()
+	return queueState.aborted
+}
+
+// abortAllCount returns how many times AbortAll was called.
+func abortAllCount() int {
+	queueState.Lock()
+	defer queueState.Unlock()
+	return queueState.aborts
+}
+
+// waitQueue blocks while the queue is paused, telling out once, until it
+// resumes, abort is closed or every job is aborted.
+func waitQueue(out io.Writer, abort <-chan struct{}) error {
+	for {
+		queueState.Lock()
+		paused, resumed, aborted := queueState.paused, queueState.resumed, queueState.aborted
+		queueState.Unlock()
+		if !paused {
+			return nil
+		}
+		fmt.Fprintln(out, "The queue is paused, waiting for it to resume...")
+		select {
+		case <-resumed:
+		case <-abort:
+			return ErrAborted
+		case <-aborted:
+			return ErrAborted
+		}
+	}
+}
+
+// holdQueue reports whether the next part or slot of a run must wait for the
+// queue to resume, and marks the run as held if so.
+func (m *Model) holdQueue() bool {
+	if !QueuePaused() {
+		return false
+	}
+	if !m.QueueHeld {
+		m.AddLog("The queue is paused: the next job waits for it to resume (H).")
+	}
+	m.QueueHeld = true
+	return true
+}
+
+// pollQueue applies the queue controls of other sessions: it aborts the
+// running job after an AbortAll and continues a held run once the queue
+// resumes.
+func (m *Model) pollQueue() tea.Cmd {
+	if n := abortAllCount(); n != m.AbortsSeen {
+		m.AbortsSeen = n
+		m.QueueHeld = false
+		if m.Busy() && !m.Aborting {
+			_, cmd := m.AbortOperation()
+			return cmd
+		}
+	}
+	if m.QueueHeld && !QueuePaused() {
+		m.QueueHeld = false
+		m.AddLog("The queue resumed.")
+		var cmd tea.Cmd
+		switch {
+		case m.Composite != nil:
+			_, cmd = m.runCompositePart()
+		case m.Duplication != nil:
+			_, cmd = m.runNextSlot()
+		}
+		return cmd
+	}
+	return nil
+}
+
+// toggleQueue pauses the queue or resumes it.
+func (m *Model) toggleQueue() {
+	if PauseQueue(m.Operator) {
+		m.AddLog("Queue paused: running jobs finish, the next ones wait. H to resume.")
+		return
+	}
+	ResumeQueue(m.Operator)
+}
+
+// abortAll aborts the jobs of every session, this one first.
+func (m *Model) abortAll() (tea.Model, tea.Cmd) {
+	n := AbortAll(m.Operator)
+	m.AddLog(fmt.Sprintf("> Aborting all jobs (%d running)...", n))
+	m.AbortsSeen = abortAllCount()
+	m.QueueHeld = false
+	if m.Busy() && !m.Aborting {
+		return m.AbortOperation()
+	}
+	return m, nil
+}
@@ -0,0 +1,241 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/husarion/husarion-os-flasher/internal/flash"
+	"github.com/husarion/husarion-os-flasher/platform"
+	"github.com/husarion/husarion-os-flasher/util"
+)
+
+// throttledProgress returns a progress callback for in-process writers that sends
+// at most one pv-style line per second. what describes the counted bytes
+// (e.g. "mapped"); the line is replaced in place by AddLog.
+func throttledProgress(progressChan chan tea.Msg, what string) func(written, total int64, elapsed time.Duration) {
+	var last time.Time
+	return func(written, total int64, elapsed time.Duration) {
+		if time.Since(last) < time.Second && written < total {
+			return
+		}
+		last = time.Now()
+		select {
+		case progressChan <- ProgressMsg(progressLine(written, total, elapsed, what)):
+		default:
+		}
+	}
+}
+
+// progressLine formats a pv-style progress line, replaced in place by AddLog:
+// the bytes written, the percentage, the speed and the time left.
+func progressLine(written, total int64, elapsed time.Duration, what string) string {
+	rate := float64(written) / max(elapsed.Seconds(), 0.001)
+	line := fmt.Sprintf("%s / %s %s(%d%%) %s/s",
+		util.FormatBytes(written), util.FormatBytes(total), what, written*100/max(total, 1), util.FormatBytes(int64(rate)))
+	if written < total && rate > 0 {
+		line += " ETA " + util.FormatDuration(time.Duration(float64(total-written)/rate*float64(time.Second)))
+	}
+	return line
+}
+
+// syncInterval returns how many bytes in-process writes write between flushes,
+// as configured.
+func syncInterval() int64 {
+	return currentConfig().SyncInterval()
+}
+
+// deviceWriter returns how the in-process writers write to out: through
+// io_uring when configured and available, or directly. done releases it once
+// the write has ended, before out is closed.
+func deviceWriter(out *os.File, progressChan chan tea.Msg) (dev flash.Device, done func()) {
+	cfg := currentConfig()
+	if cfg == nil || cfg.Writer != "io_uring" {
+		return out, func() {}
+	}
+	depth := cfg.QueueDepth
+	if depth == 0 {
+		depth = 8
+	}
+	u, err := flash.NewURing(out, depth)
+	if err != nil {
+		progressChan <- ProgressMsg("Writing without io_uring: " + err.Error())
+		return out, func() {}
+	}
+	progressChan <- ProgressMsg(fmt.Sprintf("Writing through io_uring, %d writes in flight", depth))
+	return u, func() { _ = u.Close() }
+}
+
+// syncAndFinish flushes an in-process write to the device and reports completion.
+func syncAndFinish(out flash.Device, src, dst string, progressChan chan tea.Msg) {
+	select {
+	case progressChan <- ProgressMsg("Syncing..."):
+	default:
+		return
+	}
+	stop := watchSync(progressChan)
+	err := out.Sync()
+	stop()
+	if err != nil {
+		select {
+		case progressChan <- ErrorMsg{Err: fmt.Errorf("sync failed: %v", err)}:
+		default:
+		}
+		return
+	}
+	select {
+	case progressChan <- ProgressMsg("Sync completed successfully."):
+	default:
+		return
+	}
+	flushDevice(out, dst, progressChan)
+	select {
+	case progressChan <- DoneMsg{Src: src, Dst: dst}:
+	default:
+	}
+}
+
+// flushDevice asks the device to write its cache to the medium, when the
+// config asks for it. A device that cannot is only warned about, as sync has
+// done what it could.
+func flushDevice(dev interface{ Fd() uintptr }, dst string, progressChan chan tea.Msg) {
+	if !currentConfig().FlushDevice() {
+		return
+	}
+	if err := flash.FlushDeviceCache(dev, dst); err != nil {
+		select {
+		case progressChan <- ProgressMsg(fmt.Sprintf("Warning: %s did not flush its write cache: %v", dst, err)):
+		default:
+		}
+	}
+}
+
+// stallTimeout fails an in-process write that made no progress for this long.
+const stallTimeout = 120 * time.Second
+
+// startRawWrite writes img to a raw device in whole sectors on a goroutine,
+// reporting progress and completion on progressChan. The write fails when the
+// decompressor does, or when the image ends short of total and total is
+// exact. release runs once the write has ended, after out is closed.
+func startRawWrite(img *flash.Raw, out *os.File, src, dst string, total int64, exact bool, progressChan chan tea.Msg, release func()) {
+	cancel := make(chan struct{})
+	var once sync.Once
+	progressChan <- DDStartedMsg{Cancel: func() {
+		once.Do(func() {
+			close(cancel)
+			img.Kill()
+		})
+	}}
+
+	// A hung device or decompressor is stopped by a watchdog
+	var lastProgress atomic.Int64
+	var stalled atomic.Bool
+	lastProgress.Store(time.Now().UnixNano())
+	report := throttledProgress(progressChan, "")
+	progress := func(written, total int64, elapsed time.Duration) {
+		lastProgress.Store(time.Now().UnixNano())
+		report(written, total, elapsed)
+	}
+	finished := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-finished:
+				return
+			case <-ticker.C:
+				if time.Since(time.Unix(0, lastProgress.Load())) > stallTimeout {
+					stalled.Store(true)
+					img.Kill()
+					return
+				}
+			}
+		}
+	}()
+
+	dev, done := deviceWriter(out, progressChan)
+	go func() {
+		defer recoverJob(progressChan)
+		defer release()
+		defer out.Close()
+		defer done()
+
+		written, copyErr := flash.WriteAligned(img, flash.SyncEvery(dev, syncInterval()), total, progress, cancel)
+		close(finished)
+		if copyErr == nil {
+			copyErr = img.Wait()
+		}
+		img.Close()
+
+		select {
+		case <-cancel:
+			// AbortOperation reports completion
+			return
+		default:
+		}
+		if stalled.Load() {
+			copyErr = fmt.Errorf("operation timed out - no progress for %v", stallTimeout)
+		} else if copyErr != nil {
+			copyErr = img.Explain(copyErr)
+		} else if exact && written != total {
+			copyErr = fmt.Errorf("image ended after %s of %s", util.FormatBytes(written), util.FormatBytes(total))
+		}
+		if copyErr != nil {
+			select {
+			case progressChan <- ErrorMsg{Err: copyErr}:
+			default:
+			}
+			return
+		}
+		syncAndFinish(dev, src, dst, progressChan)
+	}()
+}
+
+// flashNative writes an image to a device in-process. flash.OpenRaw reads the
+// image, decompressing xz, zstd and bzip2 images with their tool and zip
+// archives itself, and the bytes are counted on their way to the device,
+// opened with O_DIRECT where supported.
+func flashNative(src, dst string, progressChan chan tea.Msg) {
+	if tool := flash.DecompressTool(src); tool != "" {
+		if _, err := exec.LookPath(tool); err != nil {
+			progressChan <- ErrorMsg{Err: fmt.Errorf("cannot decompress %s: %s utility not found", filepath.Base(src), tool)}
+			return
+		}
+	}
+	if strings.HasSuffix(src, ".iso") && !flash.IsHybridISO(src) {
+		progressChan <- ProgressMsg("Warning: " + filepath.Base(src) + " is not a hybrid ISO; the device may not boot")
+	}
+
+	size, exact := flash.RawSize(src)
+	if disk, err := platform.Current.DiskSize(dst); err == nil && exact && disk < size {
+		progressChan <- ErrorMsg{Err: fmt.Errorf("image needs %s but %s is only %s",
+			util.FormatBytes(size), dst, util.FormatBytes(disk))}
+		return
+	}
+	if !exact {
+		progressChan <- ProgressMsg("Uncompressed size estimated (xz -l parse failed)")
+	}
+
+	out, err := flash.OpenDevice(dst)
+	if err != nil {
+		progressChan <- ErrorMsg{Err: fmt.Errorf("failed to open %s: %v", dst, err)}
+		return
+	}
+	img, err := flash.OpenRaw(src, prioritize)
+	if err != nil {
+		out.Close()
+		progressChan <- ErrorMsg{Err: err}
+		return
+	}
+
+	progressChan <- ProgressMsg(fmt.Sprintf("Flashing %s to %s (size: %s)...", filepath.Base(src), dst, util.FormatBytes(size)))
+	startRawWrite(img, out, src, dst, size, exact, progressChan, func() {})
+}
@@ -0,0 +1,249 @@
+package ui
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// recordingsDir keeps a recording of every job, in the log directory.
+const recordingsDir = "recordings"
+
+// RecordingsPath returns the directory of the job recordings of an image
+// directory.
+func RecordingsPath(osImgPath string) string {
+	return filepath.Join(crashDir(osImgPath), recordingsDir)
+}
+
+// Terminal size announced in recordings. Jobs print log lines, not the UI, so
+// any size that fits them replays fine.
+const (
+	recordingWidth  = 120
+	recordingHeight = 40
+)
+
+// recordingProgressInterval is the minimum time between two recorded progress
+// lines, which keeps recordings of long flashes small.
+const recordingProgressInterval = time.Second
+
+// recording is the open recording of a running job.
+type recording struct {
+	f            *os.File
+	started      time.Time
+	progress     bool      // the last line was a progress line, overwritten by the next
+	lastProgress time.Time // when the last progress line was recorded
+	pending      string    // progress line held back by recordingProgressInterval
+}
+
+// recordState holds the recordings of the running jobs of all sessions.
+var recordState = struct {
+	sync.Mutex
+	jobs map[int]*recording
+}{jobs: make(map[int]*recording)}
+
+// recordingName returns the path of the recording of a job, relative to the
+// log directory.
+func recordingName(job JobRecord) string {
+	return filepath.Join(recordingsDir, fmt.Sprintf("%s-%s-%d.cast", job.Kind, job.Started.Format("20060102-150405"), job.ID))
+}
+
+// startRecording starts recording a job into the log directory, in the
+// asciicast v2 format of asciinema. Jobs are not recorded when it cannot be
+// created.
+func startRecording(job JobRecord) {
+	crashState.Lock()
+	imgPath := crashState.imgPath
+	crashState.Unlock()
+	if imgPath == "" {
+		return
+	}
+	path := filepath.Join(crashDir(imgPath), recordingName(job))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return
+	}
+
+	title := job.Kind + " " + job.Src
+	if job.Dst != "" {
+		title += " -> " + job.Dst
+	}
+	if job.Operator != "" {
+		title += " by " + job.Operator
+	}
+	header, _ := json.Marshal(map[string]any{
+		"version":   2,
+		"width":     recordingWidth,
+		"height":    recordingHeight,
+		"timestamp": job.Started.Unix(),
+		"title":     title,
+	})
+	if _, err := fmt.Fprintf(f, "%s\n", header); err != nil {
+		f.Close()
+		return
+	}
+
+	recordState.Lock()
+	recordState.jobs[job.ID] = &recording{f: f, started: job.Started}
+	recordState.Unlock()
+}
+
+// writeEvent appends an output event to a recording.
+func (r *recording) writeEvent(data string) {
+	event, _ := json.Marshal([]any{time.Since(r.started).Seconds(), "o", data})
+	_, _ = fmt.Fprintf(r.f, "%s\n", event)
+}
+
+// recordLog records a log line of a job as the UI shows it: a progress line
+// replaces the previous progress line.
+func recordLog(id int, line string) {
+	recordState.Lock()
+	defer recordState.Unlock()
+	r, ok := recordState.jobs[id]
+	if !ok {
+		return
+	}
+	if isProgressLine(line) {
+		r.pending = line
+		if time.Since(r.lastProgress) >= recordingProgressInterval {
+			r.flushProgress()
+		}
+		return
+	}
+	r.flushProgress()
+	if r.progress {
+		line = "\r\n" + line
+		r.progress = false
+	}
+	r.writeEvent(line + "\r\n")
+}
+
+// flushProgress records the progress line held back, if any.
+func (r *recording) flushProgress() {
+	if r.pending == "" {
+		return
+	}
+	r.writeEvent("\r" + r.pending + "\x1b[K")
+	r.pending = ""
+	r.progress = true
+	r.lastProgress = time.Now()
+}
+
+// progressWriter returns a writer that publishes the lines a job without the
+// UI writes to out as JobProgress, and writes them to out.
+func progressWriter(id int, out io.Writer) io.Writer {
+	return &jobOutput{id: id, out: out}
+}
+
+type jobOutput struct {
+	id      int
+	out     io.Writer
+	partial string // text after the last newline
+}
+
+func (w *jobOutput) Write(p []byte) (int, error) {
+	lines := strings.Split(w.partial+string(p), "\n")
+	w.partial = lines[len(lines)-1]
+	for _, line := range lines[:len(lines)-1] {
+		Events.Publish(JobProgress{ID: w.id, Line: line})
+	}
+	return w.out.Write(p)
+}
+
+// stopRecording closes the recording of a job that ended.
+func stopRecording(id int) {
+	recordState.Lock()
+	r, ok := recordState.jobs[id]
+	delete(recordState.jobs, id)
+	recordState.Unlock()
+	if ok {
+		r.flushProgress()
+		r.f.Close()
+	}
+}
+
+// recordResult appends the result of a finished job to its recording, which
+// may already be closed.
+func recordResult(job JobRecord, result string, jobErr error) {
+	crashState.Lock()
+	imgPath := crashState.imgPath
+	crashState.Unlock()
+	if imgPath == "" {
+		return
+	}
+	line := "\r\nResult: " + result
+	if jobErr != nil {
+		line += " (" + jobErr.Error() + ")"
+	}
+	line += "\r\n"
+
+	recordState.Lock()
+	defer recordState.Unlock()
+	if r, ok := recordState.jobs[job.ID]; ok {
+		r.flushProgress()
+		r.writeEvent(line)
+		return
+	}
+	f, err := os.OpenFile(filepath.Join(crashDir(imgPath), recordingName(job)), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	(&recording{f: f, started: job.Started}).writeEvent(line)
+}
+
+// ReplayRecording writes the output of a recording to out with its original
+// timing, speed times faster. Pauses are shortened to maxWait when it is
+// positive. Closing abort stops it.
+func ReplayRecording(path string, out io.Writer, speed float64, maxWait time.Duration, abort <-chan struct{}) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	var header struct {
+		Version int    `json:"version"`
+		Title   string `json:"title"`
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &header); err != nil || header.Version != 2 {
+		return fmt.Errorf("%s is not an asciicast v2 recording", path)
+	}
+	if header.Title != "" {
+		fmt.Fprintf(out, "# %s\r\n", header.Title)
+	}
+
+	var last float64
+	for i, line := range lines[1:] {
+		var event []any
+		if err := json.Unmarshal([]byte(line), &event); err != nil || len(event) != 3 {
+			return fmt.Errorf("%s: bad event on line %d", path, i+2)
+		}
+		at, _ := event[0].(float64)
+		kind, _ := event[1].(string)
+		data, _ := event[2].(string)
+		if kind != "o" {
+			continue
+		}
+		wait := time.Duration((at - last) / speed * float64(time.Second))
+		if maxWait > 0 && wait > maxWait {
+			wait = maxWait
+		}
+		last = at
+		select {
+		case <-time.After(wait):
+		case <-abort:
+			return ErrAborted
+		}
+		if _, err := io.WriteString(out, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/husarion/husarion-os-flasher/config"
+)
+
+// configCheckInterval is how often the config file is checked for changes.
+const configCheckInterval = 2 * time.Second
+
+// reloadState follows the config file the flasher started with, shared by
+// every session as they share the config. Only the settings that are safe to
+// change under running jobs are applied: theme, protected_devices, on_success
+// and on_failure, read through liveConfig. Other changes are logged as
+// needing a restart.
+var reloadState = struct {
+	sync.Mutex
+	checked time.Time // last check of the file
+	modTime time.Time // of the file last loaded
+	size    int64
+	seq     int      // lines logged so far
+	lines   []string // recent lines, for the sessions to log
+}{}
+
+// liveConfig returns the settings of cfg that a reload may change.
+func liveConfig(cfg *config.Config) (protected []string, onSuccess, onFailure string) {
+	if cfg == nil {
+		return nil, "", ""
+	}
+	reloadState.Lock()
+	defer reloadState.Unlock()
+	return cfg.ProtectedDevices, cfg.OnSuccess, cfg.OnFailure
+}
+
+// pollConfig loads the config file again when it changed, at most every
+// configCheckInterval across sessions. An invalid file is logged and leaves
+// the running config as it is.
+func pollConfig(cfg *config.Config) {
+	if cfg == nil || cfg.Path == "" {
+		return
+	}
+	reloadState.Lock()
+	if time.Since(reloadState.checked) < configCheckInterval {
+		reloadState.Unlock()
+		return
+	}
+	reloadState.checked = time.Now()
+	info, err := os.Stat(cfg.Path)
+	if err != nil || (info.ModTime().Equal(reloadState.modTime) && info.Size() == reloadState.size) {
+		reloadState.Unlock()
+		return
+	}
+	first := reloadState.modTime.IsZero()
+	reloadState.modTime, reloadState.size = info.ModTime(), info.Size()
+	reloadState.Unlock()
+	if first {
+		return
+	}
+
+	loaded, err := config.Load(cfg.Path, true)
+	if err != nil {
+		logReload(fmt.Sprintf("Config not reloaded: %v", err))
+		return
+	}
+
+	reloadState.Lock()
+	var changes []string
+	if loaded.Theme != cfg.Theme {
+		cfg.Theme = loaded.Theme
+		SetTheme(cfg.Theme)
+		changes = append(changes, "theme "+orDefault(cfg.Theme))
+	}
+	if !slices.Equal(loaded.ProtectedDevices, cfg.ProtectedDevices) {
+		cfg.ProtectedDevices = loaded.ProtectedDevices
+		changes = append(changes, "protected devices "+orNone(strings.Join(cfg.ProtectedDevices, ", ")))
+	}
+	if loaded.OnSuccess != cfg.OnSuccess {
+		cfg.OnSuccess = loaded.OnSuccess
+		changes = append(changes, "on_success "+orNone(cfg.OnSuccess))
+	}
+	if loaded.OnFailure != cfg.OnFailure {
+		cfg.OnFailure = loaded.OnFailure
+		changes = append(changes, "on_failure "+orNone(cfg.OnFailure))
+	}
+	rest := *loaded
+	rest.Theme, rest.ProtectedDevices, rest.OnSuccess, rest.OnFailure = cfg.Theme, cfg.ProtectedDevices, cfg.OnSuccess, cfg.OnFailure
+	restart := !reflect.DeepEqual(rest, *cfg)
+	reloadState.Unlock()
+
+	if len(changes) > 0 {
+		logReload("Config reloaded: " + strings.Join(changes, "; "))
+	}
+	if restart {
+		logReload("Config changed: the other changes take effect after a restart")
+	}
+}
+
+// logReload records a line for every session to log, and in the audit log.
+func logReload(line string) {
+	reloadState.Lock()
+	reloadState.seq++
+	reloadState.lines = append(reloadState.lines, line)
+	if over := len(reloadState.lines) - 10; over > 0 {
+		reloadState.lines = reloadState.lines[over:]
+	}
+	reloadState.Unlock()
+	writeAuditLine(line)
+}
+
+// configReloadSeq returns the number of config reload lines logged so far.
+func configReloadSeq() int {
+	reloadState.Lock()
+	defer reloadState.Unlock()
+	return reloadState.seq
+}
+
+// logConfigChanges logs the config reloads this session has not logged yet,
+// and restyles it for a new theme.
+func (m *Model) logConfigChanges() {
+	reloadState.Lock()
+	seq := reloadState.seq
+	unseen := min(seq-m.ConfigSeen, len(reloadState.lines))
+	lines := append([]string(nil), reloadState.lines[len(reloadState.lines)-unseen:]...)
+	reloadState.Unlock()
+
+	m.ConfigSeen = seq
+	if len(lines) == 0 {
+		return
+	}
+	for _, line := range lines {
+		m.AddLog(line)
+	}
+	title := lipgloss.NewStyle().
+		Bold(true).
+		Foreground(lipgloss.Color(ColorWhite)).
+		Background(lipgloss.Color(ColorPantone)).
+		Padding(0, 1)
+	m.DeviceList.Styles.Title = title
+	m.ImageList.Styles.Title = title
+	if m.info != nil {
+		m.info.key, m.info.listKey = "", ""
+	}
+}
+
+// orDefault returns s, or "default" when it is empty.
+func orDefault(s string) string {
+	if s == "" {
+		return "default"
+	}
+	return s
+}
+
+// orNone returns s, or "none" when it is empty.
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
@@ -0,0 +1,167 @@
+package ui
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/husarion/husarion-os-flasher/config"
+	"github.com/husarion/husarion-os-flasher/internal/robot"
+)
+
+// connectedRobot is the robot detected by the last poll of any session, recorded
+// with the jobs started while it is connected.
+var connectedRobot struct {
+	sync.Mutex
+	robot *robot.Robot
+}
+
+// robotRules returns the configured robot detection rules.
+func robotRules(cfg *config.Config) []robot.Rule {
+	if cfg == nil {
+		return nil
+	}
+	rules := make([]robot.Rule, 0, len(cfg.Robots))
+	for _, r := range cfg.Robots {
+		rules = append(rules, robot.Rule{Model: r.Model, USB: r.USB, Name: r.Product, EEPROM: r.EEPROM})
+	}
+	return rules
+}
+
+// detectRobot looks for a configured robot's controller on USB and records the
+// result as the connected robot. It returns nil when none is connected.
+func detectRobot(cfg *config.Config) *robot.Robot {
+	var detected *robot.Robot
+	if r, ok, err := robot.Detect(robotRules(cfg)); err == nil && ok {
+		detected = &r
+	}
+	connectedRobot.Lock()
+	connectedRobot.robot = detected
+	connectedRobot.Unlock()
+	return detected
+}
+
+// currentRobot returns the connected robot, nil when none is.
+func currentRobot() *robot.Robot {
+	connectedRobot.Lock()
+	defer connectedRobot.Unlock()
+	return connectedRobot.robot
+}
+
+// robotEnv describes the connected robot to hooks and custom actions.
+func robotEnv(r *robot.Robot) []string {
+	if r == nil {
+		return []string{"ROBOT_MODEL=", "ROBOT_REVISION=", "ROBOT_SERIAL="}
+	}
+	return []string{
+		"ROBOT_MODEL=" + r.Model,
+		"ROBOT_REVISION=" + r.Controller.Revision,
+		"ROBOT_SERIAL=" + r.Controller.Serial,
+	}
+}
+
+// pollRobot logs robots being connected and disconnected, and makes a newly
+// connected robot the target robot.
+func (m *Model) pollRobot() {
+	detected := detectRobot(m.Config)
+	switch {
+	case detected == nil && m.DetectedRobot != nil:
+		m.AddLog(fmt.Sprintf("%s disconnected.", m.DetectedRobot.Model))
+	case detected != nil && (m.DetectedRobot == nil || *detected != *m.DetectedRobot):
+		m.AddLog(fmt.Sprintf("Detected %s on USB.", detected))
+		if !robotMatches(detected.Model, m.TargetRobot) {
+			m.SetTargetRobot(detected.Model)
+		}
+	}
+	m.DetectedRobot = detected
+}
+
+// robotMatches reports whether an image built for robot suits the target robot.
+func robotMatches(robot, target string) bool {
+	return strings.EqualFold(strings.TrimSpace(robot), strings.TrimSpace(target))
+}
+
+// robotWarning describes why an image does not suit the target robot, or
+// returns an empty string. Images that name no robot suit any.
+func robotWarning(img, target string) string {
+	meta := LoadImageMeta(img)
+	if meta == nil || meta.Robot == "" || target == "" || robotMatches(meta.Robot, target) {
+		return ""
+	}
+	return fmt.Sprintf("%s is built for %s, not %s", filepath.Base(img), meta.Robot, target)
+}
+
+// knownRobots returns the robots the listed images are built for and the
+// configured one, sorted.
+func (m *Model) knownRobots() []string {
+	seen := map[string]bool{}
+	var robots []string
+	add := func(robot string) {
+		if robot != "" && !seen[strings.ToLower(robot)] {
+			seen[strings.ToLower(robot)] = true
+			robots = append(robots, robot)
+		}
+	}
+	if m.Config != nil {
+		add(m.Config.Robot)
+	}
+	for _, item := range m.ImageList.Items() {
+		if meta := LoadImageMeta(item.(Item).value); meta != nil {
+			add(meta.Robot)
+		}
+	}
+	sort.Slice(robots, func(i, j int) bool { return strings.ToLower(robots[i]) < strings.ToLower(robots[j]) })
+	return robots
+}
+
+// CycleTargetRobot chooses the next known robot as the target, then none.
+func (m *Model) CycleTargetRobot() {
+	robots := append(m.knownRobots(), "")
+	next := robots[0]
+	for i, robot := range robots[:len(robots)-1] {
+		if robotMatches(robot, m.TargetRobot) {
+			next = robots[i+1]
+		}
+	}
+	m.SetTargetRobot(next)
+}
+
+// SetTargetRobot sets the robot being provisioned and selects an image built
+// for it.
+func (m *Model) SetTargetRobot(robot string) {
+	m.TargetRobot = robot
+	m.Refresh()
+	if robot == "" {
+		m.AddLog("No target robot: images are not checked against a robot.")
+		return
+	}
+	if img, ok := m.selectRecommended(); ok {
+		m.AddLog(fmt.Sprintf("Target robot: %s, recommended image: %s", robot, filepath.Base(img)))
+	} else {
+		m.AddLog(fmt.Sprintf("Target robot: %s, but no image is built for it.", robot))
+	}
+}
+
+// selectRecommended selects an image built for the target robot, unless the
+// selected one is, and returns it.
+func (m *Model) selectRecommended() (string, bool) {
+	if m.TargetRobot == "" {
+		return "", false
+	}
+	recommended := func(img string) bool {
+		meta := LoadImageMeta(img)
+		return meta != nil && robotMatches(meta.Robot, m.TargetRobot)
+	}
+	if item := m.ImageList.SelectedItem(); item != nil && recommended(item.(Item).value) {
+		return item.(Item).value, true
+	}
+	for i, item := range m.ImageList.Items() {
+		if !item.(Item).copying && recommended(item.(Item).value) {
+			m.ImageList.Select(i)
+			return item.(Item).value, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,172 @@
+package ui
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	gossh "golang.org/x/crypto/ssh"
+
+	"github.com/husarion/husarion-os-flasher/config"
+	"github.com/husarion/husarion-os-flasher/internal/sign"
+)
+
+// Roles of Config.Roles.
+const (
+	RoleOperator = "operator"
+	RoleAdmin    = "admin"
+)
+
+// adminIdleTimeout locks a console unlocked with the admin PIN again after
+// this long without input.
+const adminIdleTimeout = 5 * time.Minute
+
+// adminUnlock is the admin PIN being typed on the console.
+type adminUnlock struct {
+	PIN   string // typed so far
+	Tries int    // wrong PINs entered
+}
+
+// KeyRole returns the role of an SSH user: admin when their key is one of
+// the admin keys, operator otherwise, also without a key.
+func KeyRole(cfg *config.Config, key gossh.PublicKey) string {
+	if cfg == nil || cfg.Roles == nil || cfg.Roles.AdminKeys == "" || key == nil {
+		return RoleOperator
+	}
+	// Read on every session, so admins are added without a restart
+	keys, err := sign.LoadKeys(cfg.Roles.AdminKeys)
+	if err != nil {
+		rememberLog(fmt.Sprintf("Error: reading the admin keys failed: %v", err))
+		return RoleOperator
+	}
+	for _, k := range keys {
+		if bytes.Equal(k.Marshal(), key.Marshal()) {
+			return RoleAdmin
+		}
+	}
+	return RoleOperator
+}
+
+// Allowed reports whether a role may run an action, a name of
+// config.Builtins or config.RemoteCommands. Without roles everyone may.
+func Allowed(cfg *config.Config, role, action string) bool {
+	if cfg == nil || cfg.Roles == nil || role == RoleAdmin {
+		return true
+	}
+	return !slices.Contains(cfg.Roles.AdminActions(), action)
+}
+
+// allowed reports whether the user of this session may run an action, and
+// logs why not.
+func (m *Model) allowed(action string) bool {
+	if Allowed(m.Config, m.Role, action) {
+		return true
+	}
+	m.AddLog(fmt.Sprintf("%s is reserved to admins.", action))
+	return false
+}
+
+// canUnlock reports whether the console can be unlocked with the admin PIN.
+func (m *Model) canUnlock() bool {
+	return !m.SSH && m.Config != nil && m.Config.Roles != nil && m.Config.Roles.AdminPINSHA256 != ""
+}
+
+// toggleAdmin asks for the admin PIN on the console, or locks it again.
+func (m *Model) toggleAdmin() {
+	if !m.canUnlock() {
+		return
+	}
+	if m.Role == RoleAdmin {
+		m.lockAdmin("Admin role locked.")
+		return
+	}
+	m.Unlock = &adminUnlock{}
+}
+
+// lockAdmin drops the console back to the operator role.
+func (m *Model) lockAdmin(reason string) {
+	m.Role = RoleOperator
+	m.AddLog(reason)
+	writeAuditLine(m.Operator + " locked admin")
+}
+
+// lockIdleAdmin locks a console unlocked with the admin PIN after
+// adminIdleTimeout without input. It is called before recording new input.
+func (m *Model) lockIdleAdmin() {
+	if m.Role == RoleAdmin && m.canUnlock() && time.Since(m.LastInput) > adminIdleTimeout {
+		m.lockAdmin("Admin role locked after inactivity.")
+	}
+}
+
+// handleUnlockKey edits the admin PIN, checks it on Enter and cancels on Esc.
+func (m Model) handleUnlockKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	u := m.Unlock
+	switch msg.Type {
+	case tea.KeyEsc:
+		m.Unlock = nil
+		return m, nil
+	case tea.KeyBackspace:
+		if len(u.PIN) > 0 {
+			u.PIN = u.PIN[:len(u.PIN)-1]
+		}
+		return m, nil
+	case tea.KeyRunes:
+		u.PIN += string(msg.Runes)
+		return m, nil
+	case tea.KeyEnter:
+	default:
+		return m, nil
+	}
+
+	sum := sha256.Sum256([]byte(u.PIN))
+	want, _ := hex.DecodeString(m.Config.Roles.AdminPINSHA256)
+	u.PIN = ""
+	if subtle.ConstantTimeCompare(sum[:], want) != 1 {
+		u.Tries++
+		writeAuditLine(m.Operator + " entered a wrong admin PIN")
+		if u.Tries >= maxApprovalTries {
+			m.Unlock = nil
+			m.AddLog(fmt.Sprintf("Error: admin unlock failed after %d wrong PINs.", u.Tries))
+		}
+		return m, nil
+	}
+	m.Unlock = nil
+	m.Role = RoleAdmin
+	m.AddLog("Admin role unlocked. ctrl+A locks it again.")
+	writeAuditLine(m.Operator + " unlocked admin")
+	return m, nil
+}
+
+// renderUnlock renders the admin PIN prompt.
+func (m Model) renderUnlock() string {
+	styles := Styles()
+	u := m.Unlock
+	header := styles.Header.Render(" Unlock admin ")
+
+	lines := []string{
+		"Admins may also " + strings.Join(m.Config.Roles.AdminActions(), ", ") + ".",
+		"",
+		"PIN: " + strings.Repeat("•", len(u.PIN)),
+	}
+	if u.Tries > 0 {
+		lines = append(lines, lipgloss.NewStyle().Foreground(lipgloss.Color(ColorError)).Render(
+			fmt.Sprintf("Wrong PIN, %d of %d tries left.", maxApprovalTries-u.Tries, maxApprovalTries)))
+	}
+	body := styles.Container.Render(styles.InfoPanel.Render(strings.Join(lines, "\n")))
+	footer := styles.FooterStyle.Render("Enter the admin PIN • ENTER to unlock • ESC to cancel")
+
+	return lipgloss.Place(
+		m.Width,
+		m.Height,
+		lipgloss.Center,
+		lipgloss.Center,
+		lipgloss.JoinVertical(lipgloss.Center, header, body, footer),
+	)
+}
@@ -0,0 +1,176 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// searchStyles returns the highlights of the log lines matching a search and
+// of the current match.
+func searchStyles() (match, current lipgloss.Style) {
+	match = lipgloss.NewStyle().Foreground(lipgloss.Color(ColorWhite)).Background(lipgloss.Color(ColorLilac))
+	current = lipgloss.NewStyle().Foreground(lipgloss.Color(ColorWhite)).Background(lipgloss.Color(ColorPantone)).Bold(true)
+	return match, current
+}
+
+// logSearch is an incremental, case-insensitive search of the log.
+type logSearch struct {
+	Query   string
+	Editing bool // keys go to the query
+	Current int  // index in matches of the match shown, -1 for the first one in view
+
+	matches []int // log lines containing the query
+}
+
+// logContent returns the log for the viewport, with the lines matching the
+// search highlighted.
+func (m *Model) logContent() string {
+	content := "Logs:\n" + strings.Join(m.wrappedLogs, "\n")
+	s := m.LogSearch
+	if s == nil {
+		return content
+	}
+	s.matches = s.matches[:0]
+	if s.Query == "" {
+		return content
+	}
+
+	query := strings.ToLower(s.Query)
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		if i > 0 && strings.Contains(strings.ToLower(stripANSI(line)), query) {
+			s.matches = append(s.matches, i)
+		}
+	}
+	if s.Current < 0 || s.Current >= len(s.matches) {
+		s.Current = 0
+		for i, line := range s.matches {
+			if line >= m.Viewport.YOffset {
+				s.Current = i
+				break
+			}
+		}
+	}
+	match, current := searchStyles()
+	for i, line := range s.matches {
+		style := match
+		if i == s.Current {
+			style = current
+		}
+		lines[line] = highlight(stripANSI(lines[line]), query, style)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// highlight styles every occurrence of the lower case query in line.
+func highlight(line, query string, style lipgloss.Style) string {
+	lower := strings.ToLower(line)
+	if len(lower) != len(line) {
+		return style.Render(line)
+	}
+	var b strings.Builder
+	for {
+		i := strings.Index(lower, query)
+		if i < 0 {
+			break
+		}
+		b.WriteString(line[:i])
+		b.WriteString(style.Render(line[i : i+len(query)]))
+		line, lower = line[i+len(query):], lower[i+len(query):]
+	}
+	b.WriteString(line)
+	return b.String()
+}
+
+// showLogSearch renders the log for the search and scrolls to its current
+// match.
+func (m *Model) showLogSearch() {
+	m.Viewport.SetContent(m.logContent())
+	if s := m.LogSearch; s != nil && len(s.matches) > 0 {
+		m.Viewport.SetYOffset(s.matches[s.Current] - m.Viewport.Height/2)
+	}
+}
+
+// closeLogSearch removes the highlights and follows the log again.
+func (m *Model) closeLogSearch() {
+	m.LogSearch = nil
+	m.Viewport.SetContent(m.logContent())
+	m.Viewport.GotoBottom()
+}
+
+// handleSearchKey opens the log search (/), edits its query and moves between
+// its matches (N and shift+N). It reports whether the key was used.
+func (m *Model) handleSearchKey(msg tea.KeyMsg) bool {
+	s := m.LogSearch
+	if s == nil {
+		if msg.String() != "/" {
+			return false
+		}
+		m.LogSearch = &logSearch{Editing: true, Current: -1}
+		m.showLogSearch()
+		return true
+	}
+
+	if s.Editing {
+		switch msg.Type {
+		case tea.KeyEnter:
+			s.Editing = false
+			return true
+		case tea.KeyEsc:
+			m.closeLogSearch()
+			return true
+		case tea.KeyBackspace:
+			if r := []rune(s.Query); len(r) > 0 {
+				s.Query = string(r[:len(r)-1])
+			}
+		case tea.KeySpace:
+			s.Query += " "
+		case tea.KeyRunes:
+			s.Query += string(msg.Runes)
+		default:
+			// Scroll the log
+			m.Viewport, _ = m.Viewport.Update(msg)
+			return true
+		}
+		s.Current = -1
+		m.showLogSearch()
+		return true
+	}
+
+	switch msg.String() {
+	case "n":
+		if len(s.matches) > 0 {
+			s.Current = (s.Current + 1) % len(s.matches)
+		}
+	case "N":
+		if len(s.matches) > 0 {
+			s.Current = (s.Current + len(s.matches) - 1) % len(s.matches)
+		}
+	case "/":
+		s.Editing = true
+		return true
+	case "esc":
+		m.closeLogSearch()
+		return true
+	default:
+		return false
+	}
+	m.showLogSearch()
+	return true
+}
+
+// searchFooter describes the search and its keys in the footer.
+func (m Model) searchFooter() string {
+	s := m.LogSearch
+	count := "no matches"
+	if len(s.matches) > 0 {
+		count = fmt.Sprintf("match %d of %d", s.Current+1, len(s.matches))
+	}
+	if s.Editing {
+		return fmt.Sprintf("Search: %s▏ • %s • ENTER to keep • ESC to close", s.Query, count)
+	}
+	return fmt.Sprintf("Search: %s • %s • N next • shift+N previous • / to edit • ESC to close", s.Query, count)
+}
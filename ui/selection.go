@@ -0,0 +1,83 @@
+package ui
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/husarion/husarion-os-flasher/platform"
+)
+
+// deviceID identifies a device independently of its path, which the kernel
+// may hand to another device after a replug: by its World Wide Name, or else
+// its model and serial number. It is empty when the platform cannot tell.
+func deviceID(device string) string {
+	if wwn := platform.WWN(device); wwn != "" {
+		return "WWN " + wwn
+	}
+	if serial := platform.Serial(device); serial != "" {
+		return strings.TrimSpace(platform.Model(device) + " " + serial)
+	}
+	return ""
+}
+
+// followSelectedDevice remembers the selected device and its identity. When
+// the device list changed and the remembered device now has another path, as
+// a card replugged from sda to sdb, the selection follows it.
+func (m *Model) followSelectedDevice(devices []string) {
+	changed := devices != nil && !slices.Equal(devices, m.ListedDevices)
+	if devices != nil {
+		m.ListedDevices = devices
+	}
+	item, ok := m.DeviceList.SelectedItem().(Item)
+	if !ok {
+		m.SelectedDevice, m.SelectedDeviceID = "", ""
+		return
+	}
+	if changed && m.SelectedDevice != "" {
+		if m.SelectedDeviceID != "" && deviceID(m.SelectedDevice) != m.SelectedDeviceID {
+			for i, other := range m.DeviceList.Items() {
+				path := other.(Item).value
+				if deviceID(path) == m.SelectedDeviceID {
+					m.DeviceList.Select(i)
+					m.AddLog(fmt.Sprintf("The selected device %s (%s) is now %s.", m.SelectedDevice, m.SelectedDeviceID, path))
+					m.SelectedDevice = path
+					return
+				}
+			}
+		} else if selectItemByValue(&m.DeviceList, m.SelectedDevice) {
+			// Still there, whatever moved around it
+			return
+		}
+	}
+	if item.value != m.SelectedDevice {
+		m.SelectedDevice, m.SelectedDeviceID = item.value, deviceID(item.value)
+	}
+}
+
+// selectedDeviceChanged reports whether the selected path now holds another
+// device than when it was selected, warning in the log if so. The new device
+// is remembered, so flashing again goes ahead.
+func (m *Model) selectedDeviceChanged() bool {
+	item, ok := m.DeviceList.SelectedItem().(Item)
+	if !ok {
+		return false
+	}
+	if item.value != m.SelectedDevice {
+		m.followSelectedDevice(nil)
+		return false
+	}
+	id := deviceID(item.value)
+	if m.SelectedDeviceID == "" || id == m.SelectedDeviceID {
+		m.SelectedDeviceID = id
+		return false
+	}
+	now := id
+	if now == "" {
+		now = "unknown"
+	}
+	m.AddLog(fmt.Sprintf("Warning: %s is no longer the device that was selected (was %s, now %s). Check the device and start again.",
+		item.value, m.SelectedDeviceID, now))
+	m.SelectedDeviceID = id
+	return true
+}
@@ -0,0 +1,55 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/husarion/husarion-os-flasher/internal/flash"
+)
+
+func init() {
+	flash.SetSizeCache(integritySizes{})
+}
+
+// integritySizes keeps the uncompressed sizes of xz images in integrity.yaml,
+// next to their checks, so that flashing an image again shows exact progress
+// without listing the archive.
+type integritySizes struct{}
+
+func (integritySizes) CachedSize(path string) (int64, bool) {
+	entry, ok := loadIntegrityEntry(path)
+	if !ok || entry.RawSize == 0 || entry.RawSizeOf == "" || entry.RawSizeOf != archiveStamp(path) {
+		return 0, false
+	}
+	return entry.RawSize, true
+}
+
+func (integritySizes) CacheSize(path string, size int64) {
+	stamp := archiveStamp(path)
+	if stamp == "" {
+		return
+	}
+	if entry, ok := loadIntegrityEntry(path); ok && entry.RawSize == size && entry.RawSizeOf == stamp {
+		return
+	}
+	// A read-only image directory only goes without the cache
+	_ = updateIntegrityEntry(path, func(entry IntegrityEntry) IntegrityEntry {
+		entry.RawSize, entry.RawSizeOf = size, stamp
+		return entry
+	})
+}
+
+// archiveStamp identifies the contents of an image by its size and
+// modification time, or is empty when it cannot be read.
+func archiveStamp(path string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+	size, err := flash.FileSize(path)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%d %s", size, info.ModTime().UTC().Format(time.RFC3339Nano))
+}
@@ -0,0 +1,70 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/husarion/husarion-os-flasher/cluster"
+	"github.com/husarion/husarion-os-flasher/util"
+)
+
+// renderStations renders the coordinator's dashboard: every station reporting
+// to it with its devices and running jobs.
+func (m Model) renderStations() string {
+	styles := Styles()
+	header := styles.Header.Render(" Stations ")
+	offline := lipgloss.NewStyle().Foreground(lipgloss.Color(ColorDisabled))
+
+	now := time.Now()
+	var lines []string
+	for _, st := range cluster.Stations() {
+		title := fmt.Sprintf("%s  %s  %s", st.Name, st.Address, st.Version)
+		if !st.Online(now) {
+			lines = append(lines, offline.Render(title+"  offline since "+st.LastSeen.Format(time.TimeOnly)))
+			continue
+		}
+		lines = append(lines, lipgloss.NewStyle().Bold(true).Render(title))
+
+		jobs := make(map[string]cluster.Job)
+		for _, job := range st.Jobs {
+			jobs[job.Device] = job
+		}
+		for _, dev := range st.Devices {
+			line := fmt.Sprintf("  %s (%s)", dev.Path, util.FormatBytes(dev.Size))
+			if job, ok := jobs[dev.Path]; ok {
+				line += fmt.Sprintf(": #%d %s %s for %s", job.ID, job.Kind, job.Image, util.FormatDuration(now.Sub(job.Started)))
+				if job.Operator != "" {
+					line += " by " + job.Operator
+				}
+				delete(jobs, dev.Path)
+			}
+			lines = append(lines, line)
+		}
+		// Jobs without a device, e.g. extraction
+		for _, job := range st.Jobs {
+			if _, ok := jobs[job.Device]; ok {
+				lines = append(lines, fmt.Sprintf("  #%d %s %s for %s", job.ID, job.Kind, job.Image, util.FormatDuration(now.Sub(job.Started))))
+			}
+		}
+		if len(st.Devices) == 0 && len(st.Jobs) == 0 {
+			lines = append(lines, "  no devices")
+		}
+	}
+	if len(lines) == 0 {
+		lines = append(lines, "No station has reported yet. Start agents with --coordinator.")
+	}
+
+	body := styles.Container.Render(styles.InfoPanel.Render(strings.Join(lines, "\n")))
+	footer := styles.FooterStyle.Render("Dispatch jobs with: remote --host <coordinator> dispatch STATION COMMAND • any key to close")
+
+	return lipgloss.Place(
+		m.Width,
+		m.Height,
+		lipgloss.Center,
+		lipgloss.Center,
+		lipgloss.JoinVertical(lipgloss.Center, header, body, footer),
+	)
+}
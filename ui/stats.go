@@ -0,0 +1,78 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/husarion/husarion-os-flasher/internal/history"
+)
+
+// OpenStats shows the statistics screen, summarizing the job history.
+func (m *Model) OpenStats() (tea.Model, tea.Cmd) {
+	entries, err := history.Load(HistoryPath(m.OsImgPath))
+	if err != nil {
+		m.AddLog(fmt.Sprintf("Error: %v", err))
+		return m, nil
+	}
+	m.StatsLines = history.Summarize(entries).Lines()
+	m.ShowStats = true
+	return m, nil
+}
+
+// handleStatsKey exports the statistics on E and closes the screen on any key
+// other than quit.
+func (m Model) handleStatsKey(key string) (tea.Model, tea.Cmd) {
+	switch key {
+	case "q":
+		return m, tea.Quit
+	case "e", "E":
+		if path, err := exportStats(m.OsImgPath); err != nil {
+			m.AddLog(fmt.Sprintf("Error: exporting statistics failed: %v", err))
+		} else {
+			m.AddLog("Statistics exported to " + path)
+		}
+	}
+	m.ShowStats = false
+	return m, nil
+}
+
+// exportStats writes the statistics as CSV next to the history file and
+// returns its path.
+func exportStats(osImgPath string) (string, error) {
+	entries, err := history.Load(HistoryPath(osImgPath))
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(crashDir(osImgPath), "stats-"+time.Now().Format("20060102-150405")+".csv")
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	if err := history.Summarize(entries).WriteCSV(f); err != nil {
+		f.Close()
+		return "", err
+	}
+	return path, f.Close()
+}
+
+// renderStats renders the statistics screen.
+func (m Model) renderStats() string {
+	styles := Styles()
+	header := styles.Header.Render(" Flash Statistics ")
+	body := styles.Container.Render(styles.InfoPanel.Render(strings.Join(m.StatsLines, "\n")))
+	footer := styles.FooterStyle.Render("E to export as CSV • any key to close")
+
+	return lipgloss.Place(
+		m.Width,
+		m.Height,
+		lipgloss.Center,
+		lipgloss.Center,
+		lipgloss.JoinVertical(lipgloss.Center, header, body, footer),
+	)
+}
@@ -4,8 +4,8 @@ import (
 	"github.com/charmbracelet/lipgloss"
 )
 
-const (
-	// Color constants
+// Colors of the UI, set by SetTheme
+var (
 	ColorBackground = "#201F24" // Blackish
 	ColorWhite      = "#FFFFFF"
 	ColorPantone    = "#D0112B" // Pantone 186C
@@ -14,11 +14,11 @@ const (
 	ColorLightRed   = "#ED3B42"
 	ColorError      = "#FF3333" // Bright red for errors
 	ColorDisabled   = "#1A1B22" // Darker color for disabled buttons
-
-	// Minimal width for each selection window.
-	MinListWidth = 50
 )
 
+// Minimal width for each selection window.
+const MinListWidth = 50
+
 // Styles returns common styles used in the UI
 func Styles() struct {
 	Header      lipgloss.Style
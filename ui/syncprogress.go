@@ -0,0 +1,50 @@
+package ui
+
+import (
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// watchSync reports how much of the cached data has been flushed while a sync
+// runs, so that a slow card does not look hung at 100%. The returned function
+// stops the reports; none is sent after it returns.
+func watchSync(progressChan chan tea.Msg) func() {
+	start, ok := pendingWriteback()
+	if !ok || start == 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		began := time.Now()
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			left, ok := pendingWriteback()
+			if !ok {
+				return
+			}
+			select {
+			case progressChan <- ProgressMsg(progressLine(max(start-left, 0), start, time.Since(began), "flushed ")):
+			default:
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-exited
+		})
+	}
+}
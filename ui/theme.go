@@ -0,0 +1,20 @@
+package ui
+
+// themes are the palettes of config.Themes, in the order of the Color
+// variables: background, white, Pantone, lilac, anthracite, light red, error
+// and disabled.
+var themes = map[string][8]string{
+	"default":       {"#201F24", "#FFFFFF", "#D0112B", "#718CFD", "#2F303B", "#ED3B42", "#FF3333", "#1A1B22"},
+	"high-contrast": {"#000000", "#FFFFFF", "#E00000", "#00BFFF", "#A0A0A0", "#FF4040", "#FF0000", "#808080"},
+}
+
+// SetTheme sets the colors of the UI to a theme of config.Themes, the default
+// one for an empty or unknown name. It applies to every session.
+func SetTheme(name string) {
+	palette, ok := themes[name]
+	if !ok {
+		palette = themes["default"]
+	}
+	ColorBackground, ColorWhite, ColorPantone, ColorLilac = palette[0], palette[1], palette[2], palette[3]
+	ColorAnthracite, ColorLightRed, ColorError, ColorDisabled = palette[4], palette[5], palette[6], palette[7]
+}
@@ -0,0 +1,133 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/husarion/husarion-os-flasher/bmap"
+	"github.com/husarion/husarion-os-flasher/internal/flash"
+	"github.com/husarion/husarion-os-flasher/platform"
+	"github.com/husarion/husarion-os-flasher/util"
+)
+
+// throughputFile keeps the write speed measured on each device, next to the
+// job history.
+const throughputFile = "throughput.yaml"
+
+// Writes shorter than minCalibrationBytes say little about sustained speed and
+// are not measured.
+const minCalibrationBytes = 256 << 20
+
+// A write slower than slowThroughput times the usual speed of its device is
+// reported, as the reader or the card may be failing.
+const slowThroughput = 0.5
+
+// Throughput is the sustained write speed measured on a device.
+type Throughput struct {
+	Rate    float64   `yaml:"rate"`    // bytes per second, a moving average
+	Writes  int       `yaml:"writes"`  // number of writes measured
+	Updated time.Time `yaml:"updated"` // last write measured
+}
+
+// throughputState holds the measured speeds of the process, loaded once from
+// the throughput file and shared by all sessions.
+var throughputState = struct {
+	sync.Mutex
+	loaded  bool
+	devices map[string]Throughput
+}{}
+
+// deviceKey identifies a device across jobs by its model and serial number,
+// empty when neither is known.
+func deviceKey(device string) string {
+	return strings.TrimSpace(platform.Model(device) + " " + platform.Serial(device))
+}
+
+// loadThroughputs reads the throughput file once. The caller holds the lock.
+func loadThroughputs(osImgPath string) {
+	if throughputState.loaded {
+		return
+	}
+	throughputState.loaded = true
+	throughputState.devices = map[string]Throughput{}
+	if b, err := os.ReadFile(filepath.Join(crashDir(osImgPath), throughputFile)); err == nil {
+		_ = yaml.Unmarshal(b, &throughputState.devices)
+	}
+}
+
+// knownThroughput returns the speed measured on a device.
+func knownThroughput(osImgPath, key string) (Throughput, bool) {
+	throughputState.Lock()
+	defer throughputState.Unlock()
+	loadThroughputs(osImgPath)
+	t, ok := throughputState.devices[key]
+	return t, ok
+}
+
+// recordThroughput adds a write at rate to the average of a device and returns
+// the average before it. Failing to save it only loses the measurement.
+func recordThroughput(osImgPath, key string, rate float64) (Throughput, bool) {
+	throughputState.Lock()
+	defer throughputState.Unlock()
+	loadThroughputs(osImgPath)
+	prev, ok := throughputState.devices[key]
+	t := Throughput{Rate: rate, Writes: prev.Writes + 1, Updated: time.Now()}
+	if ok {
+		t.Rate = 0.7*prev.Rate + 0.3*rate
+	}
+	throughputState.devices[key] = t
+
+	b, err := yaml.Marshal(throughputState.devices)
+	if err == nil && os.MkdirAll(crashDir(osImgPath), 0755) == nil {
+		_ = os.WriteFile(filepath.Join(crashDir(osImgPath), throughputFile), b, 0644)
+	}
+	return prev, ok
+}
+
+// writtenBytes returns how many bytes flashing src writes: the mapped blocks
+// of its block map, or the whole image when its size is known.
+func writtenBytes(src string) (int64, bool) {
+	if bmapPath := bmap.Find(src, stripCompression(src)); bmapPath != "" {
+		if bm, err := bmap.Load(bmapPath); err == nil {
+			return bm.MappedBytes(), true
+		}
+	}
+	return flash.RawSize(src)
+}
+
+// logExpectedDuration estimates how long flashing src to dst takes from the
+// speed measured on dst before.
+func (m *Model) logExpectedDuration(src, dst string) {
+	key := deviceKey(dst)
+	if key == "" {
+		return
+	}
+	t, ok := knownThroughput(m.OsImgPath, key)
+	size, exact := writtenBytes(src)
+	if !ok || !exact || t.Rate <= 0 {
+		return
+	}
+	m.AddLog(fmt.Sprintf("Expected to take about %s: %s usually writes %s/s.",
+		util.FormatDuration(time.Duration(float64(size)/t.Rate*float64(time.Second))), key, util.FormatBytes(int64(t.Rate))))
+}
+
+// calibrate measures the speed of the write of src to dst that just ended and
+// warns when it was much slower than usual for the device.
+func (m *Model) calibrate(src, dst string) {
+	key := deviceKey(dst)
+	size, exact := writtenBytes(src)
+	if key == "" || !exact || size < minCalibrationBytes {
+		return
+	}
+	rate := float64(size) / time.Since(m.FlashStartTime).Seconds()
+	if prev, ok := recordThroughput(m.OsImgPath, key, rate); ok && rate < prev.Rate*slowThroughput {
+		m.AddLog(fmt.Sprintf("Warning: this write ran at %s/s, much slower than the usual %s/s of %s: the reader or the card may be failing.",
+			util.FormatBytes(int64(rate)), util.FormatBytes(int64(prev.Rate)), key))
+	}
+}
@@ -0,0 +1,57 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// appTitle is the terminal title of an idle session.
+const appTitle = "husarion-os-flasher"
+
+// terminalTitle returns the terminal title of the session: the running job and
+// its progress, such as "flashing 63% - husarion-os-flasher", or appTitle.
+func (m *Model) terminalTitle() string {
+	var job string
+	switch {
+	case m.Aborting:
+		job = "aborting"
+	case m.Flashing:
+		job = "flashing"
+	case m.Extracting:
+		job = "extracting"
+	case m.Checking:
+		job = "checking"
+	case m.FlashingFirmware:
+		job = "flashing firmware"
+	case m.UpdatingCAN:
+		job = "updating CAN"
+	case m.BurningIn:
+		job = "burn-in"
+	case m.RunningAction != "":
+		job = strings.ToLower(m.RunningAction)
+	default:
+		return appTitle
+	}
+	if m.Composite != nil && m.Composite.running() {
+		job = fmt.Sprintf("%s %.0f%%", job, m.compositeProgress()*100)
+	} else if p := m.lastProgress(); p > 0 {
+		job = fmt.Sprintf("%s %.0f%%", job, p*100)
+	}
+	return job + " - " + appTitle
+}
+
+// updateTitle sets the terminal title of an SSH session when it changed,
+// unless the config turns it off.
+func (m *Model) updateTitle() tea.Cmd {
+	if !m.SSH || !m.Config.ShowTerminalTitle() {
+		return nil
+	}
+	title := m.terminalTitle()
+	if title == m.title {
+		return nil
+	}
+	m.title = title
+	return tea.SetWindowTitle(title)
+}
@@ -13,7 +13,9 @@ import (
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	zone "github.com/lrstanley/bubblezone"
-	
+
+	"github.com/husarion/husarion-os-flasher/config"
+	"github.com/husarion/husarion-os-flasher/platform"
 	"github.com/husarion/husarion-os-flasher/util"
 )
 
@@ -75,12 +77,24 @@ func (d wrappingDelegate) Render(w io.Writer, m list.Model, index int, item list
 		desc:  realItem.desc,
 	}
 	
+	// Images still being copied are greyed out
+	if realItem.copying {
+		dimmed := d.DefaultDelegate
+		disabled := lipgloss.Color(ColorDisabled)
+		dimmed.Styles.NormalTitle = dimmed.Styles.NormalTitle.Foreground(disabled)
+		dimmed.Styles.NormalDesc = dimmed.Styles.NormalDesc.Foreground(disabled)
+		dimmed.Styles.SelectedTitle = dimmed.Styles.SelectedTitle.Foreground(disabled)
+		dimmed.Styles.SelectedDesc = dimmed.Styles.SelectedDesc.Foreground(disabled)
+		dimmed.Render(w, m, index, truncatedItem)
+		return
+	}
+
 	// Use the default delegate to render with the truncated title
 	d.DefaultDelegate.Render(w, m, index, truncatedItem)
 }
 
 // NewModel creates a new model for the application
-func NewModel(osImgPath string, termWidth, termHeight int) Model {
+func NewModel(osImgPath string, cfg *config.Config, termWidth, termHeight int) Model {
 	currentUser, _ := user.Current()
 	if currentUser.Uid != "0" {
 		return Model{Err: fmt.Errorf("this program must be run as root")}
@@ -95,25 +109,22 @@ func NewModel(osImgPath string, termWidth, termHeight int) Model {
 	}
 
 	// Get available devices and images
-	devices, err := GetAvailableDevices()
+	devices, err := platform.Current.Devices()
 	if err != nil {
 		return Model{Err: err}
 	}
-	images, err := GetImageFiles(osImgPath)
+	images, err := ImageFiles(osImgPath)
 	if err != nil {
 		return Model{Err: err}
 	}
 
-	var deviceItems []list.Item
-	for _, dev := range devices {
-		deviceItems = append(deviceItems, Item{title: dev, value: dev, desc: "Storage Device"})
-	}
+	setCrashContext(osImgPath, cfg)
+	loadJournal()
 
-	var imageItems []list.Item
-	for _, img := range images {
-		imageItems = append(imageItems, Item{title: filepath.Base(img), value: img, desc: "OS Image"})
+	var target string
+	if cfg != nil {
+		target = cfg.Robot
 	}
-
 	// Use default delegate for devices, custom truncating delegate for images
 	deviceDelegate := list.NewDefaultDelegate()
 	imageDelegate := newWrappingDelegate() // Intelligent truncation
@@ -124,7 +135,7 @@ func NewModel(osImgPath string, termWidth, termHeight int) Model {
 		listWidth = 30 // Minimum width
 	}
 
-	deviceList := list.New(deviceItems, deviceDelegate, listWidth, 7)
+	deviceList := list.New(deviceItems(cfg, devices), deviceDelegate, listWidth, 7)
 	deviceList.Title = "  Select Target Device  "
 	deviceList.SetShowTitle(true)
 	deviceList.SetShowHelp(false)
@@ -135,7 +146,7 @@ func NewModel(osImgPath string, termWidth, termHeight int) Model {
 		Background(lipgloss.Color(ColorPantone)).
 		Padding(0, 1)
 
-	imageList := list.New(imageItems, imageDelegate, listWidth, 7)
+	imageList := list.New(imageItems(osImgPath, images, target), imageDelegate, listWidth, 7)
 	imageList.Title = "    Select Image File   "
 	imageList.SetShowTitle(true)
 	imageList.SetShowHelp(false)
@@ -146,14 +157,16 @@ func NewModel(osImgPath string, termWidth, termHeight int) Model {
 		Background(lipgloss.Color(ColorPantone)).
 		Padding(0, 1)
 
-	viewport := viewport.New(termWidth, 7)
+	viewport := viewport.New(termWidth, DefaultLogLines)
 	viewport.SetContent("Logs:\n")
 
-	return Model{
+	m := Model{
 		DeviceList:    deviceList,
 		ImageList:     imageList,
 		Logs:          make([]string, 0),
 		Tick:          time.Now(),
+		LastInput:     time.Now(),
+		info:          &infoCache{},
 		ActiveList:    0,  // Starting with device list selected
 		ProgressChan:  make(chan tea.Msg),
 		Width:         termWidth,
@@ -161,14 +174,72 @@ func NewModel(osImgPath string, termWidth, termHeight int) Model {
 		Zones:         zone.New(), // Initialize zone manager
 		Viewport:      viewport,
 		OsImgPath:     osImgPath,
+		Config:        cfg,
+		Operator:      ConsoleOperator(),
+		InventorySeen: inventorySeq(),
+		ConfigSeen:    configReloadSeq(),
+		Role:          RoleOperator,
+		AbortsSeen:    abortAllCount(),
+		Monitoring:    errMonitoring() != nil,
+		TargetRobot:   target,
 		Extracting:    false,  // Initialize extraction state
 	}
+
+	m.applyLayout()
+	m.selectRecommended()
+	m.pollRobot()
+
+	if synced, reason := ClockStatus(); !synced {
+		requestNTPSync()
+		m.AddLog(fmt.Sprintf("Warning: %s. History, integrity and audit records are marked \"unsynced clock\" until it is set.", reason))
+	}
+
+	// Offer to restart a job that was interrupted by a crash
+	if jobs := takeInterruptedJobs(crashDir(osImgPath)); len(jobs) > 0 {
+		job := jobs[len(jobs)-1]
+		m.InterruptedJob = &job
+		m.AddLog(fmt.Sprintf("Error: previous session crashed during %s of %s (started %s)",
+			job.Kind, filepath.Base(job.Src), job.Started.Format(time.RFC3339)))
+		if job.Kind == "flash" || job.Kind == "burnin" {
+			m.AddLog(fmt.Sprintf("Contents of %s are unknown - flash it again before use.", job.Dst))
+		}
+		if job.Kind == "firmware" {
+			m.AddLog(fmt.Sprintf("The controller on %s may not start - write its firmware again.", job.Dst))
+		}
+		m.AddLog("Press R to restart the interrupted job.")
+	}
+
+	// Jobs cut short without a crash report, e.g. by a power loss
+	for _, job := range takeLostJobs() {
+		if m.InterruptedJob != nil && m.InterruptedJob.Started.Equal(job.Started) {
+			continue
+		}
+		m.AddLog(fmt.Sprintf("Error: the station stopped during %s of %s (started %s)",
+			job.Kind, filepath.Base(job.Src), job.Started.Format(time.RFC3339)))
+		if job.Kind == "flash" || job.Kind == "burnin" || job.Kind == "action" {
+			m.AddLog(fmt.Sprintf("%s is suspect - verify before use.", job.Dst))
+		}
+		if job.Kind == "firmware" {
+			m.AddLog(fmt.Sprintf("The controller on %s may not start - write its firmware again.", job.Dst))
+		}
+		if m.InterruptedJob == nil && job.Kind != "action" {
+			job := job
+			m.InterruptedJob = &job
+			m.AddLog("Press R to restart the interrupted job.")
+		}
+	}
+
+	return m
 }
 
 // Init initializes the model
 func (m Model) Init() tea.Cmd {
-	return tea.Tick(time.Second, func(t time.Time) tea.Msg {
+	return tea.Batch(waitImageChange(m.OsImgPath), tea.Tick(time.Second, func(t time.Time) tea.Msg {
 		return TickMsg(t)
+	}), func() tea.Msg {
+		// Look the tool versions up before a report needs them
+		toolVersions()
+		return nil
 	})
 }
 
@@ -177,7 +248,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var cmds []tea.Cmd
 	
 	// Update ready state at the beginning of every update
-	m.Ready = (m.DeviceList.SelectedItem() != nil && m.ImageList.SelectedItem() != nil)
+	m.Ready = (m.DeviceList.SelectedItem() != nil && m.imageSelected())
 
 	switch msg := msg.(type) {
 	case tea.WindowSizeMsg:
@@ -207,26 +278,79 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 		m.DeviceList.SetSize(listWidth, m.DeviceList.Height())
 		m.ImageList.SetSize(listWidth, m.ImageList.Height())
+
+		// Each size class keeps its own layout
+		if sizeClass(m.Width, m.Height) != m.LayoutClass {
+			m.applyLayout()
+		}
+		m.Viewport.Height = min(m.logLines(), m.maxLogLines())
 		
 		return m, nil
 
 	case TickMsg:
+		maybeStartMaintenance(m.OsImgPath, m.Config, time.Time(msg))
+		pollInstance()
+		_, monitoring := monitorStatus()
+		if m.Monitoring && !monitoring {
+			m.AddLog("The other flasher instance exited; this one now controls the devices.")
+		}
+		m.Monitoring = monitoring
+		m.pollRobot()
+		m.checkMemory()
+		pollInventory(m.OsImgPath)
+		m.logInventoryChanges()
+		pollConfig(m.Config)
+		m.logConfigChanges()
 		m.Refresh()
-		return m, tea.Tick(time.Second, func(t time.Time) tea.Msg {
+		m.prewarmSelected()
+		m.pollPower()
+		return m, tea.Batch(m.pollQueue(), m.updateTitle(), tea.Tick(time.Second, func(t time.Time) tea.Msg {
 			return TickMsg(t)
-		})
+		}))
+
+	case ImagesChangedMsg:
+		pollInventory(m.OsImgPath)
+		m.logInventoryChanges()
+		m.Refresh()
+		return m, waitImageChange(m.OsImgPath)
 
 	case ProgressMsg:
 		m.AddLog(string(msg))
 		// Continue listening for progress messages during any long-running action
-		if m.Flashing || m.Extracting || m.Checking {
+		if m.Busy() {
 			return m, ListenProgress(m.ProgressChan)
 		}
 		return m, nil
 
 	case DoneMsg:
+		if !msg.Verified && !msg.Plugins {
+			m.calibrate(msg.Src, msg.Dst)
+		}
+		if mode := m.verifyMode(msg.Src); mode != "none" && !msg.Verified {
+			m.wizardVerifying()
+			m.compositeVerifying()
+			m.VerifyMode = mode
+			m.DdCmd = nil
+			m.DdPty = nil
+			m.DdCancel = nil
+			return m, tea.Batch(
+				VerifyWrite(msg.Src, msg.Dst, mode, m.ProgressChan),
+				ListenProgress(m.ProgressChan),
+			)
+		}
+		if job, _ := runningJob(m.JobID); !msg.Plugins && hasPluginSteps(job.Kind == "flash") {
+			m.DdCmd = nil
+			m.DdPty = nil
+			m.DdCancel = nil
+			return m, tea.Batch(
+				RunPluginSteps(msg, job.Kind == "flash", m.ProgressChan),
+				ListenProgress(m.ProgressChan),
+			)
+		}
+		clearSuspect(msg.Dst)
 		m.Flashing = false
 		m.Aborting = false  // Reset aborting state
+		job, jobOk := m.finishJob()
 		
 		// Calculate flashing duration
 		duration := time.Since(m.FlashStartTime)
@@ -240,6 +364,15 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				srcName, 
 				msg.Dst, 
 				util.FormatDuration(duration))
+			if meta := LoadImageMeta(msg.Src); meta != nil && meta.Version != "" {
+				successMsg += " (release " + meta.Summary() + ")"
+			}
+			if msg.Verified {
+				successMsg += ", verified (" + m.VerifyMode + ")"
+			}
+			if job.Kind == "verify" {
+				successMsg = fmt.Sprintf("%s verified on %s in %s (%s)", srcName, msg.Dst, util.FormatDuration(duration), m.VerifyMode)
+			}
 		} else {
 			// Fallback if source/destination info is missing
 			successMsg = fmt.Sprintf("Flashing completed successfully in %s!", util.FormatDuration(duration))
@@ -254,7 +387,8 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.AddLog(successMsg)
 		m.DdCmd = nil
 		m.DdPty = nil  // Clear pty reference after completion
-		return m, nil
+		m.DdCancel = nil
+		return m, m.jobHook(job, jobOk, "success", nil)
 
 	case ErrorMsg:
 		m.Flashing = false
@@ -262,24 +396,35 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.ConfiguringEeprom = false
 		m.Extracting = false
 		m.Checking = false
+		m.FlashingFirmware = false
+		m.UpdatingCAN = false
+		m.BurningIn = false
+		m.RunningAction = ""
+		job, jobOk := m.finishJob()
 		m.AddLog(fmt.Sprintf("Error: %v", msg.Err))
 		m.DdCmd = nil
-		m.ExtractCmd = nil
+		m.DdCancel = nil
+		m.ExtractCancel = nil
 		m.CheckCmd = nil
 		m.DdPty = nil
-		m.ExtractPty = nil
 		m.CheckPty = nil
-		return m, nil
+		m.ActionCmd = nil
+		m.ActionPty = nil
+		m.FirmwareCmd = nil
+		m.FirmwarePty = nil
+		m.CANCancel = nil
+		m.BurnInCancel = nil
+		return m, m.jobHook(job, jobOk, "failure", msg.Err)
 
 	case DDStartedMsg:
 		m.DdCmd = msg.Cmd
 		m.DdPty = msg.Pty
+		m.DdCancel = msg.Cancel
 		// Continue listening for progress messages.
 		return m, ListenProgress(m.ProgressChan)
 
 	case ExtractStartedMsg:
-		m.ExtractCmd = msg.Cmd
-		m.ExtractPty = msg.Pty
+		m.ExtractCancel = msg.Cancel
 		// Continue listening for progress messages and also send an immediate progress message
 		m.AddLog("Extraction started - monitoring progress...")
 		return m, tea.Batch(
@@ -291,8 +436,8 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	case ExtractCompletedMsg:
 		m.Extracting = false
-		m.ExtractCmd = nil  // Clear command reference after completion
-		m.ExtractPty = nil  // Clear pty reference after completion
+		job, jobOk := m.finishJob()
+		m.ExtractCancel = nil // Clear the abort after completion
 		
 		// Calculate extraction duration
 		duration := time.Since(m.ExtractStartTime)
@@ -308,11 +453,21 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			Render(successMsg)
 		
 		m.AddLog(successMsg)
+
+		// Flash the image when the extraction was the first step of a flash
+		if c := m.Chain; c != nil && c.Image == msg.Dst {
+			m.Chain = nil
+			_, cmd := m.flashExtracted(c)
+			return m, tea.Batch(cmd, m.jobHook(job, jobOk, "success", nil))
+		}
 		
 		// Refresh the image list
-		return m, func() tea.Msg {
-			return TickMsg(time.Now())
-		}
+		return m, tea.Batch(
+			func() tea.Msg {
+				return TickMsg(time.Now())
+			},
+			m.jobHook(job, jobOk, "success", nil),
+		)
 
 	case CheckStartedMsg:
 		m.CheckCmd = msg.Cmd
@@ -322,21 +477,154 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	case CheckCompletedMsg:
 		m.Checking = false
+		job, jobOk := m.finishJob()
 		m.CheckCmd = nil
 		m.CheckPty = nil
 		if msg.Ok {
 			m.AddLog(lipgloss.NewStyle().Foreground(lipgloss.Color("#00FF00")).Bold(true).Render("Integrity OK"))
+			return m, m.jobHook(job, jobOk, "success", nil)
+		}
+		m.AddLog(lipgloss.NewStyle().Foreground(lipgloss.Color("#FF0000")).Bold(true).Render("Integrity FAILED"))
+		if line := quarantineImage(msg.File, 0); line != "" {
+			m.AddLog(line)
+			m.Refresh()
+		}
+		return m, m.jobHook(job, jobOk, "failure", fmt.Errorf("integrity check failed"))
+
+	case ActionStartedMsg:
+		m.ActionCmd = msg.Cmd
+		m.ActionPty = msg.Pty
+		return m, ListenProgress(m.ProgressChan)
+
+	case FirmwareStartedMsg:
+		m.FirmwareCmd = msg.Cmd
+		m.FirmwarePty = msg.Pty
+		return m, ListenProgress(m.ProgressChan)
+
+	case FirmwareCompletedMsg:
+		// An aborted tool exits after the abort was reported
+		if !m.FlashingFirmware {
+			return m, nil
+		}
+		m.FlashingFirmware = false
+		m.FirmwareCmd = nil
+		m.FirmwarePty = nil
+		job, jobOk := m.finishJob()
+		if msg.Err != nil {
+			m.AddLog(fmt.Sprintf("Error: writing firmware %s to %s failed: %v", filepath.Base(msg.File), msg.Port, msg.Err))
+			return m, m.jobHook(job, jobOk, "failure", msg.Err)
+		}
+		m.AddLog(lipgloss.NewStyle().Foreground(lipgloss.Color("#00FF00")).Bold(true).Render(
+			fmt.Sprintf("Firmware %s written to %s in %s", filepath.Base(msg.File), msg.Port, util.FormatDuration(time.Since(m.FlashStartTime)))))
+		return m, m.jobHook(job, jobOk, "success", nil)
+
+	case CANStartedMsg:
+		m.CANCancel = msg.Cancel
+		return m, ListenProgress(m.ProgressChan)
+
+	case CANCompletedMsg:
+		if !m.UpdatingCAN {
+			return m, nil
+		}
+		m.UpdatingCAN = false
+		m.CANCancel = nil
+		job, jobOk := m.finishJob()
+		if err := m.canSummary(msg.Results); err != nil {
+			return m, m.jobHook(job, jobOk, "failure", err)
+		}
+		m.AddLog(lipgloss.NewStyle().Foreground(lipgloss.Color("#00FF00")).Bold(true).Render(
+			fmt.Sprintf("All %d CAN nodes on %s updated in %s", len(msg.Results), msg.Interface, util.FormatDuration(time.Since(m.FlashStartTime)))))
+		return m, m.jobHook(job, jobOk, "success", nil)
+
+	case BurnInStartedMsg:
+		m.BurnInCancel = msg.Cancel
+		return m, ListenProgress(m.ProgressChan)
+
+	case BurnInCompletedMsg:
+		if !m.BurningIn {
+			return m, nil
+		}
+		m.BurningIn = false
+		m.BurnInCancel = nil
+		job, jobOk := m.finishJob()
+		if err := m.burnInSummary(msg); err != nil {
+			m.AddLog(fmt.Sprintf("Error: %v", err))
+			return m, m.jobHook(job, jobOk, "failure", err)
+		}
+		m.AddLog(lipgloss.NewStyle().Foreground(lipgloss.Color("#00FF00")).Bold(true).Render(
+			fmt.Sprintf("%s passed %d burn-in passes in %s", msg.Device, len(msg.Passes), util.FormatDuration(time.Since(m.FlashStartTime)))))
+		return m, m.jobHook(job, jobOk, "success", nil)
+
+	case ActionCompletedMsg:
+		m.RunningAction = ""
+		m.ActionCmd = nil
+		m.ActionPty = nil
+		m.finishJob()
+		if msg.Err != nil {
+			m.AddLog(lipgloss.NewStyle().Foreground(lipgloss.Color("#FF0000")).Bold(true).Render(
+				fmt.Sprintf("%s failed: %v", msg.Label, msg.Err)))
+		} else {
+			m.AddLog(lipgloss.NewStyle().Foreground(lipgloss.Color("#00FF00")).Bold(true).Render(
+				fmt.Sprintf("%s completed successfully", msg.Label)))
+		}
+		m.wizardStepFinished(ternary(msg.Err == nil, "success", "failure"), msg.Err)
+		return m, nil
+
+	case HookOutputMsg:
+		m.AddLog(string(msg))
+		if m.HookRunning > 0 {
+			return m, ListenProgress(m.HookChan)
+		}
+		return m, nil
+
+	case HookCompletedMsg:
+		m.HookRunning--
+		if msg.Err != nil {
+			m.AddLog(fmt.Sprintf("Error: %s hook failed: %v", msg.Name, msg.Err))
 		} else {
-			m.AddLog(lipgloss.NewStyle().Foreground(lipgloss.Color("#FF0000")).Bold(true).Render("Integrity FAILED"))
+			m.AddLog(fmt.Sprintf("%s hook completed", msg.Name))
+		}
+		if m.HookRunning > 0 {
+			return m, ListenProgress(m.HookChan)
 		}
 		return m, nil
 
 	case tea.KeyMsg:
+		m.lockIdleAdmin()
+		if m.wake() {
+			return m, nil
+		}
 		return m.handleKeyMsg(msg)
 
 	case tea.MouseMsg:
+		m.lockIdleAdmin()
+		if m.wake() {
+			return m, nil
+		}
 		return m.handleMouseMsg(msg)
 
+	case DeviceSnapshotMsg:
+		m.keepSnapshot(msg)
+		return m, nil
+
+	case AboutMsg:
+		if m.ShowAbout {
+			m.AboutLines = msg.Lines
+		}
+		return m, nil
+
+	case PreviewMsg:
+		m.showPreview(msg)
+		return m, nil
+
+	case BootOptionsMsg:
+		m.showBootEdit(msg)
+		return m, nil
+
+	case BootEditedMsg:
+		m.bootEdited(msg)
+		return m, nil
+
 	case EEPROMConfigMsg:
 		for _, line := range msg.Output {
 			if line != "" { // Skip empty lines
@@ -344,24 +632,36 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 		}
 		m.ConfiguringEeprom = false
+		m.wizardStepFinished("success", nil)
 		return m, nil
 		
 	case AbortCompletedMsg:
 		m.Flashing = false
 		m.Extracting = false
 		m.Checking = false
+		m.FlashingFirmware = false
+		m.UpdatingCAN = false
+		m.BurningIn = false
 		m.Aborting = false
+		m.RunningAction = ""
+		job, jobOk := m.finishJob()
 		m.DdCmd = nil
-		m.ExtractCmd = nil
+		m.DdCancel = nil
+		m.ExtractCancel = nil
 		m.CheckCmd = nil
+		m.ActionCmd = nil
 		m.DdPty = nil
-		m.ExtractPty = nil
 		m.CheckPty = nil
+		m.ActionPty = nil
+		m.FirmwareCmd = nil
+		m.FirmwarePty = nil
+		m.CANCancel = nil
+		m.BurnInCancel = nil
 		m.AddLog(lipgloss.NewStyle().
 			Foreground(lipgloss.Color("#FFCC00")).
 			Bold(true).
 			Render("Operation aborted by user"))
-		return m, nil
+		return m, m.jobHook(job, jobOk, "aborted", fmt.Errorf("aborted by user"))
 	}
 
 	return m, tea.Batch(cmds...)
@@ -369,10 +669,60 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 // handleKeyMsg handles keyboard input
 func (m Model) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	// Any key other than quit closes the About overlay
+	if m.ShowAbout && msg.String() != "q" {
+		m.ShowAbout = false
+		return m, nil
+	}
+	// Any key other than quit closes the stations dashboard
+	if m.ShowStations && msg.String() != "q" {
+		m.ShowStations = false
+		return m, nil
+	}
+	if m.ShowStats {
+		return m.handleStatsKey(msg.String())
+	}
+	if m.ShowFailures {
+		return m.handleFailuresKey(msg)
+	}
+	if m.Preview != nil {
+		return m.handlePreviewKey(msg)
+	}
+	if m.BootEdit != nil {
+		return m.handleBootEditKey(msg)
+	}
+	if len(m.PrunePlan) > 0 {
+		return m.confirmPrune(msg.String())
+	}
+	if len(m.DuplicateGroups) > 0 {
+		return m.confirmDedup(msg.String())
+	}
+	if m.Approval != nil {
+		return m.handleApprovalKey(msg)
+	}
+	if m.Unlock != nil {
+		return m.handleUnlockKey(msg)
+	}
+	if m.handleSearchKey(msg) {
+		return m, nil
+	}
+	if m.Wizard != nil {
+		return m.handleWizardKey(msg)
+	}
+	if m.Composite != nil {
+		return m.handleCompositeKey(msg)
+	}
+	if m.Duplication != nil {
+		return m.handleDuplicationKey(msg)
+	}
+
 	switch msg.String() {
 	case "esc": // hit Esc → run 'shutdown -Ph now' (requires root)
 		// fire-and-forget so UI can exit immediately
 		go func() {
+			if demoMode {
+				return
+			}
 			cmd := exec.Command("shutdown", "-Ph", "now")
 			// optional: surface any error; omit if you prefer silence
 			if err := cmd.Run(); err != nil {
@@ -380,6 +730,7 @@ func (m Model) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			}
 		}()
 
+		m.ShutdownRequested = true
 		return m, tea.Quit
 		
 	case "q":
@@ -388,6 +739,75 @@ func (m Model) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	case "tab":
 		// Cycle through UI elements
 		return m.handleTab()
+
+	case "a":
+		return m.RunBuiltin("about")
+
+	case "p":
+		return m.RunBuiltin("prune")
+
+	case "d":
+		return m.RunBuiltin("dedup")
+
+	case "s":
+		return m.RunBuiltin("stations")
+
+	case "t":
+		return m.RunBuiltin("stats")
+
+	case "e":
+		return m.RunBuiltin("failures")
+
+	case "v":
+		return m.RunBuiltin("preview")
+
+	case "o":
+		return m.RunBuiltin("boot")
+
+	case "b":
+		m.CycleTargetRobot()
+		return m, nil
+
+	case "w":
+		return m.RunBuiltin("provision")
+
+	case "m":
+		return m.RunBuiltin("composite")
+
+	case "u":
+		return m.RunBuiltin("duplicate")
+
+	case "h":
+		m.toggleQueue()
+		return m, nil
+
+	case "ctrl+x":
+		return m.abortAll()
+
+	case "ctrl+a":
+		m.toggleAdmin()
+		return m, nil
+
+	case "l":
+		m.ToggleLists()
+		return m, nil
+
+	case "c":
+		m.ToggleCompact()
+		return m, nil
+
+	case "+", "=":
+		m.ResizeLog(1)
+		return m, nil
+
+	case "-":
+		m.ResizeLog(-1)
+		return m, nil
+
+	case "r", "R":
+		if m.InterruptedJob != nil {
+			return m.ResumeInterruptedJob()
+		}
 		
 	case "enter":
 		return m.handleEnter()
@@ -398,10 +818,12 @@ func (m Model) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	case 0: // Device list
 		var cmd tea.Cmd
 		m.DeviceList, cmd = m.DeviceList.Update(msg)
+		m.followSelectedDevice(nil)
 		return m, cmd
 	case 1: // Image list
 		var cmd tea.Cmd
 		m.ImageList, cmd = m.ImageList.Update(msg)
+		m.skipCopyingImage()
 		return m, cmd
 	case 2: // Viewport
 		var cmd tea.Cmd
@@ -415,103 +837,43 @@ func (m Model) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 
 // handleTab handles tab key navigation between UI elements
 func (m Model) handleTab() (tea.Model, tea.Cmd) {
-	// Start with the current active element
-	currentActive := m.ActiveList
-	
-	// Base focusable elements are the lists and viewport
-	validElements := []int{0, 1, 2}
-	
-	inOperation := m.Flashing || m.Extracting || m.Checking
-	hasCompressedImage := m.IsCompressedImageSelected()
-	isPi := util.IsRaspberryPi()
-
-	if inOperation {
-		// While an operation is running, only allow Abort among the buttons
-		abortIndex := -1
-		if isPi {
-			if hasCompressedImage || m.Extracting || m.Checking {
-				abortIndex = 6
-			} else {
-				abortIndex = 5
-			}
-		} else {
-			if hasCompressedImage || m.Extracting || m.Checking {
-				abortIndex = 5
-			} else {
-				abortIndex = 4
-			}
-		}
-		validElements = append(validElements, abortIndex)
-	} else {
-		// When idle, Flash is focusable
-		validElements = append(validElements, 3)
-		// EEPROM on Pi
-		if isPi {
-			validElements = append(validElements, 4)
-		}
-		// Extract button only when compressed image is selected and not in operation
-		if hasCompressedImage {
-			if isPi {
-				validElements = append(validElements, 5)
-			} else {
-				validElements = append(validElements, 4)
-			}
+	// Focus order: device list, image list, viewport, then every enabled button
+	if m.ActiveList < ActiveButtons-1 {
+		m.ActiveList++
+		return m, nil
+	}
+
+	var enabled []string
+	for _, b := range m.Buttons() {
+		if m.ButtonEnabled(b) {
+			enabled = append(enabled, b.ID)
 		}
-		// Add a virtual index for Check button to be navigable
-		validElements = append(validElements, 7)
 	}
-	
-	// Find the next valid element greater than current
-	foundNext := false
-	for i := 0; i < len(validElements); i++ {
-		if validElements[i] > currentActive {
-			m.ActiveList = validElements[i]
-			foundNext = true
-			break
+
+	next := 0
+	if m.ActiveList == ActiveButtons {
+		next = len(enabled)
+		for i, id := range enabled {
+			if id == m.FocusedButton {
+				next = i + 1
+				break
+			}
 		}
 	}
-	// Wrap around if needed
-	if !foundNext {
-		m.ActiveList = validElements[0]
+	// Wrap around to the device list after the last button
+	if next >= len(enabled) {
+		m.ActiveList = 0
+		m.FocusedButton = ""
+		return m, nil
 	}
+	m.FocusButton(enabled[next])
 	return m, nil
 }
 
 // handleEnter handles enter key press based on the active element
 func (m Model) handleEnter() (tea.Model, tea.Cmd) {
-	// Handle enter key based on which element is selected
-	if m.ActiveList == 3 {
-		// Flash button - only allow if not already in an operation and ready
-		if !m.Flashing && !m.Extracting && m.Ready {
-			return m.StartFlashing()
-		}
-	} else if m.ActiveList == 4 {
-		// This could be either EEPROM config or Abort button
-		if m.Flashing || m.Extracting {
-			// If we're in an operation, this is the Abort button
-			return m.AbortOperation()
-		} else if util.IsRaspberryPi() {
-			// Otherwise on Pi, this is the EEPROM button - only allow if not in operation
-			if !m.ConfiguringEeprom {
-				return m.ConfigEEPROM()
-			}
-		} else if m.IsCompressedImageSelected() {
-			// On non-Pi systems, this is the Extract Button - only allow if not in operation
-			if !m.Flashing && !m.Extracting {
-				return m.UncompressImage()
-			}
-		}
-	} else if (util.IsRaspberryPi() && m.ActiveList == 5 && !m.Flashing && !m.Extracting && !m.Checking) {
-		// Extract button on Pi (only when not in an operation)
-		if m.IsCompressedImageSelected() {
-			return m.UncompressImage()
-		}
-	} else if m.ActiveList == 7 && !m.Flashing && !m.Extracting && !m.Checking {
-		// Check button (virtual index)
-		return m.StartIntegrityCheck()
-	} else if (util.IsRaspberryPi() && m.ActiveList == 6) || (!util.IsRaspberryPi() && m.ActiveList == 5) {
-		// This is the dedicated Abort button position
-		return m.AbortOperation()
+	if m.ActiveList == ActiveButtons {
+		return m.PressFocusedButton()
 	}
 	return m, nil
 }
@@ -523,65 +885,24 @@ func (m Model) handleMouseMsg(msg tea.MouseMsg) (tea.Model, tea.Cmd) {
 		return m.HandleMouseWheel(msg)
 	}
 
-	// Only process left button clicks
-	if msg.Action == tea.MouseActionRelease || msg.Button != tea.MouseButtonLeft {
+	// Dragging the top border of the log resizes it
+	if m.dragLogBorder(msg) {
 		return m, nil
 	}
 
-	// Handle abort button clicks - make this the first check to prioritize it
-	if m.Zones.Get("abort-button").InBounds(msg) {
-		// Ensure we call abortOperation even if clicking from another UI element
-		return m.AbortOperation()
-	}
-
-	// Handle flash button clicks
-	if m.Zones.Get("flash-button").InBounds(msg) {
-		// First set the flash button as the active element
-		m.ActiveList = 3
-		
-		// Only allow flashing if not already in an operation
-		if !m.Flashing && !m.Extracting && m.Ready {
-			return m.StartFlashing()
-		}
-		return m, nil // Return after handling the flash button
-	}
-
-	// Handle uncompress button clicks
-	if m.IsCompressedImageSelected() && m.Zones.Get("uncompress-button").InBounds(msg) {
-		// Set appropriate focus index based on system
-		if util.IsRaspberryPi() {
-			m.ActiveList = 5
-		} else {
-			m.ActiveList = 4
-		}
-		
-		// Only allow extraction if not already in an operation
-		if !m.Flashing && !m.Extracting {
-			return m.UncompressImage()
-		}
-		return m, nil // Return after handling the uncompress button
-	}
-
-	// Check button clicks
-	if m.Zones.Get("check-button").InBounds(msg) {
-		// Mark selection for proper highlighting
-		m.ActiveList = 7
-		// Only allow when idle
-		if !m.Flashing && !m.Extracting && !m.Checking {
-			return m.StartIntegrityCheck()
-		}
+	// Only process left button clicks
+	if msg.Action == tea.MouseActionRelease || msg.Button != tea.MouseButtonLeft {
 		return m, nil
 	}
 
-	// Handle other element clicks
-	if m.Zones.Get("eeprom-button").InBounds(msg) {
-		// Only allow EEPROM configuration if not already in an operation
-		if !m.Flashing && !m.Extracting && !m.ConfiguringEeprom {
-			return m.ConfigEEPROM()
+	// Handle button clicks; focus follows the click even if the button is disabled
+	for _, b := range m.Buttons() {
+		if m.Zones.Get(b.ID).InBounds(msg) {
+			m.FocusButton(b.ID)
+			return m.PressFocusedButton()
 		}
-		return m, nil
 	}
-	
+
 	// Handle list selection
 	if m.Zones.Get("device-view").InBounds(msg) {
 		m.ActiveList = 0
@@ -0,0 +1,154 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/husarion/husarion-os-flasher/bmap"
+	"github.com/husarion/husarion-os-flasher/internal/flash"
+)
+
+// verifyDescriptions explain the verify policies in the info panel.
+var verifyDescriptions = map[string]string{
+	"none":    "not verified after flashing",
+	"quick":   "partition table, partition starts and samples compared after every flash",
+	"sampled": "first and last regions and a random 5% of blocks compared after every flash",
+	"full":    "full read-back compared after every flash",
+}
+
+// verifySampling is what each verify policy compares.
+var verifySampling = map[string]flash.Sampling{
+	"quick":   flash.VerifyQuick,
+	"sampled": flash.VerifySampled,
+	"full":    flash.VerifyAll,
+}
+
+// VerifyWrite checks what was written to dst against src, as the verify policy
+// mode ("quick", "sampled" or "full") requires. It sends DoneMsg with Verified set when
+// they match, and can be aborted like a write.
+func VerifyWrite(src, dst, mode string, progressChan chan tea.Msg) tea.Cmd {
+	return func() tea.Msg {
+		defer recoverJob(progressChan)
+
+		if demoMode {
+			demoVerify(src, dst, mode, progressChan)
+			return nil
+		}
+
+		// A block-map write leaves unmapped blocks as they were
+		size, _ := flash.RawSize(src)
+		var mapped []flash.Extent
+		if bmapPath := bmap.Find(src, stripCompression(src)); bmapPath != "" {
+			if bm, err := bmap.Load(bmapPath); err == nil {
+				size = bm.ImageSize
+				for _, r := range bm.Ranges {
+					mapped = append(mapped, flash.Extent{
+						Start: r.First * bm.BlockSize,
+						End:   min((r.Last+1)*bm.BlockSize, bm.ImageSize),
+					})
+				}
+			}
+		}
+
+		dev, err := os.Open(dst)
+		if err != nil {
+			return ErrorMsg{Err: fmt.Errorf("verification failed: %v", err)}
+		}
+		flushDevice(dev, dst, progressChan)
+		flash.DropCache(dev)
+		img, err := flash.OpenRaw(src)
+		if err != nil {
+			dev.Close()
+			return ErrorMsg{Err: err}
+		}
+
+		progressChan <- ProgressMsg(fmt.Sprintf("Verifying %s (%s)...", dst, mode))
+
+		cancel := make(chan struct{})
+		var once sync.Once
+		progressChan <- DDStartedMsg{Cancel: func() {
+			once.Do(func() {
+				close(cancel)
+				img.Kill()
+			})
+		}}
+
+		go func() {
+			defer recoverJob(progressChan)
+			defer dev.Close()
+
+			err := flash.Verify(img, dev, size, mapped, verifySampling[mode], throttledProgress(progressChan, "verified "), cancel)
+			img.Close()
+
+			select {
+			case <-cancel:
+				// AbortOperation reports completion
+				return
+			default:
+			}
+			if err = img.Explain(err); err != nil {
+				select {
+				case progressChan <- ErrorMsg{Err: fmt.Errorf("verification failed: %w", err)}:
+				default:
+				}
+				return
+			}
+			select {
+			case progressChan <- ProgressMsg("Verification passed."):
+			default:
+				return
+			}
+			select {
+			case progressChan <- DoneMsg{Src: src, Dst: dst, Verified: true}:
+			default:
+			}
+		}()
+
+		return nil
+	}
+}
+
+// verifyMode returns the check run after flashing image: its verify policy,
+// see verifyPolicy, but at least a quick check when the provisioning wizard
+// flashes.
+func (m *Model) verifyMode(image string) string {
+	mode := verifyPolicy(m.Config, image)
+	if mode == "none" && m.Wizard != nil && m.Wizard.running(stepFlash) {
+		return "quick"
+	}
+	return mode
+}
+
+// StartVerify checks the selected device against the selected image without
+// flashing it, as a verify job. mode "none" is taken as a quick check.
+func (m *Model) StartVerify(mode string) (tea.Model, tea.Cmd) {
+	if m.DeviceList.SelectedItem() == nil || !m.imageSelected() || m.Busy() {
+		return m, nil
+	}
+	if mode == "none" {
+		mode = "quick"
+	}
+	imagePath := m.ImageList.SelectedItem().(Item).value
+	devicePath := m.DeviceList.SelectedItem().(Item).value
+	jobID, err := beginJob("verify", imagePath, devicePath, m.Operator)
+	if err != nil {
+		m.AddLog(fmt.Sprintf("Error: %v", err))
+		return m, nil
+	}
+
+	m.ProgressChan = make(chan tea.Msg, 100)
+	m.Flashing = true
+	m.FlashStartTime = time.Now()
+	m.JobID = jobID
+	m.VerifyMode = mode
+	m.FocusButton("abort-button")
+
+	return m, tea.Batch(
+		VerifyWrite(imagePath, devicePath, mode, m.ProgressChan),
+		ListenProgress(m.ProgressChan),
+	)
+}
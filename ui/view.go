@@ -4,9 +4,12 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
-	"gopkg.in/yaml.v3"
+	"github.com/charmbracelet/bubbles/list"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/husarion/husarion-os-flasher/platform"
 	"github.com/husarion/husarion-os-flasher/util"
 )
 
@@ -26,119 +29,144 @@ func (m Model) View() string {
 		m.Height = 20
 	}
 
-	// Build extra info panel for disk and image sizes.
-	var diskInfo, imageInfo string
-	if m.DeviceList.SelectedItem() != nil {
-		disk := m.DeviceList.SelectedItem().(Item).value
-		size, err := util.GetDiskSize(disk)
-		if err != nil {
-			diskInfo = disk + " (size: unknown)"
-		} else {
-			diskInfo = disk + " (size: " + util.FormatBytes(size) + ")"
-		}
-	} else {
-		diskInfo = "No disk selected"
+	if m.ShowAbout {
+		return m.renderAbout(styles)
 	}
-
-	integrityStatus := "unknown"
-	integrityActual := ""
-	if m.ImageList.SelectedItem() != nil {
-		image := m.ImageList.SelectedItem().(Item).value
-		stat, err := os.Stat(image)
-		if err != nil {
-			imageInfo = image + " (size: unknown)"
-		} else {
-			imageInfo = image + " (size: " + util.FormatBytes(stat.Size()) + ")"
-		}
-		// Load integrity.yaml from the image's directory and look up status
-		yamlPath := filepath.Join(filepath.Dir(image), "integrity.yaml")
-		if b, err := os.ReadFile(yamlPath); err == nil {
-			var doc IntegrityFile
-			if yaml.Unmarshal(b, &doc) == nil && doc.Files != nil {
-				if entry, ok := doc.Files[filepath.Base(image)]; ok {
-					if entry.Status != "" {
-						integrityStatus = entry.Status
-					}
-					if entry.Actual != "" {
-						integrityActual = entry.Actual
-					}
-				}
-			}
-		}
-	} else {
-		imageInfo = "No image selected"
+	if m.ShowStations {
+		return m.renderStations()
+	}
+	if m.ShowStats {
+		return m.renderStats()
+	}
+	if m.ShowFailures {
+		return m.renderFailures()
+	}
+	if m.Preview != nil {
+		return m.renderPreview()
+	}
+	if m.BootEdit != nil {
+		return m.renderBootEdit()
+	}
+	if len(m.PrunePlan) > 0 {
+		return m.renderPrune()
+	}
+	if len(m.DuplicateGroups) > 0 {
+		return m.renderDedup()
+	}
+	if m.Approval != nil {
+		return m.renderApproval()
+	}
+	if m.Unlock != nil {
+		return m.renderUnlock()
+	}
+	if m.idle() {
+		return m.renderIdle()
 	}
 
-	integrityLine := "Integrity check: " + integrityStatus
-	if integrityActual != "" {
-		integrityLine += ", actual: " + integrityActual
+	var infoPanel string
+	if !m.Layout.Compact {
+		infoPanel = styles.InfoPanel.Render(m.infoText())
+	}
+	if m.Failure != nil && !m.Busy() {
+		infoPanel = m.errorPanel(min(m.Width-4, 100))
 	}
-	infoPanel := styles.InfoPanel.Render("Disk: " + diskInfo + "\nImage: " + imageInfo + "\n" + integrityLine)
 
 	// Header
 	header := styles.Header.Render(" Husarion OS Flasher ")
-
-	// Mark active and inactive elements
-	deviceView := m.DeviceList.View()
-	imageView := m.ImageList.View()
-	viewportView := m.Viewport.View()
-
-	// Add explicit selection indicators (index/total)
-	if m.DeviceList.FilterState() == 0 {
-		// Only when not filtering
-		if total := len(m.DeviceList.Items()); total > 0 && m.DeviceList.Index() >= 0 {
-			deviceView = deviceView + "\n" + lipgloss.NewStyle().Foreground(lipgloss.Color(ColorLilac)).Render(
-				fmt.Sprintf("Selected device: %d/%d", m.DeviceList.Index()+1, total),
-			)
+	if step, reorganizes := maintenanceStatus(); step != "" {
+		banner := "Maintenance running: " + step
+		if reorganizes {
+			banner += " (flashing paused)"
 		}
+		header = lipgloss.JoinVertical(lipgloss.Center, header, lipgloss.NewStyle().
+			Bold(true).
+			Foreground(lipgloss.Color("#FFCC00")).
+			Render(banner))
 	}
-	if m.ImageList.FilterState() == 0 {
-		if total := len(m.ImageList.Items()); total > 0 && m.ImageList.Index() >= 0 {
-			imageView = imageView + "\n" + lipgloss.NewStyle().Foreground(lipgloss.Color(ColorLilac)).Render(
-				fmt.Sprintf("Selected image: %d/%d", m.ImageList.Index()+1, total),
-			)
+	if other, monitoring := monitorStatus(); monitoring {
+		banner := fmt.Sprintf("Monitor mode: flasher pid %d controls the devices", other.PID)
+		if len(other.Jobs) > 0 {
+			banner += " • " + strings.Join(other.Jobs, " • ")
 		}
+		header = lipgloss.JoinVertical(lipgloss.Center, header, lipgloss.NewStyle().
+			Bold(true).
+			Foreground(lipgloss.Color("#FFCC00")).
+			Render(banner))
+	}
+
+	if QueuePaused() {
+		header = lipgloss.JoinVertical(lipgloss.Center, header, lipgloss.NewStyle().
+			Bold(true).
+			Foreground(lipgloss.Color("#FFCC00")).
+			Render("Queue paused: running jobs finish, the next ones wait • H to resume"))
+	}
+
+	if demoMode {
+		header = lipgloss.JoinVertical(lipgloss.Center, header, lipgloss.NewStyle().
+			Bold(true).
+			Foreground(lipgloss.Color("#FFCC00")).
+			Render("Demo: devices and jobs are simulated, nothing is written"))
 	}
 
+	listView := m.listPanel(styles.Container, styles.Active, styles.Inactive)
+
 	// Calculate scroll percentage
 	scrollPercent := int(m.Viewport.ScrollPercent() * 100)
 	viewportProgressView := styles.ViewportProgress.
 		Width(m.Viewport.Width).
 		Render(fmt.Sprintf("%d%%", scrollPercent))
 
-	// Apply active/inactive styling based on ActiveList
-	if m.ActiveList == 0 {
-		deviceView = m.Zones.Mark("device-view", styles.Active.Render(deviceView))
-		imageView = m.Zones.Mark("image-view", styles.Inactive.Render(imageView))
-		viewportView = m.Zones.Mark("viewport-view", styles.Inactive.Render(viewportView))
-	} else if m.ActiveList == 1 {
-		deviceView = m.Zones.Mark("device-view", styles.Inactive.Render(deviceView))
-		imageView = m.Zones.Mark("image-view", styles.Active.Render(imageView))
-		viewportView = m.Zones.Mark("viewport-view", styles.Inactive.Render(viewportView))
-	} else if m.ActiveList == 2 {
-		deviceView = m.Zones.Mark("device-view", styles.Inactive.Render(deviceView))
-		imageView = m.Zones.Mark("image-view", styles.Inactive.Render(imageView))
-		viewportView = m.Zones.Mark("viewport-view", styles.Active.Render(viewportView))
-	} else {
-		deviceView = m.Zones.Mark("device-view", styles.Inactive.Render(deviceView))
-		imageView = m.Zones.Mark("image-view", styles.Inactive.Render(imageView))
-		viewportView = m.Zones.Mark("viewport-view", styles.Inactive.Render(viewportView))
-	}
-
-	// Combine lists based on window width
-	var listView string
-	if m.Width < 80 {
-		listView = lipgloss.JoinVertical(lipgloss.Center, deviceView, imageView)
-	} else {
-		listView = lipgloss.JoinHorizontal(lipgloss.Center, deviceView, imageView)
+	viewportStyle := styles.Inactive
+	if m.ActiveList == 2 {
+		viewportStyle = styles.Active
 	}
-	listView = styles.Container.Render(listView)
+	viewportView := m.Zones.Mark("viewport-view", viewportStyle.Render(m.Viewport.View()))
 
 	// Create buttons
 	buttonView := m.renderButtons(styles)
+	if m.Wizard != nil {
+		buttonView = m.renderWizard()
+	}
+	if m.Composite != nil {
+		buttonView = m.renderComposite()
+	}
+	if m.Duplication != nil {
+		buttonView = m.renderDuplication()
+	}
 
 	// Footer
-	footer := styles.FooterStyle.Render("TAB to switch • ↑↓ to navigate • ENTER to select • ESC to power-off • Q to quit.")
+	footerText := "TAB to switch • ↑↓ to navigate • ENTER to select • A for about • L/C for layout • ESC to power-off • Q to quit."
+	if m.Coordinator {
+		footerText = "S for stations • " + footerText
+	}
+	if m.Config != nil && len(m.Config.Composites) > 0 {
+		footerText = "M for composite profiles • " + footerText
+	}
+	if m.Config != nil && len(m.Config.Duplicators) > 0 {
+		footerText = "U to flash all slots • " + footerText
+	}
+	if m.Wizard == nil && m.Composite == nil && m.Duplication == nil {
+		footerText = "W to provision a robot • V/O to preview a card or edit its boot options • " + footerText
+	} else {
+		footerText = "↑↓ to scroll the log • +/- to resize it • Q to quit."
+	}
+	if m.Busy() || m.QueueHeld {
+		footerText = "H to pause the queue • ctrl+X to abort all jobs • " + footerText
+	}
+	if m.canUnlock() {
+		if m.Role == RoleAdmin {
+			footerText = "ctrl+A to lock admin • " + footerText
+		} else {
+			footerText = "ctrl+A to unlock admin • " + footerText
+		}
+	}
+	if m.InterruptedJob != nil {
+		footerText = "R to resume interrupted " + m.InterruptedJob.Kind + " • " + footerText
+	}
+	if m.LogSearch != nil {
+		footerText = m.searchFooter()
+	}
+	footer := styles.FooterStyle.Render(footerText)
 
 	// Combine all elements
 	ui := lipgloss.JoinVertical(lipgloss.Center,
@@ -150,6 +178,12 @@ func (m Model) View() string {
 		viewportProgressView,
 		footer,
 	)
+	if m.Layout.Compact {
+		ui = lipgloss.JoinVertical(lipgloss.Center, header, listView, infoPanel, buttonView, viewportView, footer)
+	}
+	if m.info != nil {
+		m.info.chrome = lipgloss.Height(ui) - m.Viewport.Height
+	}
 
 	// Place in the window
 	final := lipgloss.Place(
@@ -179,187 +213,226 @@ func (m Model) renderButtons(styles struct {
 	ViewportProgress lipgloss.Style
 	SelectedBadge    lipgloss.Style
 }) string {
-	// Flash button styling
-	var buttonStyle lipgloss.Style
-	var buttonText string
-
-	// Determine button text based on state
-	if m.Flashing {
-		buttonText = "Flashing..."
-	} else {
-		buttonText = "Flash"
-	}
-	
-	// Base styles
-	buttonStyle = styles.Button
-	
-	// Apply background color based on state and selection
-	if m.Flashing || m.Extracting || m.Checking {
-		buttonStyle = buttonStyle.Background(lipgloss.Color(ColorDisabled))
-	} else if m.ActiveList == 3 {
-		buttonStyle = buttonStyle.Background(lipgloss.Color(ColorPantone))
-	} else {
-		// Ensure Flash has a visible background when idle and not selected
-		buttonStyle = buttonStyle.Background(lipgloss.Color(ColorAnthracite))
-	}
-
-	flashButton := m.Zones.Mark("flash-button", buttonStyle.Render(buttonText))
-
-	// Initialize buttonView variable
-	var buttonView string
-	
-	// Create abort button that appears during any operation
-	var abortButton string
-	if m.Flashing || m.Extracting || m.Checking {
-		abortStyle := styles.AbortButton
-		// Determine expected abort index based on layout
-		abortIndex := -1
-		if util.IsRaspberryPi() {
-			if m.IsCompressedImageSelected() || m.Extracting || m.Checking {
-				abortIndex = 6
-			} else {
-				abortIndex = 5
-			}
-		} else {
-			if m.IsCompressedImageSelected() || m.Extracting || m.Checking {
-				abortIndex = 5
-			} else {
-				abortIndex = 4
-			}
+	var rendered []string
+	for _, b := range m.Buttons() {
+		style := styles.Button
+		switch b.ID {
+		case "flash-button":
+			style = styles.FlashButton
+		case "abort-button":
+			style = styles.AbortButton
 		}
+		rendered = append(rendered, m.renderButton(style, b))
+	}
+	return lipgloss.JoinHorizontal(lipgloss.Center, rendered...)
+}
 
-		var abortText string
-		if m.Aborting {
-			abortText = "Aborting..."
-			abortStyle = abortStyle.Background(lipgloss.Color(ColorDisabled))
+// renderAbout renders the About overlay with version and environment details
+func (m Model) renderAbout(styles struct {
+	Header           lipgloss.Style
+	Container        lipgloss.Style
+	Active           lipgloss.Style
+	Inactive         lipgloss.Style
+	Button           lipgloss.Style
+	FlashButton      lipgloss.Style
+	AbortButton      lipgloss.Style
+	FooterStyle      lipgloss.Style
+	InfoPanel        lipgloss.Style
+	ViewportProgress lipgloss.Style
+	SelectedBadge    lipgloss.Style
+}) string {
+	header := styles.Header.Render(" About Husarion OS Flasher ")
+	body := styles.Container.Render(styles.InfoPanel.Render(strings.Join(m.AboutLines, "\n")))
+	footer := styles.FooterStyle.Render("Press any key to close.")
+
+	return lipgloss.Place(
+		m.Width,
+		m.Height,
+		lipgloss.Center,
+		lipgloss.Center,
+		lipgloss.JoinVertical(lipgloss.Center, header, body, footer),
+	)
+}
+
+// infoCacheTTL is how long the info panel is reused while the selection stays
+// the same. Building it runs blockdev and reads sidecar files, which is too
+// slow to repeat on every render.
+const infoCacheTTL = time.Second
+
+// infoCache holds the last rendered info panel text and list panel.
+type infoCache struct {
+	key  string // selected disk and image
+	text string
+	at   time.Time
+
+	listKey string // lists, focus and size the list panel was rendered for
+	list    string
+
+	chrome int // rows of the last render besides the log
+}
+
+// infoText returns the disk and image details shown in the info panel.
+func (m Model) infoText() string {
+	var key string
+	if m.DeviceList.SelectedItem() != nil {
+		key = m.DeviceList.SelectedItem().(Item).value
+	}
+	key += "\x00"
+	if m.ImageList.SelectedItem() != nil {
+		key += m.ImageList.SelectedItem().(Item).value
+	}
+	key += "\x00" + m.TargetRobot
+	if m.DetectedRobot != nil {
+		key += "\x00" + m.DetectedRobot.String()
+	}
+	if m.info != nil && m.info.key == key && time.Since(m.info.at) < infoCacheTTL {
+		return m.info.text
+	}
+	text := m.buildInfoText()
+	if m.info != nil {
+		m.info.key, m.info.text, m.info.at = key, text, time.Now()
+	}
+	return text
+}
+
+// buildInfoText builds the info panel text for the current selection.
+func (m Model) buildInfoText() string {
+	var diskInfo, imageInfo string
+	if m.DeviceList.SelectedItem() != nil {
+		disk := m.DeviceList.SelectedItem().(Item).value
+		size, err := platform.Current.DiskSize(disk)
+		if err != nil {
+			diskInfo = disk + " (size: unknown)"
 		} else {
-			abortText = "   Abort   "
-			if m.ActiveList == abortIndex {
-				abortStyle = abortStyle.Background(lipgloss.Color(ColorLightRed))
-			} else {
-				abortStyle = abortStyle.Background(lipgloss.Color(ColorAnthracite))
-			}
+			diskInfo = disk + " (size: " + util.FormatBytes(size) + ")"
 		}
-		abortButton = m.Zones.Mark("abort-button", abortStyle.Render(abortText))
+		if s, ok := suspectDevice(disk); ok {
+			diskInfo += "\nSuspect: writing " + filepath.Base(s.Image) + " was cut off " + s.Since.Format("2006-01-02 15:04") + " - verify before use"
+		}
+	} else {
+		diskInfo = "No disk selected"
 	}
 
-	// Add uncompress button only when a compressed image is selected OR currently extracting
-	var checkButton string
-	if m.IsCompressedImageSelected() || m.Extracting {
-		uncompressStyle := styles.Button
-		var uncompressText string
-		if m.Extracting {
-			uncompressText = "Extracting..."
-			uncompressStyle = uncompressStyle.Background(lipgloss.Color(ColorDisabled))
+	integrityStatus := "unknown"
+	integrityActual := ""
+	metaLines := ""
+	if m.ImageList.SelectedItem() != nil {
+		image := m.ImageList.SelectedItem().(Item).value
+		stat, err := os.Stat(image)
+		if err != nil {
+			imageInfo = image + " (size: unknown)"
 		} else {
-			uncompressText = "Extract"
-			if (util.IsRaspberryPi() && m.ActiveList == 5 && !m.Flashing && !m.Checking) || (!util.IsRaspberryPi() && m.ActiveList == 4 && !m.Flashing && !m.Checking) {
-				uncompressStyle = uncompressStyle.Background(lipgloss.Color(ColorLilac))
-			} else if m.Flashing || m.Checking {
-				uncompressStyle = uncompressStyle.Background(lipgloss.Color(ColorDisabled))
-			} else {
-				uncompressStyle = uncompressStyle.Background(lipgloss.Color(ColorAnthracite))
-			}
+			imageInfo = image + " (size: " + util.FormatBytes(stat.Size()) + ")"
 		}
-		buttonUncompress := m.Zones.Mark("uncompress-button", uncompressStyle.Render(uncompressText))
-
-		// Integrity Check button
-		checkStyle := styles.Button
-		var checkText string
-		if m.Checking {
-			checkText = "Checking..."
-			checkStyle = checkStyle.Background(lipgloss.Color(ColorDisabled))
-		} else {
-			checkText = " Check "
-			if m.ActiveList == 7 && !m.Flashing && !m.Extracting {
-				checkStyle = checkStyle.Background(lipgloss.Color(ColorLilac))
-			} else if m.Flashing || m.Extracting {
-				checkStyle = checkStyle.Background(lipgloss.Color(ColorDisabled))
-			} else {
-				checkStyle = checkStyle.Background(lipgloss.Color(ColorAnthracite))
-			}
+		if line := prewarmLine(image); line != "" {
+			imageInfo += "\n" + line
 		}
-		checkButton = m.Zones.Mark("check-button", checkStyle.Render(checkText))
-
-		if util.IsRaspberryPi() {
-			eepromStyle := styles.Button
-			var eepromText string
-			if m.ConfiguringEeprom {
-				eepromText = "Configuring..."
-				eepromStyle = eepromStyle.Background(lipgloss.Color(ColorDisabled))
-			} else {
-				eepromText = "Config EEPROM"
-				if m.ActiveList == 4 && !m.Flashing && !m.Extracting && !m.Checking {
-					eepromStyle = eepromStyle.Background(lipgloss.Color(ColorLilac))
-				} else if m.Flashing || m.Extracting || m.Checking {
-					eepromStyle = eepromStyle.Background(lipgloss.Color(ColorDisabled))
-				} else {
-					eepromStyle = eepromStyle.Background(lipgloss.Color(ColorAnthracite))
-				}
+		if meta := LoadImageMeta(image); meta != nil && meta.Summary() != "" {
+			metaLines = "\nRelease: " + meta.Summary()
+			if meta.ChangelogURL != "" && (m.Config == nil || !m.Config.Offline) {
+				metaLines += "\nChangelog: " + meta.ChangelogURL
 			}
-			buttonEeprom := m.Zones.Mark("eeprom-button", eepromStyle.Render(eepromText))
-			if m.Flashing || m.Extracting || m.Checking {
-				buttonView = lipgloss.JoinHorizontal(lipgloss.Center, flashButton, buttonEeprom, buttonUncompress, checkButton, abortButton)
-			} else {
-				buttonView = lipgloss.JoinHorizontal(lipgloss.Center, flashButton, buttonEeprom, buttonUncompress, checkButton)
+		}
+		// Load integrity.yaml from the image's directory and look up status
+		if entry, ok := loadIntegrityEntry(image); ok {
+			if entry.Status != "" {
+				integrityStatus = entry.Status
 			}
-		} else {
-			if m.Flashing || m.Extracting || m.Checking {
-				buttonView = lipgloss.JoinHorizontal(lipgloss.Center, flashButton, buttonUncompress, checkButton, abortButton)
-			} else {
-				buttonView = lipgloss.JoinHorizontal(lipgloss.Center, flashButton, buttonUncompress, checkButton)
+			if entry.Actual != "" {
+				integrityActual = entry.Actual
 			}
 		}
 	} else {
-		// Raw .img branch (no Extract button)
-		checkStyle := styles.Button
-		var checkText string
-		if m.Checking {
-			checkText = "Checking..."
-			checkStyle = checkStyle.Background(lipgloss.Color(ColorDisabled))
-		} else {
-			checkText = " Check "
-			if m.Flashing || m.Extracting {
-				// Disable Check while flashing raw .img
-				checkStyle = checkStyle.Background(lipgloss.Color(ColorDisabled))
-			} else if m.ActiveList == 7 {
-				checkStyle = checkStyle.Background(lipgloss.Color(ColorLilac))
-			} else {
-				checkStyle = checkStyle.Background(lipgloss.Color(ColorAnthracite))
+		imageInfo = "No image selected"
+	}
+
+	integrityLine := "Integrity check: " + integrityStatus
+	if integrityActual != "" {
+		integrityLine += ", actual: " + integrityActual
+	}
+	if m.TargetRobot != "" {
+		robotLine := "Target robot: " + m.TargetRobot
+		if r := m.DetectedRobot; r != nil && robotMatches(r.Model, m.TargetRobot) {
+			robotLine += ", detected: " + r.String()
+			if r.Controller.Port != "" {
+				robotLine += " on " + r.Controller.Port
 			}
 		}
-		checkButton = m.Zones.Mark("check-button", checkStyle.Render(checkText))
-
-		if util.IsRaspberryPi() {
-			eepromStyle := styles.Button
-			var eepromText string
-			if m.ConfiguringEeprom {
-				eepromText = "Configuring..."
-				eepromStyle = eepromStyle.Background(lipgloss.Color(ColorDisabled))
-			} else {
-				eepromText = "Config EEPROM"
-				if m.ActiveList == 4 && !m.Flashing && !m.Extracting && !m.Checking {
-					eepromStyle = eepromStyle.Background(lipgloss.Color(ColorLilac))
-				} else if m.Flashing || m.Extracting || m.Checking {
-					eepromStyle = eepromStyle.Background(lipgloss.Color(ColorDisabled))
-				} else {
-					eepromStyle = eepromStyle.Background(lipgloss.Color(ColorAnthracite))
-				}
-			}
-			buttonEeprom := m.Zones.Mark("eeprom-button", eepromStyle.Render(eepromText))
-			if m.Flashing || m.Extracting || m.Checking {
-				buttonView = lipgloss.JoinHorizontal(lipgloss.Center, flashButton, buttonEeprom, checkButton, abortButton)
-			} else {
-				buttonView = lipgloss.JoinHorizontal(lipgloss.Center, flashButton, buttonEeprom, checkButton)
-			}
-		} else {
-			if m.Flashing || m.Extracting || m.Checking {
-				buttonView = lipgloss.JoinHorizontal(lipgloss.Center, flashButton, checkButton, abortButton)
-			} else {
-				buttonView = lipgloss.JoinHorizontal(lipgloss.Center, flashButton, checkButton)
+		if m.ImageList.SelectedItem() != nil {
+			if warning := robotWarning(m.ImageList.SelectedItem().(Item).value, m.TargetRobot); warning != "" {
+				robotLine += "\n" + lipgloss.NewStyle().Foreground(lipgloss.Color("#FFCC00")).Bold(true).Render("Warning: "+warning)
 			}
 		}
+		integrityLine += "\n" + robotLine
+	}
+	if f, ok := m.firmwareFor(); ok {
+		integrityLine += "\nFirmware: " + filepath.Base(f.File) + " via " + f.Tool
+	}
+	verifyLine := "Verify policy: " + m.Config.VerifyPolicy() + " (" + verifyDescriptions[m.Config.VerifyPolicy()] + ")"
+	if m.ImageList.SelectedItem() != nil {
+		verifyLine = m.verifyProfileLine(m.ImageList.SelectedItem().(Item).value)
+	}
+	return "Disk: " + diskInfo + "\nImage: " + imageInfo + metaLines + "\n" + integrityLine + "\n" + verifyLine
+}
+
+// listPanel renders the device and image lists. The result is reused until the
+// lists, their focus or the window size change, so log and progress updates do
+// not lay the lists out again.
+func (m Model) listPanel(container, active, inactive lipgloss.Style) string {
+	var key strings.Builder
+	fmt.Fprintf(&key, "%d %d %d %d %d %d %t\n", m.ActiveList, m.Width,
+		m.DeviceList.Width(), m.DeviceList.Height(), m.DeviceList.Index(), m.ImageList.Index(), m.verticalLists())
+	for _, l := range []list.Model{m.DeviceList, m.ImageList} {
+		for _, item := range l.Items() {
+			key.WriteString(item.FilterValue() + "\x00" + item.(Item).desc + "\x00")
+		}
+		key.WriteString("\n")
+	}
+	if m.info != nil && m.info.listKey == key.String() {
+		return m.info.list
 	}
 
-	return buttonView
+	deviceView := m.DeviceList.View()
+	imageView := m.ImageList.View()
+
+	// Add explicit selection indicators (index/total)
+	if m.DeviceList.FilterState() == 0 {
+		// Only when not filtering
+		if total := len(m.DeviceList.Items()); total > 0 && m.DeviceList.Index() >= 0 {
+			deviceView = deviceView + "\n" + lipgloss.NewStyle().Foreground(lipgloss.Color(ColorLilac)).Render(
+				fmt.Sprintf("Selected device: %d/%d", m.DeviceList.Index()+1, total),
+			)
+		}
+	}
+	if m.ImageList.FilterState() == 0 {
+		if total := len(m.ImageList.Items()); total > 0 && m.ImageList.Index() >= 0 {
+			imageView = imageView + "\n" + lipgloss.NewStyle().Foreground(lipgloss.Color(ColorLilac)).Render(
+				fmt.Sprintf("Selected image: %d/%d", m.ImageList.Index()+1, total),
+			)
+		}
+	}
+
+	// Apply active/inactive styling based on ActiveList
+	deviceStyle, imageStyle := inactive, inactive
+	if m.ActiveList == 0 {
+		deviceStyle = active
+	} else if m.ActiveList == 1 {
+		imageStyle = active
+	}
+	deviceView = m.Zones.Mark("device-view", deviceStyle.Render(deviceView))
+	imageView = m.Zones.Mark("image-view", imageStyle.Render(imageView))
+
+	// Combine lists based on window width
+	var listView string
+	if m.verticalLists() {
+		listView = lipgloss.JoinVertical(lipgloss.Center, deviceView, imageView)
+	} else {
+		listView = lipgloss.JoinHorizontal(lipgloss.Center, deviceView, imageView)
+	}
+	listView = container.Render(listView)
+
+	if m.info != nil {
+		m.info.listKey, m.info.list = key.String(), listView
+	}
+	return listView
 }
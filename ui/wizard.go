@@ -0,0 +1,345 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/husarion/husarion-os-flasher/config"
+	"github.com/husarion/husarion-os-flasher/util"
+)
+
+// Provisioning steps, in the order the wizard runs them.
+const (
+	stepFlash     = "Flash image"
+	stepVerify    = "Verify"
+	stepCustomize = "Customize"
+	stepEEPROM    = "EEPROM"
+	stepFirmware  = "Firmware"
+	stepCAN       = "CAN drivers"
+)
+
+// stepActions are the actions of config.Builtins the steps run, for
+// Config.Roles.
+var stepActions = map[string]string{
+	stepFlash:    "flash",
+	stepEEPROM:   "eeprom",
+	stepFirmware: "firmware",
+	stepCAN:      "can",
+}
+
+// States of a wizard step.
+const (
+	stepPending = "pending"
+	stepRunning = "running"
+	stepDone    = "done"
+	stepFailed  = "failed"
+	stepSkipped = "skipped"
+)
+
+// WizardStep is a step of the provisioning wizard and its outcome.
+type WizardStep struct {
+	Name    string
+	State   string
+	Detail  string // why it failed
+	Started time.Time
+	Took    time.Duration
+}
+
+// Wizard guides the operator through provisioning a whole robot: flashing and
+// verifying its card, customizing it, configuring the EEPROM and writing the
+// controller firmware, then writes a summary report. Each step runs on Enter
+// and may be retried or skipped. It replaces the button row while open.
+type Wizard struct {
+	Steps   []WizardStep
+	Current int // the step to run next, len(Steps) once finished
+	Image   string
+	Device  string
+	Robot   string
+	Started time.Time
+	Report  string // summary report written when finished
+}
+
+// running reports whether the named step is running.
+func (w *Wizard) running(name string) bool {
+	return w.Current < len(w.Steps) && w.Steps[w.Current].Name == name && w.Steps[w.Current].State == stepRunning
+}
+
+// finished reports whether every step was run or skipped.
+func (w *Wizard) finished() bool {
+	return w.Current >= len(w.Steps)
+}
+
+// StartWizard opens the provisioning wizard for the selected image and device.
+// Only the steps this station is configured for are included.
+func (m *Model) StartWizard() (tea.Model, tea.Cmd) {
+	if m.Busy() || m.Monitoring {
+		return m, nil
+	}
+	if m.DeviceList.SelectedItem() == nil || !m.imageSelected() {
+		m.AddLog("Select a device and an image to provision a robot.")
+		return m, nil
+	}
+	if m.selectedDeviceChanged() {
+		return m, nil
+	}
+
+	w := &Wizard{
+		Image:   m.ImageList.SelectedItem().(Item).value,
+		Device:  m.DeviceList.SelectedItem().(Item).value,
+		Robot:   m.TargetRobot,
+		Started: time.Now(),
+	}
+	names := []string{stepFlash, stepVerify}
+	if m.Config != nil && m.Config.Customize != "" {
+		names = append(names, stepCustomize)
+	}
+	if util.IsRaspberryPi() {
+		names = append(names, stepEEPROM)
+	}
+	if _, ok := m.firmwareFor(); ok {
+		names = append(names, stepFirmware)
+	}
+	if m.Config != nil && m.Config.CAN != nil {
+		names = append(names, stepCAN)
+	}
+	for _, name := range names {
+		w.Steps = append(w.Steps, WizardStep{Name: name, State: stepPending})
+	}
+	m.Wizard = w
+
+	robot := w.Robot
+	if robot == "" {
+		robot = "robot"
+	}
+	m.AddLog(fmt.Sprintf("> Provisioning %s with %s on %s: %s.", robot, filepath.Base(w.Image), w.Device, strings.Join(names, ", ")))
+	if warning := robotWarning(w.Image, w.Robot); warning != "" {
+		m.AddLog("Warning: " + warning)
+	}
+	return m, nil
+}
+
+// runWizardStep starts the current step on the wizard's image and device.
+func (m *Model) runWizardStep() (tea.Model, tea.Cmd) {
+	w := m.Wizard
+	if w == nil || w.finished() || m.Busy() || m.ConfiguringEeprom {
+		return m, nil
+	}
+	step := &w.Steps[w.Current]
+	if !selectItemByValue(&m.DeviceList, w.Device) || !selectItemByValue(&m.ImageList, w.Image) {
+		switch step.Name {
+		case stepFlash, stepVerify, stepCustomize:
+			m.AddLog(fmt.Sprintf("Error: %s or %s is no longer available.", w.Device, filepath.Base(w.Image)))
+			return m, nil
+		}
+	}
+	step.State, step.Started, step.Detail = stepRunning, time.Now(), ""
+	if action := stepActions[step.Name]; action != "" && !m.allowed(action) {
+		step.State, step.Detail = stepFailed, "reserved to admins"
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	switch step.Name {
+	case stepFlash:
+		m.Ready = true
+		_, cmd = m.StartFlashing()
+	case stepVerify:
+		_, cmd = m.StartVerify(verifyPolicy(m.Config, m.Wizard.Image))
+	case stepCustomize:
+		_, cmd = m.StartAction(config.Action{Label: "Customize", Command: m.Config.Customize})
+	case stepEEPROM:
+		_, cmd = m.ConfigEEPROM()
+	case stepFirmware:
+		_, cmd = m.StartFirmware()
+	case stepCAN:
+		_, cmd = m.StartCANUpdate()
+	}
+
+	// Steps that cannot start log why, a flash may wait for approval
+	if !m.Busy() && !m.ConfiguringEeprom && m.Approval == nil {
+		step.State, step.Detail = stepFailed, "could not start"
+	}
+	return m, cmd
+}
+
+// skipWizardStep moves past the current step without running it.
+func (m *Model) skipWizardStep() {
+	w := m.Wizard
+	if w == nil || w.finished() || w.Steps[w.Current].State == stepRunning {
+		return
+	}
+	w.Steps[w.Current].State = stepSkipped
+	m.AddLog(fmt.Sprintf("Skipped %s.", w.Steps[w.Current].Name))
+	w.Current++
+	if w.finished() {
+		m.finishWizard()
+	}
+}
+
+// wizardVerifying ends the running flash step as its verification starts,
+// which is the verify step.
+func (m *Model) wizardVerifying() {
+	w := m.Wizard
+	if w == nil || !w.running(stepFlash) {
+		return
+	}
+	m.wizardStepFinished("success", nil)
+	if !w.finished() && w.Steps[w.Current].Name == stepVerify {
+		w.Steps[w.Current].State = stepRunning
+		w.Steps[w.Current].Started = time.Now()
+	}
+}
+
+// wizardStepFinished records the result of the running step, if any: success,
+// failure or aborted.
+func (m *Model) wizardStepFinished(result string, err error) {
+	w := m.Wizard
+	if w == nil || w.finished() || w.Steps[w.Current].State != stepRunning {
+		return
+	}
+	step := &w.Steps[w.Current]
+	step.Took = time.Since(step.Started)
+	switch {
+	case result == "success":
+		step.State = stepDone
+		w.Current++
+	case err != nil:
+		step.State, step.Detail = stepFailed, err.Error()
+	default:
+		step.State, step.Detail = stepFailed, result
+	}
+	if w.finished() {
+		m.finishWizard()
+	}
+}
+
+// finishWizard writes the summary report and logs it.
+func (m *Model) finishWizard() {
+	lines := m.Wizard.reportLines(m.Operator)
+	for _, line := range lines[len(lines)-len(m.Wizard.Steps)-1:] {
+		m.AddLog(line)
+	}
+
+	dir := crashDir(m.OsImgPath)
+	path := filepath.Join(dir, "provision-"+time.Now().Format("20060102-150405")+".txt")
+	err := os.MkdirAll(dir, 0755)
+	if err == nil {
+		report := withEnvironment(lines, m.OsImgPath, m.Config)
+		err = os.WriteFile(path, []byte(strings.Join(report, "\n")+"\n"), 0644)
+	}
+	if err != nil {
+		m.AddLog(fmt.Sprintf("Error: writing the provisioning report failed: %v", err))
+		return
+	}
+	m.Wizard.Report = path
+	m.AddLog("Provisioning report written to " + path)
+}
+
+// reportLines returns the summary report, ending with the steps and the
+// overall result.
+func (w *Wizard) reportLines(operator string) []string {
+	robot := w.Robot
+	if r := currentRobot(); r != nil {
+		robot = r.String()
+	}
+	if robot == "" {
+		robot = "not set"
+	}
+	lines := []string{
+		"Provisioning report",
+		"Started:  " + w.Started.Format(time.RFC3339),
+		"Finished: " + time.Now().Format(time.RFC3339),
+		"Operator: " + operator,
+		"Robot:    " + robot,
+		"Image:    " + filepath.Base(w.Image),
+		"Device:   " + w.Device,
+		"",
+	}
+
+	complete := true
+	for _, s := range w.Steps {
+		line := fmt.Sprintf("  %-12s %-8s", s.Name, s.State)
+		if s.State == stepDone {
+			line += " " + util.FormatDuration(s.Took)
+		}
+		if s.Detail != "" {
+			line += " " + s.Detail
+		}
+		lines = append(lines, strings.TrimRight(line, " "))
+		complete = complete && s.State == stepDone
+	}
+	if complete {
+		return append(lines, "Result: provisioned, every step passed")
+	}
+	return append(lines, "Result: incomplete, some steps were skipped or failed")
+}
+
+// handleWizardKey runs (Enter), skips (S) or aborts the current step (X),
+// which closes the wizard when no step is running. The log can still be
+// resized (+ and -).
+func (m Model) handleWizardKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "q":
+		return m, tea.Quit
+	case "enter":
+		return m.runWizardStep()
+	case "+", "=":
+		m.ResizeLog(1)
+	case "-":
+		m.ResizeLog(-1)
+	case "s", "S":
+		m.skipWizardStep()
+	case "x", "X":
+		if m.Busy() {
+			return m.AbortOperation()
+		}
+		m.Wizard = nil
+		m.AddLog("Provisioning wizard closed.")
+	default:
+		// Scroll the log
+		vp, cmd := m.Viewport.Update(msg)
+		m.Viewport = vp
+		return m, cmd
+	}
+	return m, nil
+}
+
+// renderWizard renders the wizard's steps in place of the button row.
+func (m Model) renderWizard() string {
+	w := m.Wizard
+	var steps []string
+	for i, s := range w.Steps {
+		icon := map[string]string{stepPending: "○", stepRunning: "▶", stepDone: "✓", stepFailed: "✗", stepSkipped: "–"}[s.State]
+		style := lipgloss.NewStyle().Padding(0, 1).Margin(0, 1).Foreground(lipgloss.Color(ColorWhite)).Background(lipgloss.Color(ColorAnthracite))
+		switch {
+		case s.State == stepFailed:
+			style = style.Background(lipgloss.Color(ColorLightRed))
+		case i == w.Current:
+			style = style.Background(lipgloss.Color(ColorPantone))
+		case s.State == stepDone:
+			style = style.Background(lipgloss.Color(ColorLilac))
+		}
+		steps = append(steps, style.Render(icon+" "+s.Name))
+	}
+
+	var help string
+	switch {
+	case w.finished():
+		help = "Provisioning finished • X to close the wizard"
+	case m.Busy() || m.ConfiguringEeprom:
+		help = w.Steps[w.Current].Name + " running • X to abort"
+	case w.Steps[w.Current].State == stepFailed:
+		help = w.Steps[w.Current].Name + " failed • ENTER to retry • S to skip • X to close"
+	default:
+		help = "ENTER to run " + w.Steps[w.Current].Name + " • S to skip • X to close"
+	}
+	return lipgloss.JoinVertical(lipgloss.Center,
+		lipgloss.JoinHorizontal(lipgloss.Center, steps...),
+		lipgloss.NewStyle().Faint(true).Render(help))
+}
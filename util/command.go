@@ -0,0 +1,28 @@
+package util
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// ToolEnv returns the environment of the external tools the flasher runs: its
+// own, with LC_ALL=C so that the numbers, units and error messages it parses
+// and matches do not depend on the locale of the station. Commands written by
+// the user (actions, hooks, the maintenance sync) keep the locale.
+func ToolEnv() []string {
+	env := make([]string, 0, len(os.Environ())+1)
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, "LC_ALL=") {
+			env = append(env, kv)
+		}
+	}
+	return append(env, "LC_ALL=C")
+}
+
+// Command is exec.Command for an external tool, run with ToolEnv.
+func Command(name string, arg ...string) *exec.Cmd {
+	cmd := exec.Command(name, arg...)
+	cmd.Env = ToolEnv()
+	return cmd
+}
@@ -2,27 +2,17 @@ package util
 
 import (
 	"fmt"
-	"os/exec"
-	"strconv"
+	"sync"
 	"strings"
 	"time"
 )
 
-// IsRaspberryPi checks if the current device is a Raspberry Pi
-func IsRaspberryPi() bool {
-	_, err := exec.Command("grep", "-q", "Raspberry Pi", "/proc/cpuinfo").Output()
+// IsRaspberryPi checks if the current device is a Raspberry Pi. The result is
+// cached because the button row asks on every render.
+var IsRaspberryPi = sync.OnceValue(func() bool {
+	_, err := Command("grep", "-q", "Raspberry Pi", "/proc/cpuinfo").Output()
 	return err == nil
-}
-
-// GetDiskSize returns the size (in bytes) of a disk using "blockdev --getsize64"
-func GetDiskSize(device string) (int64, error) {
-	out, err := exec.Command("blockdev", "--getsize64", device).Output()
-	if err != nil {
-		return 0, err
-	}
-	sizeStr := strings.TrimSpace(string(out))
-	return strconv.ParseInt(sizeStr, 10, 64)
-}
+})
 
 // FormatBytes returns a human-friendly string for a byte count
 func FormatBytes(b int64) string {
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package util
+
+import "os"
+
+// PrivilegedUser names the account the flasher must run as.
+const PrivilegedUser = "root"
+
+// IsPrivileged reports whether the process may write to raw block devices.
+func IsPrivileged() bool {
+	return os.Geteuid() == 0
+}
@@ -0,0 +1,32 @@
+package util
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// tokenElevation is the TokenElevation TOKEN_INFORMATION_CLASS value.
+const tokenElevation = 20
+
+// PrivilegedUser names the account the flasher must run as.
+const PrivilegedUser = "Administrator"
+
+// IsPrivileged reports whether the process runs elevated, which is required to
+// open \\.\PhysicalDriveN for writing.
+func IsPrivileged() bool {
+	process, err := syscall.GetCurrentProcess()
+	if err != nil {
+		return false
+	}
+	var token syscall.Token
+	if err := syscall.OpenProcessToken(process, syscall.TOKEN_QUERY, &token); err != nil {
+		return false
+	}
+	defer token.Close()
+
+	var elevated, n uint32
+	if err := syscall.GetTokenInformation(token, tokenElevation, (*byte)(unsafe.Pointer(&elevated)), 4, &n); err != nil {
+		return false
+	}
+	return elevated != 0
+}
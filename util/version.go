@@ -0,0 +1,40 @@
+package util
+
+import (
+	"os"
+	"runtime/debug"
+	"strings"
+)
+
+// Version and Commit are set at build time, e.g.
+// go build -ldflags "-X github.com/husarion/husarion-os-flasher/util.Version=1.2.0"
+var (
+	Version = "dev"
+	Commit  = ""
+)
+
+// BuildCommit returns the git commit the binary was built from, falling back to
+// the VCS information embedded by the Go toolchain.
+func BuildCommit() string {
+	if Commit != "" {
+		return Commit
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			if s.Key == "vcs.revision" {
+				return s.Value
+			}
+		}
+	}
+	return "unknown"
+}
+
+// BoardModel returns the device-tree model string (e.g. "Raspberry Pi 4 Model B Rev 1.4"),
+// or an empty string on hosts without a device tree.
+func BoardModel() string {
+	b, err := os.ReadFile("/proc/device-tree/model")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimRight(string(b), "\x00\n")
+}